@@ -0,0 +1,126 @@
+package alac
+
+import (
+	"fmt"
+	"slices"
+)
+
+// maxSplitLevels is the most WithAdaptiveFrames takes: frames of 4096
+// samples down to 16.
+const maxSplitLevels = 8
+
+// WithMaxPacketSize makes EncodeFrames split frames of more than n bytes
+// into shorter ones, for transports with a packet size limit, such as RTP
+// over a network with a small MTU. Limits below the size of an
+// uncompressed frame of one sample fail with ErrInvalidConfig.
+func WithMaxPacketSize(n int) EncoderOption {
+	return func(e *Encoder) {
+		e.maxPacket = n
+	}
+}
+
+// WithAdaptiveFrames makes EncodeFrames try frames of half the size, up to
+// levels times, and keep the shorter frames where they are smaller in
+// total. That is mostly at transients, where a predictor for the attack and
+// one for the rest do better than a single one. Every level is another
+// encode of all the PCM, so this is slow. Levels above 8 fail with
+// ErrInvalidConfig.
+func WithAdaptiveFrames(levels int) EncoderOption {
+	return func(e *Encoder) {
+		e.splitLevels = levels
+	}
+}
+
+// checkSplit validates WithMaxPacketSize and WithAdaptiveFrames.
+func (e *Encoder) checkSplit() error {
+	if e.splitLevels < 0 || e.splitLevels > maxSplitLevels {
+		return fmt.Errorf("%w: %d adaptive frame levels, the limit is %d", ErrInvalidConfig, e.splitLevels, maxSplitLevels)
+	}
+	elements := len(channelLayouts[e.cfg.NumChannels-1].elements)
+	if least := e.width*e.cfg.NumChannels + MaxFrameOverhead + 7*(elements-1); e.maxPacket != 0 && e.maxPacket < least {
+		return fmt.Errorf("%w: packet size %d, frames of one sample take up to %d bytes", ErrInvalidConfig, e.maxPacket, least)
+	}
+	return nil
+}
+
+// EncodeFrames is Encode, for encoders with WithMaxPacketSize or
+// WithAdaptiveFrames, which can make more than one frame of the PCM. It
+// calls fn with every frame and its number of samples per channel, in
+// order. The frames are only valid until fn returns. Errors of fn are
+// returned as-is. Without those options there is one frame, as with Encode.
+func (e *Encoder) EncodeFrames(pcm []byte, fn func(frame []byte, samples int) error) error {
+	frames, err := e.encodeFrames(pcm)
+	if err != nil {
+		return err
+	}
+	for _, f := range frames {
+		e.addFrame(f.stats, f.frame)
+		if err := fn(f.frame, int(f.stats.Samples)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitFrame is one of the frames of encodeFrames.
+type splitFrame struct {
+	frame []byte
+	stats EncoderStats
+}
+
+// encodeFrames encodes the frames of EncodeFrames, without adding them to
+// the stream. Without splitting the frame is in the buffer of e.w.
+func (e *Encoder) encodeFrames(pcm []byte) ([]splitFrame, error) {
+	n, err := e.loadPCM(pcm)
+	if err != nil {
+		return nil, err
+	}
+	if e.maxPacket == 0 && e.splitLevels == 0 {
+		frame, err := e.encode(n)
+		if err != nil {
+			return nil, err
+		}
+		return []splitFrame{{frame, e.frame}}, nil
+	}
+	return e.split(pcm, e.splitLevels)
+}
+
+// split encodes pcm as one frame, or as the frames of its halves, split up
+// to levels times, whichever is smaller. Frames over the packet size are
+// always split.
+func (e *Encoder) split(pcm []byte, levels int) ([]splitFrame, error) {
+	n, err := e.loadPCM(pcm)
+	if err != nil {
+		return nil, err
+	}
+	frame, err := e.encode(n)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		whole = []splitFrame{{slices.Clone(frame), e.frame}}
+		fits  = e.maxPacket == 0 || len(frame) <= e.maxPacket
+	)
+	if n < 2 || fits && levels == 0 {
+		// checkSplit made sure a frame of one sample fits
+		return whole, nil
+	}
+	half := n / 2 * e.width * e.cfg.NumChannels
+	first, err := e.split(pcm[:half], max(levels-1, 0))
+	if err != nil {
+		return nil, err
+	}
+	second, err := e.split(pcm[half:], max(levels-1, 0))
+	if err != nil {
+		return nil, err
+	}
+	parts := append(first, second...)
+	size := 0
+	for _, p := range parts {
+		size += len(p.frame)
+	}
+	if !fits || size < len(frame) {
+		return parts, nil
+	}
+	return whole, nil
+}
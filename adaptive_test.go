@@ -0,0 +1,134 @@
+package alac
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// encodeFrames returns the frames of EncodeFrames, and checks that they
+// decode to pcm.
+func encodeFrames(t *testing.T, e *Encoder, pcm []byte) [][]byte {
+	t.Helper()
+	d, err := NewWithConfig(e.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		frames [][]byte
+		out    []byte
+	)
+	err = e.EncodeFrames(pcm, func(frame []byte, samples int) error {
+		frames = append(frames, bytes.Clone(frame))
+		have, err := d.DecodeFrame(frame)
+		if err != nil {
+			return err
+		}
+		if have, want := len(have), samples*e.width*e.cfg.NumChannels; have != want {
+			t.Errorf("have %d, want %d", have, want)
+		}
+		out = append(out, have...)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, pcm) {
+		t.Errorf("output differs")
+	}
+	return frames
+}
+
+func TestEncodeFrames(t *testing.T) {
+	var (
+		cfg     = Config{SampleRate: 44100, SampleSize: 16, NumChannels: 2, FrameSize: 4096}
+		signals = testSignals(cfg.FrameSize, 16)
+		noise   = interleavePCM(16, signals["noise"], reversed(signals["noise"]))
+		sine    = interleavePCM(16, signals["sine"], signals["sine"])
+	)
+
+	t.Run("plain", func(t *testing.T) {
+		e, err := NewEncoder(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := e.Encode(sine)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have := encodeFrames(t, e, sine); len(have) != 1 || !bytes.Equal(have[0], want) {
+			t.Errorf("have %d frames, want the frame of Encode", len(have))
+		}
+	})
+
+	t.Run("packet size", func(t *testing.T) {
+		e, err := NewEncoder(cfg, WithMaxPacketSize(1400))
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames := encodeFrames(t, e, noise)
+		for _, f := range frames {
+			if len(f) > 1400 {
+				t.Errorf("have a frame of %d bytes", len(f))
+			}
+		}
+		if have, want := e.Stats().Frames, len(frames); have != want {
+			t.Errorf("have %d, want %d", have, want)
+		}
+		if have, want := len(frames), 16; have != want {
+			t.Errorf("have %d, want %d", have, want)
+		}
+	})
+
+	t.Run("transient", func(t *testing.T) {
+		// silence, and noise from the middle
+		pcm := append(make([]byte, len(noise)/2), noise[len(noise)/2:]...)
+		e, err := NewEncoder(cfg, WithAdaptiveFrames(2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames := encodeFrames(t, e, pcm)
+		if len(frames) < 2 {
+			t.Fatalf("have %d frames, want a split", len(frames))
+		}
+		size := 0
+		for _, f := range frames {
+			size += len(f)
+		}
+		whole, err := NewEncoder(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		frame, err := whole.Encode(pcm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size >= len(frame) {
+			t.Errorf("have %d bytes, want less than %d", size, len(frame))
+		}
+
+		// no split when it doesn't help
+		if have := encodeFrames(t, e, sine); len(have) != 1 {
+			t.Errorf("have %d frames, want 1", len(have))
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for _, opt := range []EncoderOption{WithMaxPacketSize(11), WithMaxPacketSize(-1), WithAdaptiveFrames(9), WithAdaptiveFrames(-1)} {
+			if _, err := NewEncoder(cfg, opt); !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("have %v, want %v", err, ErrInvalidConfig)
+			}
+		}
+		e, err := NewEncoder(cfg, WithMaxPacketSize(12))
+		if err != nil {
+			t.Fatal(err)
+		}
+		stop := errors.New("stop")
+		if err := e.EncodeFrames(noise, func([]byte, int) error { return stop }); err != stop {
+			t.Errorf("have %v, want %v", err, stop)
+		}
+		if err := e.EncodeFrames(noise[:3], func([]byte, int) error { return nil }); !errors.Is(err, ErrInvalidPCM) {
+			t.Errorf("have %v, want %v", err, ErrInvalidPCM)
+		}
+	})
+}
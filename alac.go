@@ -8,9 +8,18 @@ import (
 // Config holds ALAC decoder configuration parameters.
 type Config struct {
 	SampleRate  int // e.g., 44100, 48000, 96000
-	SampleSize  int // bits per sample: 16 or 24
-	NumChannels int // 1 (mono) or 2 (stereo)
+	SampleSize  int // bits per sample: 16, 20, 24, or 32
+	NumChannels int // 1 to 8, see Encoder for the order of 3 or more
 	FrameSize   int // max samples per frame, typically 4096
+
+	// Entropy coder tuning and informational fields from the magic cookie.
+	// Zero means the encoder default.
+	HistoryMult    int // rice history multiplier ("pb"), default 40
+	InitialHistory int // rice initial history ("mb"), default 10
+	KModifier      int // rice k limit ("kb"), default 14
+	MaxRun         int // default 255, unused by the decoder
+	MaxFrameBytes  int // 0 if unknown
+	AvgBitRate     int // 0 if unknown
 }
 
 // DefaultConfig returns the default configuration (16-bit stereo 44.1kHz).
@@ -23,34 +32,262 @@ func DefaultConfig() Config {
 	}
 }
 
+// Validate checks that cfg describes a stream this decoder can handle.
+func (cfg Config) Validate() error {
+	switch cfg.SampleSize {
+	case 16, 20, 24, 32:
+	default:
+		return fmt.Errorf("%w: %d", ErrUnsupportedBitDepth, cfg.SampleSize)
+	}
+	if cfg.NumChannels < 1 || cfg.NumChannels > maxChannels {
+		return fmt.Errorf("%w: unsupported number of channels %d", ErrInvalidConfig, cfg.NumChannels)
+	}
+	if cfg.FrameSize < 1 {
+		return fmt.Errorf("%w: frame size %d", ErrInvalidConfig, cfg.FrameSize)
+	}
+	if cfg.SampleRate < 1 {
+		return fmt.Errorf("%w: sample rate %d", ErrInvalidConfig, cfg.SampleRate)
+	}
+	if cfg.HistoryMult < 0 || cfg.HistoryMult > 255 {
+		return fmt.Errorf("%w: rice history multiplier %d", ErrInvalidConfig, cfg.HistoryMult)
+	}
+	if cfg.InitialHistory < 0 || cfg.InitialHistory > 255 {
+		return fmt.Errorf("%w: rice initial history %d", ErrInvalidConfig, cfg.InitialHistory)
+	}
+	if cfg.KModifier < 0 || cfg.KModifier > 31 {
+		return fmt.Errorf("%w: rice k modifier %d", ErrInvalidConfig, cfg.KModifier)
+	}
+	if cfg.MaxRun < 0 || cfg.MaxRun > 0xFFFF {
+		return fmt.Errorf("%w: max run %d", ErrInvalidConfig, cfg.MaxRun)
+	}
+	return nil
+}
+
 // NewWithConfig creates an ALAC decoder with the specified configuration.
-func NewWithConfig(cfg Config) (*Alac, error) {
+func NewWithConfig(cfg Config, opts ...Option) (*Alac, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
 	a := create_alac(cfg.SampleSize, cfg.NumChannels)
 	if a == nil {
 		return nil, fmt.Errorf("can't create alac decoder")
 	}
 
+	for _, opt := range opts {
+		opt(a)
+	}
+	if err := a.checkLimits(cfg); err != nil {
+		return nil, err
+	}
+	if err := a.checkOptions(cfg.NumChannels); err != nil {
+		return nil, err
+	}
+
+	a.configure(cfg)
+	a.allocateBuffers()
+	return a, nil
+}
+
+// New creates an ALAC decoder with default settings (16-bit stereo 44.1kHz).
+func New(opts ...Option) (*Alac, error) {
+	return NewWithConfig(DefaultConfig(), opts...)
+}
+
+// configure copies cfg into the decoder's setinfo fields. It doesn't touch
+// the buffers.
+func (a *Alac) configure(cfg Config) {
+	a.config = cfg
+	a.samplesize = cfg.SampleSize
+	a.numchannels = cfg.NumChannels
+	width := (cfg.SampleSize + 7) / 8 // 20 bit samples take 3 bytes
+	switch {
+	case a.output.Format == FormatFloat32:
+		width = 4
+	case cfg.SampleSize == 24 && a.dither != NoDither:
+		width = 2
+	case (cfg.SampleSize == 20 || cfg.SampleSize == 24) && a.output.Packing != Packed:
+		width = 4
+	}
+	a.bytespersample = width * a.outputChannels(cfg.NumChannels)
+	if a.channelMap != nil {
+		a.bytespersample = width * len(a.channelMap)
+	}
+
 	a.setinfo_max_samples_per_frame = uint32(cfg.FrameSize)
 	a.setinfo_7a = 0
 	a.setinfo_sample_size = uint8(cfg.SampleSize)
-	a.setinfo_rice_historymult = 40
-	a.setinfo_rice_initialhistory = 10
-	a.setinfo_rice_kmodifier = 14
-	a.setinfo_7f = 2
-	a.setinfo_80 = 255
-	a.setinfo_82 = 0
-	a.setinfo_86 = 0
+	a.setinfo_rice_historymult = uint8(orDefault(cfg.HistoryMult, 40))
+	a.setinfo_rice_initialhistory = uint8(orDefault(cfg.InitialHistory, 10))
+	a.setinfo_rice_kmodifier = uint8(orDefault(cfg.KModifier, 14))
+	a.setinfo_7f = uint8(cfg.NumChannels)
+	a.setinfo_80 = uint16(orDefault(cfg.MaxRun, 255))
+	a.setinfo_82 = uint32(cfg.MaxFrameBytes)
+	a.setinfo_86 = uint32(cfg.AvgBitRate)
 	a.setinfo_8a_rate = uint32(cfg.SampleRate)
+}
+
+func orDefault(v, def int) int {
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
+// Reset clears all per-stream state so the decoder can be reused for a new
+// stream with the same configuration. The internal buffers are kept.
+func (a *Alac) Reset() {
+	a.setInput(nil)
+	a.lastSamples = 0
+	a.stats = Stats{}
+	a.ditherer = ditherer{}
+
+	clear(a.predicterror_buffer_a)
+	clear(a.predicterror_buffer_b)
+	clear(a.outputsamples_buffer_a)
+	clear(a.outputsamples_buffer_b)
+	clear(a.uncompressed_bytes_buffer_a)
+	clear(a.uncompressed_bytes_buffer_b)
+	for _, c := range a.channels {
+		clear(c)
+	}
+	a.multi = false
+}
 
+// ResetWithConfig is Reset for a stream with a different configuration, such
+// as the next track in a playlist. Buffers are only reallocated when the new
+// frame size is larger than any before, or after Close.
+func (a *Alac) ResetWithConfig(cfg Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if err := a.checkLimits(cfg); err != nil {
+		return err
+	}
+	if err := a.checkOptions(cfg.NumChannels); err != nil {
+		return err
+	}
+
+	a.configure(cfg)
 	a.allocateBuffers()
-	return a, nil
+	a.Reset()
+	return nil
 }
 
-// New creates an ALAC decoder with default settings (16-bit stereo 44.1kHz).
-func New() (*Alac, error) {
-	return NewWithConfig(DefaultConfig())
+// Close releases the internal buffers. Decoding after Close fails with
+// ErrClosed, until the decoder is revived with ResetWithConfig.
+func (a *Alac) Close() error {
+	a.Reset()
+	a.dropBuffers()
+	return nil
+}
+
+func (a *Alac) dropBuffers() {
+	a.predicterror_buffer_a = nil
+	a.predicterror_buffer_b = nil
+	a.outputsamples_buffer_a = nil
+	a.outputsamples_buffer_b = nil
+	a.uncompressed_bytes_buffer_a = nil
+	a.uncompressed_bytes_buffer_b = nil
+	a.channels = nil
+	a.mix = [2][]int32{}
+	a.frame = nil
+}
+
+// Clone returns a new decoder with the same configuration and its own
+// buffers. The clone can be used concurrently with the original. The clone
+// allocates its buffers, it doesn't use the WithArena slab.
+func (a *Alac) Clone() *Alac {
+	c := *a
+	c.arena = nil
+	if !a.closed() {
+		// allocateBuffers would reuse the copied slices
+		c.dropBuffers()
+		c.allocateBuffers()
+	}
+	c.Reset()
+	return &c
 }
 
+func (a *Alac) closed() bool {
+	return a.outputsamples_buffer_a == nil
+}
+
+// SampleRate returns the sample rate in Hz.
+func (a *Alac) SampleRate() int {
+	return a.config.SampleRate
+}
+
+// BitDepth returns the number of bits per sample.
+func (a *Alac) BitDepth() int {
+	return a.config.SampleSize
+}
+
+// Channels returns the number of interleaved channels in the output. This
+// is the number of channels of the stream, unless WithChannelMap or
+// WithDownmix say otherwise.
+func (a *Alac) Channels() int {
+	if a.channelMap != nil {
+		return len(a.channelMap)
+	}
+	return a.outputChannels(a.config.NumChannels)
+}
+
+// FrameSize returns the maximum number of samples per channel in a frame.
+func (a *Alac) FrameSize() int {
+	return a.config.FrameSize
+}
+
+// FrameBytes returns the size of the PCM of a frame of FrameSize samples,
+// which is what DecodeInto needs. Frames which store a larger sample count,
+// see WithAutoReconfigure, need more.
+func (a *Alac) FrameBytes() int {
+	return a.config.FrameSize * a.bytespersample
+}
+
+// LastFrameSamples returns the number of samples per channel produced by the
+// last call to Decode, or 0 if it failed. This is usually FrameSize, except
+// for the shorter final frame of a stream.
+func (a *Alac) LastFrameSamples() int {
+	return a.lastSamples
+}
+
+// Stats returns the decoder statistics since it was created or Reset.
+func (a *Alac) Stats() Stats {
+	return a.stats
+}
+
+// Decode decodes a single ALAC frame to interleaved little endian PCM, or big
+// endian with WithBigEndian. It returns nil if the frame can't be decoded;
+// use DecodeFrame to get the reason.
 func (a *Alac) Decode(f []byte) []byte {
+	out, _ := a.DecodeFrame(f)
+	return out
+}
+
+// DecodeFrame decodes a single ALAC frame to interleaved PCM, like Decode.
+// Errors wrap one of the Err* values of this package.
+func (a *Alac) DecodeFrame(f []byte) ([]byte, error) {
+	if a.lowLatency {
+		return a.decodeReused(f)
+	}
 	return a.decodeFrame(f)
 }
+
+// DecodeInto is DecodeFrame, but it writes the PCM to dst, and returns the
+// number of bytes written. It fails with ErrShortBuffer if dst is smaller
+// than the frame's PCM, see FrameBytes. DecodeInto doesn't allocate, which
+// makes it the method of choice for long running streams.
+func (a *Alac) DecodeInto(dst, f []byte) (int, error) {
+	return a.decodeInto(dst, f)
+}
+
+// Flush signals the end of the stream and returns any PCM the decoder still
+// holds. ALAC frames decode independently, so nothing is ever held back and
+// Flush returns nil; it's here for streaming code which treats all codecs
+// alike. Flush drops the decoder's reference to the last frame, but keeps
+// Stats. Call Reset to start the next stream.
+func (a *Alac) Flush() []byte {
+	a.setInput(nil)
+	return nil
+}
@@ -1,14 +1,19 @@
 package alac
 
 import (
+	"bytes"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
+	"math/rand/v2"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"testing"
+
+	"github.com/alicebob/alac/mp4"
 )
 
 // TestConfig matches the JSON config from generate.go
@@ -83,7 +88,7 @@ func runMatrixTest(t *testing.T, baseName string) {
 
 	// Parse M4A and extract ALAC frames
 	m4aPath := baseName + ".m4a"
-	frames, alacConfig, err := parseM4A(m4aPath)
+	frames, alacConfig, err := readM4A(m4aPath)
 	if err != nil {
 		t.Fatalf("Failed to parse M4A: %v", err)
 	}
@@ -93,7 +98,7 @@ func runMatrixTest(t *testing.T, baseName string) {
 		SampleRate:  cfg.SampleRate,
 		SampleSize:  cfg.SampleSize,
 		NumChannels: cfg.NumChannels,
-		FrameSize:   alacConfig.frameSize,
+		FrameSize:   alacConfig.FrameSize,
 	})
 	if err != nil {
 		t.Fatalf("Failed to create decoder: %v", err)
@@ -115,6 +120,116 @@ func runMatrixTest(t *testing.T, baseName string) {
 	}
 }
 
+// TestMatrixNative round-trips the audio of the test matrix through our own
+// encoder and decoder, so it runs without FFmpeg. The synthetic signals are
+// those of generate.go, at every bit depth the encoder takes, and the real
+// audio is the Librivox samples. Lossless means the decoded PCM must be the
+// same, bit for bit. TestMatrix keeps the cross-check against FFmpeg's
+// encoder, when FFmpeg is installed.
+func TestMatrixNative(t *testing.T) {
+	for _, rate := range []int{44100, 48000, 96000} {
+		for _, bits := range []int{16, 20, 24, 32} {
+			for _, channels := range []int{1, 2} {
+				cfg := Config{SampleRate: rate, SampleSize: bits, NumChannels: channels, FrameSize: 4096}
+				dirName := fmt.Sprintf("%d_%d_%s", rate, bits, map[int]string{1: "mono", 2: "stereo"}[channels])
+				for _, audioType := range []string{"silence", "sine1k", "sweep", "noise", "whitenoise"} {
+					pcm := matrixSignal(audioType, cfg, rate/2) // 500ms of audio
+					t.Run(dirName+"/"+audioType, func(t *testing.T) {
+						runNativeTest(t, cfg, pcm, PresetNormal)
+					})
+				}
+			}
+		}
+	}
+
+	for _, name := range []string{"jane_eyre_5s", "monte_cristo_5s"} {
+		wav, err := os.ReadFile("testdata/samples/" + name + ".wav")
+		if err != nil {
+			t.Fatalf("Failed to read sample: %v", err)
+		}
+		pcm := wav[bytes.Index(wav, []byte("data"))+8:]
+		for _, preset := range []Preset{PresetFast, PresetNormal} { // PresetMax is slow, see TestEncode
+			for _, frameSize := range []int{352, 4096} {
+				cfg := DefaultConfig()
+				cfg.FrameSize = frameSize
+				t.Run(fmt.Sprintf("real_audio/%s/%d/preset_%d", name, frameSize, preset), func(t *testing.T) {
+					runNativeTest(t, cfg, pcm, preset)
+				})
+			}
+		}
+	}
+}
+
+// runNativeTest encodes pcm in frames of cfg.FrameSize, and decodes them
+// with a decoder of the magic cookie of the encoder.
+func runNativeTest(t *testing.T, cfg Config, pcm []byte, preset Preset) {
+	encoder, err := NewEncoder(cfg, WithPreset(preset))
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	var frames [][]byte
+	frameBytes := (cfg.SampleSize + 7) / 8 * cfg.NumChannels * cfg.FrameSize
+	for in := pcm; len(in) > 0; {
+		n := min(len(in), frameBytes)
+		frame, err := encoder.Encode(in[:n])
+		if err != nil {
+			t.Fatalf("Frame %d: encode failed: %v", len(frames), err)
+		}
+		frames = append(frames, bytes.Clone(frame))
+		in = in[n:]
+	}
+
+	decoder, err := NewFromMagicCookie(encoder.MagicCookie(), WithStrict())
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	var decoded []byte
+	for i, frame := range frames {
+		result, err := decoder.DecodeFrame(frame)
+		if err != nil {
+			t.Fatalf("Frame %d: %v", i, err)
+		}
+		decoded = append(decoded, result...)
+	}
+	if !bytes.Equal(decoded, pcm) {
+		t.Errorf("Decoded PCM differs: got %d bytes, want %d", len(decoded), len(pcm))
+	}
+}
+
+// matrixSignal makes n samples of the synthetic audio of generate.go, in
+// the layout of cfg. whitenoise is seeded, so it's the same on every run.
+func matrixSignal(audioType string, cfg Config, n int) []byte {
+	var (
+		rng      = rand.New(rand.NewPCG(1, 2))
+		peak     = float64(int64(1)<<(cfg.SampleSize-1) - 1)
+		channels = make([][]int32, cfg.NumChannels)
+	)
+	for ch := range channels {
+		channels[ch] = make([]int32, n)
+	}
+	for i := 0; i < n; i++ {
+		for ch := range channels {
+			var sample float64
+			switch audioType {
+			case "sine1k":
+				sample = math.Sin(2 * math.Pi * 1000 * float64(i) / float64(cfg.SampleRate))
+			case "sweep":
+				t := float64(i) / float64(n)
+				freq := 20 * math.Pow(1000, t)
+				sample = math.Sin(2 * math.Pi * freq * float64(i) / float64(cfg.SampleRate))
+			case "noise":
+				seed := uint32(i*cfg.NumChannels + ch + 12345)
+				seed = seed*1103515245 + 12345
+				sample = float64(int32(seed)) / float64(math.MaxInt32) * 0.5
+			case "whitenoise":
+				sample = rng.Float64()*2 - 1
+			}
+			channels[ch][i] = int32(sample * peak)
+		}
+	}
+	return interleavePCM(cfg.SampleSize, channels...)
+}
+
 func compareSamples(got, want []byte, sampleSize int) error {
 	if len(got) != len(want) {
 		return fmt.Errorf("length mismatch: got %d, want %d", len(got), len(want))
@@ -149,334 +264,77 @@ func compareSamples(got, want []byte, sampleSize int) error {
 	return nil
 }
 
-// M4A parsing structures
-
-type alacConfigInfo struct {
-	frameSize   int
-	sampleRate  int
-	sampleSize  int
-	numChannels int
-}
-
-func parseM4A(path string) ([][]byte, alacConfigInfo, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, alacConfigInfo{}, err
-	}
-	defer f.Close()
-
-	// Parse atoms to find moov and mdat
-	var moovData, mdatData []byte
-	var mdatOffset int64
-
-	for {
-		offset, _ := f.Seek(0, io.SeekCurrent)
-		size, atomType, err := readAtomHeader(f)
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return nil, alacConfigInfo{}, err
-		}
-
-		dataSize := int64(size) - 8
-		if size == 1 {
-			// Extended size
-			var extSize uint64
-			binary.Read(f, binary.BigEndian, &extSize)
-			dataSize = int64(extSize) - 16
-		}
-
-		switch atomType {
-		case "moov":
-			moovData = make([]byte, dataSize)
-			if _, err := io.ReadFull(f, moovData); err != nil {
-				return nil, alacConfigInfo{}, err
-			}
-		case "mdat":
-			mdatOffset = offset + 8
-			if size == 1 {
-				mdatOffset += 8
-			}
-			mdatData = make([]byte, dataSize)
-			if _, err := io.ReadFull(f, mdatData); err != nil {
-				return nil, alacConfigInfo{}, err
-			}
-		default:
-			f.Seek(dataSize, io.SeekCurrent)
-		}
-	}
-
-	if moovData == nil {
-		return nil, alacConfigInfo{}, fmt.Errorf("moov atom not found")
-	}
-	if mdatData == nil {
-		return nil, alacConfigInfo{}, fmt.Errorf("mdat atom not found")
-	}
-
-	// Parse moov to get sample table info
-	stbl, err := findAtomPath(moovData, []string{"trak", "mdia", "minf", "stbl"})
-	if err != nil {
-		return nil, alacConfigInfo{}, fmt.Errorf("stbl not found: %w", err)
-	}
-
-	// Get sample sizes from stsz
-	stsz, err := findAtom(stbl, "stsz")
+// readM4A returns the frames of an M4A file, and the config of its magic
+// cookie.
+func readM4A(path string) ([][]byte, Config, error) {
+	file, err := os.Open(path)
 	if err != nil {
-		return nil, alacConfigInfo{}, fmt.Errorf("stsz not found: %w", err)
+		return nil, Config{}, err
 	}
-	sampleSizes := parseSTSZ(stsz)
-
-	// Get chunk offsets from stco or co64
-	var chunkOffsets []int64
-	if stco, err := findAtom(stbl, "stco"); err == nil {
-		chunkOffsets = parseSTCO(stco)
-	} else if co64, err := findAtom(stbl, "co64"); err == nil {
-		chunkOffsets = parseCO64(co64)
-	} else {
-		return nil, alacConfigInfo{}, fmt.Errorf("stco/co64 not found")
-	}
-
-	// Get sample-to-chunk mapping from stsc
-	stsc, err := findAtom(stbl, "stsc")
-	if err != nil {
-		return nil, alacConfigInfo{}, fmt.Errorf("stsc not found: %w", err)
-	}
-	stscEntries := parseSTSC(stsc)
-
-	// Get ALAC config from stsd
-	stsd, err := findAtom(stbl, "stsd")
+	defer file.Close()
+	f, err := mp4.Open(file)
 	if err != nil {
-		return nil, alacConfigInfo{}, fmt.Errorf("stsd not found: %w", err)
+		return nil, Config{}, err
 	}
-	alacCfg, err := parseALACConfig(stsd)
+	cfg, err := ParseMagicCookie(f.MagicCookie())
 	if err != nil {
-		return nil, alacConfigInfo{}, fmt.Errorf("failed to parse ALAC config: %w", err)
+		return nil, Config{}, err
 	}
-
-	// Extract samples from mdat
-	frames := extractSamples(mdatData, mdatOffset, sampleSizes, chunkOffsets, stscEntries)
-
-	return frames, alacCfg, nil
-}
-
-func readAtomHeader(r io.Reader) (uint32, string, error) {
-	var size uint32
-	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
-		return 0, "", err
-	}
-	typeBytes := make([]byte, 4)
-	if _, err := io.ReadFull(r, typeBytes); err != nil {
-		return 0, "", err
-	}
-	return size, string(typeBytes), nil
-}
-
-func findAtom(data []byte, name string) ([]byte, error) {
-	offset := 0
-	for offset+8 <= len(data) {
-		size := int(binary.BigEndian.Uint32(data[offset:]))
-		atomType := string(data[offset+4 : offset+8])
-
-		if size < 8 {
-			break
-		}
-		if offset+size > len(data) {
-			size = len(data) - offset
-		}
-
-		if atomType == name {
-			return data[offset+8 : offset+size], nil
+	var frames [][]byte
+	for {
+		frame, err := f.ReadFrame()
+		if err == io.EOF {
+			return frames, cfg, nil
 		}
-		offset += size
-	}
-	return nil, fmt.Errorf("atom %s not found", name)
-}
-
-func findAtomPath(data []byte, path []string) ([]byte, error) {
-	current := data
-	for _, name := range path {
-		var err error
-		current, err = findAtom(current, name)
 		if err != nil {
-			return nil, err
-		}
-	}
-	return current, nil
-}
-
-func parseSTSZ(data []byte) []int {
-	if len(data) < 12 {
-		return nil
-	}
-	// version(1) + flags(3) + sample_size(4) + sample_count(4)
-	sampleSize := binary.BigEndian.Uint32(data[4:8])
-	sampleCount := int(binary.BigEndian.Uint32(data[8:12]))
-
-	sizes := make([]int, sampleCount)
-	if sampleSize != 0 {
-		// Fixed size
-		for i := range sizes {
-			sizes[i] = int(sampleSize)
-		}
-	} else {
-		// Variable sizes
-		for i := 0; i < sampleCount && 12+i*4+4 <= len(data); i++ {
-			sizes[i] = int(binary.BigEndian.Uint32(data[12+i*4:]))
+			return nil, Config{}, err
 		}
+		frames = append(frames, bytes.Clone(frame))
 	}
-	return sizes
-}
-
-func parseSTCO(data []byte) []int64 {
-	if len(data) < 8 {
-		return nil
-	}
-	count := int(binary.BigEndian.Uint32(data[4:8]))
-	offsets := make([]int64, count)
-	for i := 0; i < count && 8+i*4+4 <= len(data); i++ {
-		offsets[i] = int64(binary.BigEndian.Uint32(data[8+i*4:]))
-	}
-	return offsets
-}
-
-func parseCO64(data []byte) []int64 {
-	if len(data) < 8 {
-		return nil
-	}
-	count := int(binary.BigEndian.Uint32(data[4:8]))
-	offsets := make([]int64, count)
-	for i := 0; i < count && 8+i*8+8 <= len(data); i++ {
-		offsets[i] = int64(binary.BigEndian.Uint64(data[8+i*8:]))
-	}
-	return offsets
 }
 
-type stscEntry struct {
-	firstChunk      int
-	samplesPerChunk int
+func ffmpegAvailable() bool {
+	cmd := exec.Command("ffmpeg", "-version")
+	return cmd.Run() == nil
 }
 
-func parseSTSC(data []byte) []stscEntry {
-	if len(data) < 8 {
-		return nil
-	}
-	count := int(binary.BigEndian.Uint32(data[4:8]))
-	entries := make([]stscEntry, count)
-	for i := 0; i < count && 8+i*12+12 <= len(data); i++ {
-		offset := 8 + i*12
-		entries[i] = stscEntry{
-			firstChunk:      int(binary.BigEndian.Uint32(data[offset:])),
-			samplesPerChunk: int(binary.BigEndian.Uint32(data[offset+4:])),
-		}
-	}
-	return entries
+func runGenerator() error {
+	cmd := exec.Command("go", "run", "testdata/generate.go")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
 }
 
-func parseALACConfig(stsdData []byte) (alacConfigInfo, error) {
-	// stsd: version(1) + flags(3) + entry_count(4) + entries...
-	if len(stsdData) < 8 {
-		return alacConfigInfo{}, fmt.Errorf("stsd too short")
-	}
-
-	// Skip to first entry
-	offset := 8
-
-	// Entry: size(4) + format(4) + reserved(6) + data_ref_index(2) + ...
-	if offset+28 > len(stsdData) {
-		return alacConfigInfo{}, fmt.Errorf("stsd entry too short")
-	}
-
-	// For audio: + version(2) + revision(2) + vendor(4) + channels(2) + sampleSize(2) + compressionID(2) + packetSize(2) + sampleRate(4)
-	// Total header before codec-specific: 8 + 6 + 2 + 2 + 2 + 4 + 2 + 2 + 2 + 2 + 4 = 36 bytes
-
-	if offset+36 > len(stsdData) {
-		return alacConfigInfo{}, fmt.Errorf("audio sample entry too short")
+// BenchmarkMatrix decodes every file of the test matrix, see TestMatrix.
+func BenchmarkMatrix(b *testing.B) {
+	paths, _ := filepath.Glob("testdata/generated/*/*.m4a")
+	if len(paths) == 0 {
+		b.Skip("Test data not generated, run TestMatrix with FFmpeg installed.")
 	}
 
-	numChannels := int(binary.BigEndian.Uint16(stsdData[offset+24:]))
-	sampleSize := int(binary.BigEndian.Uint16(stsdData[offset+26:]))
-	sampleRate := int(binary.BigEndian.Uint32(stsdData[offset+32:]) >> 16)
-
-	// Look for alac atom inside the sample entry
-	entrySize := int(binary.BigEndian.Uint32(stsdData[offset:]))
-	if offset+entrySize > len(stsdData) {
-		entrySize = len(stsdData) - offset
-	}
-
-	// Search for 'alac' sub-atom starting after the audio sample entry header
-	alacAtomOffset := offset + 36
-	for alacAtomOffset+8 <= offset+entrySize {
-		atomSize := int(binary.BigEndian.Uint32(stsdData[alacAtomOffset:]))
-		atomType := string(stsdData[alacAtomOffset+4 : alacAtomOffset+8])
-		if atomSize < 8 {
-			break
+	for _, m4aPath := range paths {
+		frames, alacConfig, err := readM4A(m4aPath)
+		if err != nil {
+			b.Fatalf("Failed to parse M4A: %v", err)
 		}
-		if atomType == "alac" && alacAtomOffset+atomSize <= offset+entrySize {
-			// alac atom: size(4) + 'alac'(4) + version(4) + config...
-			// Config: frameLength(4) + compatibleVersion(1) + bitDepth(1) + pb(1) + mb(1) + kb(1) + numChannels(1) + maxRun(2) + maxFrameBytes(4) + avgBitRate(4) + sampleRate(4)
-			cfgOffset := alacAtomOffset + 12
-			if cfgOffset+24 <= len(stsdData) {
-				frameSize := int(binary.BigEndian.Uint32(stsdData[cfgOffset:]))
-				return alacConfigInfo{
-					frameSize:   frameSize,
-					sampleRate:  sampleRate,
-					sampleSize:  sampleSize,
-					numChannels: numChannels,
-				}, nil
+		name := filepath.Base(filepath.Dir(m4aPath)) + "/" + filepath.Base(m4aPath)
+		b.Run(name, func(b *testing.B) {
+			decoder, err := NewWithConfig(alacConfig)
+			if err != nil {
+				b.Fatalf("Failed to create decoder: %v", err)
 			}
-		}
-		alacAtomOffset += atomSize
-	}
-
-	// Default frame size if not found
-	return alacConfigInfo{
-		frameSize:   4096,
-		sampleRate:  sampleRate,
-		sampleSize:  sampleSize,
-		numChannels: numChannels,
-	}, nil
-}
-
-func extractSamples(mdatData []byte, mdatOffset int64, sampleSizes []int, chunkOffsets []int64, stscEntries []stscEntry) [][]byte {
-	var frames [][]byte
-	sampleIdx := 0
-
-	for chunkIdx, chunkOffset := range chunkOffsets {
-		// Find how many samples in this chunk
-		samplesInChunk := 1
-		for i := len(stscEntries) - 1; i >= 0; i-- {
-			if chunkIdx+1 >= stscEntries[i].firstChunk {
-				samplesInChunk = stscEntries[i].samplesPerChunk
-				break
+			var size int64
+			for _, f := range frames {
+				size += int64(len(f))
 			}
-		}
-
-		// Extract samples from this chunk
-		offset := chunkOffset - mdatOffset
-		for s := 0; s < samplesInChunk && sampleIdx < len(sampleSizes); s++ {
-			size := sampleSizes[sampleIdx]
-			if offset >= 0 && int(offset)+size <= len(mdatData) {
-				frame := make([]byte, size)
-				copy(frame, mdatData[int(offset):int(offset)+size])
-				frames = append(frames, frame)
+			b.SetBytes(size) // compressed bytes
+			for b.Loop() {
+				for i, f := range frames {
+					if _, err := decoder.DecodeFrame(f); err != nil {
+						b.Fatalf("Frame %d: %v", i, err)
+					}
+				}
 			}
-			offset += int64(size)
-			sampleIdx++
-		}
+		})
 	}
-
-	return frames
-}
-
-func ffmpegAvailable() bool {
-	cmd := exec.Command("ffmpeg", "-version")
-	return cmd.Run() == nil
-}
-
-func runGenerator() error {
-	cmd := exec.Command("go", "run", "testdata/generate.go")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
 }
@@ -3,6 +3,8 @@ package alac
 import (
 	"bytes"
 	"encoding/hex"
+	"errors"
+	"strings"
 	"testing"
 )
 
@@ -67,15 +69,7 @@ func Test(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	for enc, dec := range map[string]string{
-		// 2 channel cases
-		"200000040013080981f8c1ff80000013080981f8c1ff800000ff808fffc37e3ff1306ee87b8af0ba314080780de8952c97931e90d85b5d4cebaa4a93b7a88ab0d206e0fae0ee2042894e6c3e3ce0e0f3c27b985c535c3e15826f51e095bc125faadbde9a2fd70061295676778e2924bfe023fff11a2ffc600fd327b93f8ee0ff0b22581a55daf927243553b91696954a78cb1c6a79a6933f03c072763286f08e47870076fa449e039cea55a41ed607c834c8846cfa28bd4be16f4c5066b3446906facbc3e9aefc":                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                   "000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000f90da311280edf11140ea111d20d1611d20dfc10420e9411040f8712c60f5913751001147e111815fd12de169614b4180b16221a3817391b32181f1c3919f51c291ab21dbc1a171ec51aec1d3d1a3d1da7197a1c4c19fb1b9718661b6c17701a9316a01961166b199416a919e8160f1a3d17861abb17261b6518df1ba818351c2d18fa1b5e17691b8a168d1aba15a719f91403192714491841135c1778128b169811b315be10fd148510ee14a21017158e101d15ae106b15fc10b215ef106f15b310fd149610b414c010a4145911f01407126a158d12ec153c13a316fe1366175f14c91727147c177c13af16cf12fb1526126f153d1189148110921363102713",
-		"2000000408130809b5f91bffe20058130809cbf9380006006bff109c0f63c94a58910205b809e01e910ff64d4a7f3fae8d08968a32db2744458c88a8109151c209ed086c93dbed04320c10c1a1f0acb364e39b7ca47250d93d0b4f83f05be9959f68cba66a61ba84c5661b8d241c9b2212cf6cf9fd2bc6b78ccf6b78f2270f2f047bf12254055146a60aeb0832a7ccd0931b699aa2179bc2162476091536872f0ddfdb74087c124c05493bd5cd70cc21f1ad7656598fc51a1217a1a107622502d23da3a32c3cce73a957c3576477e6f9dda501db7c4e0f85c86ff4fa5314642112cf239b6eb0688bc084216692ed26376a5017b6aa9829dfecae1ee8b8325f8671c293288330b2c8636ae209e708336bef50594a61b9b139b619e4b9f9e66b096c6a9b2309472d4cc0a18911d1f8e1f102cf94bbbe67f936e4e8cb23dd620ce09a6ad8dcd4c2829bbdc1e760e135782f31138f96f45f927fc66df57cd6b131a4c0d0901521d7e4c9b878689d340cd4127d10ee234f9f6be1b042a0cd4f899ce8d89f12a0f030cc76d811310a8a18a6cf062ca6ce6418f605ff0299911361a3e5c17934ba805935f9ab9cee2711634d4d2362b64216017371ab2a18d8a826404bc0ff2acfb5e13bede70b9fddb568a0d1a86a071877cd8978949b2ac5f24d5983e3324b09a570ae0003e824aca7be1ee3dce88f92d904a2a339954a8b2265d5a3fc180ed8411522377b1713348c71d45067e493d1a0ce83cf1c924b336f15897912969a23159cc3e1f256b61550b4a563814e9e904b2691e9f700a30472cef19d61aa3969fea612f0c0489adc0bebb999eba175a9ac8cc39c8c773f0b2c158039d358f235a2651694e1b6969091c145646af29411d6efad24902a169c6a84066ef942fb93bcca3cad7eb95d03aab5711432f44a66d9182c3e4e56d15e38342320e26bf22129d6cc4056cef425920a9215531228a985365edd5a317d1a4cc5be060e77685707075f2545889fcdc16c126444cdb01a5ca2616410227c7c2478436434fc6605dbc2e6fe5cd766cb5a1645a13a2190e9d7b05dc0": "9c103613d9106b131511a3136711be13bf11c613be11cb136811a11316112213a5105d12c20f5311c10e34106e0e910fea0e9c0f5f0fd70f690ffa0f7f0f1a10990f14103e0fcc0f770e5b0fab0ddb0e410d980ef70c870e2f0c270e4e0baa0d030ba00dfd0ae50deb0a300eef0a870e070bdd0e0b0b300fa40a270f8409350e1108bf0ce006990b2306ed0aea05bd0a1706f90a5c06490b86069a0ba606e90bef06170c3407590c4307d50cca079c0d2b09c70e5e0ae20fdc0a9210880b43117f0ce4110b0d1f123c0d3912480d0612c40cf7107e0b460fc809430dfe07e10a280645080704aa05d3012003fbff9d0060fe23fecbfcfdfb2bfb13fa90f9eff770f8f8f5e7f7dcf470f726f412f73df31cf76bf22ff7e6f1e3f62bf155f6edefb0f57feedaf40eedd5f383ebd5f2dde989f1eee7c4efdee571ee5de4bfed2ae396ec79e1d3ea83df6ae9d4ddd7e8abdcace807dc04e839db24e713da30e793d99ee7bdd93fe787d985e6e6d81ce65dd8b6e5d6d705e53dd72de4aad689e302d620e363d5bae223d58be232d5d3e261d527e38fd509e37bd5ace246d5a1e260d5dce2aad5f0e2e9d5e5e235d6dce272d6e6e2b6d63be345d78be3bfd79be302d800e4bcd8d0e4e5d981e5d2dae3e553dbcae575db6ce566db8fe59adb0fe614dc35e669dc05e685dce0e59ddcffe5eadc3be676dd2ee6ffdd26e691debde693dfb9e705e188e869e2e9e85ee3e8e8c7e3e7e8f9e308e96ae4e6e8e2e497e811e5b3e86de53ce95be6d7e994e772eab5e8edea85e91eeb10ea2aeb9cea36eb2eeb45eba7eb4deb0dec55eb91ec8deb5cedfaeb46ee5bec0def97ecc5efbcec7af0dbec19f103edaff1e5ec0cf238ecdaf151eb4af18fead0f0ffe9abf0cce9e0f028ea77f1e5ea75f280eb8af3c7eb31f40dec6ef44dec9ef44fece5f476ec50f5e1ecd4f511ed18f6eeecfef5f8ec2df6abed45f716eff9f8c7f0b9fa76f296fc34f4affedbf59d0004f7d40193f750020cf8ce020cf9e70382fa4b0501fc9e065efdde079dfe0d09fcff3f0a8701750bc702760cac033d0d9e04f80d9705b30e5f064b0fe606a30f48070410c2079e10720840116c0918128d0a3c13540b0c14a30b4414e10b49141c0c3f14030c0114640b5f138a0a6b121c0ab7110d0a7011bf0924114509a1100d091d10f708cf0fbb089d0f61083b0f3808e70e5608020f7108420f8a085f0fd0087b0f0e09860f41098d0fb809d00f610a2a10f00a50106c0b5d100e0c8d10e30cd510940dfb10d10ddd10d20d8610eb0d0710ea0d720f930dda0e230d300ee60c750deb0c0b0d350d2c0d980d680d0a0e880dda0e090e05100d0f4a112110b21231112414611265158613aa168d140d189015611995169e1a9517b21b7b18711c1c19e21c6f19e01c7819401c1e193e1b4b18171a4117e3186616d317cb15f4165b153f163515f7158d15141659161b163717fd15d917d61553187315b318ed14e6186514ee188713aa185212f71707110917800f0316e30def14a80c0d14d80b9013410b7313ca0a8e13620a9813130a8813af096e130f0924139508d7127408d9126a080213a3085e13560916140a0ab514440ae014150ab114d409311499096d13d00839120a073e100205dc0d4e03850b6601fd0839ff7806a2fd9b04d8fc5b0362fc7a02fafbd7017afb0801d9fae5ff09fab8fef6f87afd02f829fc91f72cfb42f787fac3f6cef93cf6daf8b0f5caf72df5d8f6e7f43bf6a7f4aaf530f4daf4c5f319f46df37bf3d7f2a0f229f2b5f1cbf12df1e5f11ff19bf2aaf1cef3c3f2d0f4d1f33ff558f42ef53cf4a0f49af302f401f3c9f3e2f26cf39df282f2bdf1eaf136f134f291f1a7f2ebf1a5f2def172f2d4f19af2dbf153f331f258f422f33cf51ff40cf6d1f401f794f50af881f63df9b7f7dbfa5ef99ffc01fb09fe3efc22ff40fd23001dfee800a2feec006cfefcff53fd",
-		"200000040013080981f8c1ff80000013080981f8c1ff800000ff80afbfe02bfc": "00000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000",
-		"2000000408130809a5f8ebfff2006c130809cff8fdffc20045ff0d0f5220b3f196c076b075e98899b92025f2ba5dbb3ddcf717f9c00cffc367fc7fcea6ba7196155a86afa4b3b2041fa26a737163f960d9102a88339a97e234875ea0ebdd84a2be58f02a4e714f689919e56e4fdb63852ccbe9eb94f8da79b6c2ee934b7b5d28c3f21a826baa2eb42129b7bc9be820675098578b19f3c23bfd8a19127c16eb865b00d6418a23d49bb532ab42a5415b9256a92ecba1a54423b4202aa62fe4d478fa313daef2f927cd0617b22598f94a6c9cc9dafef170e300db78f0edbd1f56e201a30b0198ac61a54a03768cee80003eec25770cfaf34d7e742677da3b25e601037aca4638c9a382a4cda30cc16b9e3f0c032de10ca6d34ac3965f782d39b273a973d7645e3895b30d1b91b85394d1dd14e3724835baf17befcfa62675bb252b4978e539b035daeab9cca237c8d8d542f9d55e17a5ef88ad42f8baa82e0af37e8e2c3b4c792ed4749a152aa7791d2ebf3f22e81a9971599d5f027a6250277659c2409dee046876a0bf09ebaa4ad6fd3010c3b4d7a20ec86716b7518d56cada699a3f9c234fb3461130acf9d108e0abc01969e2520dd0e062182d1cd6ee9bfd28e7bb8c7a06f07a2b2dcf267cd9f6bf8ac1fcce5dc36679073c3b8ba64401ad3d05e6c55a24c11e7a135e6ff844b3111d33377f5a06cc472e26a63719a844b0f02a9644915437a308413b0c0d9d3be54777741b32255b2f0cff52a47359102e9be08ad32c6760dbe990ce39df5fab370cd19997eaacc38885ff00627fc032dff0098771e8dea4e53565a72db09537d290274ff7ddc1e555d1fba6c3e3b078ce27a2e3bca604321cc99a66ddc7b0c82e7a9f9a415557e1c370068153adf9e98d072e23e4546e2298c885f4572f963d5dc82441153369c26c022440679154d78bebab5dea6fb39d48fca42897392c44d67d9d6e8a139c8bebe2bcb9ee8863c4d028f8547b3539362c6059d5deeff05983c8b172710fad9256e0311bc4ef8fb76c772c6a9394cc330a9c5a801379d283f5db10f56eee0e9f2d10e0cb7b8374c164b51b2c81d3a382e0e605405531387908d3704e0a4a06c54bd870453a365b363c1ddc65307303225800a83cb28c93bd690e05bc86ed170bb5fc1e23f34115c3d1110a92fa97b53aa69a763d681f6d0eb2cb4c81b848d516eab7743990c14e4a66a69eade72c95bc959ad380b0c7e81420ad51d8388b1b2fac6fb7e5d337fdecef403abb035c43319b7527a99c73a9f5860e362e7612a4a7266a9f8fab849f1d46e873fdbb7dc04f5f41dbe22b94e0b080b3fb1073ab0d28e0": "0f0dad0c9f0e720d890ec40c730b3409b408e60563094006c40cba09950fb90ca612f90f5817fc14e51aad18431ecf1b20215f1ea81d981a111672129f0b4a07090125fcf500edfb940ade052c11e10c2f13220f0c13370fde12240fc914c0104f17cf12a618d313ac13b00e730d8908f30c4208e710660cdd14db1054174b14ea19a1170e1a021806193717b4193618611afe182919bd171718a116d3178216d315eb142d137f1255148a130b18641751180218ed1476148b10970f3a0d100c840a68091c08270732066c05aa00dfffccfbd3fa82fc72fba5fe92fd2c022e01c60825086e0f3a0f9a1379135b16ed15391670152115371406141013be0e630d23062a0463fd1ffb61f703f5d2f619f43cfb40f8b9fe08fc510036fea303dd017608a506370841066d028b004bfc94fa10f64ff40ff439f2b3f51bf46cf84bf764fd8dfcfb003e005800c3ff6c000800e8006a00e9fe1efe8bfeaafd9bfcd8fbccf6fdf5dcf3faf2cdf523f541f623f652f7dbf702f8faf80bf50cf6e8f5e2f666f891f957f9abfa5ff9b9fa91f9fefac0f931fb23f871f97bf8d7f9f9f7b2f9f1f50af8a6f5e4f729f44df652f352f55ef469f66bf571f7b7f454f670f49df55ff97cfa7dfd9bfef9ffc000b304f004be059b055303ec0299fe98fd40f73df5caf3f8f0c3f5bef2ebfadff7d6fc8af919fa7af6bff9daf520fd12f97e0495007d08c604920283fe4dfc6ff7c0fc3af7140024fae80175fb7d006df9c6ff2af8cf02d5fa58065bfeb207f3fff30523fe7c033cfbe80267fa2f03abfaaafecaf5d4f50eecddee43e446ee99e35af344e951f4b9eafaf192e8d2f6f6edf90013f9e50497fd470217fb6e018dfa4d0405fe710795017d06a1000001d5fa0cfcbff533fb63f599fd93f8d5ff34fb85fab3f50af1a6ebc9ece2e62eec2fe6cbecf1e6c4f228edbdfcd5f7ed00fafcd1fe3ffb27fd83f9b3fb47f8aaf8a1f533f951f6a8faacf713f7b4f329f553f14ff880f4b5fe6cfb3a057002ff088206e00982076a05f402f5fc4cfaa8f4c3f17ff256efeaf6b2f3f3f8f0f592f6b5f3d2f5fff226fa71f75efeb7fbc30102ff7c05a5029903ae00dffcbaf994f42cf100ef93ebcdefa7ecfcf01deeabf2c6ef2cf723f42af748f487f6fcf3abf943f7ccf960f754f622f4f0f642f5fdfdd7fc1d0057ff2cfaa5f97af714f797fa36fa56fc03fc2ffafcf968f45df4e8ee20ef3decc1ecc0ea6beb72ec43ed88f1baf29cf628f855f4eaf5faef74f1c8f160f326f526f729f796f92bf4b8f65ff3f7f5c1faa8fd8bfb80fe5ff492f62cf476f5cbfbbffcef03d404e3089609c50a2e0bdb08e3081b00bdff76f8e3f711f959f866f94af8a2f3edf187ef4aed42f4d1f1e2fb85f93c01d8fe01088305830f530d8b13d31131105e0eab053b032afe37fbb5028aff220d050a5a0f830cca0b0309f40de30a2811fb0dc80efd0b1908c40583fe49fcf1f48ef2d7f069eee0f3aaf174f77df51cfc5efabb028c018f082c08890e880e04100210060b560b52075d08c70c8e0ec2113f14b90ac90d220046034cff3e0225023005effc670072fa49feaafba2fffbf7defbadf780fb4afa42fef9f82cfddaf95efe8e00a6056c05ff0a010159062af9b8fd05f4e2f75df018f4d2f40ff979fa5effb9f8b3fdf5f7a7fca8f66bfba9f3b3f8dff5ddfab8fd9002fb030b090006740b9d030c09ebfab6ff70f7a6fb8000fc04900ad40f410cca117605b90af0fa08007df4a9f9d4f52bfba6fa2e006ffb0e014ef9f6fec9f99aff65f943ffa6f739fd57f7aafc2dfb99009b003c0647ff080546ff1a058604550aec05b20b43042d0a10034e092601d907080125082307510e350f341640124619c00fe216950a51111c060d0c6006c40b0606310bcb00b305b4ff4104db0237072f02a7062202db06f10ab20f6413bf170711c614cb0bfc0ebc0a790d0209660b0d063a08",
-		"2000000406130807f3f9c202f7ffbe1308081df9ee0355feb7ff0a647117737554020a63d0147876131bd42387d56045d2070313d2c7c2d4546d2ec2582520b4300ad3764b514775cef153657902b64d3a48d14e40b798e449a1a035cce57f59db5f86a7063c615e30f1110a2884dc45f979c18609635e5df455f20386f8840741321189178ad60e04af15262f52404d3c930de18b855f7f4e84fbe33fa3ecb149df181266ca0407baeb4bd912f3e842c6bc72be7c39d4a049dab1e69d6fdace65e3cf0e63e749c2f912c74dd0fe5ee22ecc99f0280e5d8294d17d938d85e3cd791c9de2833ba67a3ec34234ab34d442e35d92488eaaccf67c0742836239d653ce25b0fd1fb4d665b55b7f95da56b4b6151d3020011c53f1026c1d8c106757b14f9da6603e4fda7a675b0f2b231a768301056258c97a5181aa448d20d5b4df85221775bae34eac9678bfcdbc408ccc30b0ea4aacc0a05bb76a801a327e528c69e28a675743fc99c0bbf9679fd21ecefa3aa06d129f8ea6dcc18a73082ab7e3795f07847e535bc05d64ffba0b18502deb34dec8dd3bc4c5441cf6f81949c151e6e0a8d0a2ef7c42fbffd752146da55559a8e76b71ca5b4bc5abe5fe0566f228c342c9785276a91416ba945dc36252dab0c3177fc8ac214c088150c61281a13000080a81b1440f0485c0c312884c3056120261b552c39191f1f3f2522417b120961648c5bda41d16ccdbc4b97b826e11c346cbc23b34143c3a31671fb99464b48997918c962c877b9e2eceaaafbb94b3c66f393b54d3ee21115fc8a285c55acd6000d75b8dc5ebf96d3c8526ee520d5df2964624260e2dd4a58b10a22e87110ae9b4133838cdab15d2641aa0251cea2e20a7910e55f9ccadda49f4130460d258e82da0e63007b74eb20187ec512f9ab059245f6911abe81e87b9dd628d989937fe7c78afabd4c2a99dc923ae89c5399a85bd19282c0c8c445a1cfca143371834aef43a3c9e0e313ad1e893258e153f00c48db9205cbb77469e57c1a8cb69100b510a7f0a5330ae0a658212ab4fc9fbc563e31bd1a68c9088730554c53ad743bc382482107715616939237f08cad8599a5e439b9f9527539889cc609cc2dd95280e6005b2460db7c0af4a861f":                                                                                                                                                                                                                                                                                         "b80169245103d9254405c4271a07902926086b2ab608b82a9808632a8208362a5209f02afb097d2b0c0a882b180a872ba60ad82b290b182ce30aa12b4a0bd42b220c742c820b852b480ad52976098b28e3089b27a4072c267105d2238f04b222350559231b05b723c504db238905c6243906822509066b255d05d42414057a248805c82420055924fc031b2386034422c2022f215601991fd600bf1e8001ce1ed4018e1e17015e1db900791c3301321c8a00d71a4aff2b1959ffbf189bff611891feda166dfd3f15fdfc0514e4fbe01149fa4f0f7ef9c60d2ffaa20d04fc5e0e13fe730f8c003611d4039d130307a6156609f016860b0e18410eb8191911751b2a127e1b5f12bf1a8213d21aa214cc1ade14101aee145519f2158419b2167219e815e91717155f161d15bf15da13ff130e10dd0fe10b5f0b900997080c088c06d204d3025701abfec1ff27fcd6fe35fa54fd9ef7b6fb07f5e5fa9ff3d4fa3bf32afb54f31ffb37f354fab2f2d7f9d7f291f949f331f882f26ef66cf187f44ef096f1f6ed6fee5eebf0eab6e807e7d0e5dfe39de340e2ffe261e16fe30ee0afe34ddf48e40de00de603e121e84be09de838df65e819dfc9e87cde83e8ceddf2e71adefce7f3dd50e778dd4fe692ded8e6e6e04de88ae3f6e95be517ebe9e603ec36ea60ee56ed78f0eded43f034eee3efd2efabf0e0efadef67ed4aec54eb5ae9a4eb74e8cbeb49e757e9c7e301e87be100ea81e2c9eb71e383eb90e2f8eab2e12ceaafe0b0e80adfe3e72ede75e794dd11e6e3db8de440da39e4bed9e4e4d5d95ae5a4d90ae4f3d720e4ead7fde6a5dae8e843dc1aea3bdddfeae7dd19ebe5ddd9eb7dde6bec21df28eccfdedaea66ddb7e877db5fe780dad8e631da2be57fd8aae207d605e1a1d4fde0a6d474e1ddd4cce12fd575e205d64be3cdd664e4b8d735e590d8e9e56fd9e6e66adaa1e7dadaede7d2daede871db12ebd8dc84ed58deb1efbbdf0bf256e15df5d0e310f8bde5c9f9e2e6aafb42e8a7fd98e98dffbceaf50087eba702a9ec3a0580ee3407c3ef250816f08609bef04a0ac4f0ee09d8efc40939ef800a72efc80b34f0c00bcdef100cf2efbb0d68f1c20e31f2f00e75f2df0ec4f2ce0e03f36a0ee2f20f0ee1f25d0d76f2450b6ef08209d4ee1609f6eeec0778ee880696ed90055ded6c0475ed7103bfedcf0113ed8600d6ec26ffe5ec49fc65eb0cfb1eeb12fc2fed82fb14eea3f98eedf9f8dced69f95befe7f94af1f8f8d1f1c4f7c3f136f749f287f6c7f25cf687f3a2f67df4ddf694f553f7e9f693f89ef8f8f937fa9dfb30fc57fd48fee9fdeafebcfd7cfebffd40fe1cfe63fe9cfd62fd07fc00fb7afb82f9a3fda8fa1bff19fb93fd8ff8f0fde3f7500138fa150408fc21063cfd220858fe220a47ff930cb000de0d3a019b0e6201820fb401a90f6a010611a1029c121f046b13c604cd1434061a15d5066d148a06c9143407dc15a008df162e0af015dd093014b008df14260acd14270b4c12ae0910104c086e108a090d11340b2d0e4d098c0d48093c10910cbe0f140deb0d330c260f0e0ef11197112212b812b90f2411740f8c11df108913fa0f2e13290ebe11950d1f11090f78125210ec13cf0e7812a30d2311c80d5611020dc9102b0cf30f9b0c27102f0d6c10350c210fec0a780dc80ccc0e7a0fee104e0f3b106f0fcf0f17120d126a150d1517172916f5175316b91a9418141e8e1b2920481dd922911f7d26b42277284324d2284824db29e524ca2b7326212b672549290023f629412366296622a826401f48248e1c8422b01acd200919981d19168a1a521341196412b5168d101a13c20d2311a00c750ff80be50c840a3c0a2509000964098c083c0ae605e40883021b076801990792004508cafdfd063cfbcc0581fa6506e1f9090786f7bf051ff5650491f3df03eef02802f3ed33009febd8fe89e965fd82e7d2fb02e6acfa",
-		"2000000400130802b3fed601dfff7613080313fe700295ff33c1100a207371686b25b7e82846ca4868a5409c0b626da236342a4340360d0703d43202aa760500e206349351a06c13008c8ddc867a21d212460c40ec6c750114d302051412008686982623342318c880b60cd527b3408f8a284810d4d5866c700064e61bb20c5d66a849c29024da6fb65a598ecf0934a9b490e88c40c183265873f0d89aa04c6249890899b22c2ac92a074401b189a056608c233cb8e4dd0032d14d260c42436e0086664934da4d02617812a0097923249d3484db02010d95592061933abc8315e69031360926a8688c6023818789cda18c14378e":                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                                       "fefffefffeffffffffff000000000000fffffffffeff0000ffffffff0000ffff0000ffffffff0000010000000100000001000000ffff0000fffffeff0000ffffffff000000000100ffff0100ffffffff0000feff000000000100ffff0000fdff0000000000000100ffff00000000fffffffffeff0000feff0100ffff0300000000000100ffff00000000fdfffeffffffffff0000fefffefffffffeff0100ffff00000000010000000000fffffeff0000ffff00000100ffffffffffffffff0000020000000000ffff0100ffff01000000000000000000ffff01000000ffff0000ffffffff0000fffffdfffdfffffffdff00000100feff00000000ffff0100010000000000fffffeffffff0000fdffffffffff000001000100ffff00000000ffffffff0100feff0100feff010000000100ffff0000feffffff0000ffffffff0100ffff01000000ffffffffffff000000000100ffff0000ffff0000ffff0100ffff000000000000000000000000feff0100ffff000000000000ffff00000100010002000100000000000100ffff0100fffffeffffffffff00000000fffffffffeff0100feff0200000001000000feffffffffff000000000200000001000200feff0100ffff000000000100ffff0200000000000100ffff000000000100000001000100ffff010001000100010000000000ffff0100ffff01000100ffff0000fffffdff0100ffff0100ffff0000ffff0000000000000000ffff0000ffff0000000000000100ffff000000000000000000000000ffff0000ffff0000000000000100ffff0000ffff020000000200010000000000ffffffff00000000feff0000fdff01000000ffff0100fdff0100feff0100ffff000000000000ffff010000000200feff0100fdfffefffffffeff0000000001000200ffff0200feff0000fefffffffeff0100feff0100feff00000100010000000100ffffffffffff0000feff0000fffffeff0000ffff00000100fdff0100feff01000000ffff0000ffff00000000000000000100ffffffffffffffffffff00000000ffff0000ffff00000100000001000100ffff00000000ffff0000ffff000000000000fffffeff0000ffff01000000ffff0100feff010000000200ffff0100feff0000fffffffffefffeffffffffff00000000ffff0000feffffff0100ffff01000000ffffffffffffffffffff00000100ffff01000000000000000000ffff0000feff00000000ffff0000fffffeffffffffff0100000000000000feffffffffffffff0100fefffffffefffeff0000feffffffffffffff0100ffff01000000fffffffffefffffffffffefffefffeffffffffff0100ffff0100ffff0000ffff0000ffff0000fefffeffffffffff00000000fffffffffffffeffffffffffffffffff0000ffff0000000000000100ffff0000fefffffffefffffffffffefffefffefffeff00000000ffff0000fdff0000fefffffffffffffffeff0000feff0000fffffffffffffffffffffffffffffcff0000fdff00000000fefffffffeff0000000000000000fefffdfffefffdfffffffeffffff0000fefffffffefffefffeffffffffff0000fefffffffdfffefffefffeffffff0000feff0100fdfffffffefffefffefffffffeffffffffff0000ffff0000fffffeffffffffff00000100feff0000fefffffffffffffffffffefffffffeffffff0000ffffffffffff00000000000000000000fefffffffffffffffefffefffeffffff00000000ffff0000feff0000ffff000000000000fefffffffffffffffefffefffefffeffffffffffffffffff0000000000000000fffffffffefffffffdff0100fdff0100ffffffff0000fffffefffeff0000ffff00000100fefffffffefffeff00000000feff0000feff000001000000fffffffffefffffffffffffffefffefffdffffffffffffff0000fefffeffffffffff010000000000",
-	} {
+	for enc, dec := range testFrames {
 		encB, err := hex.DecodeString(enc)
 		if err != nil {
 			t.Fatal(err)
@@ -90,3 +84,678 @@ func Test(t *testing.T) {
 		}
 	}
 }
+
+func TestReset(t *testing.T) {
+	a, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for enc, dec := range testFrames {
+		encB, _ := hex.DecodeString(enc)
+		decB, _ := hex.DecodeString(dec)
+
+		a.Decode(encB)
+		a.Reset()
+		if have, want := a.Decode(encB), decB; !bytes.Equal(have, want) {
+			t.Errorf("after Reset: have\n  %x\nwant\n  %x\n", have, want)
+		}
+	}
+
+	// switch to another stream and back
+	if err := a.ResetWithConfig(Config{SampleRate: 48000, SampleSize: 24, NumChannels: 1, FrameSize: 4096}); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(a.outputsamples_buffer_a), 4096; have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+	if err := a.ResetWithConfig(DefaultConfig()); err != nil {
+		t.Fatal(err)
+	}
+	for enc, dec := range testFrames {
+		encB, _ := hex.DecodeString(enc)
+		decB, _ := hex.DecodeString(dec)
+		if have, want := a.Decode(encB), decB; !bytes.Equal(have, want) {
+			t.Errorf("after ResetWithConfig: have\n  %x\nwant\n  %x\n", have, want)
+		}
+	}
+
+	// the buffers from the 4096 sample config are big enough for both
+	cd, hires := DefaultConfig(), Config{SampleRate: 48000, SampleSize: 24, NumChannels: 2, FrameSize: 4096}
+	allocs := testing.AllocsPerRun(10, func() {
+		if err := a.ResetWithConfig(hires); err != nil {
+			t.Fatal(err)
+		}
+		if err := a.ResetWithConfig(cd); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("ResetWithConfig allocates: %v", allocs)
+	}
+}
+
+func TestAccessors(t *testing.T) {
+	a, err := NewWithConfig(Config{SampleRate: 96000, SampleSize: 24, NumChannels: 1, FrameSize: 4096})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := a.SampleRate(), 96000; have != want {
+		t.Errorf("SampleRate: have %d, want %d", have, want)
+	}
+	if have, want := a.BitDepth(), 24; have != want {
+		t.Errorf("BitDepth: have %d, want %d", have, want)
+	}
+	if have, want := a.Channels(), 1; have != want {
+		t.Errorf("Channels: have %d, want %d", have, want)
+	}
+	if have, want := a.FrameSize(), 4096; have != want {
+		t.Errorf("FrameSize: have %d, want %d", have, want)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Errorf("default config: %s", err)
+	}
+
+	for cfg, want := range map[Config]string{
+		{SampleRate: 44100, SampleSize: 17, NumChannels: 2, FrameSize: 4096}:                  "alac: unsupported bit depth: 17",
+		{SampleRate: 44100, SampleSize: 16, NumChannels: 0, FrameSize: 4096}:                  "alac: invalid config: unsupported number of channels 0",
+		{SampleRate: 44100, SampleSize: 16, NumChannels: 2, FrameSize: 0}:                     "alac: invalid config: frame size 0",
+		{SampleRate: 0, SampleSize: 16, NumChannels: 2, FrameSize: 4096}:                      "alac: invalid config: sample rate 0",
+		{SampleRate: 44100, SampleSize: 16, NumChannels: 2, FrameSize: 4096, KModifier: 40}:   "alac: invalid config: rice k modifier 40",
+		{SampleRate: 44100, SampleSize: 16, NumChannels: 2, FrameSize: 4096, HistoryMult: -1}: "alac: invalid config: rice history multiplier -1",
+	} {
+		err := cfg.Validate()
+		if err == nil {
+			t.Errorf("%+v: expected an error", cfg)
+			continue
+		}
+		if have := err.Error(); have != want {
+			t.Errorf("have %q, want %q", have, want)
+		}
+		if _, err := NewWithConfig(cfg); err == nil {
+			t.Errorf("%+v: NewWithConfig: expected an error", cfg)
+		}
+	}
+
+	a, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.ResetWithConfig(Config{}); err == nil {
+		t.Errorf("ResetWithConfig: expected an error")
+	}
+}
+
+func TestDecodeFrameErrors(t *testing.T) {
+	stereo, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mono, err := NewWithConfig(Config{SampleRate: 44100, SampleSize: 16, NumChannels: 1, FrameSize: 352})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name  string
+		a     *Alac
+		frame string
+		want  error
+	}{
+		{"empty", stereo, "", ErrTruncatedBitstream},
+		{"stereo frame for mono", mono, "200000040013080981f8c1ff80000013080981f8c1ff800000ff80afbfe02bfc", ErrChannelMismatch},
+		{"mono frame for stereo", stereo, "0000000000", ErrChannelMismatch},
+		{"unknown element", stereo, "4000000000", ErrInvalidFrame},
+		{"too many samples", stereo, "20001000002000", ErrConfigMismatch},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			frame, _ := hex.DecodeString(c.frame)
+			out, err := c.a.DecodeFrame(frame)
+			if !errors.Is(err, c.want) {
+				t.Errorf("have %v, want %v", err, c.want)
+			}
+			if out != nil {
+				t.Errorf("unexpected output")
+			}
+			if c.a.Decode(frame) != nil {
+				t.Errorf("Decode: unexpected output")
+			}
+		})
+	}
+
+	_, err = NewWithConfig(Config{SampleRate: 44100, SampleSize: 12, NumChannels: 2, FrameSize: 4096})
+	if !errors.Is(err, ErrUnsupportedBitDepth) {
+		t.Errorf("have %v, want %v", err, ErrUnsupportedBitDepth)
+	}
+	_, err = NewWithConfig(Config{})
+	if !errors.Is(err, ErrUnsupportedBitDepth) {
+		t.Errorf("have %v, want %v", err, ErrUnsupportedBitDepth)
+	}
+	_, err = ParseMagicCookie(nil)
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("have %v, want %v", err, ErrInvalidConfig)
+	}
+}
+
+func TestLastFrameSamples(t *testing.T) {
+	a, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := a.LastFrameSamples(), 0; have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+
+	for enc := range testFrames {
+		encB, _ := hex.DecodeString(enc)
+		a.Decode(encB)
+		if have, want := a.LastFrameSamples(), 352; have != want {
+			t.Errorf("have %d, want %d", have, want)
+		}
+	}
+
+	// verbatim frame with an explicit sample count
+	short := verbatimFrame(16, 100, [][]int32{make([]int32, 100), make([]int32, 100)})
+	out, err := a.DecodeFrame(short)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := a.LastFrameSamples(), 100; have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+	if have, want := len(out), 100*4; have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+
+	a.Decode(nil)
+	if have, want := a.LastFrameSamples(), 0; have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+}
+
+func TestDecodeInto(t *testing.T) {
+	a, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := make([]byte, a.FrameBytes())
+	for in, out := range testFrames {
+		n, err := a.DecodeInto(dst, mustHex(in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := mustHex(out); !bytes.Equal(dst[:n], want) {
+			t.Errorf("output differs for frame %s...", in[:16])
+		}
+	}
+
+	if _, err := a.DecodeInto(dst[:10], testFrame("20")); !errors.Is(err, ErrShortBuffer) {
+		t.Errorf("have %v, want %v", err, ErrShortBuffer)
+	}
+
+	// the steady state doesn't allocate, not even for 24 bit or verbatim
+	// frames
+	frame := testFrame("20")
+	if allocs := testing.AllocsPerRun(10, func() { a.DecodeInto(dst, frame) }); allocs != 0 {
+		t.Errorf("have %v allocs, want 0", allocs)
+	}
+	b, err := NewWithConfig(Config{SampleRate: 44100, SampleSize: 24, NumChannels: 2, FrameSize: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verbatim := verbatimFrame(24, 3, [][]int32{{1, 2, 3}, {-1, -2, -3}})
+	dst = make([]byte, b.FrameBytes())
+	if allocs := testing.AllocsPerRun(10, func() { b.DecodeInto(dst, verbatim) }); allocs != 0 {
+		t.Errorf("have %v allocs, want 0", allocs)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	a, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Decode(testFrame("20"))
+	if have := a.Flush(); have != nil {
+		t.Errorf("have %d bytes, want nil", len(have))
+	}
+	if a.input_buffer != nil {
+		t.Errorf("frame still referenced")
+	}
+	if have, want := a.Stats().Frames, 1; have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+	if out := a.Decode(testFrame("20")); out == nil {
+		t.Errorf("can't decode after Flush")
+	}
+}
+
+func TestClose(t *testing.T) {
+	a, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if a.outputsamples_buffer_a != nil || a.predicterror_buffer_b != nil {
+		t.Errorf("buffers not released")
+	}
+
+	for enc := range testFrames {
+		if _, err := a.DecodeFrame(mustHex(enc)); !errors.Is(err, ErrClosed) {
+			t.Errorf("have %v, want %v", err, ErrClosed)
+		}
+	}
+
+	// revive
+	if err := a.ResetWithConfig(DefaultConfig()); err != nil {
+		t.Fatal(err)
+	}
+	for enc, dec := range testFrames {
+		if have, want := hex.EncodeToString(a.Decode(mustHex(enc))), dec; have != want {
+			t.Errorf("have\n  %s\nwant\n  %s\n", have, want)
+		}
+	}
+}
+
+func TestClone(t *testing.T) {
+	a, err := NewWithConfig(Config{SampleRate: 48000, SampleSize: 16, NumChannels: 2, FrameSize: 352})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := a.Clone()
+	if have, want := c.SampleRate(), 48000; have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+	if &c.outputsamples_buffer_a[0] == &a.outputsamples_buffer_a[0] {
+		t.Errorf("buffers are shared")
+	}
+
+	for enc, dec := range testFrames {
+		if have, want := hex.EncodeToString(c.Decode(mustHex(enc))), dec; have != want {
+			t.Errorf("have\n  %s\nwant\n  %s\n", have, want)
+		}
+	}
+
+	a.Close()
+	if c := a.Clone(); !c.closed() {
+		t.Errorf("clone of a closed decoder should be closed")
+	}
+}
+
+func TestShortFrames(t *testing.T) {
+	const n = 37
+
+	ramp := func(step int32) []int32 {
+		s := make([]int32, n)
+		for i := range s {
+			s[i] = int32(i-n/2) * step
+		}
+		return s
+	}
+	l16, r16 := ramp(-901), ramp(17)
+	l24, r24 := ramp(200003), ramp(-3)
+
+	for _, c := range []struct {
+		sampleSize int
+		channels   [][]int32
+	}{
+		{16, [][]int32{l16}},
+		{16, [][]int32{l16, r16}},
+		{24, [][]int32{l24}},
+		{24, [][]int32{l24, r24}},
+	} {
+		a, err := NewWithConfig(Config{SampleRate: 44100, SampleSize: c.sampleSize, NumChannels: len(c.channels), FrameSize: 4096})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var want []byte
+		for i := 0; i < n; i++ {
+			for _, ch := range c.channels {
+				v := ch[i]
+				want = append(want, byte(v), byte(v>>8))
+				if c.sampleSize == 24 {
+					want = append(want, byte(v>>16))
+				}
+			}
+		}
+
+		frame := verbatimFrame(c.sampleSize, n, c.channels)
+		have, err := a.DecodeFrame(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(have, want) {
+			t.Errorf("%d bits, %d channels: have\n  %x\nwant\n  %x\n", c.sampleSize, len(c.channels), have, want)
+		}
+		if have, want := a.LastFrameSamples(), n; have != want {
+			t.Errorf("have %d, want %d", have, want)
+		}
+	}
+
+	// compressed mono frame of 10 zero samples
+	w := &bitWriter{}
+	w.write(ElementSCE, 3)
+	w.write(0, 4+12)
+	w.write(1, 1) // hassize
+	w.write(0, 2)
+	w.write(0, 1) // compressed
+	w.write(10, 32)
+	w.write(0, 8+8) // mixbits, mixres
+	w.write(0, 4)   // prediction type
+	w.write(0, 4)   // quantitization
+	w.write(4, 3)   // rice modifier
+	w.write(0, 5)   // no predictor coefs
+	w.write(0, 1)   // the first zero, k = 1
+	w.write(0, 1)   // followed by a block of zeros, k = 4
+	w.write(10, 4)  // 9 + 1
+	w.write(ElementEND, 3)
+
+	a, err := NewWithConfig(Config{SampleRate: 44100, SampleSize: 16, NumChannels: 1, FrameSize: 4096}, WithStrict())
+	if err != nil {
+		t.Fatal(err)
+	}
+	have, err := a.DecodeFrame(w.buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := make([]byte, 10*2); !bytes.Equal(have, want) {
+		t.Errorf("have %x, want %x", have, want)
+	}
+
+	// a frame shorter than the predictor warm-up
+	w = &bitWriter{}
+	w.write(ElementSCE, 3)
+	w.write(0, 4+12)
+	w.write(1, 1) // hassize
+	w.write(0, 2)
+	w.write(0, 1) // compressed
+	w.write(1, 32)
+	w.write(0, 8+8)
+	w.write(0, 4)
+	w.write(9, 4)
+	w.write(4, 3)
+	w.write(20, 5) // 20 predictor coefs
+	for i := 0; i < 20; i++ {
+		w.write(0, 16)
+	}
+	w.write(0, 1) // a single zero
+	w.write(ElementEND, 3)
+
+	tiny, err := NewWithConfig(Config{SampleRate: 44100, SampleSize: 16, NumChannels: 1, FrameSize: 2}, WithStrict())
+	if err != nil {
+		t.Fatal(err)
+	}
+	have, err = tiny.DecodeFrame(w.buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0, 0}; !bytes.Equal(have, want) {
+		t.Errorf("have %x, want %x", have, want)
+	}
+}
+
+func TestSilence(t *testing.T) {
+	for _, c := range []struct {
+		channels int
+		coefs    []int16
+	}{
+		{1, []int16{160, -190, 170, -130}},
+		{2, []int16{160, -190, 170, -130}},
+		{2, make([]int16, 31)}, // the 0x1f delta predictor
+	} {
+		a, err := NewWithConfig(Config{SampleRate: 44100, SampleSize: 16, NumChannels: c.channels, FrameSize: 4096}, WithBufferPool(&BufferPool{}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// a recycled buffer with noise in it still comes back silent
+		a.pool.Release(bytes.Repeat([]byte{0xff}, 4096*2*c.channels))
+		pcm, err := a.DecodeFrame(silentFrame(c.coefs, c.channels, 4096))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := pcm, make([]byte, 4096*2*c.channels); !bytes.Equal(have, want) {
+			t.Errorf("%d channels, %d coefs: not silent", c.channels, len(c.coefs))
+		}
+	}
+
+	// a constant signal comes out constant, for any predictor
+	for _, n := range []int{4, 31} {
+		residuals := make([]int32, 100)
+		residuals[0] = -1234
+		out := make([]int32, 100)
+		predictorDecompressFirAdapt(residuals, out, len(out), 16, [32]int16{1: 300, 2: -50}, n, 9)
+		for i, v := range out {
+			if v != -1234 {
+				t.Fatalf("%d coefs, sample %d: have %d, want %d", n, i, v, -1234)
+			}
+		}
+	}
+}
+
+func FuzzDecodeFrame(f *testing.F) {
+	// the low bits of cfg select the decoder config, see below
+	for enc := range testFrames {
+		f.Add(byte(0x01), mustHex(enc))
+	}
+	f.Add(byte(0x00), verbatimFrame(16, 3, [][]int32{{1, 2, 3}}))
+	f.Add(byte(0x03), verbatimFrame(24, 2, [][]int32{{1, 2}, {-1, -2}}))
+	f.Add(byte(0x15), escapeFrame(16, false, 352, [][]int32{make([]int32, 352), make([]int32, 352)}))
+
+	f.Fuzz(func(t *testing.T, cfg byte, frame []byte) {
+		var opts []Option
+		if cfg&0x10 != 0 {
+			opts = append(opts, WithStrict())
+		}
+		if cfg&0x20 != 0 {
+			opts = append(opts, WithAutoReconfigure(), WithMaxFrameSize(1<<12))
+		}
+		a, err := NewWithConfig(Config{
+			SampleRate:  44100,
+			NumChannels: 1 + int(cfg&1),
+			SampleSize:  []int{16, 24}[cfg>>1&1],
+			FrameSize:   []int{352, 4096, 1, 17}[cfg>>2&3],
+		}, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// none of these may panic
+		a.InspectFrame(frame)
+		out, err := a.DecodeFrame(frame)
+		if err == nil && len(out) != a.LastFrameSamples()*a.Channels()*a.BitDepth()/8 {
+			t.Errorf("have %d bytes for %d samples", len(out), a.LastFrameSamples())
+		}
+		if err != nil {
+			return
+		}
+
+		// the typed output has to match the bytes
+		samples := make([]int32, a.LastFrameSamples()*a.Channels())
+		n, err := a.DecodeToInt32(frame, samples)
+		if err != nil {
+			t.Fatal(err)
+		}
+		width := a.BitDepth() / 8
+		for i, s := range samples[:n] {
+			b := out[i*width:]
+			want := int32(b[width-1]) << 24 >> 24 // sign extended top byte
+			for j := width - 2; j >= 0; j-- {
+				want = want<<8 | int32(b[j])
+			}
+			if s != want {
+				t.Fatalf("sample %d: have %d, want %d", i, s, want)
+			}
+		}
+	})
+}
+
+// testFrames maps hex encoded ALAC frames to their expected hex encoded
+// output, for the default config.
+var testFrames = map[string]string{
+	// 2 channel cases
+	"200000040013080981f8c1ff80000013080981f8c1ff800000ff808fffc37e3ff1306ee87b8af0ba314080780de8952c97931e90d85b5d4cebaa4a93b7a88ab0d206e0fae0ee2042894e6c3e3ce0e0f3c27b985c535c3e15826f51e095bc125faadbde9a2fd70061295676778e2924bfe023fff11a2ffc600fd327b93f8ee0ff0b22581a55daf927243553b91696954a78cb1c6a79a6933f03c072763286f08e47870076fa449e039cea55a41ed607c834c8846cfa28bd4be16f4c5066b3446906facbc3e9aefc": "000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000f90da311280edf11140ea111d20d1611d20dfc10420e9411040f8712c60f5913751001147e111815fd12de169614b4180b16221a3817391b32181f1c3919f51c291ab21dbc1a171ec51aec1d3d1a3d1da7197a1c4c19fb1b9718661b6c17701a9316a01961166b199416a919e8160f1a3d17861abb17261b6518df1ba818351c2d18fa1b5e17691b8a168d1aba15a719f91403192714491841135c1778128b169811b315be10fd148510ee14a21017158e101d15ae106b15fc10b215ef106f15b310fd149610b414c010a4145911f01407126a158d12ec153c13a316fe1366175f14c91727147c177c13af16cf12fb1526126f153d1189148110921363102713",
+	"2000000408130809b5f91bffe20058130809cbf9380006006bff109c0f63c94a58910205b809e01e910ff64d4a7f3fae8d08968a32db2744458c88a8109151c209ed086c93dbed04320c10c1a1f0acb364e39b7ca47250d93d0b4f83f05be9959f68cba66a61ba84c5661b8d241c9b2212cf6cf9fd2bc6b78ccf6b78f2270f2f047bf12254055146a60aeb0832a7ccd0931b699aa2179bc2162476091536872f0ddfdb74087c124c05493bd5cd70cc21f1ad7656598fc51a1217a1a107622502d23da3a32c3cce73a957c3576477e6f9dda501db7c4e0f85c86ff4fa5314642112cf239b6eb0688bc084216692ed26376a5017b6aa9829dfecae1ee8b8325f8671c293288330b2c8636ae209e708336bef50594a61b9b139b619e4b9f9e66b096c6a9b2309472d4cc0a18911d1f8e1f102cf94bbbe67f936e4e8cb23dd620ce09a6ad8dcd4c2829bbdc1e760e135782f31138f96f45f927fc66df57cd6b131a4c0d0901521d7e4c9b878689d340cd4127d10ee234f9f6be1b042a0cd4f899ce8d89f12a0f030cc76d811310a8a18a6cf062ca6ce6418f605ff0299911361a3e5c17934ba805935f9ab9cee2711634d4d2362b64216017371ab2a18d8a826404bc0ff2acfb5e13bede70b9fddb568a0d1a86a071877cd8978949b2ac5f24d5983e3324b09a570ae0003e824aca7be1ee3dce88f92d904a2a339954a8b2265d5a3fc180ed8411522377b1713348c71d45067e493d1a0ce83cf1c924b336f15897912969a23159cc3e1f256b61550b4a563814e9e904b2691e9f700a30472cef19d61aa3969fea612f0c0489adc0bebb999eba175a9ac8cc39c8c773f0b2c158039d358f235a2651694e1b6969091c145646af29411d6efad24902a169c6a84066ef942fb93bcca3cad7eb95d03aab5711432f44a66d9182c3e4e56d15e38342320e26bf22129d6cc4056cef425920a9215531228a985365edd5a317d1a4cc5be060e77685707075f2545889fcdc16c126444cdb01a5ca2616410227c7c2478436434fc6605dbc2e6fe5cd766cb5a1645a13a2190e9d7b05dc0": "9c103613d9106b131511a3136711be13bf11c613be11cb136811a11316112213a5105d12c20f5311c10e34106e0e910fea0e9c0f5f0fd70f690ffa0f7f0f1a10990f14103e0fcc0f770e5b0fab0ddb0e410d980ef70c870e2f0c270e4e0baa0d030ba00dfd0ae50deb0a300eef0a870e070bdd0e0b0b300fa40a270f8409350e1108bf0ce006990b2306ed0aea05bd0a1706f90a5c06490b86069a0ba606e90bef06170c3407590c4307d50cca079c0d2b09c70e5e0ae20fdc0a9210880b43117f0ce4110b0d1f123c0d3912480d0612c40cf7107e0b460fc809430dfe07e10a280645080704aa05d3012003fbff9d0060fe23fecbfcfdfb2bfb13fa90f9eff770f8f8f5e7f7dcf470f726f412f73df31cf76bf22ff7e6f1e3f62bf155f6edefb0f57feedaf40eedd5f383ebd5f2dde989f1eee7c4efdee571ee5de4bfed2ae396ec79e1d3ea83df6ae9d4ddd7e8abdcace807dc04e839db24e713da30e793d99ee7bdd93fe787d985e6e6d81ce65dd8b6e5d6d705e53dd72de4aad689e302d620e363d5bae223d58be232d5d3e261d527e38fd509e37bd5ace246d5a1e260d5dce2aad5f0e2e9d5e5e235d6dce272d6e6e2b6d63be345d78be3bfd79be302d800e4bcd8d0e4e5d981e5d2dae3e553dbcae575db6ce566db8fe59adb0fe614dc35e669dc05e685dce0e59ddcffe5eadc3be676dd2ee6ffdd26e691debde693dfb9e705e188e869e2e9e85ee3e8e8c7e3e7e8f9e308e96ae4e6e8e2e497e811e5b3e86de53ce95be6d7e994e772eab5e8edea85e91eeb10ea2aeb9cea36eb2eeb45eba7eb4deb0dec55eb91ec8deb5cedfaeb46ee5bec0def97ecc5efbcec7af0dbec19f103edaff1e5ec0cf238ecdaf151eb4af18fead0f0ffe9abf0cce9e0f028ea77f1e5ea75f280eb8af3c7eb31f40dec6ef44dec9ef44fece5f476ec50f5e1ecd4f511ed18f6eeecfef5f8ec2df6abed45f716eff9f8c7f0b9fa76f296fc34f4affedbf59d0004f7d40193f750020cf8ce020cf9e70382fa4b0501fc9e065efdde079dfe0d09fcff3f0a8701750bc702760cac033d0d9e04f80d9705b30e5f064b0fe606a30f48070410c2079e10720840116c0918128d0a3c13540b0c14a30b4414e10b49141c0c3f14030c0114640b5f138a0a6b121c0ab7110d0a7011bf0924114509a1100d091d10f708cf0fbb089d0f61083b0f3808e70e5608020f7108420f8a085f0fd0087b0f0e09860f41098d0fb809d00f610a2a10f00a50106c0b5d100e0c8d10e30cd510940dfb10d10ddd10d20d8610eb0d0710ea0d720f930dda0e230d300ee60c750deb0c0b0d350d2c0d980d680d0a0e880dda0e090e05100d0f4a112110b21231112414611265158613aa168d140d189015611995169e1a9517b21b7b18711c1c19e21c6f19e01c7819401c1e193e1b4b18171a4117e3186616d317cb15f4165b153f163515f7158d15141659161b163717fd15d917d61553187315b318ed14e6186514ee188713aa185212f71707110917800f0316e30def14a80c0d14d80b9013410b7313ca0a8e13620a9813130a8813af096e130f0924139508d7127408d9126a080213a3085e13560916140a0ab514440ae014150ab114d409311499096d13d00839120a073e100205dc0d4e03850b6601fd0839ff7806a2fd9b04d8fc5b0362fc7a02fafbd7017afb0801d9fae5ff09fab8fef6f87afd02f829fc91f72cfb42f787fac3f6cef93cf6daf8b0f5caf72df5d8f6e7f43bf6a7f4aaf530f4daf4c5f319f46df37bf3d7f2a0f229f2b5f1cbf12df1e5f11ff19bf2aaf1cef3c3f2d0f4d1f33ff558f42ef53cf4a0f49af302f401f3c9f3e2f26cf39df282f2bdf1eaf136f134f291f1a7f2ebf1a5f2def172f2d4f19af2dbf153f331f258f422f33cf51ff40cf6d1f401f794f50af881f63df9b7f7dbfa5ef99ffc01fb09fe3efc22ff40fd23001dfee800a2feec006cfefcff53fd",
+	"200000040013080981f8c1ff80000013080981f8c1ff800000ff80afbfe02bfc": "00000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000",
+	"2000000408130809a5f8ebfff2006c130809cff8fdffc20045ff0d0f5220b3f196c076b075e98899b92025f2ba5dbb3ddcf717f9c00cffc367fc7fcea6ba7196155a86afa4b3b2041fa26a737163f960d9102a88339a97e234875ea0ebdd84a2be58f02a4e714f689919e56e4fdb63852ccbe9eb94f8da79b6c2ee934b7b5d28c3f21a826baa2eb42129b7bc9be820675098578b19f3c23bfd8a19127c16eb865b00d6418a23d49bb532ab42a5415b9256a92ecba1a54423b4202aa62fe4d478fa313daef2f927cd0617b22598f94a6c9cc9dafef170e300db78f0edbd1f56e201a30b0198ac61a54a03768cee80003eec25770cfaf34d7e742677da3b25e601037aca4638c9a382a4cda30cc16b9e3f0c032de10ca6d34ac3965f782d39b273a973d7645e3895b30d1b91b85394d1dd14e3724835baf17befcfa62675bb252b4978e539b035daeab9cca237c8d8d542f9d55e17a5ef88ad42f8baa82e0af37e8e2c3b4c792ed4749a152aa7791d2ebf3f22e81a9971599d5f027a6250277659c2409dee046876a0bf09ebaa4ad6fd3010c3b4d7a20ec86716b7518d56cada699a3f9c234fb3461130acf9d108e0abc01969e2520dd0e062182d1cd6ee9bfd28e7bb8c7a06f07a2b2dcf267cd9f6bf8ac1fcce5dc36679073c3b8ba64401ad3d05e6c55a24c11e7a135e6ff844b3111d33377f5a06cc472e26a63719a844b0f02a9644915437a308413b0c0d9d3be54777741b32255b2f0cff52a47359102e9be08ad32c6760dbe990ce39df5fab370cd19997eaacc38885ff00627fc032dff0098771e8dea4e53565a72db09537d290274ff7ddc1e555d1fba6c3e3b078ce27a2e3bca604321cc99a66ddc7b0c82e7a9f9a415557e1c370068153adf9e98d072e23e4546e2298c885f4572f963d5dc82441153369c26c022440679154d78bebab5dea6fb39d48fca42897392c44d67d9d6e8a139c8bebe2bcb9ee8863c4d028f8547b3539362c6059d5deeff05983c8b172710fad9256e0311bc4ef8fb76c772c6a9394cc330a9c5a801379d283f5db10f56eee0e9f2d10e0cb7b8374c164b51b2c81d3a382e0e605405531387908d3704e0a4a06c54bd870453a365b363c1ddc65307303225800a83cb28c93bd690e05bc86ed170bb5fc1e23f34115c3d1110a92fa97b53aa69a763d681f6d0eb2cb4c81b848d516eab7743990c14e4a66a69eade72c95bc959ad380b0c7e81420ad51d8388b1b2fac6fb7e5d337fdecef403abb035c43319b7527a99c73a9f5860e362e7612a4a7266a9f8fab849f1d46e873fdbb7dc04f5f41dbe22b94e0b080b3fb1073ab0d28e0": "0f0dad0c9f0e720d890ec40c730b3409b408e60563094006c40cba09950fb90ca612f90f5817fc14e51aad18431ecf1b20215f1ea81d981a111672129f0b4a07090125fcf500edfb940ade052c11e10c2f13220f0c13370fde12240fc914c0104f17cf12a618d313ac13b00e730d8908f30c4208e710660cdd14db1054174b14ea19a1170e1a021806193717b4193618611afe182919bd171718a116d3178216d315eb142d137f1255148a130b18641751180218ed1476148b10970f3a0d100c840a68091c08270732066c05aa00dfffccfbd3fa82fc72fba5fe92fd2c022e01c60825086e0f3a0f9a1379135b16ed15391670152115371406141013be0e630d23062a0463fd1ffb61f703f5d2f619f43cfb40f8b9fe08fc510036fea303dd017608a506370841066d028b004bfc94fa10f64ff40ff439f2b3f51bf46cf84bf764fd8dfcfb003e005800c3ff6c000800e8006a00e9fe1efe8bfeaafd9bfcd8fbccf6fdf5dcf3faf2cdf523f541f623f652f7dbf702f8faf80bf50cf6e8f5e2f666f891f957f9abfa5ff9b9fa91f9fefac0f931fb23f871f97bf8d7f9f9f7b2f9f1f50af8a6f5e4f729f44df652f352f55ef469f66bf571f7b7f454f670f49df55ff97cfa7dfd9bfef9ffc000b304f004be059b055303ec0299fe98fd40f73df5caf3f8f0c3f5bef2ebfadff7d6fc8af919fa7af6bff9daf520fd12f97e0495007d08c604920283fe4dfc6ff7c0fc3af7140024fae80175fb7d006df9c6ff2af8cf02d5fa58065bfeb207f3fff30523fe7c033cfbe80267fa2f03abfaaafecaf5d4f50eecddee43e446ee99e35af344e951f4b9eafaf192e8d2f6f6edf90013f9e50497fd470217fb6e018dfa4d0405fe710795017d06a1000001d5fa0cfcbff533fb63f599fd93f8d5ff34fb85fab3f50af1a6ebc9ece2e62eec2fe6cbecf1e6c4f228edbdfcd5f7ed00fafcd1fe3ffb27fd83f9b3fb47f8aaf8a1f533f951f6a8faacf713f7b4f329f553f14ff880f4b5fe6cfb3a057002ff088206e00982076a05f402f5fc4cfaa8f4c3f17ff256efeaf6b2f3f3f8f0f592f6b5f3d2f5fff226fa71f75efeb7fbc30102ff7c05a5029903ae00dffcbaf994f42cf100ef93ebcdefa7ecfcf01deeabf2c6ef2cf723f42af748f487f6fcf3abf943f7ccf960f754f622f4f0f642f5fdfdd7fc1d0057ff2cfaa5f97af714f797fa36fa56fc03fc2ffafcf968f45df4e8ee20ef3decc1ecc0ea6beb72ec43ed88f1baf29cf628f855f4eaf5faef74f1c8f160f326f526f729f796f92bf4b8f65ff3f7f5c1faa8fd8bfb80fe5ff492f62cf476f5cbfbbffcef03d404e3089609c50a2e0bdb08e3081b00bdff76f8e3f711f959f866f94af8a2f3edf187ef4aed42f4d1f1e2fb85f93c01d8fe01088305830f530d8b13d31131105e0eab053b032afe37fbb5028aff220d050a5a0f830cca0b0309f40de30a2811fb0dc80efd0b1908c40583fe49fcf1f48ef2d7f069eee0f3aaf174f77df51cfc5efabb028c018f082c08890e880e04100210060b560b52075d08c70c8e0ec2113f14b90ac90d220046034cff3e0225023005effc670072fa49feaafba2fffbf7defbadf780fb4afa42fef9f82cfddaf95efe8e00a6056c05ff0a010159062af9b8fd05f4e2f75df018f4d2f40ff979fa5effb9f8b3fdf5f7a7fca8f66bfba9f3b3f8dff5ddfab8fd9002fb030b090006740b9d030c09ebfab6ff70f7a6fb8000fc04900ad40f410cca117605b90af0fa08007df4a9f9d4f52bfba6fa2e006ffb0e014ef9f6fec9f99aff65f943ffa6f739fd57f7aafc2dfb99009b003c0647ff080546ff1a058604550aec05b20b43042d0a10034e092601d907080125082307510e350f341640124619c00fe216950a51111c060d0c6006c40b0606310bcb00b305b4ff4104db0237072f02a7062202db06f10ab20f6413bf170711c614cb0bfc0ebc0a790d0209660b0d063a08",
+	"2000000406130807f3f9c202f7ffbe1308081df9ee0355feb7ff0a647117737554020a63d0147876131bd42387d56045d2070313d2c7c2d4546d2ec2582520b4300ad3764b514775cef153657902b64d3a48d14e40b798e449a1a035cce57f59db5f86a7063c615e30f1110a2884dc45f979c18609635e5df455f20386f8840741321189178ad60e04af15262f52404d3c930de18b855f7f4e84fbe33fa3ecb149df181266ca0407baeb4bd912f3e842c6bc72be7c39d4a049dab1e69d6fdace65e3cf0e63e749c2f912c74dd0fe5ee22ecc99f0280e5d8294d17d938d85e3cd791c9de2833ba67a3ec34234ab34d442e35d92488eaaccf67c0742836239d653ce25b0fd1fb4d665b55b7f95da56b4b6151d3020011c53f1026c1d8c106757b14f9da6603e4fda7a675b0f2b231a768301056258c97a5181aa448d20d5b4df85221775bae34eac9678bfcdbc408ccc30b0ea4aacc0a05bb76a801a327e528c69e28a675743fc99c0bbf9679fd21ecefa3aa06d129f8ea6dcc18a73082ab7e3795f07847e535bc05d64ffba0b18502deb34dec8dd3bc4c5441cf6f81949c151e6e0a8d0a2ef7c42fbffd752146da55559a8e76b71ca5b4bc5abe5fe0566f228c342c9785276a91416ba945dc36252dab0c3177fc8ac214c088150c61281a13000080a81b1440f0485c0c312884c3056120261b552c39191f1f3f2522417b120961648c5bda41d16ccdbc4b97b826e11c346cbc23b34143c3a31671fb99464b48997918c962c877b9e2eceaaafbb94b3c66f393b54d3ee21115fc8a285c55acd6000d75b8dc5ebf96d3c8526ee520d5df2964624260e2dd4a58b10a22e87110ae9b4133838cdab15d2641aa0251cea2e20a7910e55f9ccadda49f4130460d258e82da0e63007b74eb20187ec512f9ab059245f6911abe81e87b9dd628d989937fe7c78afabd4c2a99dc923ae89c5399a85bd19282c0c8c445a1cfca143371834aef43a3c9e0e313ad1e893258e153f00c48db9205cbb77469e57c1a8cb69100b510a7f0a5330ae0a658212ab4fc9fbc563e31bd1a68c9088730554c53ad743bc382482107715616939237f08cad8599a5e439b9f9527539889cc609cc2dd95280e6005b2460db7c0af4a861f":                                                                                                                                                                                                                                                                                         "b80169245103d9254405c4271a07902926086b2ab608b82a9808632a8208362a5209f02afb097d2b0c0a882b180a872ba60ad82b290b182ce30aa12b4a0bd42b220c742c820b852b480ad52976098b28e3089b27a4072c267105d2238f04b222350559231b05b723c504db238905c6243906822509066b255d05d42414057a248805c82420055924fc031b2386034422c2022f215601991fd600bf1e8001ce1ed4018e1e17015e1db900791c3301321c8a00d71a4aff2b1959ffbf189bff611891feda166dfd3f15fdfc0514e4fbe01149fa4f0f7ef9c60d2ffaa20d04fc5e0e13fe730f8c003611d4039d130307a6156609f016860b0e18410eb8191911751b2a127e1b5f12bf1a8213d21aa214cc1ade14101aee145519f2158419b2167219e815e91717155f161d15bf15da13ff130e10dd0fe10b5f0b900997080c088c06d204d3025701abfec1ff27fcd6fe35fa54fd9ef7b6fb07f5e5fa9ff3d4fa3bf32afb54f31ffb37f354fab2f2d7f9d7f291f949f331f882f26ef66cf187f44ef096f1f6ed6fee5eebf0eab6e807e7d0e5dfe39de340e2ffe261e16fe30ee0afe34ddf48e40de00de603e121e84be09de838df65e819dfc9e87cde83e8ceddf2e71adefce7f3dd50e778dd4fe692ded8e6e6e04de88ae3f6e95be517ebe9e603ec36ea60ee56ed78f0eded43f034eee3efd2efabf0e0efadef67ed4aec54eb5ae9a4eb74e8cbeb49e757e9c7e301e87be100ea81e2c9eb71e383eb90e2f8eab2e12ceaafe0b0e80adfe3e72ede75e794dd11e6e3db8de440da39e4bed9e4e4d5d95ae5a4d90ae4f3d720e4ead7fde6a5dae8e843dc1aea3bdddfeae7dd19ebe5ddd9eb7dde6bec21df28eccfdedaea66ddb7e877db5fe780dad8e631da2be57fd8aae207d605e1a1d4fde0a6d474e1ddd4cce12fd575e205d64be3cdd664e4b8d735e590d8e9e56fd9e6e66adaa1e7dadaede7d2daede871db12ebd8dc84ed58deb1efbbdf0bf256e15df5d0e310f8bde5c9f9e2e6aafb42e8a7fd98e98dffbceaf50087eba702a9ec3a0580ee3407c3ef250816f08609bef04a0ac4f0ee09d8efc40939ef800a72efc80b34f0c00bcdef100cf2efbb0d68f1c20e31f2f00e75f2df0ec4f2ce0e03f36a0ee2f20f0ee1f25d0d76f2450b6ef08209d4ee1609f6eeec0778ee880696ed90055ded6c0475ed7103bfedcf0113ed8600d6ec26ffe5ec49fc65eb0cfb1eeb12fc2fed82fb14eea3f98eedf9f8dced69f95befe7f94af1f8f8d1f1c4f7c3f136f749f287f6c7f25cf687f3a2f67df4ddf694f553f7e9f693f89ef8f8f937fa9dfb30fc57fd48fee9fdeafebcfd7cfebffd40fe1cfe63fe9cfd62fd07fc00fb7afb82f9a3fda8fa1bff19fb93fd8ff8f0fde3f7500138fa150408fc21063cfd220858fe220a47ff930cb000de0d3a019b0e6201820fb401a90f6a010611a1029c121f046b13c604cd1434061a15d5066d148a06c9143407dc15a008df162e0af015dd093014b008df14260acd14270b4c12ae0910104c086e108a090d11340b2d0e4d098c0d48093c10910cbe0f140deb0d330c260f0e0ef11197112212b812b90f2411740f8c11df108913fa0f2e13290ebe11950d1f11090f78125210ec13cf0e7812a30d2311c80d5611020dc9102b0cf30f9b0c27102f0d6c10350c210fec0a780dc80ccc0e7a0fee104e0f3b106f0fcf0f17120d126a150d1517172916f5175316b91a9418141e8e1b2920481dd922911f7d26b42277284324d2284824db29e524ca2b7326212b672549290023f629412366296622a826401f48248e1c8422b01acd200919981d19168a1a521341196412b5168d101a13c20d2311a00c750ff80be50c840a3c0a2509000964098c083c0ae605e40883021b076801990792004508cafdfd063cfbcc0581fa6506e1f9090786f7bf051ff5650491f3df03eef02802f3ed33009febd8fe89e965fd82e7d2fb02e6acfa",
+	"2000000400130802b3fed601dfff7613080313fe700295ff33c1100a207371686b25b7e82846ca4868a5409c0b626da236342a4340360d0703d43202aa760500e206349351a06c13008c8ddc867a21d212460c40ec6c750114d302051412008686982623342318c880b60cd527b3408f8a284810d4d5866c700064e61bb20c5d66a849c29024da6fb65a598ecf0934a9b490e88c40c183265873f0d89aa04c6249890899b22c2ac92a074401b189a056608c233cb8e4dd0032d14d260c42436e0086664934da4d02617812a0097923249d3484db02010d95592061933abc8315e69031360926a8688c6023818789cda18c14378e": "fefffefffeffffffffff000000000000fffffffffeff0000ffffffff0000ffff0000ffffffff0000010000000100000001000000ffff0000fffffeff0000ffffffff000000000100ffff0100ffffffff0000feff000000000100ffff0000fdff0000000000000100ffff00000000fffffffffeff0000feff0100ffff0300000000000100ffff00000000fdfffeffffffffff0000fefffefffffffeff0100ffff00000000010000000000fffffeff0000ffff00000100ffffffffffffffff0000020000000000ffff0100ffff01000000000000000000ffff01000000ffff0000ffffffff0000fffffdfffdfffffffdff00000100feff00000000ffff0100010000000000fffffeffffff0000fdffffffffff000001000100ffff00000000ffffffff0100feff0100feff010000000100ffff0000feffffff0000ffffffff0100ffff01000000ffffffffffff000000000100ffff0000ffff0000ffff0100ffff000000000000000000000000feff0100ffff000000000000ffff00000100010002000100000000000100ffff0100fffffeffffffffff00000000fffffffffeff0100feff0200000001000000feffffffffff000000000200000001000200feff0100ffff000000000100ffff0200000000000100ffff000000000100000001000100ffff010001000100010000000000ffff0100ffff01000100ffff0000fffffdff0100ffff0100ffff0000ffff0000000000000000ffff0000ffff0000000000000100ffff000000000000000000000000ffff0000ffff0000000000000100ffff0000ffff020000000200010000000000ffffffff00000000feff0000fdff01000000ffff0100fdff0100feff0100ffff000000000000ffff010000000200feff0100fdfffefffffffeff0000000001000200ffff0200feff0000fefffffffeff0100feff0100feff00000100010000000100ffffffffffff0000feff0000fffffeff0000ffff00000100fdff0100feff01000000ffff0000ffff00000000000000000100ffffffffffffffffffff00000000ffff0000ffff00000100000001000100ffff00000000ffff0000ffff000000000000fffffeff0000ffff01000000ffff0100feff010000000200ffff0100feff0000fffffffffefffeffffffffff00000000ffff0000feffffff0100ffff01000000ffffffffffffffffffff00000100ffff01000000000000000000ffff0000feff00000000ffff0000fffffeffffffffff0100000000000000feffffffffffffff0100fefffffffefffeff0000feffffffffffffff0100ffff01000000fffffffffefffffffffffefffefffeffffffffff0100ffff0100ffff0000ffff0000ffff0000fefffeffffffffff00000000fffffffffffffeffffffffffffffffff0000ffff0000000000000100ffff0000fefffffffefffffffffffefffefffefffeff00000000ffff0000fdff0000fefffffffffffffffeff0000feff0000fffffffffffffffffffffffffffffcff0000fdff00000000fefffffffeff0000000000000000fefffdfffefffdfffffffeffffff0000fefffffffefffefffeffffffffff0000fefffffffdfffefffefffeffffff0000feff0100fdfffffffefffefffefffffffeffffffffff0000ffff0000fffffeffffffffff00000100feff0000fefffffffffffffffffffefffffffeffffff0000ffffffffffff00000000000000000000fefffffffffffffffefffefffeffffff00000000ffff0000feff0000ffff000000000000fefffffffffffffffefffefffefffeffffffffffffffffff0000000000000000fffffffffefffffffdff0100fdff0100ffffffff0000fffffefffeff0000ffff00000100fefffffffefffeff00000000feff0000feff000001000000fffffffffefffffffffffffffefffefffdffffffffffffff0000fefffeffffffffff010000000000",
+}
+
+// testFrame returns the frame from testFrames which starts with prefix.
+func testFrame(prefix string) []byte {
+	for enc := range testFrames {
+		if strings.HasPrefix(enc, prefix) {
+			return mustHex(enc)
+		}
+	}
+	panic("no such test frame")
+}
+
+// bitWriter writes big endian bitstreams, for building test frames.
+type bitWriter struct {
+	buf  []byte
+	nbit int
+}
+
+func (w *bitWriter) write(v uint32, bits int) {
+	for i := bits - 1; i >= 0; i-- {
+		if w.nbit%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if v>>uint(i)&1 != 0 {
+			w.buf[len(w.buf)-1] |= 0x80 >> uint(w.nbit%8)
+		}
+		w.nbit++
+	}
+}
+
+// verbatimFrame builds an uncompressed frame with an explicit sample count.
+// Channels holds the samples for one (SCE) or two (CPE) channels.
+func verbatimFrame(sampleSize int, samples int, channels [][]int32) []byte {
+	return escapeFrame(sampleSize, true, samples, channels)
+}
+
+// escapeFrame builds an uncompressed frame, optionally without a sample
+// count.
+func escapeFrame(sampleSize int, hasSize bool, samples int, channels [][]int32) []byte {
+	w := &bitWriter{}
+	w.write(uint32(len(channels)-1), 3) // element: SCE or CPE
+	w.write(0, 4)                       // element instance
+	w.write(0, 12)                      // unused
+	if hasSize {
+		w.write(1, 1)
+	} else {
+		w.write(0, 1)
+	}
+	w.write(0, 2) // uncompressed bytes
+	w.write(1, 1) // not compressed
+	if hasSize {
+		w.write(uint32(samples), 32)
+	}
+	for i := 0; i < samples; i++ {
+		for _, ch := range channels {
+			w.write(uint32(ch[i]), sampleSize)
+		}
+	}
+	w.write(7, 3) // END
+	return w.buf
+}
+
+// compressedFrame builds a compressed 16 bit frame with an explicit sample
+// count. Every residual is stored as a rice escape, which is valid for any
+// k, as long as the residuals are big enough to keep the decoder out of
+// its zero run mode.
+func compressedFrame(coefs []int16, residuals [][]int32) []byte {
+	samples := len(residuals[0])
+	w := &bitWriter{}
+	w.write(uint32(len(residuals)-1), 3) // element: SCE or CPE
+	w.write(0, 4)                        // element instance
+	w.write(0, 12)                       // unused
+	w.write(1, 1)                        // has size
+	w.write(0, 2)                        // uncompressed bytes
+	w.write(0, 1)                        // compressed
+	w.write(uint32(samples), 32)
+	readSampleSize := 16
+	if len(residuals) == 2 {
+		w.write(2, 8) // mix bits
+		w.write(1, 8) // mix res
+		readSampleSize++
+	}
+	for range residuals {
+		w.write(0, 4) // prediction type
+		w.write(9, 4) // quantization
+		w.write(4, 3) // rice modifier
+		w.write(uint32(len(coefs)), 5)
+		for _, c := range coefs {
+			w.write(uint32(uint16(c)), 16)
+		}
+	}
+	for _, ch := range residuals {
+		for _, r := range ch {
+			z := uint32(2 * r)
+			if r < 0 {
+				z = uint32(-2*r - 1)
+			}
+			w.write(0x1ff, 9) // escape
+			w.write(z, readSampleSize)
+		}
+	}
+	w.write(7, 3) // END
+	return w.buf
+}
+
+// silentFrame builds a compressed 16 bit frame of digital silence: one 0
+// residual per channel, followed by a run of zeros for the rest.
+func silentFrame(coefs []int16, channels, samples int) []byte {
+	w := &bitWriter{}
+	w.write(uint32(channels-1), 3) // element: SCE or CPE
+	w.write(0, 4)                  // element instance
+	w.write(0, 12)                 // unused
+	w.write(1, 1)                  // has size
+	w.write(0, 2)                  // uncompressed bytes
+	w.write(0, 1)                  // compressed
+	w.write(uint32(samples), 32)
+	w.write(2, 8) // mix bits, also there for SCE
+	w.write(1, 8) // mix res
+	readSampleSize := 16
+	if channels == 2 {
+		readSampleSize++
+	}
+	for range channels {
+		w.write(0, 4) // prediction type
+		w.write(9, 4) // quantization
+		w.write(4, 3) // rice modifier
+		w.write(uint32(len(coefs)), 5)
+		for _, c := range coefs {
+			w.write(uint32(uint16(c)), 16)
+		}
+	}
+	for range channels {
+		w.write(0x1ff, 9) // escape
+		w.write(0, readSampleSize)
+		w.write(0x1ff, 9) // escape, for the zero run length
+		w.write(uint32(samples-1), 16)
+	}
+	w.write(7, 3) // END
+	return w.buf
+}
+
+// noise returns n pseudo random residuals with 1000 <= |r| < 31000.
+func noise(n int, seed int32) []int32 {
+	r := make([]int32, n)
+	for i := range r {
+		seed = seed*1103515245 + 12345
+		v := 1000 + (seed>>8)&0x7fff%30000
+		if seed&1 != 0 {
+			v = -v
+		}
+		r[i] = v
+	}
+	return r
+}
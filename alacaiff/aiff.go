@@ -0,0 +1,163 @@
+// Package alacaiff writes decoded ALAC to AIFF files.
+//
+//	dec, err := alac.NewWithConfig(cfg, alac.WithBigEndian())
+//	...
+//	w, err := alacaiff.NewWriter(f, cfg)
+//	for _, frame := range frames {
+//		pcm, err := dec.DecodeFrame(frame)
+//		...
+//		w.Write(pcm)
+//	}
+//	err = w.Close()
+package alacaiff
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+
+	"github.com/alicebob/alac"
+)
+
+// ErrTooLarge is returned by Write when the PCM doesn't fit in the 4GB an
+// AIFF file can hold.
+var ErrTooLarge = errors.New("alacaiff: too much PCM for an AIFF file")
+
+// Writer writes big endian PCM, as returned by a decoder WithBigEndian, to
+// an AIFF file.
+type Writer struct {
+	w          io.Writer
+	header     []byte
+	blockAlign int
+	data       int64 // bytes of PCM written
+	err        error
+}
+
+// offsets in the header
+const (
+	offFormSize   = 4
+	offFrames     = 12 + 8 + 2
+	offSoundSize  = 12 + 8 + 18 + 4
+	soundChunkLen = 8 // offset and block size before the PCM
+)
+
+// NewWriter writes an AIFF header for PCM of the format of cfg to w, and
+// returns a Writer for the PCM. SampleSize can be 16, 24 (packed), or 32,
+// for decoders WithPacking(MSB32).
+//
+// The header has the sizes of the file and the number of sample frames, so
+// Close updates it if w is an io.WriteSeeker. Otherwise, such as for pipes,
+// they are left at the maximum.
+func NewWriter(w io.Writer, cfg alac.Config) (*Writer, error) {
+	if cfg.SampleRate <= 0 {
+		return nil, fmt.Errorf("%w: sample rate %d", alac.ErrInvalidConfig, cfg.SampleRate)
+	}
+	if cfg.SampleSize != 16 && cfg.SampleSize != 24 && cfg.SampleSize != 32 {
+		return nil, fmt.Errorf("%w: %d bit samples", alac.ErrUnsupportedBitDepth, cfg.SampleSize)
+	}
+	if cfg.NumChannels < 1 || cfg.NumChannels > 8 {
+		return nil, fmt.Errorf("%w: %d channels", alac.ErrInvalidConfig, cfg.NumChannels)
+	}
+
+	wr := &Writer{
+		w:          w,
+		header:     header(cfg),
+		blockAlign: cfg.SampleSize / 8 * cfg.NumChannels,
+	}
+	wr.setSizes(math.MaxUint32, math.MaxUint32)
+	if _, err := w.Write(wr.header); err != nil {
+		return nil, err
+	}
+	return wr, nil
+}
+
+// header returns the FORM, COMM, and SSND chunk headers, with zero sizes.
+func header(cfg alac.Config) []byte {
+	h := make([]byte, 0, 12+8+18+8+soundChunkLen)
+	h = append(h, "FORM\x00\x00\x00\x00AIFF"...)
+	h = append(h, "COMM"...)
+	h = binary.BigEndian.AppendUint32(h, 18)
+	h = binary.BigEndian.AppendUint16(h, uint16(cfg.NumChannels))
+	h = binary.BigEndian.AppendUint32(h, 0) // sample frames
+	h = binary.BigEndian.AppendUint16(h, uint16(cfg.SampleSize))
+	h = appendExtended(h, uint64(cfg.SampleRate))
+	h = append(h, "SSND\x00\x00\x00\x00"...)
+	h = binary.BigEndian.AppendUint32(h, 0) // offset
+	h = binary.BigEndian.AppendUint32(h, 0) // block size
+	return h
+}
+
+// appendExtended appends v as the 80 bit IEEE 754 extended float AIFF uses
+// for the sample rate. v must be > 0.
+func appendExtended(b []byte, v uint64) []byte {
+	e := bits.Len64(v) - 1
+	b = binary.BigEndian.AppendUint16(b, uint16(16383+e))
+	return binary.BigEndian.AppendUint64(b, v<<(63-e))
+}
+
+// setSizes sets the SSND size and the number of sample frames, and the
+// FORM size which follows from them.
+func (w *Writer) setSizes(data, frames uint32) {
+	form, sound := data, data
+	if data != math.MaxUint32 {
+		sound = soundChunkLen + data
+		form = uint32(len(w.header)) - 8 + data + data&1
+	}
+	binary.BigEndian.PutUint32(w.header[offFormSize:], form)
+	binary.BigEndian.PutUint32(w.header[offFrames:], frames)
+	binary.BigEndian.PutUint32(w.header[offSoundSize:], sound)
+}
+
+// maxData is the most PCM which fits, with the header and the padding byte,
+// in the 32 bit FORM size.
+func (w *Writer) maxData() int64 {
+	return math.MaxUint32 - int64(len(w.header)) + 8 - 1
+}
+
+// Write writes PCM. It fails with ErrTooLarge once the file would go over
+// the 4GB limit of AIFF.
+func (w *Writer) Write(pcm []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.data+int64(len(pcm)) > w.maxData() {
+		return 0, ErrTooLarge
+	}
+	n, err := w.w.Write(pcm)
+	w.data += int64(n)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
+
+// Close adds the padding byte AIFF needs after an odd amount of PCM, and
+// updates the header if the underlying writer is an io.WriteSeeker. It
+// doesn't close the underlying writer.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	w.err = errors.New("alacaiff: writer is closed")
+	if w.data&1 != 0 {
+		if _, err := w.w.Write([]byte{0}); err != nil {
+			return err
+		}
+	}
+	s, ok := w.w.(io.WriteSeeker)
+	if !ok {
+		return nil
+	}
+	w.setSizes(uint32(w.data), uint32(w.data/int64(w.blockAlign)))
+	if _, err := s.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := s.Write(w.header); err != nil {
+		return err
+	}
+	_, err := s.Seek(0, io.SeekEnd)
+	return err
+}
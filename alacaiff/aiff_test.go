@@ -0,0 +1,102 @@
+package alacaiff
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/alicebob/alac"
+)
+
+func TestWriter(t *testing.T) {
+	cfg := alac.DefaultConfig()
+
+	t.Run("file", func(t *testing.T) {
+		f, err := os.Create(t.TempDir() + "/out.aiff")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		w, err := NewWriter(f, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte{1, 2, 3, 4, 5, 6, 7, 8}); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		have, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := mustHex(t, "464f524d"+"00000036"+"41494646"+ // FORM, 54 bytes, AIFF
+			"434f4d4d"+"00000012"+ // COMM, 18 bytes
+			"0002"+"00000002"+"0010"+"400eac44000000000000"+ // 2 channels, 2 frames, 16 bits, 44100 Hz
+			"53534e44"+"00000010"+"00000000"+"00000000"+ // SSND, 16 bytes, offset 0, block size 0
+			"0102030405060708")
+		if !bytes.Equal(have, want) {
+			t.Errorf("have\n%x\nwant\n%x", have, want)
+		}
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, alac.Config{SampleRate: 96000, SampleSize: 24, NumChannels: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte{1, 2, 3}); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		want := mustHex(t, "464f524d"+"ffffffff"+"41494646"+ // sizes unknown
+			"434f4d4d"+"00000012"+
+			"0001"+"ffffffff"+"0018"+"400fbb80000000000000"+ // 1 channel, 24 bits, 96000 Hz
+			"53534e44"+"ffffffff"+"00000000"+"00000000"+
+			"010203"+"00") // padding
+		if have := buf.Bytes(); !bytes.Equal(have, want) {
+			t.Errorf("have\n%x\nwant\n%x", have, want)
+		}
+		if _, err := w.Write([]byte{1}); err == nil {
+			t.Errorf("write after close worked")
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, cfg := range []alac.Config{
+			{SampleRate: 0, SampleSize: 16, NumChannels: 2},
+			{SampleRate: 44100, SampleSize: 20, NumChannels: 2},
+			{SampleRate: 44100, SampleSize: 16, NumChannels: 9},
+		} {
+			if _, err := NewWriter(&bytes.Buffer{}, cfg); err == nil {
+				t.Errorf("%+v: no error", cfg)
+			}
+		}
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		w, err := NewWriter(&bytes.Buffer{}, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.data = w.maxData() - 1
+		if _, err := w.Write(make([]byte, 2)); !errors.Is(err, ErrTooLarge) {
+			t.Errorf("have %v, want %v", err, ErrTooLarge)
+		}
+	})
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
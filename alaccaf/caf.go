@@ -0,0 +1,310 @@
+// Package alaccaf encodes PCM to ALAC in Core Audio Format files, the
+// container of Apple's reference alacconvert. CAF has 64 bit sizes, so
+// there is no limit to the length of a file.
+//
+//	w, err := alaccaf.NewWriter(f, cfg)
+//	...
+//	io.Copy(w, pcm)
+//	err = w.Close()
+//
+// or in one go:
+//
+//	err := alaccaf.Encode(f, pcm, cfg)
+//
+// or straight from a WAV file:
+//
+//	err := alaccaf.EncodeWAV(f, wav)
+package alaccaf
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+
+	"github.com/alicebob/alac"
+	"github.com/alicebob/alac/alacwav"
+)
+
+// descFrames is the offset of the frames per packet in the 'desc' chunk,
+// after the file header and the chunk header.
+const descFrames = 8 + 12 + 20
+
+// ErrClosed is returned by Write after Close.
+var ErrClosed = errors.New("alaccaf: writer is closed")
+
+// Writer encodes PCM, in the layout alac.Encoder takes, to a CAF file. The
+// file has the 'pakt' chunk with the frame sizes after the 'data' chunk
+// with the frames, when Close knows them.
+type Writer struct {
+	w         io.WriteSeeker
+	enc       *alac.Encoder
+	stream    *alac.StreamEncoder
+	start     int64 // of the file in w
+	kuki      int64 // offset of the magic cookie in the file
+	data      int64 // bytes of frames written
+	sizes     []uint32
+	durations []uint32 // samples of every frame
+	err       error
+}
+
+// NewWriter writes the start of a CAF file for PCM of the format of cfg to
+// w, and returns a Writer for the PCM, which encodes it with an
+// alac.Encoder with opts. The file starts at the current position of w.
+func NewWriter(w io.WriteSeeker, cfg alac.Config, opts ...alac.EncoderOption) (*Writer, error) {
+	enc, err := alac.NewEncoder(cfg, opts...)
+	if err != nil {
+		return nil, err
+	}
+	start, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	wr := &Writer{
+		w:     w,
+		enc:   enc,
+		start: start,
+	}
+	wr.stream = alac.NewStreamEncoder(enc, wr.writeFrame)
+	h, kuki := header(enc)
+	wr.kuki = int64(kuki)
+	if _, err := w.Write(h); err != nil {
+		return nil, err
+	}
+	return wr, nil
+}
+
+// Encode writes a CAF file of the PCM from src to w, see NewWriter.
+func Encode(w io.WriteSeeker, src io.Reader, cfg alac.Config, opts ...alac.EncoderOption) error {
+	return EncodeContext(context.Background(), w, src, cfg, opts...)
+}
+
+// EncodeContext is Encode, which stops when ctx is cancelled. ctx is
+// checked before every frame. On any error what was written of the file is
+// removed, see Writer.Abort.
+func EncodeContext(ctx context.Context, w io.WriteSeeker, src io.Reader, cfg alac.Config, opts ...alac.EncoderOption) error {
+	wr, err := NewWriter(w, cfg, opts...)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, (cfg.SampleSize+7)/8*cfg.NumChannels*cfg.FrameSize)
+	for err == nil {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		var n int
+		n, err = io.ReadFull(src, buf)
+		if n > 0 {
+			if _, werr := wr.Write(buf[:n]); werr != nil {
+				err = werr
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = wr.Close()
+			break
+		}
+	}
+	if err != nil {
+		wr.Abort()
+	}
+	return err
+}
+
+// EncodeWAV writes a CAF file of the PCM of the WAV file from src to w, in
+// the format of the WAV file. See alacwav.NewReader for the files it takes.
+func EncodeWAV(w io.WriteSeeker, src io.Reader, opts ...alac.EncoderOption) error {
+	wav, err := alacwav.NewReader(src)
+	if err != nil {
+		return err
+	}
+	return Encode(w, wav, wav.Config(), opts...)
+}
+
+// chunk appends the header of a chunk of size bytes.
+func chunk(b []byte, typ string, size int64) []byte {
+	b = append(b, typ...)
+	return binary.BigEndian.AppendUint64(b, uint64(size))
+}
+
+// header returns the file header, and the 'desc', 'chan', 'kuki', and
+// 'data' chunks up to the frames, and the offset of the magic cookie.
+func header(enc *alac.Encoder) ([]byte, int) {
+	var (
+		cfg    = enc.Config()
+		cookie = enc.MagicCookie()
+		be     = binary.BigEndian
+	)
+	b := append([]byte("caff"), 0, 1, 0, 0) // version 1, no flags
+
+	b = chunk(b, "desc", 32)
+	b = be.AppendUint64(b, math.Float64bits(float64(cfg.SampleRate)))
+	b = append(b, "alac"...)
+	b = be.AppendUint32(b, formatFlags(cfg.SampleSize))
+	b = be.AppendUint32(b, 0) // bytes per packet vary
+	b = be.AppendUint32(b, uint32(cfg.FrameSize))
+	b = be.AppendUint32(b, uint32(cfg.NumChannels))
+	b = be.AppendUint32(b, 0) // bits per channel, only for PCM
+
+	if cfg.NumChannels > 2 {
+		b = chunk(b, "chan", 12)
+		b = be.AppendUint32(b, alac.ChannelLayoutTag(cfg.NumChannels))
+		b = be.AppendUint32(b, 0) // channel bitmap
+		b = be.AppendUint32(b, 0) // channel descriptions
+	}
+
+	b = chunk(b, "kuki", int64(len(cookie)))
+	kuki := len(b)
+	b = append(b, cookie...)
+
+	b = chunk(b, "data", -1)           // until Close
+	return be.AppendUint32(b, 0), kuki // edit count
+}
+
+// formatFlags are the ALAC format flags of the 'desc' chunk: the bit depth
+// of the source.
+func formatFlags(bits int) uint32 {
+	switch bits {
+	case 16:
+		return 1
+	case 20:
+		return 2
+	case 24:
+		return 3
+	}
+	return 4
+}
+
+// Write encodes PCM. Frames are written to the file as they are complete.
+func (w *Writer) Write(pcm []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.stream.Write(pcm)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
+
+func (w *Writer) writeFrame(frame []byte) error {
+	if _, err := w.w.Write(frame); err != nil {
+		return err
+	}
+	w.data += int64(len(frame))
+	w.sizes = append(w.sizes, uint32(len(frame)))
+	w.durations = append(w.durations, uint32(w.stream.FrameSamples()))
+	return nil
+}
+
+// Close encodes the last frame, and writes the 'pakt' chunk, the size of
+// the 'data' chunk, and the magic cookie with the frame size and bit rate
+// of the frames. It doesn't close the underlying writer. The file ends at
+// the position of w after Close.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	w.err = ErrClosed
+	if err := w.stream.Flush(); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(w.pakt()); err != nil {
+		return err
+	}
+	end, err := w.w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	type patch struct {
+		offset int64
+		b      []byte
+	}
+	var (
+		cookie  = w.enc.MagicCookie()
+		size    = binary.BigEndian.AppendUint64(nil, uint64(4+w.data)) // with the edit count
+		patches = []patch{
+			{w.kuki, cookie},
+			{w.kuki + int64(len(cookie)) + 4, size},
+		}
+	)
+	if w.variable() {
+		patches = append(patches, patch{descFrames, make([]byte, 4)})
+	}
+	for _, p := range patches {
+		if _, err := w.w.Seek(w.start+p.offset, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := w.w.Write(p.b); err != nil {
+			return err
+		}
+	}
+	_, err = w.w.Seek(end, io.SeekStart)
+	return err
+}
+
+// Abort stops the writer, and removes what it wrote of the file: w is
+// truncated to the start of the file when it has a Truncate method, as an
+// *os.File has, and left at the start of the file. Write and Close fail
+// with ErrClosed after Abort.
+func (w *Writer) Abort() error {
+	w.err = ErrClosed
+	if t, ok := w.w.(interface{ Truncate(int64) error }); ok {
+		if err := t.Truncate(w.start); err != nil {
+			return err
+		}
+	}
+	_, err := w.w.Seek(w.start, io.SeekStart)
+	return err
+}
+
+// pakt returns the 'pakt' chunk: the number of frames, the gapless info
+// of the encoder, and the size of every frame.
+func (w *Writer) pakt() []byte {
+	var (
+		gapless = w.enc.Gapless()
+		be      = binary.BigEndian
+		b       []byte
+	)
+	b = be.AppendUint64(b, uint64(len(w.sizes)))
+	b = be.AppendUint64(b, uint64(gapless.Samples))
+	b = be.AppendUint32(b, uint32(gapless.Priming))
+	b = be.AppendUint32(b, uint32(gapless.Padding))
+	variable := w.variable()
+	for i, s := range w.sizes {
+		b = appendVarint(b, s)
+		if variable {
+			b = appendVarint(b, w.durations[i])
+		}
+	}
+	return append(chunk(nil, "pakt", int64(len(b))), b...)
+}
+
+// variable is whether frames other than the last are short, as encoders
+// WithMaxPacketSize or WithAdaptiveFrames make. The frames per packet of
+// the 'desc' chunk are 0 then, and the 'pakt' chunk has the samples of
+// every frame after its size.
+func (w *Writer) variable() bool {
+	frameSize := uint32(w.enc.Config().FrameSize)
+	for _, d := range w.durations[:max(len(w.durations)-1, 0)] {
+		if d != frameSize {
+			return true
+		}
+	}
+	return false
+}
+
+// appendVarint appends v in the variable length integers of CAF packet
+// tables: 7 bits per byte, most significant first, with the top bit set on
+// all bytes but the last.
+func appendVarint(b []byte, v uint32) []byte {
+	var tmp [5]byte
+	i := len(tmp) - 1
+	tmp[i] = byte(v & 0x7f)
+	for v >>= 7; v > 0; v >>= 7 {
+		i--
+		tmp[i] = byte(v&0x7f) | 0x80
+	}
+	return append(b, tmp[i:]...)
+}
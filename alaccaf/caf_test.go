@@ -0,0 +1,300 @@
+package alaccaf
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/alicebob/alac"
+	"github.com/alicebob/alac/alacwav"
+)
+
+// chunks returns the chunks of a CAF file by type.
+func chunks(t *testing.T, file []byte) map[string][]byte {
+	t.Helper()
+	if have, want := string(file[:8]), "caff\x00\x01\x00\x00"; have != want {
+		t.Fatalf("have %q, want %q", have, want)
+	}
+	cs := map[string][]byte{}
+	for b := file[8:]; len(b) > 0; {
+		size := int(binary.BigEndian.Uint64(b[4:]))
+		if size < 0 || 12+size > len(b) {
+			t.Fatalf("bad chunk size %d", size)
+		}
+		cs[string(b[:4])] = b[12 : 12+size]
+		b = b[12+size:]
+	}
+	return cs
+}
+
+// readVarint reads a packet table integer.
+func readVarint(b []byte) (int, []byte) {
+	v := 0
+	for {
+		v = v<<7 | int(b[0]&0x7f)
+		if b[0]&0x80 == 0 {
+			return v, b[1:]
+		}
+		b = b[1:]
+	}
+}
+
+func TestEncode(t *testing.T) {
+	wav, err := os.ReadFile("../testdata/samples/monte_cristo_5s.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcm := wav[bytes.Index(wav, []byte("data"))+8:]
+
+	for _, c := range []struct {
+		frameSize int
+		pcm       []byte
+		opts      []alac.EncoderOption
+	}{
+		{4096, pcm, nil},
+		{4096, pcm[:4096*4*3], nil},
+		{352, pcm[:352*4*10+4], nil},
+		{4096, nil, nil},
+		{4096, pcm, []alac.EncoderOption{alac.WithMaxPacketSize(2000)}}, // shorter frames
+	} {
+		cfg := alac.DefaultConfig()
+		cfg.FrameSize = c.frameSize
+		f, err := os.Create(t.TempDir() + "/out.caf")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := Encode(f, bytes.NewReader(c.pcm), cfg, c.opts...); err != nil {
+			t.Fatal(err)
+		}
+		file, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		cs := chunks(t, file)
+
+		desc := cs["desc"]
+		if have, want := math.Float64frombits(binary.BigEndian.Uint64(desc)), 44100.0; have != want {
+			t.Errorf("have %v, want %v", have, want)
+		}
+		if have, want := string(desc[8:12]), "alac"; have != want {
+			t.Errorf("have %q, want %q", have, want)
+		}
+		variable := c.opts != nil
+		want := []byte{0, 0, 0, 1, 0, 0, 0, 0, 0, 0, byte(c.frameSize >> 8), byte(c.frameSize), 0, 0, 0, 2, 0, 0, 0, 0}
+		if variable {
+			want[10], want[11] = 0, 0
+		}
+		if have := desc[12:]; !bytes.Equal(have, want) {
+			t.Errorf("have %x, want %x", have, want)
+		}
+
+		stream, err := alac.ParseMagicCookie(cs["kuki"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := alac.NewWithConfig(stream, alac.WithStrict())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var (
+			pakt    = cs["pakt"]
+			frames  = int(binary.BigEndian.Uint64(pakt))
+			samples = int(binary.BigEndian.Uint64(pakt[8:]))
+			sizes   = pakt[24:]
+			data    = cs["data"][4:]
+			out     []byte
+			largest int
+		)
+		if have, want := samples, len(c.pcm)/4; have != want {
+			t.Errorf("have %d samples, want %d", have, want)
+		}
+		last := 0
+		for range frames {
+			var size, duration int
+			size, sizes = readVarint(sizes)
+			if variable {
+				duration, sizes = readVarint(sizes)
+			}
+			largest = max(largest, size)
+			have, err := d.DecodeFrame(data[:size])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if variable && len(have)/4 != duration {
+				t.Errorf("have %d samples, want %d", len(have)/4, duration)
+			}
+			last = len(have) / 4
+			out = append(out, have...)
+			data = data[size:]
+		}
+		if have, want := int(binary.BigEndian.Uint32(pakt[20:])), c.frameSize-last; frames > 0 && have != want {
+			t.Errorf("have remainder %d, want %d", have, want)
+		}
+		if len(data) != 0 || len(sizes) != 0 {
+			t.Errorf("have %d bytes of frames and %d of sizes left", len(data), len(sizes))
+		}
+		if !bytes.Equal(out, c.pcm) {
+			t.Errorf("%d bytes: output differs", len(c.pcm))
+		}
+		if have, want := stream.MaxFrameBytes, largest; have != want {
+			t.Errorf("have %d, want %d", have, want)
+		}
+	}
+
+	t.Run("priming", func(t *testing.T) {
+		f, err := os.Create(t.TempDir() + "/out.caf")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := Encode(f, bytes.NewReader(pcm[:4*10000]), alac.DefaultConfig(), alac.WithPriming(2112)); err != nil {
+			t.Fatal(err)
+		}
+		file, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		pakt := chunks(t, file)["pakt"]
+		if have, want := pakt[:24], []byte{0, 0, 0, 0, 0, 0, 0, 29, 0, 0, 0, 0, 0, 0, 0x1e, 0xd0, 0, 0, 0x08, 0x40, 0, 0, 0, 0xd0}; !bytes.Equal(have, want) {
+			t.Errorf("have %x, want %x", have, want)
+		}
+	})
+
+	t.Run("channels", func(t *testing.T) {
+		f, err := os.Create(t.TempDir() + "/out.caf")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		cfg := alac.Config{SampleRate: 48000, SampleSize: 24, NumChannels: 6, FrameSize: 4096}
+		if err := Encode(f, bytes.NewReader(make([]byte, 6*3*1000)), cfg); err != nil {
+			t.Fatal(err)
+		}
+		file, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		cs := chunks(t, file)
+		if have, want := cs["chan"], binary.BigEndian.AppendUint32(nil, alac.ChannelLayoutTag(6)); !bytes.HasPrefix(have, want) {
+			t.Errorf("have %x, want %x", have, want)
+		}
+		if have, want := cs["desc"][15], byte(3); have != want {
+			t.Errorf("have %d, want %d", have, want)
+		}
+	})
+
+	t.Run("wav", func(t *testing.T) {
+		var files [2][]byte
+		for i, encode := range []func(*os.File) error{
+			func(f *os.File) error { return Encode(f, bytes.NewReader(pcm), alac.DefaultConfig()) },
+			func(f *os.File) error { return EncodeWAV(f, bytes.NewReader(wav)) },
+		} {
+			f, err := os.Create(t.TempDir() + "/out.caf")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			if err := encode(f); err != nil {
+				t.Fatal(err)
+			}
+			if files[i], err = os.ReadFile(f.Name()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !bytes.Equal(files[0], files[1]) {
+			t.Errorf("files differ")
+		}
+		if err := EncodeWAV(nil, bytes.NewReader(pcm)); !errors.Is(err, alacwav.ErrFormat) {
+			t.Errorf("have %v, want %v", err, alacwav.ErrFormat)
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		f, err := os.Create(t.TempDir() + "/out.caf")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString("head"); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		src := &cancelReader{r: bytes.NewReader(pcm), cancel: cancel}
+		if err := EncodeContext(ctx, f, src, alac.DefaultConfig()); !errors.Is(err, context.Canceled) {
+			t.Errorf("have %v, want %v", err, context.Canceled)
+		}
+		if have, want := src.reads, 1; have != want {
+			t.Errorf("have %d reads, want %d", have, want)
+		}
+		file, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := string(file), "head"; have != want {
+			t.Errorf("have %q, want %q", have, want)
+		}
+		if pos, err := f.Seek(0, io.SeekCurrent); err != nil || pos != 4 {
+			t.Errorf("have %d, %v, want 4", pos, err)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		f, err := os.Create(t.TempDir() + "/out.caf")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		w, err := NewWriter(f, alac.DefaultConfig())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(pcm[:3]); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); !errors.Is(err, alac.ErrInvalidPCM) {
+			t.Errorf("have %v, want %v", err, alac.ErrInvalidPCM)
+		}
+		if _, err := w.Write(pcm); !errors.Is(err, ErrClosed) {
+			t.Errorf("have %v, want %v", err, ErrClosed)
+		}
+	})
+}
+
+func TestVarint(t *testing.T) {
+	for _, c := range []struct {
+		v    uint32
+		want []byte
+	}{
+		{0, []byte{0}},
+		{127, []byte{127}},
+		{128, []byte{0x81, 0}},
+		{16383, []byte{0xff, 0x7f}},
+		{16384, []byte{0x81, 0x80, 0}},
+		{math.MaxUint32, []byte{0x8f, 0xff, 0xff, 0xff, 0x7f}},
+	} {
+		if have := appendVarint(nil, c.v); !bytes.Equal(have, c.want) {
+			t.Errorf("%d: have %x, want %x", c.v, have, c.want)
+		}
+	}
+}
+
+// cancelReader cancels a context after the first read.
+type cancelReader struct {
+	r      io.Reader
+	cancel func()
+	reads  int
+}
+
+func (r *cancelReader) Read(p []byte) (int, error) {
+	r.reads++
+	r.cancel()
+	return r.r.Read(p)
+}
@@ -0,0 +1,193 @@
+// Package alacm4a encodes PCM to ALAC M4A files, which iTunes, Music, and
+// most players take.
+//
+//	w, err := alacm4a.NewWriter(f, cfg)
+//	...
+//	io.Copy(w, pcm)
+//	err = w.Close()
+//
+// or in one go:
+//
+//	err := alacm4a.Encode(f, pcm, cfg)
+//
+// or straight from a WAV file:
+//
+//	err := alacm4a.EncodeWAV(f, wav)
+package alacm4a
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+
+	"github.com/alicebob/alac"
+	"github.com/alicebob/alac/alacwav"
+)
+
+// ErrClosed is returned by Write after Close.
+var ErrClosed = errors.New("alacm4a: writer is closed")
+
+// the 'ftyp' atom of M4A files
+const ftyp = "\x00\x00\x00\x1cftypM4A \x00\x00\x00\x00M4A mp42isom"
+
+// mdatHeader is the room for the 'mdat' atom header: a 'free' atom and a
+// 32 bit 'mdat' header, or a 64 bit 'mdat' header for more than 4GB.
+const mdatHeader = 16
+
+// Writer encodes PCM, in the layout alac.Encoder takes, to an M4A file.
+// The file has the 'mdat' atom with the frames first, and the 'moov' atom
+// with the sample tables last, when Close knows them.
+type Writer struct {
+	w         io.WriteSeeker
+	enc       *alac.Encoder
+	stream    *alac.StreamEncoder
+	start     int64 // of the file in w
+	data      int64 // bytes of frames written
+	sizes     []uint32
+	durations []uint32 // samples of every frame
+	err       error
+}
+
+// NewWriter writes the start of an M4A file for PCM of the format of cfg to
+// w, and returns a Writer for the PCM, which encodes it with an
+// alac.Encoder with opts. The file starts at the current position of w.
+func NewWriter(w io.WriteSeeker, cfg alac.Config, opts ...alac.EncoderOption) (*Writer, error) {
+	enc, err := alac.NewEncoder(cfg, opts...)
+	if err != nil {
+		return nil, err
+	}
+	start, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	wr := &Writer{
+		w:     w,
+		enc:   enc,
+		start: start,
+	}
+	wr.stream = alac.NewStreamEncoder(enc, wr.writeFrame)
+	if _, err := w.Write(append([]byte(ftyp), make([]byte, mdatHeader)...)); err != nil {
+		return nil, err
+	}
+	return wr, nil
+}
+
+// Encode writes an M4A file of the PCM from src to w, see NewWriter.
+func Encode(w io.WriteSeeker, src io.Reader, cfg alac.Config, opts ...alac.EncoderOption) error {
+	return EncodeContext(context.Background(), w, src, cfg, opts...)
+}
+
+// EncodeContext is Encode, which stops when ctx is cancelled. ctx is
+// checked before every frame. On any error what was written of the file is
+// removed, see Writer.Abort.
+func EncodeContext(ctx context.Context, w io.WriteSeeker, src io.Reader, cfg alac.Config, opts ...alac.EncoderOption) error {
+	wr, err := NewWriter(w, cfg, opts...)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, (cfg.SampleSize+7)/8*cfg.NumChannels*cfg.FrameSize)
+	for err == nil {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		var n int
+		n, err = io.ReadFull(src, buf)
+		if n > 0 {
+			if _, werr := wr.Write(buf[:n]); werr != nil {
+				err = werr
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = wr.Close()
+			break
+		}
+	}
+	if err != nil {
+		wr.Abort()
+	}
+	return err
+}
+
+// EncodeWAV writes an M4A file of the PCM of the WAV file from src to w, in
+// the format of the WAV file. See alacwav.NewReader for the files it takes.
+func EncodeWAV(w io.WriteSeeker, src io.Reader, opts ...alac.EncoderOption) error {
+	wav, err := alacwav.NewReader(src)
+	if err != nil {
+		return err
+	}
+	return Encode(w, wav, wav.Config(), opts...)
+}
+
+// Write encodes PCM. Frames are written to the file as they are complete.
+func (w *Writer) Write(pcm []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.stream.Write(pcm)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
+
+func (w *Writer) writeFrame(frame []byte) error {
+	if _, err := w.w.Write(frame); err != nil {
+		return err
+	}
+	w.data += int64(len(frame))
+	w.sizes = append(w.sizes, uint32(len(frame)))
+	w.durations = append(w.durations, uint32(w.stream.FrameSamples()))
+	return nil
+}
+
+// Close encodes the last frame, completes the 'mdat' atom, and writes the
+// 'moov' atom. It doesn't close the underlying writer. The file ends at
+// the position of w after Close.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	w.err = ErrClosed
+	if err := w.stream.Flush(); err != nil {
+		return err
+	}
+
+	header := make([]byte, 0, mdatHeader)
+	if size := mdatHeader - 8 + w.data; size > math.MaxUint32 {
+		header = binary.BigEndian.AppendUint32(header, 1)
+		header = append(header, "mdat"...)
+		header = binary.BigEndian.AppendUint64(header, uint64(mdatHeader+w.data))
+	} else {
+		header = append(header, "\x00\x00\x00\x08free"...)
+		header = binary.BigEndian.AppendUint32(header, uint32(size))
+		header = append(header, "mdat"...)
+	}
+	if _, err := w.w.Seek(w.start+int64(len(ftyp)), io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.w.Seek(w.start+int64(len(ftyp)+mdatHeader)+w.data, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := w.w.Write(w.moov())
+	return err
+}
+
+// Abort stops the writer, and removes what it wrote of the file: w is
+// truncated to the start of the file when it has a Truncate method, as an
+// *os.File has, and left at the start of the file. Write and Close fail
+// with ErrClosed after Abort.
+func (w *Writer) Abort() error {
+	w.err = ErrClosed
+	if t, ok := w.w.(interface{ Truncate(int64) error }); ok {
+		if err := t.Truncate(w.start); err != nil {
+			return err
+		}
+	}
+	_, err := w.w.Seek(w.start, io.SeekStart)
+	return err
+}
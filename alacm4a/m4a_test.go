@@ -0,0 +1,288 @@
+package alacm4a
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/alicebob/alac"
+	"github.com/alicebob/alac/alacwav"
+)
+
+// atom returns the content of the atom at the path, in the atoms of b. The
+// full atoms on the path are given with their version and flags.
+func atom(t *testing.T, b []byte, path ...string) []byte {
+	t.Helper()
+	skip := map[string]int{"stsd": 8, "dref": 8}
+	for _, name := range path {
+		found := false
+		for len(b) >= 8 {
+			size := int(binary.BigEndian.Uint32(b))
+			if size < 8 || size > len(b) {
+				t.Fatalf("bad atom size %d", size)
+			}
+			if string(b[4:8]) == name {
+				b, found = b[8:size], true
+				break
+			}
+			b = b[size:]
+		}
+		if !found {
+			t.Fatalf("no %q atom in %v", name, path)
+		}
+		b = b[skip[name]:]
+	}
+	return b
+}
+
+func u32(b []byte, i int) int {
+	return int(binary.BigEndian.Uint32(b[4*i:]))
+}
+
+// frames returns the frames of an M4A file, and its sample entry and
+// frame durations.
+func frames(t *testing.T, file []byte) ([][]byte, []byte, []int) {
+	t.Helper()
+	stbl := atom(t, file, "moov", "trak", "mdia", "minf", "stbl")
+	var (
+		stsz      = atom(t, stbl, "stsz")[4:]
+		stsc      = atom(t, stbl, "stsc")[4:]
+		stco      = atom(t, stbl, "stco")[4:]
+		stts      = atom(t, stbl, "stts")[4:]
+		out       [][]byte
+		durations []int
+	)
+	for i := range u32(stts, 0) {
+		for range u32(stts, 1+2*i) {
+			durations = append(durations, u32(stts, 2+2*i))
+		}
+	}
+	sizes := stsz[8:]
+	n := 0
+	for c := range u32(stco, 0) {
+		per := 0
+		for e := range u32(stsc, 0) {
+			if u32(stsc, 1+3*e) <= c+1 {
+				per = u32(stsc, 2+3*e)
+			}
+		}
+		offset := u32(stco, 1+c)
+		for range per {
+			size := u32(sizes, n)
+			out = append(out, file[offset:offset+size])
+			offset += size
+			n++
+		}
+	}
+	if have, want := n, u32(stsz, 1); have != want {
+		t.Errorf("have %d frames in chunks, want %d", have, want)
+	}
+	return out, atom(t, stbl, "stsd"), durations
+}
+
+func TestEncode(t *testing.T) {
+	wav, err := os.ReadFile("../testdata/samples/jane_eyre_5s.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcm := wav[bytes.Index(wav, []byte("data"))+8:]
+
+	for _, c := range []struct {
+		frameSize int
+		pcm       []byte
+		opts      []alac.EncoderOption
+	}{
+		{4096, pcm, nil},
+		{4096, pcm[:4096*4*3], nil}, // whole frames
+		{352, pcm[:352*4*200+44], nil},
+		{4096, nil, nil},
+		{4096, pcm, []alac.EncoderOption{alac.WithMaxPacketSize(2000)}}, // shorter frames
+	} {
+		cfg := alac.DefaultConfig()
+		cfg.FrameSize = c.frameSize
+		f, err := os.Create(t.TempDir() + "/out.m4a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := Encode(f, bytes.NewReader(c.pcm), cfg, c.opts...); err != nil {
+			t.Fatal(err)
+		}
+		file, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := string(file[:36]), ftyp+"\x00\x00\x00\x08free"; have != want {
+			t.Errorf("have %q, want %q", have, want)
+		}
+
+		fs, entry, durations := frames(t, file)
+		stream, err := alac.ParseMagicCookie(atom(t, entry[36:], "alac")[4:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := stream.FrameSize, c.frameSize; have != want {
+			t.Errorf("have %d, want %d", have, want)
+		}
+		d, err := alac.NewWithConfig(stream, alac.WithStrict())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []byte
+		total := 0
+		for i, frame := range fs {
+			have, err := d.DecodeFrame(frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have, want := durations[i], len(have)/4; have != want {
+				t.Errorf("frame %d: have duration %d, want %d", i, have, want)
+			}
+			total += durations[i]
+			out = append(out, have...)
+		}
+		if !bytes.Equal(out, c.pcm) {
+			t.Errorf("%d bytes: output differs", len(c.pcm))
+		}
+		mdhd := atom(t, file, "moov", "trak", "mdia", "mdhd")
+		if have, want := u32(mdhd, 3), 44100; have != want {
+			t.Errorf("have timescale %d, want %d", have, want)
+		}
+		if have, want := u32(mdhd, 4), total; have != want {
+			t.Errorf("have duration %d, want %d", have, want)
+		}
+	}
+
+	t.Run("gapless", func(t *testing.T) {
+		f, err := os.Create(t.TempDir() + "/out.m4a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := Encode(f, bytes.NewReader(pcm[:4*10000]), alac.DefaultConfig(), alac.WithPriming(2112)); err != nil {
+			t.Fatal(err)
+		}
+		file, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		elst := atom(t, file, "moov", "trak", "edts", "elst")
+		if have, want := elst, []byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0x1e, 0xd0, 0, 0, 0x08, 0x40, 0, 1, 0, 0}; !bytes.Equal(have, want) {
+			t.Errorf("have %x, want %x", have, want)
+		}
+		if have, want := u32(atom(t, file, "moov", "mvhd"), 4), 10000-2112; have != want {
+			t.Errorf("have %d, want %d", have, want)
+		}
+		if have, want := u32(atom(t, file, "moov", "trak", "mdia", "mdhd"), 4), 10000; have != want {
+			t.Errorf("have %d, want %d", have, want)
+		}
+		tag := atom(t, file, "moov", "udta", "meta")[4:]
+		if have, want := string(atom(t, tag, "ilst", "----", "name")[4:]), "iTunSMPB"; have != want {
+			t.Errorf("have %q, want %q", have, want)
+		}
+		want := " 00000000 00000840 000000D0 0000000000001ED0 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000"
+		if have := string(atom(t, tag, "ilst", "----", "data")[8:]); have != want {
+			t.Errorf("have %q, want %q", have, want)
+		}
+	})
+
+	t.Run("wav", func(t *testing.T) {
+		var files [2][]byte
+		for i, encode := range []func(*os.File) error{
+			func(f *os.File) error { return Encode(f, bytes.NewReader(pcm), alac.DefaultConfig()) },
+			func(f *os.File) error { return EncodeWAV(f, bytes.NewReader(wav)) },
+		} {
+			f, err := os.Create(t.TempDir() + "/out.m4a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			if err := encode(f); err != nil {
+				t.Fatal(err)
+			}
+			if files[i], err = os.ReadFile(f.Name()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !bytes.Equal(files[0], files[1]) {
+			t.Errorf("files differ")
+		}
+		if err := EncodeWAV(nil, bytes.NewReader(pcm)); !errors.Is(err, alacwav.ErrFormat) {
+			t.Errorf("have %v, want %v", err, alacwav.ErrFormat)
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		f, err := os.Create(t.TempDir() + "/out.m4a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString("head"); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		src := &cancelReader{r: bytes.NewReader(pcm), cancel: cancel}
+		if err := EncodeContext(ctx, f, src, alac.DefaultConfig()); !errors.Is(err, context.Canceled) {
+			t.Errorf("have %v, want %v", err, context.Canceled)
+		}
+		if have, want := src.reads, 1; have != want {
+			t.Errorf("have %d reads, want %d", have, want)
+		}
+		file, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := string(file), "head"; have != want {
+			t.Errorf("have %q, want %q", have, want)
+		}
+		if pos, err := f.Seek(0, io.SeekCurrent); err != nil || pos != 4 {
+			t.Errorf("have %d, %v, want 4", pos, err)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		f, err := os.Create(t.TempDir() + "/out.m4a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		w, err := NewWriter(f, alac.DefaultConfig())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(pcm[:3]); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); !errors.Is(err, alac.ErrInvalidPCM) {
+			t.Errorf("have %v, want %v", err, alac.ErrInvalidPCM)
+		}
+		if _, err := w.Write(pcm); !errors.Is(err, ErrClosed) {
+			t.Errorf("have %v, want %v", err, ErrClosed)
+		}
+
+		cfg := alac.DefaultConfig()
+		cfg.SampleSize = 12
+		if _, err := NewWriter(f, cfg); !errors.Is(err, alac.ErrUnsupportedBitDepth) {
+			t.Errorf("have %v, want %v", err, alac.ErrUnsupportedBitDepth)
+		}
+	})
+}
+
+// cancelReader cancels a context after the first read.
+type cancelReader struct {
+	r      io.Reader
+	cancel func()
+	reads  int
+}
+
+func (r *cancelReader) Read(p []byte) (int, error) {
+	r.reads++
+	r.cancel()
+	return r.r.Read(p)
+}
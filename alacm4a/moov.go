@@ -0,0 +1,238 @@
+package alacm4a
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/alicebob/alac"
+)
+
+// the identity matrix of 'mvhd' and 'tkhd'
+var matrix = []byte{
+	0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0x40, 0, 0, 0,
+}
+
+// box returns an atom of the type with the content.
+func box(typ string, content ...[]byte) []byte {
+	size := 8
+	for _, c := range content {
+		size += len(c)
+	}
+	b := make([]byte, 0, size)
+	b = binary.BigEndian.AppendUint32(b, uint32(size))
+	b = append(b, typ...)
+	for _, c := range content {
+		b = append(b, c...)
+	}
+	return b
+}
+
+// fullBox is box for atoms with a version and flags.
+func fullBox(typ string, version byte, flags uint32, content ...[]byte) []byte {
+	vf := binary.BigEndian.AppendUint32(nil, uint32(version)<<24|flags)
+	return box(typ, append([][]byte{vf}, content...)...)
+}
+
+// moov returns the 'moov' atom of the file: one track with the frames in
+// the 'mdat' atom.
+func (w *Writer) moov() []byte {
+	var (
+		cfg      = w.enc.Config()
+		rate     = uint32(cfg.SampleRate)
+		gapless  = w.enc.Gapless()
+		duration = uint64(gapless.Priming) + uint64(gapless.Samples) // of the media
+		playing  = uint64(gapless.Samples)                           // of the edit
+		version  = byte(0)
+		be       = binary.BigEndian
+	)
+	if duration > math.MaxUint32 {
+		version = 1
+	}
+
+	mvhd := fullBox("mvhd", version, 0,
+		times(version, rate, false, playing),
+		be.AppendUint32(nil, 0x00010000), // rate 1.0
+		be.AppendUint16(nil, 0x0100),     // volume 1.0
+		make([]byte, 10),                 // reserved
+		matrix,
+		make([]byte, 24),        // pre-defined
+		be.AppendUint32(nil, 2), // next track ID
+	)
+
+	tkhd := fullBox("tkhd", version, 7, // enabled, in movie, in preview
+		times(version, 1, true, playing), // track 1
+		make([]byte, 8),                  // reserved
+		make([]byte, 4),                  // layer and alternate group
+		be.AppendUint16(nil, 0x0100),     // volume 1.0
+		make([]byte, 2),                  // reserved
+		matrix,
+		make([]byte, 8), // width and height
+	)
+
+	mdhd := fullBox("mdhd", version, 0,
+		times(version, rate, false, duration),
+		be.AppendUint16(nil, 0x55c4), // language "und"
+		make([]byte, 2),
+	)
+	hdlr := fullBox("hdlr", 0, 0,
+		make([]byte, 4), // pre-defined
+		[]byte("soun"),
+		make([]byte, 12),
+		[]byte("SoundHandler\x00"),
+	)
+	dinf := box("dinf", fullBox("dref", 0, 0,
+		be.AppendUint32(nil, 1),
+		fullBox("url ", 0, 1), // the frames are in this file
+	))
+
+	stbl := box("stbl",
+		fullBox("stsd", 0, 0, be.AppendUint32(nil, 1), w.enc.SampleEntry()),
+		w.stts(),
+		w.stsc(cfg),
+		w.stsz(),
+		w.stco(cfg),
+	)
+	minf := box("minf", fullBox("smhd", 0, 0, make([]byte, 4)), dinf, stbl)
+	trak := box("trak", tkhd, edts(version, gapless), box("mdia", mdhd, hdlr, minf))
+	return box("moov", mvhd, trak, udta(gapless))
+}
+
+// edts returns the edit list of the track, which skips the priming: one
+// edit of the samples to play.
+func edts(version byte, g alac.Gapless) []byte {
+	var b []byte
+	b = binary.BigEndian.AppendUint32(b, 1) // entries
+	if version == 1 {
+		b = binary.BigEndian.AppendUint64(b, uint64(g.Samples))
+		b = binary.BigEndian.AppendUint64(b, uint64(g.Priming))
+	} else {
+		b = binary.BigEndian.AppendUint32(b, uint32(g.Samples))
+		b = binary.BigEndian.AppendUint32(b, uint32(g.Priming))
+	}
+	b = binary.BigEndian.AppendUint32(b, 0x00010000) // rate 1.0
+	return box("edts", fullBox("elst", version, 0, b))
+}
+
+// udta returns the iTunes metadata of the file: the iTunSMPB tag with the
+// gapless info, which iTunes reads instead of the edit list.
+func udta(g alac.Gapless) []byte {
+	hdlr := fullBox("hdlr", 0, 0,
+		make([]byte, 4), // pre-defined
+		[]byte("mdirappl"),
+		make([]byte, 9), // reserved, and an empty name
+	)
+	tag := box("----",
+		fullBox("mean", 0, 0, []byte("com.apple.iTunes")),
+		fullBox("name", 0, 0, []byte("iTunSMPB")),
+		fullBox("data", 0, 1, make([]byte, 4), []byte(g.ITunSMPB())), // UTF-8, no locale
+	)
+	return box("udta", fullBox("meta", 0, 0, hdlr, box("ilst", tag)))
+}
+
+// times returns the start of the 'mvhd', 'tkhd', and 'mdhd' atoms: zero
+// creation and modification times, the timescale or the track ID v, and the
+// duration, in 64 bits for version 1. The 'tkhd' atom has 4 reserved bytes
+// before the duration.
+func times(version byte, v uint32, tkhd bool, duration uint64) []byte {
+	b := make([]byte, 8<<version)
+	b = binary.BigEndian.AppendUint32(b, v)
+	if tkhd {
+		b = append(b, 0, 0, 0, 0)
+	}
+	if version == 1 {
+		return binary.BigEndian.AppendUint64(b, duration)
+	}
+	return binary.BigEndian.AppendUint32(b, uint32(duration))
+}
+
+// stts returns the time to sample atom, with a run of frames of the same
+// duration per entry: usually one of FrameSize samples, and the shorter
+// last frame.
+func (w *Writer) stts() []byte {
+	var entries [][2]uint32
+	for _, d := range w.durations {
+		if n := len(entries); n > 0 && entries[n-1][1] == d {
+			entries[n-1][0]++
+		} else {
+			entries = append(entries, [2]uint32{1, d})
+		}
+	}
+	b := binary.BigEndian.AppendUint32(nil, uint32(len(entries)))
+	for _, e := range entries {
+		b = binary.BigEndian.AppendUint32(b, e[0])
+		b = binary.BigEndian.AppendUint32(b, e[1])
+	}
+	return fullBox("stts", 0, 0, b)
+}
+
+// framesPerChunk is the number of frames in a chunk of the file: about a
+// second of audio, like iTunes does.
+func framesPerChunk(sampleRate, frameSize int) int {
+	return max(1, sampleRate/frameSize)
+}
+
+// stsc returns the sample to chunk atom, for chunks of framesPerChunk
+// frames and a shorter last chunk.
+func (w *Writer) stsc(cfg alac.Config) []byte {
+	var (
+		per    = framesPerChunk(cfg.SampleRate, cfg.FrameSize)
+		frames = len(w.sizes)
+		b      []byte
+	)
+	entry := func(first, n int) {
+		b = binary.BigEndian.AppendUint32(b, uint32(first))
+		b = binary.BigEndian.AppendUint32(b, uint32(n))
+		b = binary.BigEndian.AppendUint32(b, 1) // sample description
+	}
+	count := 0
+	if frames > 0 {
+		entry(1, min(per, frames))
+		count++
+		if rest := frames % per; rest != 0 && frames > per {
+			entry(frames/per+1, rest)
+			count++
+		}
+	}
+	return fullBox("stsc", 0, 0, binary.BigEndian.AppendUint32(nil, uint32(count)), b)
+}
+
+// stsz returns the sample size atom.
+func (w *Writer) stsz() []byte {
+	b := binary.BigEndian.AppendUint32(nil, 0) // sizes vary
+	b = binary.BigEndian.AppendUint32(b, uint32(len(w.sizes)))
+	for _, s := range w.sizes {
+		b = binary.BigEndian.AppendUint32(b, s)
+	}
+	return fullBox("stsz", 0, 0, b)
+}
+
+// stco returns the chunk offset atom, or the 64 bit 'co64' for files over
+// 4GB.
+func (w *Writer) stco(cfg alac.Config) []byte {
+	var (
+		per     = framesPerChunk(cfg.SampleRate, cfg.FrameSize)
+		offset  = w.start + int64(len(ftyp)+mdatHeader)
+		offsets []int64
+	)
+	for i, s := range w.sizes {
+		if i%per == 0 {
+			offsets = append(offsets, offset)
+		}
+		offset += int64(s)
+	}
+	large := offset > math.MaxUint32
+	b := binary.BigEndian.AppendUint32(nil, uint32(len(offsets)))
+	for _, o := range offsets {
+		if large {
+			b = binary.BigEndian.AppendUint64(b, uint64(o))
+		} else {
+			b = binary.BigEndian.AppendUint32(b, uint32(o))
+		}
+	}
+	if large {
+		return fullBox("co64", 0, 0, b)
+	}
+	return fullBox("stco", 0, 0, b)
+}
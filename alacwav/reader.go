@@ -0,0 +1,228 @@
+package alacwav
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/alicebob/alac"
+)
+
+// ErrFormat is returned by NewReader for files which aren't WAV or RF64
+// files of integer PCM.
+var ErrFormat = errors.New("alacwav: not a PCM WAV file")
+
+// wavToALAC are the WAV channels of the ALAC channels, by number of
+// channels, for files with the usual speaker layouts: 5.1 is L R C LFE Ls Rs
+// in WAV, and C L R Ls Rs LFE in ALAC. These are the tables of ffmpeg.
+var wavToALAC = [8][]int{
+	{0},
+	{0, 1},
+	{2, 0, 1},
+	{2, 0, 1, 3},
+	{2, 0, 1, 3, 4},
+	{2, 0, 1, 4, 5, 3},
+	{2, 0, 1, 4, 5, 6, 3},
+	{2, 6, 7, 0, 1, 4, 5, 3},
+}
+
+// Reader reads the PCM of a WAV or RF64 file, in the layout alac.Encoder
+// takes.
+type Reader struct {
+	r          io.Reader
+	cfg        alac.Config
+	blockAlign int
+	order      []int  // WAV channel of every ALAC channel, nil to keep them
+	left       int64  // bytes of PCM, -1 for until EOF
+	block      []byte // one sample for every channel
+	pending    []byte // of block, for reads of less than a sample
+	tmp        []byte
+}
+
+// NewReader reads the header of a WAV, RF64, or BW64 file from r, up to
+// the PCM. It takes 16, 24, and 32 bit integer PCM, and 20 bit PCM in 24
+// bit WAVE_FORMAT_EXTENSIBLE files, of 1 to 8 channels. Channels with a
+// speaker mask, such as those of Writer, are reordered from WAV to ALAC
+// order; files with a zero mask are taken to be in ALAC order already.
+// Other files fail with ErrFormat or alac.ErrUnsupportedBitDepth.
+//
+// A data size of 0xffffffff, which Writer leaves for pipes, reads until
+// EOF.
+func NewReader(r io.Reader) (*Reader, error) {
+	var hdr [12]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFormat, err)
+	}
+	riff := string(hdr[:4])
+	if riff != "RIFF" && riff != "RF64" && riff != "BW64" || string(hdr[8:]) != "WAVE" {
+		return nil, fmt.Errorf("%w: no RIFF WAVE header", ErrFormat)
+	}
+	var (
+		rd     = &Reader{r: r}
+		ds64   = int64(-1) // data size of the ds64 chunk
+		gotFmt bool
+	)
+	for {
+		var ch [8]byte
+		if _, err := io.ReadFull(r, ch[:]); err != nil {
+			return nil, fmt.Errorf("%w: no data chunk: %w", ErrFormat, err)
+		}
+		id, size := string(ch[:4]), binary.LittleEndian.Uint32(ch[4:])
+		switch id {
+		case "ds64", "fmt ":
+			if size > 1<<16 {
+				return nil, fmt.Errorf("%w: %q chunk of %d bytes", ErrFormat, id, size)
+			}
+			b := make([]byte, size+size&1)
+			if _, err := io.ReadFull(r, b); err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrFormat, err)
+			}
+			if id == "fmt " {
+				if err := rd.parseFmt(b[:size]); err != nil {
+					return nil, err
+				}
+				gotFmt = true
+			} else if len(b) >= 16 {
+				ds64 = int64(binary.LittleEndian.Uint64(b[8:]))
+			}
+		case "data":
+			if !gotFmt {
+				return nil, fmt.Errorf("%w: data before fmt chunk", ErrFormat)
+			}
+			rd.left = int64(size)
+			if size == math.MaxUint32 {
+				rd.left = -1
+				if riff != "RIFF" && ds64 >= 0 {
+					rd.left = ds64
+				}
+			}
+			return rd, nil
+		default:
+			if _, err := io.CopyN(io.Discard, r, int64(size+size&1)); err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrFormat, err)
+			}
+		}
+	}
+}
+
+// parseFmt reads the format of the PCM from the fmt chunk.
+func (r *Reader) parseFmt(b []byte) error {
+	if len(b) < 16 {
+		return fmt.Errorf("%w: fmt chunk of %d bytes", ErrFormat, len(b))
+	}
+	var (
+		le         = binary.LittleEndian
+		format     = le.Uint16(b)
+		channels   = int(le.Uint16(b[2:]))
+		rate       = int(le.Uint32(b[4:]))
+		blockAlign = int(le.Uint16(b[12:]))
+		bits       = int(le.Uint16(b[14:]))
+		valid      = bits
+		mask       = uint32(0)
+	)
+	switch format {
+	case formatPCM:
+		mask = 1 // the default layout
+	case formatExtensible:
+		if len(b) < 40 || [16]byte(b[24:40]) != subtypePCM {
+			return fmt.Errorf("%w: not integer PCM", ErrFormat)
+		}
+		if v := int(le.Uint16(b[18:])); v != 0 {
+			valid = v
+		}
+		mask = le.Uint32(b[20:])
+	default:
+		return fmt.Errorf("%w: format %#x", ErrFormat, format)
+	}
+	if channels < 1 || channels > 8 || rate <= 0 {
+		return fmt.Errorf("%w: %d channels at %d Hz", ErrFormat, channels, rate)
+	}
+	if bits%8 != 0 || blockAlign != bits/8*channels {
+		return fmt.Errorf("%w: %d bit samples in blocks of %d bytes", ErrFormat, bits, blockAlign)
+	}
+	if (valid+7)/8 != bits/8 || valid != 16 && valid != 20 && valid != 24 && valid != 32 {
+		return fmt.Errorf("%w: %d bit samples in %d bits", alac.ErrUnsupportedBitDepth, valid, bits)
+	}
+
+	r.cfg = alac.DefaultConfig()
+	r.cfg.SampleRate = rate
+	r.cfg.SampleSize = valid
+	r.cfg.NumChannels = channels
+	r.blockAlign = blockAlign
+	r.block = make([]byte, blockAlign)
+	if channels > 2 && mask != 0 {
+		r.order = wavToALAC[channels-1]
+	}
+	return nil
+}
+
+// Config returns the config of the PCM, with the default FrameSize.
+func (r *Reader) Config() alac.Config {
+	return r.cfg
+}
+
+// Read reads PCM, in ALAC channel order. It fails with io.ErrUnexpectedEOF
+// when the file ends before its data size.
+func (r *Reader) Read(p []byte) (int, error) {
+	if len(r.pending) == 0 && len(p) < r.blockAlign {
+		// less than a sample
+		n, err := r.read(r.block)
+		r.pending = r.block[:n]
+		if n == 0 {
+			return 0, err
+		}
+	}
+	if len(r.pending) > 0 {
+		n := copy(p, r.pending)
+		r.pending = r.pending[n:]
+		return n, nil
+	}
+	return r.read(p)
+}
+
+// read reads whole samples for every channel.
+func (r *Reader) read(p []byte) (int, error) {
+	if r.left == 0 {
+		return 0, io.EOF
+	}
+	n := len(p) - len(p)%r.blockAlign
+	if r.left > 0 {
+		n = int(min(int64(n), r.left))
+	}
+	n, err := io.ReadFull(r.r, p[:n])
+	if r.left < 0 && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+		err = nil
+		r.left = 0
+	}
+	n -= n % r.blockAlign
+	if r.left > 0 {
+		r.left -= int64(n)
+	}
+	r.reorder(p[:n])
+	if n == 0 && err == nil {
+		return 0, io.EOF
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// reorder puts the channels of whole samples in ALAC order.
+func (r *Reader) reorder(pcm []byte) {
+	if r.order == nil {
+		return
+	}
+	width := r.blockAlign / len(r.order)
+	if len(r.tmp) < r.blockAlign {
+		r.tmp = make([]byte, r.blockAlign)
+	}
+	for ; len(pcm) > 0; pcm = pcm[r.blockAlign:] {
+		copy(r.tmp, pcm[:r.blockAlign])
+		for c, w := range r.order {
+			copy(pcm[c*width:(c+1)*width], r.tmp[w*width:])
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package alacwav
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/alicebob/alac"
+)
+
+func TestReader(t *testing.T) {
+	t.Run("file", func(t *testing.T) {
+		wav, err := os.ReadFile("../testdata/samples/jane_eyre_5s.wav")
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := NewReader(bytes.NewReader(wav))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := r.Config(), alac.DefaultConfig(); have != want {
+			t.Errorf("have %+v, want %+v", have, want)
+		}
+		have, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := wav[bytes.Index(wav, []byte("data"))+8:]; !bytes.Equal(have, want) {
+			t.Errorf("have %d bytes, want %d", len(have), len(want))
+		}
+	})
+
+	// files of Writer read back as they were written
+	for _, c := range []struct {
+		name string
+		cfg  alac.Config
+		rf64 bool
+	}{
+		{"16 bit", alac.Config{SampleRate: 48000, SampleSize: 16, NumChannels: 2}, false},
+		{"24 bit mono", alac.Config{SampleRate: 96000, SampleSize: 24, NumChannels: 1}, false},
+		{"32 bit 6 channels", alac.Config{SampleRate: 44100, SampleSize: 32, NumChannels: 6}, false},
+		{"20 bit 8 channels", alac.Config{SampleRate: 48000, SampleSize: 20, NumChannels: 8}, false},
+		{"rf64", alac.Config{SampleRate: 44100, SampleSize: 24, NumChannels: 2}, true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			pcm := make([]byte, (c.cfg.SampleSize+7)/8*c.cfg.NumChannels*1000)
+			for i := range pcm {
+				pcm[i] = byte(i * 7)
+			}
+			for _, seek := range []bool{true, false} {
+				var (
+					f             = &seeker{}
+					out io.Writer = f
+				)
+				if !seek {
+					out = &f.buf // sizes left at the maximum
+				}
+				w, err := newWriter(out, c.cfg, c.rf64)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := w.Write(pcm); err != nil {
+					t.Fatal(err)
+				}
+				if err := w.Close(); err != nil {
+					t.Fatal(err)
+				}
+				r, err := NewReader(bytes.NewReader(f.buf.Bytes()))
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := alac.DefaultConfig()
+				want.SampleRate, want.SampleSize, want.NumChannels = c.cfg.SampleRate, c.cfg.SampleSize, c.cfg.NumChannels
+				if have := r.Config(); have != want {
+					t.Errorf("have %+v, want %+v", have, want)
+				}
+				have, err := io.ReadAll(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(have, pcm) {
+					t.Errorf("seek %t: have %d bytes, want %d", seek, len(have), len(pcm))
+				}
+			}
+		})
+	}
+
+	t.Run("5.1", func(t *testing.T) {
+		// L R C LFE Ls Rs, with a speaker mask, and a LIST chunk
+		wav := mustHex(t, "52494646"+"00000000"+"57415645"+
+			"4c495354"+"03000000"+"61626300"+
+			"666d7420"+"28000000"+
+			"feff"+"0600"+"80bb0000"+"00650400"+"0c00"+"1000"+
+			"1600"+"1000"+"3f000000"+"0100000000001000800000aa00389b71"+
+			"64617461"+"18000000"+
+			"0100"+"0200"+"0300"+"0400"+"0500"+"0600"+
+			"1100"+"1200"+"1300"+"1400"+"1500"+"1600")
+		r, err := NewReader(bytes.NewReader(wav))
+		if err != nil {
+			t.Fatal(err)
+		}
+		have, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// C L R Ls Rs LFE
+		want := mustHex(t, "0300"+"0100"+"0200"+"0500"+"0600"+"0400"+
+			"1300"+"1100"+"1200"+"1500"+"1600"+"1400")
+		if !bytes.Equal(have, want) {
+			t.Errorf("have %x, want %x", have, want)
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, alac.DefaultConfig())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(make([]byte, 400)); err != nil {
+			t.Fatal(err)
+		}
+		file := buf.Bytes()
+		file[40] = 0xff // a data size of 0x1ff
+		file[41] = 0x01
+		r, err := NewReader(bytes.NewReader(file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		have, err := io.ReadAll(r)
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("have %v, want %v", err, io.ErrUnexpectedEOF)
+		}
+		if have, want := len(have), 400; have != want {
+			t.Errorf("have %d, want %d", have, want)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for _, c := range []struct {
+			file string
+			err  error
+		}{
+			{"", ErrFormat},
+			{"52494646" + "00000000" + "41494646", ErrFormat},
+			{"52494646" + "00000000" + "57415645", ErrFormat},
+			{"52494646" + "00000000" + "57415645" + "64617461" + "00000000", ErrFormat},
+			// float
+			{"52494646" + "00000000" + "57415645" + "666d7420" + "10000000" + "0300" + "0200" + "44ac0000" + "20620500" + "0800" + "2000" + "64617461" + "00000000", ErrFormat},
+			// 8 bit
+			{"52494646" + "00000000" + "57415645" + "666d7420" + "10000000" + "0100" + "0200" + "44ac0000" + "88580100" + "0200" + "0800" + "64617461" + "00000000", alac.ErrUnsupportedBitDepth},
+		} {
+			if _, err := NewReader(bytes.NewReader(mustHex(t, c.file))); !errors.Is(err, c.err) {
+				t.Errorf("%s: have %v, want %v", c.file, err, c.err)
+			}
+		}
+	})
+}
+
+// seeker is an in-memory io.WriteSeeker.
+type seeker struct {
+	buf bytes.Buffer
+	pos int
+}
+
+func (s *seeker) Write(p []byte) (int, error) {
+	if s.pos == s.buf.Len() {
+		s.buf.Write(p)
+	} else {
+		copy(s.buf.Bytes()[s.pos:], p)
+	}
+	s.pos += len(p)
+	return len(p), nil
+}
+
+func (s *seeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+		s.pos = int(offset)
+	case io.SeekEnd:
+		s.pos = s.buf.Len() + int(offset)
+	}
+	return int64(s.pos), nil
+}
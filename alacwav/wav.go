@@ -0,0 +1,281 @@
+// Package alacwav writes decoded ALAC to WAV files, or RF64 files for more
+// than 4GB of PCM, and reads WAV files to encode.
+//
+//	dec, err := alac.NewWithConfig(cfg)
+//	...
+//	w, err := alacwav.NewWriter(f, cfg)
+//	for _, frame := range frames {
+//		pcm, err := dec.DecodeFrame(frame)
+//		...
+//		w.Write(pcm)
+//	}
+//	err = w.Close()
+//
+// A Reader reads WAV files, for the encoder.
+package alacwav
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/alicebob/alac"
+)
+
+// ErrTooLarge is returned by Write when the PCM doesn't fit in the 4GB a
+// WAV file can hold, see NewRF64Writer.
+var ErrTooLarge = errors.New("alacwav: too much PCM for a WAV file")
+
+const (
+	formatPCM        = 1
+	formatExtensible = 0xfffe
+)
+
+// the KSDATAFORMAT_SUBTYPE_PCM GUID of WAVE_FORMAT_EXTENSIBLE
+var subtypePCM = [16]byte{1, 0, 0, 0, 0, 0, 0x10, 0, 0x80, 0, 0, 0xaa, 0, 0x38, 0x9b, 0x71}
+
+// offset of the sizes in the ds64 chunk of RF64 files
+const offDS64 = 12 + 8
+
+// Writer writes little endian PCM, as returned by Decode, to a WAV file.
+type Writer struct {
+	w          io.Writer
+	rf64       bool
+	header     []byte
+	blockAlign int
+	order      []int  // WAV channel of every ALAC channel, nil to keep them
+	pending    []byte // of a sample, for writes of partial samples
+	block      []byte // one sample for every channel
+	tmp        []byte
+	data       int64 // bytes of PCM written
+	err        error
+}
+
+// NewWriter writes a WAV header for PCM of the format of cfg to w, and
+// returns a Writer for the PCM. SampleSize can be 16, 20 or 24 (packed),
+// or 32, for decoders WithPacking(MSB32); 20 bit samples are in 24 bits,
+// as Decode gives them. Streams of more than 16 bits or 2 channels get a
+// WAVE_FORMAT_EXTENSIBLE header, with the speaker mask of their ALAC
+// layout, and the channels of streams of more than 2 are reordered to WAV
+// order, see Write.
+//
+// The header has the sizes of the file, so Close updates it if w is an
+// io.WriteSeeker. Otherwise, such as for pipes, the sizes are left at the
+// maximum, which most readers take as "until the end".
+func NewWriter(w io.Writer, cfg alac.Config) (*Writer, error) {
+	return newWriter(w, cfg, false)
+}
+
+// NewRF64Writer is NewWriter for RF64 (EBU Tech 3306) files, the WAV
+// variant with 64 bit sizes, which is also what BW64 is. RF64 files have no
+// size limit, but not every WAV reader knows them, so use NewWriter when
+// the PCM is known to stay under 4GB.
+func NewRF64Writer(w io.Writer, cfg alac.Config) (*Writer, error) {
+	return newWriter(w, cfg, true)
+}
+
+func newWriter(w io.Writer, cfg alac.Config, rf64 bool) (*Writer, error) {
+	if cfg.SampleRate <= 0 {
+		return nil, fmt.Errorf("%w: sample rate %d", alac.ErrInvalidConfig, cfg.SampleRate)
+	}
+	if cfg.SampleSize != 16 && cfg.SampleSize != 20 && cfg.SampleSize != 24 && cfg.SampleSize != 32 {
+		return nil, fmt.Errorf("%w: %d bit samples", alac.ErrUnsupportedBitDepth, cfg.SampleSize)
+	}
+	if cfg.NumChannels < 1 || cfg.NumChannels > 8 {
+		return nil, fmt.Errorf("%w: %d channels", alac.ErrInvalidConfig, cfg.NumChannels)
+	}
+
+	wr := &Writer{
+		w:          w,
+		rf64:       rf64,
+		header:     header(cfg, rf64),
+		blockAlign: (cfg.SampleSize + 7) / 8 * cfg.NumChannels,
+	}
+	if cfg.NumChannels > 2 {
+		wr.order = wavToALAC[cfg.NumChannels-1]
+		wr.block = make([]byte, wr.blockAlign)
+	}
+	wr.setSizes(0, false)
+	if _, err := w.Write(wr.header); err != nil {
+		return nil, err
+	}
+	return wr, nil
+}
+
+// header returns the RIFF, fmt, and data chunk headers, and the ds64 chunk
+// for RF64, with zero sizes.
+func header(cfg alac.Config, rf64 bool) []byte {
+	var (
+		width      = (cfg.SampleSize + 7) / 8 // 20 bit samples take 3 bytes
+		blockAlign = width * cfg.NumChannels
+		extensible = cfg.SampleSize > 16 || cfg.NumChannels > 2
+		fmtSize    = 16
+		format     = formatPCM
+	)
+	if extensible {
+		fmtSize, format = 40, formatExtensible
+	}
+
+	h := make([]byte, 0, 12+8+28+8+fmtSize+8)
+	if rf64 {
+		h = append(h, "RF64\x00\x00\x00\x00WAVE"...)
+		h = append(h, "ds64"...)
+		h = binary.LittleEndian.AppendUint32(h, 28)
+		h = append(h, make([]byte, 28)...) // RIFF size, data size, sample frames, no table
+	} else {
+		h = append(h, "RIFF\x00\x00\x00\x00WAVE"...)
+	}
+	h = append(h, "fmt "...)
+	h = binary.LittleEndian.AppendUint32(h, uint32(fmtSize))
+	h = binary.LittleEndian.AppendUint16(h, uint16(format))
+	h = binary.LittleEndian.AppendUint16(h, uint16(cfg.NumChannels))
+	h = binary.LittleEndian.AppendUint32(h, uint32(cfg.SampleRate))
+	h = binary.LittleEndian.AppendUint32(h, uint32(cfg.SampleRate*blockAlign))
+	h = binary.LittleEndian.AppendUint16(h, uint16(blockAlign))
+	h = binary.LittleEndian.AppendUint16(h, uint16(8*width))
+	if extensible {
+		h = binary.LittleEndian.AppendUint16(h, 22)                     // extension size
+		h = binary.LittleEndian.AppendUint16(h, uint16(cfg.SampleSize)) // valid bits
+		h = binary.LittleEndian.AppendUint32(h, channelMask(cfg.NumChannels))
+		h = append(h, subtypePCM[:]...)
+	}
+	h = append(h, "data\x00\x00\x00\x00"...)
+	return h
+}
+
+// channelMasks are the speaker positions of the ALAC layouts, by number of
+// channels, in the WAV order of wavToALAC. The surrounds are back
+// speakers, and the Lc Rc of 7.1 front left and right of center, as in
+// ffmpeg.
+var channelMasks = [8]uint32{
+	0x4,   // FC
+	0x3,   // FL FR
+	0x7,   // FL FR FC
+	0x107, // FL FR FC BC
+	0x37,  // FL FR FC BL BR
+	0x3f,  // FL FR FC LFE BL BR
+	0x13f, // FL FR FC LFE BL BR BC
+	0xff,  // FL FR FC LFE BL BR FLC FRC
+}
+
+// channelMask returns the speaker positions of the channels.
+func channelMask(channels int) uint32 {
+	return channelMasks[channels-1]
+}
+
+// setSizes sets the data size, and the RIFF size and the number of sample
+// frames which follow from it. Unknown sizes are set to the maximum. RF64
+// files have the sizes in the ds64 chunk, and the maximum elsewhere.
+func (w *Writer) setSizes(data int64, known bool) {
+	var (
+		riff, size, frames = uint64(math.MaxUint64), uint64(math.MaxUint64), uint64(math.MaxUint64)
+		riff32, size32     = uint32(math.MaxUint32), uint32(math.MaxUint32)
+	)
+	if known {
+		riff = uint64(int64(len(w.header)) - 8 + data + data&1)
+		size = uint64(data)
+		frames = size / uint64(w.blockAlign)
+		if !w.rf64 {
+			riff32, size32 = uint32(riff), uint32(size)
+		}
+	}
+	binary.LittleEndian.PutUint32(w.header[4:], riff32)
+	binary.LittleEndian.PutUint32(w.header[len(w.header)-4:], size32)
+	if w.rf64 {
+		ds := w.header[offDS64:]
+		binary.LittleEndian.PutUint64(ds[0:], riff)
+		binary.LittleEndian.PutUint64(ds[8:], size)
+		binary.LittleEndian.PutUint64(ds[16:], frames)
+	}
+}
+
+// maxData is the most PCM which fits, with the header and the padding byte,
+// in the 32 bit RIFF size.
+func (w *Writer) maxData() int64 {
+	if w.rf64 {
+		return math.MaxInt64 - int64(len(w.header))
+	}
+	return math.MaxUint32 - int64(len(w.header)) + 8 - 1
+}
+
+// Write writes PCM, in ALAC channel order, as Decode gives it. Streams of
+// more than 2 channels are written in WAV order, so the end of a sample
+// which doesn't fit in a Write waits for the next one. It fails with
+// ErrTooLarge once the file would go over the 4GB limit of WAV, unless
+// it's an RF64 file.
+func (w *Writer) Write(pcm []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.data+int64(len(w.pending)+len(pcm)) > w.maxData() {
+		return 0, ErrTooLarge
+	}
+	if w.order == nil {
+		return w.write(pcm)
+	}
+
+	w.tmp = append(append(w.tmp[:0], w.pending...), pcm...)
+	n := len(w.tmp) - len(w.tmp)%w.blockAlign
+	w.reorder(w.tmp[:n])
+	if _, err := w.write(w.tmp[:n]); err != nil {
+		return 0, err
+	}
+	w.pending = append(w.pending[:0], w.tmp[n:]...)
+	return len(pcm), nil
+}
+
+func (w *Writer) write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	w.data += int64(n)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
+
+// reorder puts the channels of whole samples in WAV order.
+func (w *Writer) reorder(pcm []byte) {
+	width := w.blockAlign / len(w.order)
+	for ; len(pcm) > 0; pcm = pcm[w.blockAlign:] {
+		copy(w.block, pcm[:w.blockAlign])
+		for c, wav := range w.order {
+			copy(pcm[wav*width:(wav+1)*width], w.block[c*width:])
+		}
+	}
+}
+
+// Close adds the padding byte WAV needs after an odd amount of PCM, and
+// updates the header if the underlying writer is an io.WriteSeeker. The
+// start of a sample a Write left is written as it is. It doesn't close the
+// underlying writer.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if len(w.pending) > 0 {
+		if _, err := w.write(w.pending); err != nil {
+			return err
+		}
+	}
+	w.err = errors.New("alacwav: writer is closed")
+	if w.data&1 != 0 {
+		if _, err := w.w.Write([]byte{0}); err != nil {
+			return err
+		}
+	}
+	s, ok := w.w.(io.WriteSeeker)
+	if !ok {
+		return nil
+	}
+	w.setSizes(w.data, true)
+	if _, err := s.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := s.Write(w.header); err != nil {
+		return err
+	}
+	_, err := s.Seek(0, io.SeekEnd)
+	return err
+}
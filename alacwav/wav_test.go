@@ -0,0 +1,196 @@
+package alacwav
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/alicebob/alac"
+)
+
+func TestWriter(t *testing.T) {
+	cfg := alac.DefaultConfig()
+
+	t.Run("file", func(t *testing.T) {
+		f, err := os.Create(t.TempDir() + "/out.wav")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		w, err := NewWriter(f, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte{1, 2, 3, 4}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte{5, 6, 7, 8}); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		have, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := mustHex(t, "52494646"+"2c000000"+"57415645"+ // RIFF, 44 bytes, WAVE
+			"666d7420"+"10000000"+ // fmt, 16 bytes
+			"0100"+"0200"+"44ac0000"+"10b10200"+"0400"+"1000"+ // PCM, 2 channels, 44100 Hz, 176400 bytes/s, 4 bytes/frame, 16 bits
+			"64617461"+"08000000"+"0102030405060708") // data, 8 bytes
+		if !bytes.Equal(have, want) {
+			t.Errorf("have\n%x\nwant\n%x", have, want)
+		}
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, alac.Config{SampleRate: 96000, SampleSize: 24, NumChannels: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte{1, 2, 3}); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		want := mustHex(t, "52494646"+"ffffffff"+"57415645"+ // sizes unknown
+			"666d7420"+"28000000"+ // fmt, 40 bytes
+			"feff"+"0100"+"00770100"+"00650400"+"0300"+"1800"+ // extensible, 1 channel, 96000 Hz, 288000 bytes/s, 3 bytes/frame, 24 bits
+			"1600"+"1800"+"04000000"+"0100000000001000800000aa00389b71"+ // 24 valid bits, front center, PCM
+			"64617461"+"ffffffff"+"010203"+"00") // padding
+		if have := buf.Bytes(); !bytes.Equal(have, want) {
+			t.Errorf("have\n%x\nwant\n%x", have, want)
+		}
+		if _, err := w.Write([]byte{1}); err == nil {
+			t.Errorf("write after close worked")
+		}
+	})
+
+	t.Run("rf64", func(t *testing.T) {
+		f, err := os.Create(t.TempDir() + "/out.wav")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		w, err := NewRF64Writer(f, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte{1, 2, 3, 4, 5, 6, 7, 8}); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		have, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := mustHex(t, "52463634"+"ffffffff"+"57415645"+ // RF64, size in ds64, WAVE
+			"64733634"+"1c000000"+ // ds64, 28 bytes
+			"5000000000000000"+"0800000000000000"+"0200000000000000"+"00000000"+ // RIFF 80 bytes, data 8 bytes, 2 frames, no table
+			"666d7420"+"10000000"+
+			"0100"+"0200"+"44ac0000"+"10b10200"+"0400"+"1000"+
+			"64617461"+"ffffffff"+"0102030405060708") // data, size in ds64
+		if !bytes.Equal(have, want) {
+			t.Errorf("have\n%x\nwant\n%x", have, want)
+		}
+
+	})
+
+	t.Run("5.1", func(t *testing.T) {
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, alac.Config{SampleRate: 48000, SampleSize: 16, NumChannels: 6})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// C L R Ls Rs LFE, twice, in writes which split the samples
+		pcm := mustHex(t, "c000"+"1000"+"2000"+"3000"+"4000"+"5000"+
+			"c100"+"1100"+"2100"+"3100"+"4100"+"5100")
+		for _, b := range [][]byte{pcm[:5], pcm[5:13], pcm[13:]} {
+			if n, err := w.Write(b); err != nil || n != len(b) {
+				t.Fatalf("have %d, %v, want %d", n, err, len(b))
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		want := mustHex(t, "52494646"+"ffffffff"+"57415645"+
+			"666d7420"+"28000000"+
+			"feff"+"0600"+"80bb0000"+"00ca0800"+"0c00"+"1000"+ // extensible, 6 channels, 48000 Hz, 576000 bytes/s, 12 bytes/frame, 16 bits
+			"1600"+"1000"+"3f000000"+"0100000000001000800000aa00389b71"+ // 16 valid bits, 5.1, PCM
+			"64617461"+"ffffffff"+
+			"1000"+"2000"+"c000"+"5000"+"3000"+"4000"+ // L R C LFE Ls Rs
+			"1100"+"2100"+"c100"+"5100"+"3100"+"4100")
+		if have := buf.Bytes(); !bytes.Equal(have, want) {
+			t.Errorf("have\n%x\nwant\n%x", have, want)
+		}
+	})
+
+	t.Run("20 bit", func(t *testing.T) {
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, alac.Config{SampleRate: 48000, SampleSize: 20, NumChannels: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte{0x10, 0x32, 0x54, 0x70, 0x98, 0xba}); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		want := mustHex(t, "52494646"+"ffffffff"+"57415645"+
+			"666d7420"+"28000000"+
+			"feff"+"0200"+"80bb0000"+"00650400"+"0600"+"1800"+ // extensible, 2 channels, 48000 Hz, 288000 bytes/s, 6 bytes/frame, 24 bits
+			"1600"+"1400"+"03000000"+"0100000000001000800000aa00389b71"+ // 20 valid bits, stereo, PCM
+			"64617461"+"ffffffff"+"1032547098ba")
+		if have := buf.Bytes(); !bytes.Equal(have, want) {
+			t.Errorf("have\n%x\nwant\n%x", have, want)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, cfg := range []alac.Config{
+			{SampleRate: 0, SampleSize: 16, NumChannels: 2},
+			{SampleRate: 44100, SampleSize: 12, NumChannels: 2},
+			{SampleRate: 44100, SampleSize: 16, NumChannels: 9},
+		} {
+			if _, err := NewWriter(&bytes.Buffer{}, cfg); err == nil {
+				t.Errorf("%+v: no error", cfg)
+			}
+		}
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		w, err := NewWriter(&bytes.Buffer{}, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.data = w.maxData() - 1
+		if _, err := w.Write(make([]byte, 2)); !errors.Is(err, ErrTooLarge) {
+			t.Errorf("have %v, want %v", err, ErrTooLarge)
+		}
+
+		rf, err := NewRF64Writer(&bytes.Buffer{}, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rf.data = 1 << 33
+		if _, err := rf.Write(make([]byte, 2)); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
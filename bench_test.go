@@ -0,0 +1,206 @@
+package alac
+
+import (
+	"context"
+	"testing"
+)
+
+func BenchmarkDecode(b *testing.B) {
+	var frames [][]byte
+	for enc := range testFrames {
+		frames = append(frames, mustHex(enc))
+	}
+	a, err := New()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(frames) * 352 * 4))
+	for b.Loop() {
+		for _, f := range frames {
+			if _, err := a.DecodeFrame(f); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkDecodeVerbatim(b *testing.B) {
+	ch := make([]int32, 4096)
+	for i := range ch {
+		ch[i] = int32(i*7919) % (1 << 23)
+	}
+	frame := verbatimFrame(24, 4096, [][]int32{ch, ch})
+	a, err := NewWithConfig(Config{SampleRate: 44100, SampleSize: 24, NumChannels: 2, FrameSize: 4096})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(4096 * 6)
+	for b.Loop() {
+		if _, err := a.DecodeFrame(frame); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeToInt32(b *testing.B) {
+	ch := make([]int32, 4096)
+	for i := range ch {
+		ch[i] = int32(i*7919) % (1 << 23)
+	}
+	frame := verbatimFrame(24, 4096, [][]int32{ch, ch})
+	a, err := NewWithConfig(Config{SampleRate: 44100, SampleSize: 24, NumChannels: 2, FrameSize: 4096})
+	if err != nil {
+		b.Fatal(err)
+	}
+	dst := make([]int32, 4096*2)
+	b.SetBytes(4096 * 6)
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := a.DecodeToInt32(frame, dst); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeSilence(b *testing.B) {
+	frame := silentFrame([]int16{160, -190, 170, -130, 80, -30, 10, -5}, 2, 4096)
+	a, err := NewWithConfig(Config{SampleRate: 44100, SampleSize: 16, NumChannels: 2, FrameSize: 4096})
+	if err != nil {
+		b.Fatal(err)
+	}
+	dst := make([]byte, a.FrameBytes())
+	b.SetBytes(int64(len(dst)))
+	for b.Loop() {
+		if _, err := a.DecodeInto(dst, frame); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeInto(b *testing.B) {
+	var frames [][]byte
+	for enc := range testFrames {
+		frames = append(frames, mustHex(enc))
+	}
+	a, err := New()
+	if err != nil {
+		b.Fatal(err)
+	}
+	dst := make([]byte, a.FrameBytes())
+	b.SetBytes(int64(len(frames) * len(dst)))
+	b.ReportAllocs()
+	for b.Loop() {
+		for _, f := range frames {
+			if _, err := a.DecodeInto(dst, f); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	if allocs := testing.AllocsPerRun(10, func() { a.DecodeInto(dst, frames[0]) }); allocs != 0 {
+		b.Errorf("have %v allocs/op, want 0", allocs)
+	}
+}
+
+func BenchmarkBufferPool(b *testing.B) {
+	var (
+		pool  BufferPool
+		frame = testFrame("20")
+	)
+	a, err := New(WithBufferPool(&pool))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for b.Loop() {
+		pool.Release(a.Decode(frame))
+	}
+}
+
+func BenchmarkParallelChannels(b *testing.B) {
+	frame := compressedFrame(
+		[]int16{160, -190, 170, -130, 80, -30, 10, -5},
+		[][]int32{noise(4096, 1), noise(4096, 2)},
+	)
+	cfg := Config{SampleRate: 44100, SampleSize: 16, NumChannels: 2, FrameSize: 4096}
+	for _, c := range []struct {
+		name string
+		opts []Option
+	}{
+		{"sequential", nil},
+		{"parallel", []Option{WithParallelChannels()}},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			a, err := NewWithConfig(cfg, c.opts...)
+			if err != nil {
+				b.Fatal(err)
+			}
+			dst := make([]byte, a.FrameBytes())
+			b.SetBytes(int64(len(dst)))
+			for b.Loop() {
+				if _, err := a.DecodeInto(dst, frame); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkParallelDecoder(b *testing.B) {
+	var frames [][]byte
+	for i := int32(0); i < 16; i++ {
+		frames = append(frames, compressedFrame(
+			[]int16{160, -190, 170, -130, 80, -30, 10, -5},
+			[][]int32{noise(4096, 2*i), noise(4096, 2*i+1)},
+		))
+	}
+	a, err := NewWithConfig(Config{SampleRate: 44100, SampleSize: 16, NumChannels: 2, FrameSize: 4096})
+	if err != nil {
+		b.Fatal(err)
+	}
+	ctx := context.Background()
+	p := NewParallelDecoder(a, 0)
+	b.SetBytes(int64(len(frames) * a.FrameBytes()))
+	for b.Loop() {
+		if _, err := p.DecodeAll(ctx, frames); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkLowLatency is the worst case for WithLowLatency: a stereo
+// AirPlay frame with the most predictor coefficients, and every residual
+// escaped.
+func BenchmarkLowLatency(b *testing.B) {
+	coefs := make([]int16, 30) // 31 selects the fixed predictor
+	for i := range coefs {
+		coefs[i] = int16(100 - 7*i)
+	}
+	frame := compressedFrame(coefs, [][]int32{noise(352, 1), noise(352, 2)})
+	a, err := New(WithLowLatency())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(352 * 4)
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := a.DecodeFrame(frame); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	cfg := Config{SampleRate: 44100, SampleSize: 16, NumChannels: 2, FrameSize: 4096}
+	signals := testSignals(cfg.FrameSize, 16)
+	pcm := interleavePCM(16, signals["sine"], signals["noise"])
+	e, err := NewEncoder(cfg)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(pcm)))
+	for b.Loop() {
+		if _, err := e.Encode(pcm); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package alac
+
+import "encoding/binary"
+
+// maxChannels is the most channels of a stream, the most ALAC has layouts
+// for.
+const maxChannels = 8
+
+// channelLayoutSize is the size of an ALACChannelLayoutInfo, the 'chan'
+// atom which follows the config in the magic cookie of a stream with more
+// than 2 channels.
+const channelLayoutSize = 24
+
+// channelLayouts are the layouts of ALAC streams by number of channels,
+// from Apple's encoder: the order of the channels in the PCM, the channels
+// of each element of a frame, and the CoreAudio layout tag. Like Apple's
+// encoder, the LFE channel is stored in an SCE; some decoders, such as
+// ffmpeg's, don't take LFE elements.
+var channelLayouts = [maxChannels]struct {
+	elements []int
+	tag      uint32
+}{
+	{[]int{1}, 100<<16 | 1},             // mono: C
+	{[]int{2}, 101<<16 | 2},             // stereo: L R
+	{[]int{1, 2}, 113<<16 | 3},          // MPEG 3.0 B: C L R
+	{[]int{1, 2, 1}, 116<<16 | 4},       // MPEG 4.0 B: C L R Cs
+	{[]int{1, 2, 2}, 120<<16 | 5},       // MPEG 5.0 D: C L R Ls Rs
+	{[]int{1, 2, 2, 1}, 124<<16 | 6},    // MPEG 5.1 D: C L R Ls Rs LFE
+	{[]int{1, 2, 2, 1, 1}, 142<<16 | 7}, // AAC 6.1: C L R Ls Rs Cs LFE
+	{[]int{1, 2, 2, 2, 1}, 127<<16 | 8}, // MPEG 7.1 B: C Lc Rc L R Ls Rs LFE
+}
+
+// ChannelLayoutTag returns the CoreAudio channel layout tag of ALAC streams
+// of channels channels, or 0 for unsupported counts. See Encoder for the
+// order of the channels.
+func ChannelLayoutTag(channels int) uint32 {
+	if channels < 1 || channels > maxChannels {
+		return 0
+	}
+	return channelLayouts[channels-1].tag
+}
+
+// appendChannelLayout appends the ALACChannelLayoutInfo of streams of
+// channels channels: the layout tag, without a channel bitmap or channel
+// descriptions.
+func appendChannelLayout(b []byte, channels int) []byte {
+	b = binary.BigEndian.AppendUint32(b, channelLayoutSize)
+	b = append(b, "chan"...)
+	b = binary.BigEndian.AppendUint32(b, 0) // version and flags
+	b = binary.BigEndian.AppendUint32(b, ChannelLayoutTag(channels))
+	b = binary.BigEndian.AppendUint32(b, 0)    // channel bitmap
+	return binary.BigEndian.AppendUint32(b, 0) // channel descriptions
+}
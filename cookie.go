@@ -0,0 +1,111 @@
+package alac
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// cookieSize is the size of a bare ALACSpecificConfig.
+const cookieSize = 24
+
+// ParseMagicCookie parses an ALACSpecificConfig, the "magic cookie" found in
+// the 'alac' atom of an M4A file or in the 'kuki' chunk of a CAF file.
+//
+// Like Apple's decoder it accepts the bare 24 byte config, the config still
+// wrapped in its 12 byte 'alac' atom header (36 bytes), and the QuickTime
+// form which is preceded by a 'frma' atom. Any trailing data, such as a
+// channel layout, is ignored.
+func ParseMagicCookie(cookie []byte) (Config, error) {
+	// skip format ('frma') atom if present
+	if len(cookie) >= 12 && string(cookie[4:8]) == "frma" {
+		cookie = cookie[12:]
+	}
+	// skip 'alac' atom header if present
+	if len(cookie) >= 12 && string(cookie[4:8]) == "alac" {
+		cookie = cookie[12:]
+	}
+	if len(cookie) < cookieSize {
+		return Config{}, fmt.Errorf("%w: magic cookie too short: %d bytes", ErrInvalidConfig, len(cookie))
+	}
+
+	// frameLength(4) compatibleVersion(1) bitDepth(1) pb(1) mb(1) kb(1)
+	// numChannels(1) maxRun(2) maxFrameBytes(4) avgBitRate(4) sampleRate(4)
+	if v := cookie[4]; v != 0 {
+		return Config{}, fmt.Errorf("%w: unsupported magic cookie version %d", ErrInvalidConfig, v)
+	}
+	return Config{
+		FrameSize:      int(binary.BigEndian.Uint32(cookie[0:])),
+		SampleSize:     int(cookie[5]),
+		HistoryMult:    int(cookie[6]),
+		InitialHistory: int(cookie[7]),
+		KModifier:      int(cookie[8]),
+		NumChannels:    int(cookie[9]),
+		MaxRun:         int(binary.BigEndian.Uint16(cookie[10:])),
+		MaxFrameBytes:  int(binary.BigEndian.Uint32(cookie[12:])),
+		AvgBitRate:     int(binary.BigEndian.Uint32(cookie[16:])),
+		SampleRate:     int(binary.BigEndian.Uint32(cookie[20:])),
+	}, nil
+}
+
+// MagicCookie returns cfg as a bare 24 byte ALACSpecificConfig, the form
+// stored in an M4A 'alac' atom (after its version and flags), a CAF 'kuki'
+// chunk, or an AirPlay "a=fmtp" line. Zero tuning fields are written with
+// their defaults. For streams of more than 2 channels the config is
+// followed by their 24 byte ALACChannelLayoutInfo, as Apple's encoder does.
+func (cfg Config) MagicCookie() []byte {
+	b := make([]byte, cookieSize, cookieSize+channelLayoutSize)
+	binary.BigEndian.PutUint32(b[0:], uint32(cfg.FrameSize))
+	b[4] = 0 // compatibleVersion
+	b[5] = uint8(cfg.SampleSize)
+	b[6] = uint8(orDefault(cfg.HistoryMult, 40))
+	b[7] = uint8(orDefault(cfg.InitialHistory, 10))
+	b[8] = uint8(orDefault(cfg.KModifier, 14))
+	b[9] = uint8(cfg.NumChannels)
+	binary.BigEndian.PutUint16(b[10:], uint16(orDefault(cfg.MaxRun, 255)))
+	binary.BigEndian.PutUint32(b[12:], uint32(cfg.MaxFrameBytes))
+	binary.BigEndian.PutUint32(b[16:], uint32(cfg.AvgBitRate))
+	binary.BigEndian.PutUint32(b[20:], uint32(cfg.SampleRate))
+	if cfg.NumChannels > 2 {
+		b = appendChannelLayout(b, cfg.NumChannels)
+	}
+	return b
+}
+
+// NewFromMagicCookie creates an ALAC decoder configured by a magic cookie.
+// See ParseMagicCookie for the accepted formats.
+func NewFromMagicCookie(cookie []byte, opts ...Option) (*Alac, error) {
+	cfg, err := ParseMagicCookie(cookie)
+	if err != nil {
+		return nil, err
+	}
+	return NewWithConfig(cfg, opts...)
+}
+
+// SampleEntry returns cfg as the 'alac' sample entry of an MP4 'stsd' box,
+// for muxers: an AudioSampleEntry with the channels, bit depth, and sample
+// rate, followed by the 'alac' atom with the magic cookie. Sample rates
+// above 65535 Hz don't fit the 16.16 rate of the AudioSampleEntry, which is
+// then 0, as players use the rate from the cookie.
+func (cfg Config) SampleEntry() []byte {
+	var (
+		cookie = cfg.MagicCookie()
+		size   = 36 + 12 + len(cookie) // the AudioSampleEntry, and the 'alac' atom
+		b      = make([]byte, 36, size)
+	)
+	binary.BigEndian.PutUint32(b[0:], uint32(size))
+	copy(b[4:], "alac")
+	// 6 reserved bytes
+	binary.BigEndian.PutUint16(b[14:], 1) // data reference index
+	// version, revision level, and vendor
+	binary.BigEndian.PutUint16(b[24:], uint16(cfg.NumChannels))
+	binary.BigEndian.PutUint16(b[26:], uint16(cfg.SampleSize))
+	// compression ID and packet size
+	if cfg.SampleRate <= 0xFFFF {
+		binary.BigEndian.PutUint32(b[32:], uint32(cfg.SampleRate)<<16)
+	}
+
+	b = binary.BigEndian.AppendUint32(b, uint32(12+len(cookie)))
+	b = append(b, "alac"...)
+	b = binary.BigEndian.AppendUint32(b, 0) // version and flags
+	return append(b, cookie...)
+}
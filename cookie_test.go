@@ -0,0 +1,133 @@
+package alac
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestParseMagicCookie(t *testing.T) {
+	want := Config{
+		SampleRate:     44100,
+		SampleSize:     16,
+		NumChannels:    2,
+		FrameSize:      4096,
+		HistoryMult:    40,
+		InitialHistory: 10,
+		KModifier:      14,
+		MaxRun:         255,
+		MaxFrameBytes:  0x20e7,
+		AvgBitRate:     0x069fe4,
+	}
+
+	for name, cookie := range map[string]string{
+		"bare":      "000010000010280a0e0200ff000020e700069fe40000ac44",
+		"atom":      "00000024616c616300000000" + "000010000010280a0e0200ff000020e700069fe40000ac44",
+		"quicktime": "0000000c66726d61616c6163" + "00000024616c616300000000" + "000010000010280a0e0200ff000020e700069fe40000ac44",
+		"with chan": "000010000010280a0e0200ff000020e700069fe40000ac44" + "000000186368616e000000000064000100000000",
+	} {
+		t.Run(name, func(t *testing.T) {
+			b, err := hex.DecodeString(cookie)
+			if err != nil {
+				t.Fatal(err)
+			}
+			have, err := ParseMagicCookie(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have != want {
+				t.Errorf("have %+v, want %+v", have, want)
+			}
+		})
+	}
+
+	for name, cookie := range map[string]string{
+		"empty":   "",
+		"short":   "000010000010280a0e0200ff000020e700069fe400",
+		"atom":    "00000024616c616300000000",
+		"version": "000010000110280a0e0200ff000020e700069fe40000ac44",
+	} {
+		t.Run("invalid "+name, func(t *testing.T) {
+			b, _ := hex.DecodeString(cookie)
+			if _, err := ParseMagicCookie(b); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
+
+func TestNewFromMagicCookie(t *testing.T) {
+	b, err := hex.DecodeString("000001600010280a0e0200ff00000000000000000000ac44")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewFromMagicCookie(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := a.FrameSize(), 352; have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+
+	for enc, dec := range testFrames {
+		encB, _ := hex.DecodeString(enc)
+		if have, want := hex.EncodeToString(a.Decode(encB)), dec; have != want {
+			t.Errorf("have\n  %s\nwant\n  %s\n", have, want)
+		}
+	}
+}
+
+func TestMagicCookie(t *testing.T) {
+	cfg := Config{
+		SampleRate:     96000,
+		SampleSize:     24,
+		NumChannels:    2,
+		FrameSize:      4096,
+		HistoryMult:    40,
+		InitialHistory: 10,
+		KModifier:      14,
+		MaxRun:         255,
+		MaxFrameBytes:  24588,
+		AvgBitRate:     2304000,
+	}
+	cookie := cfg.MagicCookie()
+	if have, want := hex.EncodeToString(cookie), "000010000018280a0e0200ff0000600c00232800"+"00017700"; have != want {
+		t.Errorf("have %s, want %s", have, want)
+	}
+	have, err := ParseMagicCookie(cookie)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have != cfg {
+		t.Errorf("have %+v, want %+v", have, cfg)
+	}
+
+	// defaults are filled in
+	def := DefaultConfig().MagicCookie()
+	if have, want := hex.EncodeToString(def), "000001600010280a0e0200ff00000000000000000000ac44"; have != want {
+		t.Errorf("have %s, want %s", have, want)
+	}
+}
+
+func TestSampleEntry(t *testing.T) {
+	entry := DefaultConfig().SampleEntry()
+	if have, want := hex.EncodeToString(entry), "00000048616c6163000000000000000100000000000000000002001000000000ac440000"+
+		"00000024616c616300000000"+"000001600010280a0e0200ff00000000000000000000ac44"; have != want {
+		t.Errorf("have %s, want %s", have, want)
+	}
+	cfg, err := ParseMagicCookie(entry[36:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := cfg.FrameSize, 352; have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+
+	// the rate is only in the cookie
+	hires := Config{SampleRate: 192000, SampleSize: 24, NumChannels: 2, FrameSize: 4096}.SampleEntry()
+	if have, want := hex.EncodeToString(hires[32:36]), "00000000"; have != want {
+		t.Errorf("have %s, want %s", have, want)
+	}
+	if have, want := hex.EncodeToString(hires[68:]), "0002ee00"; have != want {
+		t.Errorf("have %s, want %s", have, want)
+	}
+}
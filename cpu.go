@@ -0,0 +1,34 @@
+package alac
+
+// kernel is one implementation of a hot loop.
+type kernel uint8
+
+const (
+	scalar kernel = iota // the Go code, which all others must match
+	sse41
+	avx2
+	neon
+)
+
+func (k kernel) String() string {
+	return [...]string{"scalar", "sse4.1", "avx2", "neon"}[k]
+}
+
+// kernels has the implementation of every hot loop. An optimized version
+// of a loop gets a kernel constant, a case in the function which runs the
+// loop, and an entry in cpuKernels for the CPUs which can run it.
+type kernels struct {
+	firSum kernel
+	mix16  kernel
+}
+
+func (k kernels) String() string {
+	return "fir=" + k.firSum.String() + ",mix16=" + k.mix16.String()
+}
+
+// dispatch is what the decoder runs: the last, and best, of cpuKernels. The
+// tests go through all of them.
+var dispatch = func() kernels {
+	ks := cpuKernels()
+	return ks[len(ks)-1]
+}()
@@ -0,0 +1,28 @@
+//go:build !purego
+
+package alac
+
+// cpuKernels returns the kernels this CPU can run, the scalar ones first.
+func cpuKernels() []kernels {
+	ks := []kernels{{firSum: scalar, mix16: scalar}}
+
+	_, _, ecx1, _ := cpuid(1, 0)
+	if ecx1&(1<<19) != 0 {
+		ks = append(ks, kernels{firSum: sse41, mix16: scalar})
+	}
+
+	// AVX2 also needs the OS to save the YMM registers
+	const osxsave, avx = 1 << 27, 1 << 28
+	if ecx1&osxsave != 0 && ecx1&avx != 0 {
+		if xcr0, _ := xgetbv(); xcr0&6 == 6 {
+			if _, ebx7, _, _ := cpuid(7, 0); ebx7&(1<<5) != 0 {
+				ks = append(ks, kernels{firSum: avx2, mix16: scalar})
+			}
+		}
+	}
+	return ks
+}
+
+func cpuid(eax, ecx uint32) (a, b, c, d uint32)
+
+func xgetbv() (eax, edx uint32)
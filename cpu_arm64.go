@@ -0,0 +1,14 @@
+//go:build !purego
+
+package alac
+
+// cpuKernels returns the kernels this CPU can run, the scalar ones first.
+// ASIMD is part of ARMv8-A, which Go requires, so the NEON kernels could
+// always run, but they haven't run on arm64 hardware yet: until TestFirSum
+// and TestMix16 pass there, the decoder keeps to the scalar ones. Those
+// tests call the NEON kernels directly.
+func cpuKernels() []kernels {
+	return []kernels{
+		{firSum: scalar, mix16: scalar},
+	}
+}
@@ -0,0 +1,8 @@
+//go:build (!amd64 && !arm64) || purego
+
+package alac
+
+// cpuKernels returns the kernels this CPU can run: only the scalar ones.
+func cpuKernels() []kernels {
+	return []kernels{{firSum: scalar, mix16: scalar}}
+}
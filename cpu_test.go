@@ -0,0 +1,34 @@
+package alac
+
+import (
+	"slices"
+	"testing"
+)
+
+// kernelVariants runs fn with every set of kernels the CPU can run.
+func kernelVariants(t testing.TB, fn func(t testing.TB, name string)) {
+	saved := dispatch
+	defer func() { dispatch = saved }()
+
+	for _, k := range cpuKernels() {
+		dispatch = k
+		fn(t, k.String())
+	}
+}
+
+// supported reports whether the CPU runs kernel k for some loop.
+func supported(k kernel) bool {
+	return slices.ContainsFunc(cpuKernels(), func(ks kernels) bool {
+		return ks.firSum == k || ks.mix16 == k
+	})
+}
+
+func TestDispatch(t *testing.T) {
+	ks := cpuKernels()
+	if have, want := ks[0], (kernels{firSum: scalar, mix16: scalar}); have != want {
+		t.Errorf("have %v, want %v", have, want)
+	}
+	if have, want := dispatch, ks[len(ks)-1]; have != want {
+		t.Errorf("have %v, want %v", have, want)
+	}
+}
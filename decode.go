@@ -34,13 +34,18 @@
 package alac
 
 import (
+	"encoding/binary"
 	"fmt"
+	"log/slog"
+	"math/bits"
+	"sync"
 )
 
 type Alac struct {
 	input_buffer                []byte
-	input_buffer_index          int // we rewind the buffer sometimes
-	input_buffer_bitaccumulator int // used so we can do arbitary bit reads
+	input_buffer_index          int  // we rewind the buffer sometimes
+	input_buffer_bitaccumulator int  // used so we can do arbitary bit reads
+	input_buffer_overrun        bool // we tried to read past the end
 
 	samplesize     int
 	numchannels    int
@@ -56,6 +61,11 @@ type Alac struct {
 	uncompressed_bytes_buffer_a []int32
 	uncompressed_bytes_buffer_b []int32
 
+	channels [][]int32 // of frames of more than 2 channels, unmixed
+	multi    bool      // the last frame is in channels
+	pair     [2][]int32
+	mix      [2][]int32 // see WithDownmix
+
 	/* stuff from setinfo */
 	setinfo_max_samples_per_frame uint32 /* 0x1000 = 4096 */ // max samples per frame?
 	setinfo_7a                    uint8  /* 0x00 */
@@ -70,6 +80,35 @@ type Alac struct {
 	setinfo_8a_rate               uint32 /* 0x0000ac44 */
 	/* end setinfo stuff */
 
+	config      Config // as given to NewWithConfig or ResetWithConfig
+	lastSamples int    // samples per channel in the last decoded frame
+
+	stats Stats
+
+	strict       bool        // see WithStrict
+	scanning     bool        // see FrameLength
+	warn         func(error) // see WithWarningHandler
+	maxFrameSize int         // see WithMaxFrameSize
+	maxChannels  int         // see WithMaxChannels
+	onFrame      func(FrameInfo, []byte)
+	logger       *slog.Logger // see SetLogger
+	output       OutputSpec   // see WithOutput
+	dither       Dither       // see WithDither
+	downmix      bool         // see WithDownmix
+	channelMap   []int        // see WithChannelMap
+	gain         float64      // see WithGain
+	gainQ16      int64        // gain in 16.16 fixed point
+	hasGain      bool         // gainQ16 is to be applied
+	levels       bool         // see WithLevels
+	frameLevels  [2]Level     // of the last frame, with levels
+	ditherer     ditherer
+
+	autoReconfigure bool        // see WithAutoReconfigure
+	pool            *BufferPool // see WithBufferPool
+	parallel        bool        // see WithParallelChannels
+	lowLatency      bool        // see WithLowLatency
+	frame           []byte      // the PCM buffer of WithLowLatency
+	arena           []int32     // see WithArena
 }
 
 const host_bigendian = false
@@ -96,14 +135,48 @@ func signExtend24(v int32) int32 {
 }
 
 func (alac *Alac) allocateBuffers() {
-	alac.predicterror_buffer_a = make([]int32, alac.setinfo_max_samples_per_frame*4)
-	alac.predicterror_buffer_b = make([]int32, alac.setinfo_max_samples_per_frame*4)
+	// the C version allocates max_samples_per_frame*4 bytes, that's
+	// max_samples_per_frame int32s.
+	alac.allocateSamples(int(alac.setinfo_max_samples_per_frame))
+	if alac.lowLatency {
+		if n := int(alac.setinfo_max_samples_per_frame) * alac.bytespersample; cap(alac.frame) < n {
+			alac.frame = make([]byte, n)
+		}
+	}
+}
+
+// arenaBuffers is the number of sample buffers allocateSamples sizes.
+const arenaBuffers = 6
+
+// allocateSamples sizes the buffers for frames of n samples. Buffers which
+// are big enough already are reused. New buffers come from the arena, if it
+// has room for all of them.
+func (alac *Alac) allocateSamples(n int) {
+	if a := alac.arena; len(a) >= arenaBuffers*n && cap(alac.outputsamples_buffer_a) < n {
+		alac.predicterror_buffer_a, a = a[:n:n], a[n:]
+		alac.predicterror_buffer_b, a = a[:n:n], a[n:]
+		alac.outputsamples_buffer_a, a = a[:n:n], a[n:]
+		alac.outputsamples_buffer_b, a = a[:n:n], a[n:]
+		alac.uncompressed_bytes_buffer_a, a = a[:n:n], a[n:]
+		alac.uncompressed_bytes_buffer_b = a[:n:n]
+		return
+	}
+	alac.predicterror_buffer_a = resize(alac.predicterror_buffer_a, n)
+	alac.predicterror_buffer_b = resize(alac.predicterror_buffer_b, n)
+
+	alac.outputsamples_buffer_a = resize(alac.outputsamples_buffer_a, n)
+	alac.outputsamples_buffer_b = resize(alac.outputsamples_buffer_b, n)
 
-	alac.outputsamples_buffer_a = make([]int32, alac.setinfo_max_samples_per_frame*4)
-	alac.outputsamples_buffer_b = make([]int32, alac.setinfo_max_samples_per_frame*4)
+	alac.uncompressed_bytes_buffer_a = resize(alac.uncompressed_bytes_buffer_a, n)
+	alac.uncompressed_bytes_buffer_b = resize(alac.uncompressed_bytes_buffer_b, n)
+}
 
-	alac.uncompressed_bytes_buffer_a = make([]int32, alac.setinfo_max_samples_per_frame*4)
-	alac.uncompressed_bytes_buffer_b = make([]int32, alac.setinfo_max_samples_per_frame*4)
+// resize returns b with length n, reallocating only when b is too small.
+func resize(b []int32, n int) []int32 {
+	if cap(b) < n {
+		return make([]int32, n)
+	}
+	return b[:n]
 }
 
 /*
@@ -156,132 +229,46 @@ void alac_set_info(alac_file *alac, char *inputbuffer)
 }
 */
 
-// supports reading 1 to 16 bits, in big endian format
-func (alac *Alac) readbits_16(bits int) uint32 {
-	var result uint32
-
-	result = (uint32(alac.input_buffer[alac.input_buffer_index]) << 16)
-	// bug in the original
-	if len(alac.input_buffer)-alac.input_buffer_index > 1 {
-		result |= (uint32(alac.input_buffer[alac.input_buffer_index+1]) << 8)
-	}
-	// bug in the original
-	if len(alac.input_buffer)-alac.input_buffer_index > 2 {
-		result |= uint32(alac.input_buffer[alac.input_buffer_index+2])
+// peek returns the next 64 bits of input, left aligned, without consuming
+// them. Bits past the end of the input read as zeros. This replaces the
+// byte-at-a-time readbits_16 of the C version: with at least 8 bytes left,
+// which is almost always, it's a single load.
+func (alac *Alac) peek() uint64 {
+	var (
+		buf = alac.input_buffer
+		i   = alac.input_buffer_index
+		w   uint64
+	)
+	if i+8 <= len(buf) {
+		w = binary.BigEndian.Uint64(buf[i : i+8])
+	} else {
+		for j := 0; i+j < len(buf); j++ {
+			w |= uint64(buf[i+j]) << uint(56-8*j)
+		}
 	}
-
-	/* shift left by the number of bits we've already read,
-	 * so that the top 'n' bits of the 24 bits we read will
-	 * be the return bits */
-	result = result << uint(alac.input_buffer_bitaccumulator)
-
-	result = result & 0x00ffffff
-
-	/* and then only want the top 'n' bits from that, where
-	 * n is 'bits' */
-	result = result >> uint(24-bits)
-
-	new_accumulator := (alac.input_buffer_bitaccumulator + bits)
-
-	/* increase the buffer pointer if we've read over n bytes. */
-	alac.input_buffer_index += new_accumulator >> 3
-
-	/* and the remainder goes back into the bit accumulator */
-	alac.input_buffer_bitaccumulator = (new_accumulator & 7)
-
-	return result
+	return w << uint(alac.input_buffer_bitaccumulator)
 }
 
-// supports reading 1 to 32 bits, in big endian format
-func (alac *Alac) readbits(bits int) uint32 {
-	var result int32 = 0
-
-	if bits > 16 {
-		bits -= 16
-		result = int32(alac.readbits_16(16) << uint(bits))
+// skip consumes bits bits, which may be negative to unread bits. Reads past
+// the end set input_buffer_overrun, the caller checks it when it's done.
+func (alac *Alac) skip(bits int) {
+	new_accumulator := alac.input_buffer_bitaccumulator + bits
+	alac.input_buffer_index += new_accumulator >> 3
+	alac.input_buffer_bitaccumulator = new_accumulator & 7
+	if alac.bitsLeft() < 0 {
+		alac.input_buffer_overrun = true
 	}
-
-	result |= int32(alac.readbits_16(bits))
-
-	return uint32(result)
 }
 
-/* reads a single bit */
-func (alac *Alac) readbit() int {
-	result := int(alac.input_buffer[alac.input_buffer_index])
-	result = result << uint(alac.input_buffer_bitaccumulator)
-	result = result >> 7 & 1
-
-	new_accumulator := int(alac.input_buffer_bitaccumulator + 1)
-	alac.input_buffer_index += new_accumulator / 8
-	alac.input_buffer_bitaccumulator = (new_accumulator % 8)
-
+// supports reading 0 to 32 bits, in big endian format
+func (alac *Alac) readbits(bits int) uint32 {
+	result := uint32(alac.peek() >> uint(64-bits))
+	alac.skip(bits)
 	return result
 }
 
-func (alac *Alac) unreadbits(bits int) {
-	new_accumulator := int(alac.input_buffer_bitaccumulator - bits)
-
-	alac.input_buffer_index += new_accumulator >> 3
-
-	alac.input_buffer_bitaccumulator = (new_accumulator & 7)
-	if alac.input_buffer_bitaccumulator < 0 {
-		alac.input_buffer_bitaccumulator *= -1
-	}
-}
-
 func count_leading_zeros(input int) int {
-	output := 0
-	curbyte := 0
-
-	curbyte = input >> 24
-	if curbyte > 0 {
-		goto found
-	}
-	output += 8
-
-	curbyte = input >> 16
-	if curbyte&0xff > 0 {
-		goto found
-	}
-	output += 8
-
-	curbyte = input >> 8
-	if curbyte&0xff > 0 {
-		goto found
-	}
-	output += 8
-
-	curbyte = input
-	if curbyte&0xff > 0 {
-		goto found
-	}
-	output += 8
-
-	return output
-
-found:
-	if (curbyte & 0xf0) == 0 {
-		output += 4
-	} else {
-		curbyte >>= 4
-	}
-
-	if curbyte&0x8 > 0 {
-		return output
-	}
-	if curbyte&0x4 > 0 {
-		return output + 1
-	}
-	if curbyte&0x2 > 0 {
-		return output + 2
-	}
-	if curbyte&0x1 > 0 {
-		return output + 3
-	}
-
-	/* shouldn't get here: */
-	return output + 4
+	return bits.LeadingZeros32(uint32(input))
 }
 
 const rice_threshold = 8 // maximum number of bits for a rice prefix.
@@ -291,37 +278,43 @@ func (alac *Alac) entropyDecodeValue(
 	k int,
 	rice_kmodifier_mask int,
 ) int32 {
-	x := int32(0) // decoded value
+	// one peek has all the bits we need: at most 9 bits of prefix and 32
+	// bits of value, and 57 bits are always valid.
+	w := alac.peek()
 
-	// read x, number of 1s before 0 represent the rice value.
-	for x <= rice_threshold && alac.readbit() != 0 {
-		x++
-	}
+	// x, the number of 1s before the 0, is the rice value. A lookup table
+	// of (k, next 12 bits) -> (value, length), for k up to 15, made
+	// BenchmarkDecode 5 to 20% slower than this count and a few shifts:
+	// the 256KB of tables don't fit in L1, and the count is one
+	// instruction.
+	x := bits.LeadingZeros64(^w)
 
 	if x > rice_threshold {
-		// read the number from the bit stream (raw value)
-		value := int32(alac.readbits(readSampleSize))
-
-		// mask value
-		value &= int32((uint32(0xffffffff) >> uint(32-readSampleSize)))
+		// an escape: the prefix is rice_threshold+1 ones, followed by the
+		// raw value.
+		w <<= rice_threshold + 1
+		alac.skip(rice_threshold + 1 + readSampleSize)
+		return int32(uint32(w >> uint(64-readSampleSize)))
+	}
 
-		x = value
-	} else {
-		if k != 1 {
-			extraBits := int(alac.readbits(k))
+	value := int32(x)
+	n := x + 1 // the prefix and the 0
+	if k != 1 {
+		extraBits := int(w << uint(n) >> uint(64-k))
 
-			// x = x * (2^k - 1)
-			x *= int32((((1 << uint(k)) - 1) & rice_kmodifier_mask))
+		// x = x * (2^k - 1)
+		value *= int32((((1 << uint(k)) - 1) & rice_kmodifier_mask))
 
-			if extraBits > 1 {
-				x += int32(extraBits - 1)
-			} else {
-				alac.unreadbits(1)
-			}
+		if extraBits > 1 {
+			value += int32(extraBits - 1)
+			n += k
+		} else {
+			n += k - 1 // the C version reads k bits and unreads one
 		}
 	}
+	alac.skip(n)
 
-	return x
+	return value
 }
 
 func (alac *Alac) entropyRiceDecode(
@@ -332,13 +325,16 @@ func (alac *Alac) entropyRiceDecode(
 	rice_kmodifier int,
 	rice_historymult int,
 	rice_kmodifier_mask int,
-) {
+) error {
 	var (
 		history      int = rice_initialhistory
 		signModifier int = 0
+		// out is what's left to decode. Consuming it from the front, rather
+		// than indexing, lets the compiler drop the bounds checks.
+		out = outputBuffer[:outputSize]
 	)
 
-	for outputCount := 0; outputCount < outputSize; outputCount++ {
+	for len(out) > 0 {
 		var (
 			decodedValue int32
 			finalValue   int32
@@ -362,7 +358,7 @@ func (alac *Alac) entropyRiceDecode(
 			finalValue *= -1
 		}
 
-		outputBuffer[outputCount] = finalValue
+		out[0] = finalValue
 
 		signModifier = 0
 
@@ -370,12 +366,14 @@ func (alac *Alac) entropyRiceDecode(
 		history += (int(decodedValue) * rice_historymult) -
 			((history * rice_historymult) >> 9)
 
-		if decodedValue > 0xFFFF {
+		// unsigned, as in Apple's decoder, so a 32 bit escape value can't
+		// make the history negative.
+		if uint32(decodedValue) > 0xFFFF {
 			history = 0xFFFF
 		}
 
 		// special case, for compressed blocks of 0
-		if (history < 128) && (outputCount+1 < outputSize) {
+		if (history < 128) && (len(out) > 1) {
 			var blockSize int32
 
 			signModifier = 1
@@ -385,23 +383,36 @@ func (alac *Alac) entropyRiceDecode(
 			// note: blockSize is always 16bit
 			blockSize = int32(alac.entropyDecodeValue(16, int(k), rice_kmodifier_mask))
 
-			// got blockSize 0s
-			if blockSize > 0 {
-				// memset(&outputBuffer[outputCount+1], 0, blockSize*sizeof(*outputBuffer))
-				// Note: blockSize is element count, not bytes
-				for i := outputCount + 1; i < outputCount+1+int(blockSize); i++ {
-					outputBuffer[i] = 0
-				}
-				outputCount += int(blockSize)
+			done := 1 + int(blockSize)
+			if blockSize < 0 || done > len(out) {
+				return fmt.Errorf("%w: block of %d zeros overflows the frame", ErrInvalidFrame, blockSize)
 			}
 
+			// got blockSize 0s
+			// memset(&outputBuffer[outputCount+1], 0, blockSize*sizeof(*outputBuffer))
+			// Note: blockSize is element count, not bytes
+			clear(out[1:done])
+
 			if blockSize > 0xFFFF {
 				signModifier = 0
 			}
 
 			history = 0
+			out = out[done:]
+			continue
+		}
+		out = out[1:]
+	}
+	return nil
+}
+
+func allZero(b []int32) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
 		}
 	}
+	return true
 }
 
 func sign_extended32(val int32, bits int) int32 {
@@ -427,17 +438,34 @@ func predictorDecompressFirAdapt(
 	predictor_coef_num int,
 	predictor_quantitization int,
 ) {
+	if output_size <= 0 {
+		return
+	}
+	// fixing both lengths up front drops the bounds checks in the loops
+	buffer_out = buffer_out[:output_size]
+	error_buffer = error_buffer[:output_size]
+
 	/* first sample always copies */
 	// *buffer_out = *error_buffer;
 	buffer_out[0] = error_buffer[0]
 
 	if predictor_coef_num == 0 {
-		if output_size <= 1 {
-			return
-		}
 		// memcpy(buffer_out+1, error_buffer+1, (output_size-1) * 4);
 		// Note: Go's copy() on []int32 copies elements, not bytes
-		copy(buffer_out[1:], error_buffer[1:output_size])
+		copy(buffer_out[1:], error_buffer[1:])
+		return
+	}
+
+	// silence, or any other constant signal, only has the first residual.
+	// Every predictor then repeats the first sample, without adapting.
+	if first := buffer_out[0]; first == sign_extended32(first, readsamplesize) && allZero(error_buffer[1:]) {
+		if first == 0 {
+			clear(buffer_out[1:])
+			return
+		}
+		for i := 1; i < len(buffer_out); i++ {
+			buffer_out[i] = first
+		}
 		return
 	}
 
@@ -445,13 +473,10 @@ func predictorDecompressFirAdapt(
 		/* second-best case scenario for fir decompression,
 		 * error describes a small difference from the previous sample only
 		 */
-		if output_size <= 1 {
-			return
-		}
-		for i := 0; i < output_size-1; i++ {
-			prev_value := buffer_out[i]
-			error_value := error_buffer[i+1]
-			buffer_out[i+1] = int32(sign_extended32((prev_value + error_value),
+		for i := 1; i < len(buffer_out); i++ {
+			prev_value := buffer_out[i-1]
+			error_value := error_buffer[i]
+			buffer_out[i] = int32(sign_extended32((prev_value + error_value),
 				readsamplesize))
 		}
 		return
@@ -459,91 +484,130 @@ func predictorDecompressFirAdapt(
 
 	/* read warm-up samples */
 	if predictor_coef_num > 0 {
-		for i := 0; i < predictor_coef_num; i++ {
-			val := buffer_out[i] + error_buffer[i+1]
+		// short frames can have fewer samples than warm-up samples
+		for i := 1; i <= predictor_coef_num && i < len(buffer_out); i++ {
+			val := buffer_out[i-1] + error_buffer[i]
 
 			val = sign_extended32(val, readsamplesize)
 
-			buffer_out[i+1] = val
+			buffer_out[i] = val
 		}
 	}
 
 	/* general case */
 	if predictor_coef_num > 0 {
-		for i := predictor_coef_num + 1; i < output_size; i++ {
+		// coefs is predictor_coef_table reversed, so coefs[k] goes with
+		// buffer_out[k+1], which lets firSum walk both forwards. They're
+		// int32 for the SIMD versions, but we keep the int16 wrapping.
+		var coefs [32]int32
+		for k := 0; k < predictor_coef_num; k++ {
+			coefs[k] = int32(predictor_coef_table[predictor_coef_num-1-k])
+		}
+
+		c := coefs[:predictor_coef_num]
+		for i := predictor_coef_num + 1; i < len(buffer_out); i++ {
 			var (
-				sum       int = 0
+				sum       int
 				outval    int
 				error_val = error_buffer[i]
+				// the C version moves buffer_out along, we take a window:
+				// base is buffer_out[0] there, x is buffer_out[1:]
+				window = buffer_out[i-predictor_coef_num-1 : i]
+				base   = window[0]
+				x      = window[1:][:len(c)]
 			)
 
-			for j := 0; j < predictor_coef_num; j++ {
-				sum += int((buffer_out[predictor_coef_num-j] - buffer_out[0]) *
-					int32(predictor_coef_table[j]))
-			}
+			sum = int(firSum(x, c, base))
 
 			outval = (1 << uint(predictor_quantitization-1)) + sum
 			outval = outval >> uint(predictor_quantitization)
-			outval = outval + int(buffer_out[0]) + int(error_val)
+			outval = outval + int(base) + int(error_val)
 			outval = int(sign_extended32(int32(outval), readsamplesize))
 
-			buffer_out[predictor_coef_num+1] = int32(outval)
+			buffer_out[i] = int32(outval)
 
+			// predictor_num in the C version is predictor_coef_num-1-k
 			if error_val > 0 {
-				var predictor_num int = predictor_coef_num - 1
+				for k := 0; k < len(c) && error_val > 0; k++ {
+					val := int(base - x[k])
+					sign := sign_only(val)
 
-				for predictor_num >= 0 && error_val > 0 {
-					var val int = int(buffer_out[0] -
-						buffer_out[predictor_coef_num-predictor_num])
-					var sign int = sign_only(val)
-
-					predictor_coef_table[predictor_num] -= int16(sign)
+					c[k] = int32(int16(c[k] - int32(sign)))
 
 					val *= sign /* absolute value */
 
-					error_val -= int32((val >> uint(predictor_quantitization)) *
-						(predictor_coef_num - predictor_num))
-
-					predictor_num--
+					error_val -= int32((val >> uint(predictor_quantitization)) * (k + 1))
 				}
 			} else if error_val < 0 {
-				predictor_num := predictor_coef_num - 1
-
-				for predictor_num >= 0 && error_val < 0 {
-					val := int(buffer_out[0] -
-						buffer_out[predictor_coef_num-predictor_num])
-					sign := -sign_only(int(val))
+				for k := 0; k < len(c) && error_val < 0; k++ {
+					val := int(base - x[k])
+					sign := -sign_only(val)
 
-					predictor_coef_table[predictor_num] -= int16(sign)
+					c[k] = int32(int16(c[k] - int32(sign)))
 
 					val *= sign /* neg value */
 
-					error_val -= int32((val >> uint(predictor_quantitization)) *
-						(predictor_coef_num - predictor_num))
-
-					predictor_num--
+					error_val -= int32((val >> uint(predictor_quantitization)) * (k + 1))
 				}
 			}
-
-			buffer_out = buffer_out[1:]
 		}
 	}
 }
 
+// firSumGeneric is the dot product of the adaptive FIR: the sum of
+// (x[k]-base)*c[k]. Like the C version the products wrap at 32 bits, but
+// the sum doesn't.
+func firSumGeneric(x, c []int32, base int32) int64 {
+	var sum int64
+	x = x[:len(c)]
+	for k, cv := range c {
+		sum += int64((x[k] - base) * cv)
+	}
+	return sum
+}
+
+// put16 stores a 16 bit sample. The C version left this to a _Swap16 on
+// big endian hosts.
+func put16(b []byte, s int16, bigendian bool) {
+	if bigendian {
+		b[0], b[1] = byte(s>>8), byte(s)
+		return
+	}
+	b[0], b[1] = byte(s), byte(s>>8)
+}
+
+func put32(b []byte, s int32, bigendian bool) {
+	if bigendian {
+		b[0], b[1], b[2], b[3] = byte(s>>24), byte(s>>16), byte(s>>8), byte(s)
+		return
+	}
+	b[0], b[1], b[2], b[3] = byte(s), byte(s>>8), byte(s>>16), byte(s>>24)
+}
+
 func deinterlace_16(
 	buffer_a, buffer_b []int32,
 	buffer_out []byte, // was an []int16
 	numchannels, numsamples int,
 	interlacing_shift uint8,
 	interlacing_leftweight uint8,
+	bigendian bool,
 ) {
 	if numsamples <= 0 {
 		return
 	}
 
+	start := 0
+	if numchannels == 2 && !bigendian && interlacing_shift < 32 {
+		start = mix16(buffer_out, buffer_a, buffer_b, numsamples, interlacing_shift, interlacing_leftweight)
+	}
+
+	buffer_a = buffer_a[:numsamples]
+	buffer_b = buffer_b[:numsamples]
+	stride := 2 * numchannels
+
 	/* weighted interlacing */
 	if interlacing_leftweight != 0 {
-		for i := 0; i < numsamples; i++ {
+		for i := start; i < len(buffer_a); i++ {
 			var (
 				difference, midright int32
 				left                 int16
@@ -556,170 +620,608 @@ func deinterlace_16(
 			right = int16(midright - ((difference * int32(interlacing_leftweight)) >> interlacing_shift))
 			left = right + int16(difference)
 
-			/* output is always little endian */
-			/* TODO
-			if host_bigendian {
-				_Swap16(left)
-				_Swap16(right)
-			}
-			*/
-
 			// buffer_out[i*numchannels] = left
 			// buffer_out[i*numchannels+1] = right
-			buffer_out[2*i*numchannels] = byte(left)
-			buffer_out[2*i*numchannels+1] = byte(left >> 8)
-			buffer_out[2*i*numchannels+2] = byte(right)
-			buffer_out[2*i*numchannels+3] = byte(right >> 8)
+			out := buffer_out[i*stride : i*stride+4]
+			put16(out, left, bigendian)
+			put16(out[2:], right, bigendian)
 		}
 
 		return
 	}
 
 	/* otherwise basic interlacing took place */
-	for i := 0; i < numsamples; i++ {
+	for i := start; i < len(buffer_a); i++ {
 		var left, right int16
 
 		left = int16(buffer_a[i])
 		right = int16(buffer_b[i])
 
-		/* output is always little endian */
-		/* TODO
-		if host_bigendian {
-			_Swap16(left)
-			_Swap16(right)
-		}
-		*/
-
 		// buffer_out[i*numchannels] = left
 		// buffer_out[i*numchannels+1] = right
-		buffer_out[2*i*numchannels] = byte(left)
-		buffer_out[2*i*numchannels+1] = byte(left >> 8)
-		buffer_out[2*i*numchannels+2] = byte(right)
-		buffer_out[2*i*numchannels+3] = byte(right >> 8)
+		out := buffer_out[i*stride : i*stride+4]
+		put16(out, left, bigendian)
+		put16(out[2:], right, bigendian)
 	}
 }
 
-// note: translation untested
-func deinterlace_24(
-	buffer_a, buffer_b []int32,
-	uncompressed_bytes int,
-	uncompressed_bytes_buffer_a, uncompressed_bytes_buffer_b []int32,
-	buffer_out []byte, // was a *void
-	numchannels, numsamples int,
-	interlacing_shift, interlacing_leftweight uint8,
-) {
-	if numsamples <= 0 {
+// unmix turns the predictor output of a frame into the final samples, in
+// place: it undoes the stereo mixing and puts back the low bits which were
+// stored uncompressed. Mono frames pass a nil b.
+func unmix(a, b, lowA, lowB []int32, shift uint, mixBits, mixRes uint8) {
+	n := len(a)
+	if b != nil && mixRes != 0 {
+		b = b[:n]
+		weight := int32(mixRes)
+		for i, midright := range a {
+			difference := b[i]
+			right := midright - (difference*weight)>>mixBits
+			a[i], b[i] = right+difference, right
+		}
+	}
+	if shift == 0 {
 		return
 	}
+	mask := int32(1)<<shift - 1
+	lowA = lowA[:n]
+	for i := range a {
+		a[i] = a[i]<<shift | lowA[i]&mask
+	}
+	if b != nil {
+		b, lowB = b[:n], lowB[:n]
+		for i := range b {
+			b[i] = b[i]<<shift | lowB[i]&mask
+		}
+	}
+}
 
-	/* weighted interlacing */
-	if interlacing_leftweight > 0 {
-		for i := 0; i < numsamples; i++ {
-			var left, right int32
+// pack24 writes the 24 bit samples of one channel to out, starting at
+// offset and stride bytes apart, with the endianness and packing of the
+// OutputSpec.
+func pack24(out []byte, offset, stride int, samples []int32, bigendian bool, packing Packing) {
+	switch {
+	case packing == Packed && !bigendian:
+		for i, s := range samples {
+			b := out[offset+i*stride : offset+i*stride+3]
+			b[0], b[1], b[2] = byte(s), byte(s>>8), byte(s>>16)
+		}
+	case packing == Packed:
+		for i, s := range samples {
+			b := out[offset+i*stride : offset+i*stride+3]
+			b[0], b[1], b[2] = byte(s>>16), byte(s>>8), byte(s)
+		}
+	default:
+		for i, s := range samples {
+			if packing == MSB32 {
+				s <<= 8
+			} else {
+				s = s << 8 >> 8
+			}
+			put32(out[offset+i*stride:offset+i*stride+4], s, bigendian)
+		}
+	}
+}
 
-			midright := buffer_a[i]
-			difference := buffer_b[i]
+// readFrameHeader reads the element header at the start of a frame, up to
+// the per channel predictor info.
+func (alac *Alac) readFrameHeader() (FrameInfo, error) {
+	var info FrameInfo
 
-			right = midright - ((difference * int32(interlacing_leftweight)) >> interlacing_shift)
-			left = right + difference
+	if alac.bitsLeft() < 23 {
+		return info, fmt.Errorf("%w: frame header", ErrTruncatedBitstream)
+	}
 
-			if uncompressed_bytes > 0 {
-				mask := uint32(^(0xFFFFFFFF << uint(uncompressed_bytes*8)))
-				left <<= uint(uncompressed_bytes * 8)
-				right <<= uint(uncompressed_bytes * 8)
+	info.Element = int(alac.readbits(3))
+	switch info.Element {
+	case ElementSCE, ElementLFE:
+		info.Channels = 1
+	case ElementCPE:
+		info.Channels = 2
+	default:
+		return info, fmt.Errorf("%w: unsupported element %d", ErrInvalidFrame, info.Element)
+	}
 
-				left |= uncompressed_bytes_buffer_a[i] & int32(mask)
-				right |= uncompressed_bytes_buffer_b[i] & int32(mask)
-			}
+	info.Instance = int(alac.readbits(4))
+	if unused := alac.readbits(12); unused != 0 {
+		if err := alac.deviation("unused header bits set: %03x", unused); err != nil {
+			return info, err
+		}
+	}
 
-			buffer_out[i*numchannels*3] = byte((left) & 0xFF)
-			buffer_out[i*numchannels*3+1] = byte((left >> 8) & 0xFF)
-			buffer_out[i*numchannels*3+2] = byte((left >> 16) & 0xFF)
+	info.HasSize = alac.readbits(1) != 0        // the output sample size is stored soon
+	uncompressed_bytes := int(alac.readbits(2)) // number of bytes in the (compressed) stream that are not compressed
+	info.Verbatim = alac.readbits(1) != 0       // whether the frame is compressed
+	info.Samples = int(alac.setinfo_max_samples_per_frame)
 
-			buffer_out[i*numchannels*3+3] = byte((right) & 0xFF)
-			buffer_out[i*numchannels*3+4] = byte((right >> 8) & 0xFF)
-			buffer_out[i*numchannels*3+5] = byte((right >> 16) & 0xFF)
+	if info.HasSize {
+		// now read the number of samples, as a 32bit integer
+		if alac.bitsLeft() < 32 {
+			return info, fmt.Errorf("%w: frame header", ErrTruncatedBitstream)
 		}
+		samples := alac.readbits(32)
+		if samples > alac.setinfo_max_samples_per_frame && !alac.autoReconfigure {
+			return info, fmt.Errorf("%w: %d samples in a frame, frame size is %d", ErrConfigMismatch, samples, alac.setinfo_max_samples_per_frame)
+		}
+		info.Samples = int(samples)
+	}
 
-		return
+	if info.Verbatim {
+		return info, nil // uncompressed_bytes is always 0 for uncompressed
+	}
+	info.ShiftBits = uncompressed_bytes * 8
+	if info.ShiftBits >= int(alac.setinfo_sample_size) {
+		return info, fmt.Errorf("%w: %d uncompressed bits for %d bit samples", ErrInvalidFrame, info.ShiftBits, alac.setinfo_sample_size)
+	}
+	if bits := int(alac.setinfo_sample_size) - info.ShiftBits + info.Channels - 1; bits > 32 {
+		// 32 bit stereo without uncompressed bits needs 33 bit predictions
+		return info, fmt.Errorf("%w: %d bit predictions", ErrInvalidFrame, bits)
 	}
 
-	/* otherwise basic interlacing took place */
-	for i := 0; i < numsamples; i++ {
-		left := buffer_a[i]
-		right := buffer_b[i]
+	if alac.bitsLeft() < 16 {
+		return info, fmt.Errorf("%w: frame header", ErrTruncatedBitstream)
+	}
+	mixBits := int(alac.readbits(8))
+	mixRes := int(alac.readbits(8))
+	if info.Channels == 2 {
+		// unused in the mono case
+		info.MixBits, info.MixRes = mixBits, mixRes
+	}
+	return info, nil
+}
+
+// setInput starts reading from the start of buf.
+func (alac *Alac) setInput(buf []byte) {
+	alac.input_buffer = buf
+	alac.input_buffer_index = 0
+	alac.input_buffer_bitaccumulator = 0
+	alac.input_buffer_overrun = false
+}
+
+// bitsLeft returns the number of unread bits in the input buffer.
+func (alac *Alac) bitsLeft() int {
+	return (len(alac.input_buffer)-alac.input_buffer_index)*8 - alac.input_buffer_bitaccumulator
+}
+
+// predict undoes the prediction of one channel. Type 0 is the only one
+// Apple's encoder uses. Type 15 runs the adaptive FIR twice, the first pass
+// being the special predictor_coef_num = 31 case. Like ffmpeg, we treat
+// unknown types as type 0.
+func (alac *Alac) predict(
+	prediction_type int,
+	error_buffer []int32,
+	buffer_out []int32,
+	output_size int,
+	readsamplesize int,
+	predictor_coef_table [32]int16,
+	predictor_coef_num int,
+	predictor_quantitization int,
+) error {
+	if err := alac.checkPrediction(prediction_type); err != nil {
+		return err
+	}
+	unpredict(
+		prediction_type,
+		error_buffer,
+		buffer_out,
+		output_size,
+		readsamplesize,
+		predictor_coef_table,
+		predictor_coef_num,
+		predictor_quantitization,
+	)
+	return nil
+}
 
-		if uncompressed_bytes > 0 {
-			mask := uint32(^(0xFFFFFFFF << uint(uncompressed_bytes*8)))
-			left <<= uint(uncompressed_bytes * 8)
-			right <<= uint(uncompressed_bytes * 8)
+// parallelMinSamples is the smallest frame WithParallelChannels splits
+// over goroutines. Below that the goroutine costs more than it saves.
+const parallelMinSamples = 1024
+
+// channelPrediction has the arguments of unpredict.
+type channelPrediction struct {
+	prediction_type          int
+	error_buffer             []int32
+	buffer_out               []int32
+	output_size              int
+	readsamplesize           int
+	predictor_coef_table     [32]int16
+	predictor_coef_num       int
+	predictor_quantitization int
+}
 
-			left |= uncompressed_bytes_buffer_a[i] & int32(mask)
-			right |= uncompressed_bytes_buffer_b[i] & int32(mask)
+func (p *channelPrediction) unpredict() {
+	unpredict(
+		p.prediction_type,
+		p.error_buffer,
+		p.buffer_out,
+		p.output_size,
+		p.readsamplesize,
+		p.predictor_coef_table,
+		p.predictor_coef_num,
+		p.predictor_quantitization,
+	)
+}
+
+// unpredictParallel runs the predictors of a channel pair concurrently.
+func unpredictParallel(a, b channelPrediction) {
+	var wg sync.WaitGroup
+	wg.Go(b.unpredict)
+	a.unpredict()
+	wg.Wait()
+}
+
+// checkPrediction reports unknown prediction types.
+func (alac *Alac) checkPrediction(prediction_type int) error {
+	switch prediction_type {
+	case 0, 15:
+		return nil
+	default:
+		return alac.deviation("unknown prediction type %d", prediction_type)
+	}
+}
+
+// unpredict is predict without the checks. It only touches its arguments,
+// so the channels of a frame can be done concurrently.
+func unpredict(
+	prediction_type int,
+	error_buffer []int32,
+	buffer_out []int32,
+	output_size int,
+	readsamplesize int,
+	predictor_coef_table [32]int16,
+	predictor_coef_num int,
+	predictor_quantitization int,
+) {
+	if prediction_type == 15 {
+		// can be done in place
+		predictorDecompressFirAdapt(error_buffer, error_buffer, output_size,
+			readsamplesize, [32]int16{}, 31, 0)
+	}
+
+	predictorDecompressFirAdapt(
+		error_buffer,
+		buffer_out,
+		output_size,
+		readsamplesize,
+		predictor_coef_table,
+		predictor_coef_num,
+		predictor_quantitization,
+	)
+}
+
+// checkTrailer reads the elements after the audio element. Only fill and
+// data stream elements may come before the END element, which must be
+// followed by zero padding up to the end of the frame. It's skipped for
+// lenient decoders without a warning handler or logger, since there is
+// nothing to report to.
+func (alac *Alac) checkTrailer() error {
+	if !alac.strict && !alac.scanning && alac.warn == nil && alac.logger == nil {
+		return nil
+	}
+
+	for {
+		if alac.bitsLeft() < 3 {
+			return alac.deviation("missing END element")
+		}
+		tag := int(alac.readbits(3))
+		if alac.logger != nil {
+			alac.logger.Debug("alac: element", "tag", tag)
 		}
+		switch tag {
+		case ElementEND:
+			if pad := alac.input_buffer_bitaccumulator; pad != 0 {
+				if alac.readbits(8-pad) != 0 {
+					return alac.deviation("non-zero padding after END element")
+				}
+			}
+			if n := len(alac.input_buffer) - alac.input_buffer_index; n > 0 && !alac.scanning {
+				return alac.deviation("%d bytes after END element", n)
+			}
+			return nil
+		case ElementFIL:
+			// fill element, parse but ignore
+			if alac.bitsLeft() < 4 {
+				return alac.deviation("truncated fill element")
+			}
+			count := int(alac.readbits(4))
+			if count == 15 {
+				if alac.bitsLeft() < 8 {
+					return alac.deviation("truncated fill element")
+				}
+				count += int(alac.readbits(8)) - 1
+			}
+			if alac.bitsLeft() < count*8 {
+				return alac.deviation("truncated fill element")
+			}
+			alac.input_buffer_index += count
+		case ElementDSE:
+			// data stream element, parse but ignore
+			if alac.bitsLeft() < 13 {
+				return alac.deviation("truncated data stream element")
+			}
+			alac.readbits(4) // element instance tag
+			align := alac.readbits(1)
+			count := int(alac.readbits(8))
+			if count == 255 {
+				if alac.bitsLeft() < 8 {
+					return alac.deviation("truncated data stream element")
+				}
+				count += int(alac.readbits(8))
+			}
+			if align != 0 && alac.input_buffer_bitaccumulator != 0 {
+				alac.input_buffer_index++
+				alac.input_buffer_bitaccumulator = 0
+			}
+			if alac.bitsLeft() < count*8 {
+				return alac.deviation("truncated data stream element")
+			}
+			alac.input_buffer_index += count
+		default:
+			return alac.deviation("unexpected element %d", tag)
+		}
+	}
+}
+
+// reconfigure adapts the config to a frame which doesn't fit it, see
+// WithAutoReconfigure.
+func (alac *Alac) reconfigure(info FrameInfo) error {
+	if !alac.autoReconfigure {
+		return fmt.Errorf("%w: %d channel frame, but configured for %d channels", ErrChannelMismatch, info.Channels, alac.numchannels)
+	}
+
+	// frames without a sample count still have FrameSize samples, so only
+	// the buffers grow
+	cfg := alac.config
+	cfg.NumChannels = info.Channels
+	limits := cfg
+	limits.FrameSize = max(cfg.FrameSize, info.Samples)
+	if err := alac.checkLimits(limits); err != nil {
+		return err
+	}
+	if !validChannelMap(alac.channelMap, alac.outputChannels(cfg.NumChannels)) {
+		return fmt.Errorf("%w: %d channel frame, channel map %v", ErrChannelMismatch, info.Channels, alac.channelMap)
+	}
+	alac.configure(cfg)
+	if info.Samples > len(alac.outputsamples_buffer_a) {
+		alac.allocateSamples(info.Samples)
+	}
+	if alac.logger != nil {
+		alac.logger.Info("alac: reconfigured", "channels", cfg.NumChannels, "samples", info.Samples)
+	}
+	return nil
+}
+
+// frameDone updates the bookkeeping after a successfully decoded frame, and
+// calls the OnFrame hook.
+func (alac *Alac) frameDone(info FrameInfo, pcm []byte) {
+	alac.lastSamples = info.Samples
+	alac.stats.Frames++
+	if info.Verbatim {
+		alac.stats.VerbatimFrames++
+	}
+	alac.stats.Samples += int64(info.Samples)
+	if alac.levels {
+		info.Levels = alac.frameLevels
+	}
+	if alac.onFrame != nil {
+		alac.onFrame(info, pcm)
+	}
+}
+
+// deviation handles a violation of the spec which the decoder can work
+// around. Strict decoders return it as an error, lenient ones report it to
+// the warning handler and carry on.
+func (alac *Alac) deviation(format string, args ...any) error {
+	err := fmt.Errorf("%w: "+format, append([]any{ErrInvalidFrame}, args...)...)
+	if alac.scanning {
+		return err
+	}
+	if alac.logger != nil {
+		alac.logger.Warn("alac: deviation", "err", err)
+	}
+	if alac.strict {
+		return err
+	}
+	if alac.warn != nil {
+		alac.warn(err)
+	}
+	return nil
+}
 
-		buffer_out[i*numchannels*3] = byte((left) & 0xFF)
-		buffer_out[i*numchannels*3+1] = byte((left >> 8) & 0xFF)
-		buffer_out[i*numchannels*3+2] = byte((left >> 16) & 0xFF)
+func (alac *Alac) decodeFrame(inbuffer []byte) ([]byte, error) {
+	info, err := alac.decodeSamples(inbuffer)
+	if err != nil {
+		return nil, err
+	}
+	var outbuffer []byte
+	if n := info.Samples * alac.bytespersample; alac.pool != nil {
+		outbuffer = alac.pool.get(n)
+	} else {
+		outbuffer = make([]byte, n)
+	}
+	if err := alac.writeBytes(info, outbuffer); err != nil {
+		if alac.pool != nil {
+			alac.pool.Release(outbuffer)
+		}
+		return nil, err
+	}
+	alac.frameDone(info, outbuffer)
+	return outbuffer, nil
+}
 
-		buffer_out[i*numchannels*3+3] = byte((right) & 0xFF)
-		buffer_out[i*numchannels*3+4] = byte((right >> 8) & 0xFF)
-		buffer_out[i*numchannels*3+5] = byte((right >> 16) & 0xFF)
+// decodeReused is decodeFrame for WithLowLatency: the PCM goes to
+// alac.frame, which only grows for frames larger than FrameSize.
+func (alac *Alac) decodeReused(inbuffer []byte) ([]byte, error) {
+	return alac.decodeGrow(&alac.frame, inbuffer)
+}
 
+// decodeGrow is decodeFrame to *buf, which is grown when the PCM doesn't
+// fit.
+func (alac *Alac) decodeGrow(buf *[]byte, inbuffer []byte) ([]byte, error) {
+	info, err := alac.decodeSamples(inbuffer)
+	if err != nil {
+		return nil, err
+	}
+	n := info.Samples * alac.bytespersample
+	if cap(*buf) < n {
+		*buf = make([]byte, n)
 	}
+	outbuffer := (*buf)[:n]
+	if err := alac.writeBytes(info, outbuffer); err != nil {
+		return nil, err
+	}
+	alac.frameDone(info, outbuffer)
+	return outbuffer, nil
+}
 
+func (alac *Alac) decodeInto(outbuffer, inbuffer []byte) (int, error) {
+	info, err := alac.decodeSamples(inbuffer)
+	if err != nil {
+		return 0, err
+	}
+	n := info.Samples * alac.bytespersample
+	if len(outbuffer) < n {
+		return 0, fmt.Errorf("%w: frame has %d bytes of PCM, dst has room for %d", ErrShortBuffer, n, len(outbuffer))
+	}
+	outbuffer = outbuffer[:n]
+	if err := alac.writeBytes(info, outbuffer); err != nil {
+		return 0, err
+	}
+	alac.frameDone(info, outbuffer)
+	return n, nil
 }
 
-func (alac *Alac) decodeFrame(inbuffer []byte) []byte {
-	outputsamples := alac.setinfo_max_samples_per_frame
+// decodeSamples decodes a frame into the outputsamples and
+// uncompressed_bytes buffers, with the channels still decorrelated, or for
+// frames of more than one element into alac.channels. The FrameInfo of
+// those is of the first element, with the Channels of all of them.
+func (alac *Alac) decodeSamples(inbuffer []byte) (FrameInfo, error) {
+	alac.lastSamples = 0
+	alac.multi = false
+	if alac.closed() {
+		return FrameInfo{}, ErrClosed
+	}
+	if len(inbuffer) == 0 {
+		return FrameInfo{}, fmt.Errorf("%w: empty frame", ErrTruncatedBitstream)
+	}
 
 	/* setup the stream */
-	alac.input_buffer = inbuffer
-	alac.input_buffer_index = 0
-	alac.input_buffer_bitaccumulator = 0
+	alac.setInput(inbuffer)
+
+	info, err := alac.readFrameHeader()
+	if err != nil {
+		return info, err
+	}
+
+	if alac.numchannels <= 2 && info.Channels != alac.numchannels || info.Samples > len(alac.outputsamples_buffer_a) {
+		want := info
+		if alac.numchannels > 2 {
+			want.Channels = alac.numchannels // the other elements follow
+		}
+		if err := alac.reconfigure(want); err != nil {
+			return FrameInfo{}, err
+		}
+	}
+	if err := alac.decodeElement(info); err != nil {
+		return FrameInfo{}, err
+	}
+	if alac.numchannels > 2 || alac.autoReconfigure && alac.audioElementNext() {
+		return alac.decodeElements(info)
+	}
+	if err := alac.checkTrailer(); err != nil {
+		return FrameInfo{}, err
+	}
+	return info, nil
+}
+
+// decodeElements decodes the elements of a frame of more than 2 channels,
+// of which the first, with the header first, is decoded already, into
+// alac.channels, unmixed.
+func (alac *Alac) decodeElements(first FrameInfo) (FrameInfo, error) {
+	var (
+		info  = first
+		c     = 0
+		limit = orDefault(alac.maxChannels, DefaultMaxChannels)
+	)
+	for {
+		alac.keepChannels(c, info)
+		c += info.Channels
+		if !alac.audioElementNext() {
+			break
+		}
+		next, err := alac.readFrameHeader()
+		if err != nil {
+			return FrameInfo{}, err
+		}
+		if next.Samples != first.Samples {
+			return FrameInfo{}, fmt.Errorf("%w: element of %d samples in a frame of %d", ErrInvalidFrame, next.Samples, first.Samples)
+		}
+		if c+next.Channels > limit {
+			return FrameInfo{}, fmt.Errorf("%w: %d channels, the limit is %d", ErrLimitsExceeded, c+next.Channels, limit)
+		}
+		if err := alac.decodeElement(next); err != nil {
+			return FrameInfo{}, err
+		}
+		info = next
+	}
+	if err := alac.checkTrailer(); err != nil {
+		return FrameInfo{}, err
+	}
+	first.Channels = c
+	if c != alac.numchannels {
+		if err := alac.reconfigure(first); err != nil {
+			return FrameInfo{}, err
+		}
+	}
+	alac.multi = true
+	return first, nil
+}
+
+// audioElementNext reports whether an SCE, CPE, or LFE element follows.
+func (alac *Alac) audioElementNext() bool {
+	if alac.bitsLeft() < 3 {
+		return false
+	}
+	switch alac.peek() >> 61 {
+	case ElementSCE, ElementCPE, ElementLFE:
+		return true
+	}
+	return false
+}
+
+// decodeElement decodes the element of the header info into the
+// outputsamples and uncompressed_bytes buffers. The channels are still
+// decorrelated.
+func (alac *Alac) decodeElement(info FrameInfo) error {
+	if info.Verbatim {
+		// the samples are stored as is, so we know exactly how long the
+		// frame has to be
+		need := info.Samples * info.Channels * int(alac.setinfo_sample_size)
+		if have := alac.bitsLeft(); have < need {
+			return fmt.Errorf("%w: escape frame of %d samples needs %d bits, has %d", ErrTruncatedBitstream, info.Samples, need, have)
+		}
+	}
 
-	channels := alac.readbits(3)
+	alac.traceFrame(info)
 
-	outputsize := int(outputsamples) * alac.bytespersample
+	outputsamples := uint32(info.Samples)
+	uncompressed_bytes := info.ShiftBits / 8
 
-	switch channels {
-	case 0: /* 1 channel */
+	switch info.Element {
+	case ElementSCE, ElementLFE: /* 1 channel */
 		// note: translation untested
 		var (
 			readsamplesize int
 			ricemodifier   int
 		)
 
-		// 2^result = something to do with output waiting.
-		// perhaps matters if we read > 1 frame in a pass?
-		alac.readbits(4)
-		alac.readbits(12) // unknown, skip 12 bits
-
-		var (
-			hassize            = int(alac.readbits(1)) // the output sample size is stored soon
-			uncompressed_bytes = int(alac.readbits(2)) // number of bytes in the (compressed) stream that are not compressed
-			isnotcompressed    = int(alac.readbits(1)) // whether the frame is compressed
-		)
-
-		if hassize > 0 {
-			// now read the number of samples, as a 32bit integer
-			outputsamples = alac.readbits(32)
-			outputsize = int(outputsamples) * alac.bytespersample
-		}
-
 		readsamplesize = int(alac.setinfo_sample_size) - (uncompressed_bytes * 8)
 
-		if isnotcompressed == 0 {
+		if !info.Verbatim {
 			// so it is compressed
 			var (
 				predictor_coef_table [32]int16
 			)
 
-			// skip 16 bits, not sure what they are. seem to be used in
-			// two channel case
-			alac.readbits(8)
-			alac.readbits(8)
-
 			prediction_type := int(alac.readbits(4))
 			prediction_quantitization := int(alac.readbits(4))
 			ricemodifier = int(alac.readbits(3))
@@ -728,6 +1230,7 @@ func (alac *Alac) decodeFrame(inbuffer []byte) []byte {
 			for i := 0; i < predictor_coef_num; i++ {
 				predictor_coef_table[i] = int16(alac.readbits(16))
 			}
+			alac.traceChannel(0, prediction_type, prediction_quantitization, ricemodifier, predictor_coef_num)
 
 			if uncompressed_bytes != 0 {
 				for i := uint32(0); i < outputsamples; i++ {
@@ -735,7 +1238,7 @@ func (alac *Alac) decodeFrame(inbuffer []byte) []byte {
 				}
 			}
 
-			alac.entropyRiceDecode(
+			if err := alac.entropyRiceDecode(
 				alac.predicterror_buffer_a,
 				int(outputsamples),
 				readsamplesize,
@@ -743,26 +1246,21 @@ func (alac *Alac) decodeFrame(inbuffer []byte) []byte {
 				int(alac.setinfo_rice_kmodifier),
 				ricemodifier*int(alac.setinfo_rice_historymult)/4,
 				(1<<alac.setinfo_rice_kmodifier)-1,
-			)
+			); err != nil {
+				return err
+			}
 
-			if prediction_type == 0 {
-				// adaptive fir
-				predictorDecompressFirAdapt(
-					alac.predicterror_buffer_a,
-					alac.outputsamples_buffer_a,
-					int(outputsamples),
-					readsamplesize,
-					predictor_coef_table,
-					predictor_coef_num,
-					prediction_quantitization,
-				)
-			} else {
-				fmt.Printf("FIXME: unhandled predicition type: %d\n", prediction_type)
-				// i think the only other prediction type (or perhaps this is just a
-				// boolean?) runs adaptive fir twice.. like:
-				// predictor_decompress_fir_adapt(predictor_error, tempout, ...)
-				// predictor_decompress_fir_adapt(predictor_error, outputsamples ...)
-				// little strange..
+			if err := alac.predict(
+				prediction_type,
+				alac.predicterror_buffer_a,
+				alac.outputsamples_buffer_a,
+				int(outputsamples),
+				readsamplesize,
+				predictor_coef_table,
+				predictor_coef_num,
+				prediction_quantitization,
+			); err != nil {
+				return err
 			}
 
 		} else {
@@ -781,85 +1279,27 @@ func (alac *Alac) decodeFrame(inbuffer []byte) []byte {
 					// as we'll be ORing the low 16bits into this
 					audiobits = audiobits << (alac.setinfo_sample_size - 16)
 					audiobits |= int32(alac.readbits(int(alac.setinfo_sample_size - 16)))
-					audiobits = signExtend24(audiobits)
+					audiobits = sign_extended32(audiobits, int(alac.setinfo_sample_size))
 
 					alac.outputsamples_buffer_a[i] = audiobits
 				}
 			}
-			uncompressed_bytes = 0 // always 0 for uncompressed
 		}
 
-		outbuffer := make([]byte, outputsize)
-		switch alac.setinfo_sample_size {
-		case 16:
-			for i := uint32(0); i < outputsamples; i++ {
-				sample := int16(alac.outputsamples_buffer_a[i])
-				// TODO
-				// if host_bigendian {
-				// _Swap16(sample);
-				// }
-
-				// ((int16_t*)outbuffer)[i * alac->numchannels] = sample;
-				outbuffer[2*int(i)*alac.numchannels] = byte(sample)
-				outbuffer[2*int(i)*alac.numchannels+1] = byte(sample >> 8)
-			}
-		case 24:
-			for i := uint32(0); i < outputsamples; i++ {
-				sample := int32(alac.outputsamples_buffer_a[i])
-				if uncompressed_bytes != 0 {
-					sample = sample << uint(uncompressed_bytes*8)
-					mask := uint32(^(0xFFFFFFFF << uint(uncompressed_bytes*8)))
-					sample |= alac.uncompressed_bytes_buffer_a[i] & int32(mask)
-				}
-
-				outbuffer[int(i)*alac.numchannels*3] = byte((sample) & 0xFF)
-				outbuffer[int(i)*alac.numchannels*3+1] = byte((sample >> 8) & 0xFF)
-				outbuffer[int(i)*alac.numchannels*3+2] = byte((sample >> 16) & 0xFF)
-			}
-		case 20, 32:
-			fmt.Printf("FIXME: unimplemented sample size %d\n", alac.setinfo_sample_size)
-		default:
+		if alac.input_buffer_overrun {
+			return fmt.Errorf("%w: frame ends early", ErrTruncatedBitstream)
 		}
-		return outbuffer
-	case 1:
+
+	default: // ElementCPE, readFrameHeader rejects everything else
 		// 2 channels
 		var (
-			hassize         int
-			isnotcompressed int
-			readsamplesize  int
-
-			uncompressed_bytes int
-
-			interlacing_shift      uint8
-			interlacing_leftweight uint8
+			readsamplesize int
 		)
 
-		/* 2^result = something to do with output waiting.
-		 * perhaps matters if we read > 1 frame in a pass?
-		 */
-		alac.readbits(4)
-
-		alac.readbits(12) /* unknown, skip 12 bits */
-
-		hassize = int(alac.readbits(1)) /* the output sample size is stored soon */
-
-		uncompressed_bytes = int(alac.readbits(2)) /* the number of bytes in the (compressed) stream that are not compressed */
-
-		isnotcompressed = int(alac.readbits(1)) /* whether the frame is compressed */
-
-		if hassize != 0 {
-			/* now read the number of samples,
-			 * as a 32bit integer */
-			outputsamples = alac.readbits(32)
-			outputsize = int(outputsamples) * alac.bytespersample
-		}
-
 		readsamplesize = int(alac.setinfo_sample_size) - (uncompressed_bytes * 8) + 1
 
-		if isnotcompressed == 0 {
+		if !info.Verbatim {
 			/* compressed */
-			interlacing_shift = uint8(alac.readbits(8))
-			interlacing_leftweight = uint8(alac.readbits(8))
 			var (
 				predictor_coef_table_a [32]int16
 				predictor_coef_table_b [32]int16
@@ -878,6 +1318,7 @@ func (alac *Alac) decodeFrame(inbuffer []byte) []byte {
 			for i := 0; i < predictor_coef_num_a; i++ {
 				predictor_coef_table_a[i] = int16(alac.readbits(16))
 			}
+			alac.traceChannel(0, prediction_type_a, prediction_quantitization_a, ricemodifier_a, predictor_coef_num_a)
 
 			/******** channel 2 *********/
 			var (
@@ -891,6 +1332,7 @@ func (alac *Alac) decodeFrame(inbuffer []byte) []byte {
 			for i := 0; i < predictor_coef_num_b; i++ {
 				predictor_coef_table_b[i] = int16(alac.readbits(16))
 			}
+			alac.traceChannel(1, prediction_type_b, prediction_quantitization_b, ricemodifier_b, predictor_coef_num_b)
 
 			/*********************/
 			if uncompressed_bytes != 0 {
@@ -902,49 +1344,82 @@ func (alac *Alac) decodeFrame(inbuffer []byte) []byte {
 			}
 
 			/* channel 1 */
-			alac.entropyRiceDecode(
+			if err := alac.entropyRiceDecode(
 				alac.predicterror_buffer_a,
 				int(outputsamples),
 				readsamplesize,
 				int(alac.setinfo_rice_initialhistory),
 				int(alac.setinfo_rice_kmodifier),
 				ricemodifier_a*int(alac.setinfo_rice_historymult)/4,
-				(1<<alac.setinfo_rice_kmodifier)-1)
-
-			if prediction_type_a == 0 { /* adaptive fir */
-				predictorDecompressFirAdapt(
-					alac.predicterror_buffer_a,
-					alac.outputsamples_buffer_a,
-					int(outputsamples),
-					readsamplesize,
-					predictor_coef_table_a,
-					predictor_coef_num_a,
-					prediction_quantitization_a)
-			} else {
-				/* see mono case */
-				fmt.Printf("FIXME: unhandled predicition type: %d\n", prediction_type_a)
+				(1<<alac.setinfo_rice_kmodifier)-1); err != nil {
+				return err
 			}
+
 			/* channel 2 */
-			alac.entropyRiceDecode(
+			if err := alac.entropyRiceDecode(
 				alac.predicterror_buffer_b,
 				int(outputsamples),
 				readsamplesize,
 				int(alac.setinfo_rice_initialhistory),
 				int(alac.setinfo_rice_kmodifier),
 				ricemodifier_b*int(alac.setinfo_rice_historymult)/4,
-				(1<<alac.setinfo_rice_kmodifier)-1)
+				(1<<alac.setinfo_rice_kmodifier)-1); err != nil {
+				return err
+			}
 
-			if prediction_type_b == 0 { /* adaptive fir */
-				predictorDecompressFirAdapt(
+			// the channels are independent once their residuals are read
+			if !alac.parallel || outputsamples < parallelMinSamples {
+				if err := alac.predict(
+					prediction_type_a,
+					alac.predicterror_buffer_a,
+					alac.outputsamples_buffer_a,
+					int(outputsamples),
+					readsamplesize,
+					predictor_coef_table_a,
+					predictor_coef_num_a,
+					prediction_quantitization_a); err != nil {
+					return err
+				}
+				if err := alac.predict(
+					prediction_type_b,
 					alac.predicterror_buffer_b,
 					alac.outputsamples_buffer_b,
 					int(outputsamples),
 					readsamplesize,
 					predictor_coef_table_b,
 					predictor_coef_num_b,
-					prediction_quantitization_b)
+					prediction_quantitization_b); err != nil {
+					return err
+				}
 			} else {
-				fmt.Printf("FIXME: unhandled predicition type: %d\n", prediction_type_b)
+				if err := alac.checkPrediction(prediction_type_a); err != nil {
+					return err
+				}
+				if err := alac.checkPrediction(prediction_type_b); err != nil {
+					return err
+				}
+				unpredictParallel(
+					channelPrediction{
+						prediction_type_a,
+						alac.predicterror_buffer_a,
+						alac.outputsamples_buffer_a,
+						int(outputsamples),
+						readsamplesize,
+						predictor_coef_table_a,
+						predictor_coef_num_a,
+						prediction_quantitization_a,
+					},
+					channelPrediction{
+						prediction_type_b,
+						alac.predicterror_buffer_b,
+						alac.outputsamples_buffer_b,
+						int(outputsamples),
+						readsamplesize,
+						predictor_coef_table_b,
+						predictor_coef_num_b,
+						prediction_quantitization_b,
+					},
+				)
 			}
 		} else {
 			/* not compressed, easy case */
@@ -964,23 +1439,80 @@ func (alac *Alac) decodeFrame(inbuffer []byte) []byte {
 					audiobits_a := int32(alac.readbits(16))
 					audiobits_a = audiobits_a << (alac.setinfo_sample_size - 16)
 					audiobits_a |= int32(alac.readbits(int(alac.setinfo_sample_size - 16)))
-					audiobits_a = signExtend24(audiobits_a)
+					audiobits_a = sign_extended32(audiobits_a, int(alac.setinfo_sample_size))
 
 					audiobits_b := int32(alac.readbits(16))
 					audiobits_b = audiobits_b << (alac.setinfo_sample_size - 16)
 					audiobits_b |= int32(alac.readbits(int(alac.setinfo_sample_size - 16)))
-					audiobits_b = signExtend24(audiobits_b)
+					audiobits_b = sign_extended32(audiobits_b, int(alac.setinfo_sample_size))
 
 					alac.outputsamples_buffer_a[i] = audiobits_a
 					alac.outputsamples_buffer_b[i] = audiobits_b
 				}
 			}
-			uncompressed_bytes = 0 // always 0 for uncompressed
-			interlacing_shift = 0
-			interlacing_leftweight = 0
 		}
 
-		outbuffer := make([]byte, outputsize)
+		if alac.input_buffer_overrun {
+			return fmt.Errorf("%w: frame ends early", ErrTruncatedBitstream)
+		}
+
+	}
+	return nil
+}
+
+// writeBytes interleaves the samples decoded by decodeSamples into outbuffer, as
+// little or big endian PCM.
+func (alac *Alac) writeBytes(info FrameInfo, outbuffer []byte) error {
+	outputsamples := uint32(info.Samples)
+	uncompressed_bytes := info.ShiftBits / 8
+
+	if alac.multi {
+		alac.writeMapped(info, outbuffer)
+		return nil
+	}
+	if uncompressed_bytes == 0 && alac.silent(info) {
+		// mixing and packing zeros gives zeros, whatever the layout
+		clear(outbuffer)
+		alac.frameLevels = [2]Level{}
+		return nil
+	}
+	if alac.channelMap != nil || alac.hasGain || alac.levels || alac.output.Format != FormatInt || alac.output.Layout != Interleaved ||
+		alac.setinfo_sample_size == 20 || alac.setinfo_sample_size == 32 {
+		alac.writeMapped(info, outbuffer)
+		return nil
+	}
+
+	switch info.Element {
+	case ElementSCE, ElementLFE:
+		switch alac.setinfo_sample_size {
+		case 16:
+			for i := uint32(0); i < outputsamples; i++ {
+				sample := int16(alac.outputsamples_buffer_a[i])
+
+				// ((int16_t*)outbuffer)[i * alac->numchannels] = sample;
+				put16(outbuffer[2*int(i)*alac.numchannels:], sample, alac.bigEndian())
+			}
+		case 24:
+			n := int(outputsamples)
+			samples := alac.outputsamples_buffer_a[:n]
+			unmix(samples, nil, alac.uncompressed_bytes_buffer_a, nil, uint(uncompressed_bytes*8), 0, 0)
+			if alac.dither != NoDither {
+				alac.ditherer.run(outbuffer, 0, alac.bytespersample, samples, 0, alac.dither == DitherShaped, alac.bigEndian())
+				break
+			}
+			done := 0
+			if alac.output.Packing == Packed && !alac.bigEndian() && alac.numchannels == 1 {
+				done = pack24LE(outbuffer, samples, nil)
+			}
+			pack24(outbuffer, done*alac.bytespersample, alac.bytespersample, samples[done:], alac.bigEndian(), alac.output.Packing)
+		default:
+			return fmt.Errorf("%w: %d", ErrUnsupportedBitDepth, alac.setinfo_sample_size)
+		}
+	default: // ElementCPE
+		var (
+			interlacing_shift      = uint8(info.MixBits)
+			interlacing_leftweight = uint8(info.MixRes)
+		)
 
 		switch alac.setinfo_sample_size {
 		case 16:
@@ -992,32 +1524,43 @@ func (alac *Alac) decodeFrame(inbuffer []byte) []byte {
 				int(outputsamples),
 				interlacing_shift,
 				interlacing_leftweight,
+				alac.bigEndian(),
 			)
 		case 24:
-			deinterlace_24(
-				alac.outputsamples_buffer_a,
-				alac.outputsamples_buffer_b,
-				uncompressed_bytes,
-				alac.uncompressed_bytes_buffer_a,
-				alac.uncompressed_bytes_buffer_b,
-				outbuffer, // was []int16
-				alac.numchannels,
-				int(outputsamples),
-				interlacing_shift,
-				interlacing_leftweight,
+			var (
+				n     = int(outputsamples)
+				left  = alac.outputsamples_buffer_a[:n]
+				right = alac.outputsamples_buffer_b[:n]
+				width = alac.bytespersample / alac.numchannels
 			)
-		case 20, 32:
-			fmt.Printf("FIXME: unimplemented sample size %d\n", alac.setinfo_sample_size)
+			unmix(left, right, alac.uncompressed_bytes_buffer_a, alac.uncompressed_bytes_buffer_b, uint(uncompressed_bytes*8), interlacing_shift, interlacing_leftweight)
+			if shaped := alac.dither == DitherShaped; alac.dither != NoDither {
+				alac.ditherer.run(outbuffer, 0, alac.bytespersample, left, 0, shaped, alac.bigEndian())
+				alac.ditherer.run(outbuffer, width, alac.bytespersample, right, 1, shaped, alac.bigEndian())
+				break
+			}
+			done := 0
+			if alac.output.Packing == Packed && !alac.bigEndian() && alac.numchannels == 2 {
+				done = pack24LE(outbuffer, left, right)
+			}
+			offset := done * alac.bytespersample
+			pack24(outbuffer, offset, alac.bytespersample, left[done:], alac.bigEndian(), alac.output.Packing)
+			pack24(outbuffer, offset+width, alac.bytespersample, right[done:], alac.bigEndian(), alac.output.Packing)
 		default:
+			return fmt.Errorf("%w: %d", ErrUnsupportedBitDepth, alac.setinfo_sample_size)
 		}
-		return outbuffer
-	default:
-		fmt.Printf("unimplemented channel size %d\n", channels+1)
 	}
-
 	return nil
 }
 
+// silent reports whether all decoded samples of the frame are 0.
+func (alac *Alac) silent(info FrameInfo) bool {
+	if !allZero(alac.outputsamples_buffer_a[:info.Samples]) {
+		return false
+	}
+	return info.Channels == 1 || allZero(alac.outputsamples_buffer_b[:info.Samples])
+}
+
 func create_alac(samplesize, numchannels int) *Alac {
 	return &Alac{
 		samplesize:     samplesize,
@@ -0,0 +1,77 @@
+package alac
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// FrameReader is a source of ALAC frames, such as a demuxer. ReadFrame
+// returns io.EOF after the last frame.
+type FrameReader interface {
+	ReadFrame() ([]byte, error)
+}
+
+// DecodeAll decodes frames in order and returns the concatenated PCM. ctx is
+// checked before every frame, so a cancelled ctx stops the decode within one
+// frame. On error the PCM decoded so far is returned together with the
+// error.
+func (a *Alac) DecodeAll(ctx context.Context, frames [][]byte) ([]byte, error) {
+	var pcm []byte
+	for i, f := range frames {
+		if err := ctx.Err(); err != nil {
+			return pcm, err
+		}
+		out, err := a.decodeFrame(f)
+		if err != nil {
+			return pcm, fmt.Errorf("%w (frame %d)", err, i)
+		}
+		pcm = append(pcm, out...)
+	}
+	return pcm, nil
+}
+
+// DecodeBatch decodes frames in order into dst, back to back, and returns the
+// number of bytes written. Like DecodeInto it doesn't allocate; dst needs
+// room for the PCM of all frames, len(frames)*FrameBytes is always enough.
+// It fails with ErrShortBuffer as soon as a frame doesn't fit. On error the
+// bytes written so far are returned together with the error.
+func (a *Alac) DecodeBatch(frames [][]byte, dst []byte) (int, error) {
+	n := 0
+	for i, f := range frames {
+		m, err := a.decodeInto(dst[n:], f)
+		if err != nil {
+			return n, fmt.Errorf("%w (frame %d)", err, i)
+		}
+		n += m
+	}
+	return n, nil
+}
+
+// DecodeReader is DecodeAll for frames read from r, until r returns io.EOF.
+// Errors from r are returned as-is. The PCM of a Trimmer is trimmed to what
+// it plays.
+func (a *Alac) DecodeReader(ctx context.Context, r FrameReader) ([]byte, error) {
+	var (
+		pcm []byte
+		t   = newTrim(r)
+	)
+	for i := 0; !t.done(); i++ {
+		if err := ctx.Err(); err != nil {
+			return pcm, err
+		}
+		f, err := r.ReadFrame()
+		if err == io.EOF {
+			return pcm, nil
+		}
+		if err != nil {
+			return pcm, err
+		}
+		out, err := a.decodeFrame(f)
+		if err != nil {
+			return pcm, fmt.Errorf("%w (frame %d)", err, i)
+		}
+		pcm = append(pcm, t.apply(out, a.bytespersample)...)
+	}
+	return pcm, nil
+}
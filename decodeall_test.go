@@ -0,0 +1,111 @@
+package alac
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestDecodeAll(t *testing.T) {
+	var (
+		frames [][]byte
+		want   []byte
+	)
+	for in, out := range testFrames {
+		frames = append(frames, mustHex(in))
+		want = append(want, mustHex(out)...)
+	}
+	ctx := context.Background()
+
+	a, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	have, err := a.DecodeAll(ctx, frames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(have, want) {
+		t.Errorf("DecodeAll output differs")
+	}
+
+	r := frameSlice(frames)
+	have, err = a.DecodeReader(ctx, &r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(have, want) {
+		t.Errorf("DecodeReader output differs")
+	}
+
+	t.Run("error", func(t *testing.T) {
+		broken := append([][]byte{frames[0], {0x20}}, frames[1:]...)
+		have, err := a.DecodeAll(ctx, broken)
+		if !errors.Is(err, ErrTruncatedBitstream) {
+			t.Errorf("have %v, want %v", err, ErrTruncatedBitstream)
+		}
+		if have, want := len(have), 352*4; have != want {
+			t.Errorf("have %d, want %d", have, want)
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		if _, err := a.DecodeAll(ctx, frames); !errors.Is(err, context.Canceled) {
+			t.Errorf("have %v, want %v", err, context.Canceled)
+		}
+		r := frameSlice(frames)
+		if _, err := a.DecodeReader(ctx, &r); !errors.Is(err, context.Canceled) {
+			t.Errorf("have %v, want %v", err, context.Canceled)
+		}
+	})
+}
+
+func TestDecodeBatch(t *testing.T) {
+	var (
+		frames [][]byte
+		want   []byte
+	)
+	for in, out := range testFrames {
+		frames = append(frames, mustHex(in))
+		want = append(want, mustHex(out)...)
+	}
+	a, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := make([]byte, len(frames)*a.FrameBytes())
+	n, err := a.DecodeBatch(frames, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dst[:n], want) {
+		t.Errorf("DecodeBatch output differs")
+	}
+	if allocs := testing.AllocsPerRun(10, func() { a.DecodeBatch(frames, dst) }); allocs != 0 {
+		t.Errorf("have %v allocs/op, want 0", allocs)
+	}
+
+	t.Run("error", func(t *testing.T) {
+		broken := append([][]byte{frames[0], {0x20}}, frames[1:]...)
+		n, err := a.DecodeBatch(broken, dst)
+		if !errors.Is(err, ErrTruncatedBitstream) {
+			t.Errorf("have %v, want %v", err, ErrTruncatedBitstream)
+		}
+		if have, want := n, 352*4; have != want {
+			t.Errorf("have %d, want %d", have, want)
+		}
+	})
+
+	t.Run("short", func(t *testing.T) {
+		n, err := a.DecodeBatch(frames, dst[:a.FrameBytes()+10])
+		if !errors.Is(err, ErrShortBuffer) {
+			t.Errorf("have %v, want %v", err, ErrShortBuffer)
+		}
+		if have, want := n, a.FrameBytes(); have != want {
+			t.Errorf("have %d, want %d", have, want)
+		}
+	})
+}
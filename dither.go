@@ -0,0 +1,38 @@
+package alac
+
+import (
+	"math"
+)
+
+// ditherer is the state of WithDither, which carries over from frame to
+// frame.
+type ditherer struct {
+	seed uint32
+	err  [DefaultMaxChannels]int32 // rounding error of the last sample, per channel
+}
+
+// run reduces 24 bit samples to 16 bits, and stores them every stride bytes
+// from offset. ch is the channel of the samples.
+func (d *ditherer) run(out []byte, offset, stride int, samples []int32, ch int, shaped, bigendian bool) {
+	e := d.err[ch]
+	for _, s := range samples {
+		// corrupt frames can overflow the sample size, wrap them the way
+		// pack24 does
+		x := s << 8 >> 8
+		if shaped {
+			x -= e
+		}
+		// the difference of two uniform values has a triangular
+		// distribution, of ±1 LSB of the 16 bit output
+		d.seed = d.seed*1664525 + 1013904223
+		noise := int32(d.seed>>24) - int32(d.seed>>16&0xff)
+		y := (x + noise + 128) >> 8
+		e = y<<8 - x
+		y = min(max(y, math.MinInt16), math.MaxInt16)
+		put16(out[offset:], int16(y), bigendian)
+		offset += stride
+	}
+	if shaped {
+		d.err[ch] = e
+	}
+}
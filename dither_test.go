@@ -0,0 +1,92 @@
+package alac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestDither(t *testing.T) {
+	const n = 4096
+	cfg := Config{SampleRate: 44100, SampleSize: 24, NumChannels: 2, FrameSize: n}
+	flat, ramp := make([]int32, n), make([]int32, n)
+	for i := range flat {
+		flat[i] = 0x12380 // halfway between two 16 bit values
+		ramp[i] = int32(i*4099)%(1<<24) - 1<<23
+	}
+	frame := verbatimFrame(24, n, [][]int32{flat, ramp})
+
+	for _, d := range []Dither{DitherTPDF, DitherShaped} {
+		a, err := NewWithConfig(cfg, WithDither(d))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := a.FrameBytes(), n*4; have != want {
+			t.Errorf("have %d, want %d", have, want)
+		}
+		pcm, err := a.DecodeFrame(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := 0
+		for i := range n {
+			l := int32(int16(binary.LittleEndian.Uint16(pcm[4*i:])))
+			r := int32(int16(binary.LittleEndian.Uint16(pcm[4*i+2:])))
+			if l < 0x123-2 || l > 0x124+2 {
+				t.Fatalf("%d: sample %d: have %#x, want about 0x123.8", d, i, l)
+			}
+			sum += int(l)
+			want := ramp[i] >> 8
+			if diff := r - want; diff < -3 || diff > 3 {
+				t.Fatalf("%d: sample %d: have %#x, want about %#x", d, i, r, want)
+			}
+		}
+		// dither makes the average come out right, plain rounding would
+		// always give 0x124
+		if have, want := float64(sum)/n, 291.5; have < want-0.1 || have > want+0.1 {
+			t.Errorf("%d: have %v, want %v", d, have, want)
+		}
+		// shaping cancels the error of a sample with the next one, so the
+		// error of the sum stays within one sample
+		if d == DitherShaped {
+			if have := sum<<8 - n*0x12380; have < -1024 || have > 1024 {
+				t.Errorf("have %d, want at most ±1024", have)
+			}
+		}
+
+		// a reset decoder repeats itself
+		a.Reset()
+		if again, _ := a.DecodeFrame(frame); !bytes.Equal(again, pcm) {
+			t.Errorf("%d: output differs after Reset", d)
+		}
+	}
+
+	t.Run("clip", func(t *testing.T) {
+		top := []int32{1<<23 - 1, 1<<23 - 1, -1 << 23, -1 << 23}
+		a, err := NewWithConfig(Config{SampleRate: 44100, SampleSize: 24, NumChannels: 1, FrameSize: 4}, WithDither(DitherShaped))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pcm, err := a.DecodeFrame(verbatimFrame(24, 4, [][]int32{top}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, want := range []int{32767, 32767, -32768, -32768} {
+			if have := int(int16(binary.LittleEndian.Uint16(pcm[2*i:]))); have < want-2 || have > want+2 {
+				t.Errorf("sample %d: have %d, want %d", i, have, want)
+			}
+		}
+	})
+
+	t.Run("16 bit", func(t *testing.T) {
+		a, err := New(WithDither(DitherTPDF))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for in, out := range testFrames {
+			if have, _ := a.DecodeFrame(mustHex(in)); !bytes.Equal(have, mustHex(out)) {
+				t.Errorf("output differs for frame %s...", in[:16])
+			}
+		}
+	})
+}
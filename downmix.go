@@ -0,0 +1,73 @@
+package alac
+
+// Downmix coefficients in the 16.16 fixed point of applyGain.
+const (
+	mix3dB = 46341       // 1/sqrt(2)
+	mix6dB = gainOne / 2 // 1/2
+)
+
+// downmixes are the coefficients of WithDownmix for streams of i+1
+// channels: those of the channels of the ALAC layout, see channelLayouts,
+// in the left and in the right output channel. The front channels are kept, the
+// center and the surrounds are 3 dB down as in ITU-R BS.775, a back center
+// goes to both sides 6 dB down, and the LFE is dropped. Mono and stereo
+// aren't mixed.
+var downmixes = [maxChannels][2][maxChannels]int64{
+	2: { // C L R
+		{mix3dB, gainOne, 0},
+		{mix3dB, 0, gainOne},
+	},
+	3: { // C L R Cs
+		{mix3dB, gainOne, 0, mix6dB},
+		{mix3dB, 0, gainOne, mix6dB},
+	},
+	4: { // C L R Ls Rs
+		{mix3dB, gainOne, 0, mix3dB, 0},
+		{mix3dB, 0, gainOne, 0, mix3dB},
+	},
+	5: { // C L R Ls Rs LFE
+		{mix3dB, gainOne, 0, mix3dB, 0, 0},
+		{mix3dB, 0, gainOne, 0, mix3dB, 0},
+	},
+	6: { // C L R Ls Rs Cs LFE
+		{mix3dB, gainOne, 0, mix3dB, 0, mix6dB, 0},
+		{mix3dB, 0, gainOne, 0, mix3dB, mix6dB, 0},
+	},
+	7: { // C Lc Rc L R Ls Rs LFE
+		{mix3dB, gainOne, 0, gainOne, 0, mix3dB, 0, 0},
+		{mix3dB, 0, gainOne, 0, gainOne, 0, mix3dB, 0},
+	},
+}
+
+// outputChannels returns the number of channels a frame of n channels
+// decodes to before the WithChannelMap map: 2 for a WithDownmix decoder of
+// more than 2, n otherwise.
+func (a *Alac) outputChannels(n int) int {
+	if a.downmix && n > 2 {
+		return 2
+	}
+	return n
+}
+
+// downmixed mixes the channels of a frame to stereo, see WithDownmix, and
+// clips the samples to the bit depth.
+func (a *Alac) downmixed(channels [][]int32) [][]int32 {
+	var (
+		n     = len(channels[0])
+		coefs = &downmixes[len(channels)-1]
+		hi    = int64(1)<<(a.setinfo_sample_size-1) - 1
+		lo    = -hi - 1
+	)
+	for o := range a.mix {
+		mix := resize(a.mix[o], n)
+		for j := range mix {
+			var v int64
+			for c, samples := range channels {
+				v += int64(samples[j]) * coefs[o][c]
+			}
+			mix[j] = int32(min(max((v+gainOne/2)>>16, lo), hi))
+		}
+		a.mix[o] = mix
+	}
+	return a.mix[:]
+}
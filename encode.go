@@ -0,0 +1,730 @@
+package alac
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// MaxFrameOverhead is the most an encoded frame of a mono or stereo stream
+// can be larger than its PCM: the headers of an uncompressed frame which
+// stores its sample count. Streams of more channels have up to 7 bytes more
+// for every element after the first.
+const MaxFrameOverhead = 8
+
+// encodeMaxOrder is the highest predictor order the encoder tries. The
+// decoder takes up to 31 coefficients, but 31 selects its fixed first order
+// predictor.
+const encodeMaxOrder = 30
+
+// Encoder is an ALAC encoder, the counterpart of Alac. It takes PCM in the
+// layout Decode gives by default: interleaved little endian signed samples,
+// of 2 bytes for 16 bit streams, 3 for 24 bit ones, and 4 for 32 bit ones.
+// 20 bit samples take 3 bytes, in the top 20 bits. Frames are
+// independent of each other, so an Encoder can encode the frames of a
+// stream in any order, and a ParallelEncoder on all cores.
+//
+// The output is deterministic: the same PCM, config, and options make the
+// same frames, on every platform, and with any number of workers, so
+// encoded files can be hashed.
+//
+// Streams of 3 to 8 channels take them in the order of their ALAC layout,
+// see ChannelLayoutTag: C L R for 3 channels, up to C Lc Rc L R Ls Rs LFE for
+// 8. Their frames have an element for every channel or channel pair, which
+// the decoder puts back in the same order.
+type Encoder struct {
+	cfg    Config
+	width  int  // bytes per sample of the PCM
+	shift  uint // low bits of each sample which are stored uncompressed
+	preset Preset
+	search search
+	opts   []EncoderOption // for clone
+
+	quantizer   quantizer // of the float samples
+	priming     int
+	maxPacket   int // WithMaxPacketSize
+	splitLevels int // WithAdaptiveFrames
+
+	samples   [][]int32  // of every channel
+	shifted   [][]int32  // the samples without their low shift bits
+	mixed     [2][]int32 // the samples of an element after stereo mixing
+	residuals [2][]int32 // of the best coding of an element so far
+	candidate [2][]int32 // of the coding being tried
+	trial     []int32    // of the predictor being tried
+	mix       stereoMix
+	codings   [2]coding
+	w         bitstream
+	count     bitstream // to measure the residuals of a trial
+
+	verify   bool
+	verifier *Alac // WithVerify
+	decoded  []int32
+
+	frame         EncoderStats // of the frame being encoded
+	stats         EncoderStats
+	maxFrameBytes int
+	lastSamples   int // of the last frame
+	onFrame       func(EncoderStats, []byte)
+}
+
+// coding is how a channel of a frame is coded.
+type coding struct {
+	coefs        []int16
+	quantization int
+	riceModifier int
+}
+
+// stereoMix is the mixing of a channel pair: the first channel becomes
+// right + (left-right)*res>>bits, and the second left-right. The zero value
+// stores the channels as they are.
+type stereoMix struct {
+	bits, res int
+}
+
+// NewEncoder creates an encoder for streams described by cfg. The frames it
+// makes decode with a decoder from NewWithConfig(cfg), or from
+// NewFromMagicCookie(cfg.MagicCookie()). The FrameSize is at most
+// DefaultMaxFrameSize, which is what decoders accept by default, and there
+// are at most 8 channels. See WithPreset for the trade off between speed
+// and size.
+func NewEncoder(cfg Config, opts ...EncoderOption) (*Encoder, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.FrameSize > DefaultMaxFrameSize {
+		// this also keeps runs of zeros within the 16 bits of their count
+		return nil, fmt.Errorf("%w: frame size %d, the limit is %d", ErrLimitsExceeded, cfg.FrameSize, DefaultMaxFrameSize)
+	}
+	e := &Encoder{
+		cfg:   cfg,
+		width: (cfg.SampleSize + 7) / 8,
+		shift: encodeShift(cfg.SampleSize),
+		trial: make([]int32, cfg.FrameSize),
+		count: bitstream{countOnly: true},
+		opts:  opts,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	search, ok := presets[e.preset]
+	if !ok {
+		return nil, fmt.Errorf("%w: preset %d", ErrInvalidConfig, e.preset)
+	}
+	e.search = search
+	if err := e.checkSplit(); err != nil {
+		return nil, err
+	}
+	if e.priming < 0 {
+		return nil, fmt.Errorf("%w: priming %d", ErrInvalidConfig, e.priming)
+	}
+	if e.quantizer.dither < NoDither || e.quantizer.dither > DitherShaped {
+		return nil, fmt.Errorf("%w: dither %d", ErrInvalidConfig, e.quantizer.dither)
+	}
+	if e.verify {
+		verifier, err := NewWithConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		e.verifier = verifier
+		e.decoded = make([]int32, cfg.NumChannels*cfg.FrameSize)
+	}
+	for range cfg.NumChannels {
+		e.samples = append(e.samples, make([]int32, cfg.FrameSize))
+		e.shifted = append(e.shifted, make([]int32, cfg.FrameSize))
+	}
+	for c := range min(cfg.NumChannels, 2) {
+		e.mixed[c] = make([]int32, cfg.FrameSize)
+		e.residuals[c] = make([]int32, cfg.FrameSize)
+		e.candidate[c] = make([]int32, cfg.FrameSize)
+	}
+	return e, nil
+}
+
+// clone returns a new Encoder with the config and options of e, without
+// its stats.
+func (e *Encoder) clone() *Encoder {
+	c, err := NewEncoder(e.cfg, e.opts...)
+	if err != nil {
+		panic(err) // they made e
+	}
+	return c
+}
+
+// encodeShift is the number of low bits Apple's encoder stores uncompressed
+// for samples of bits bits. They are mostly noise, and predicting the rest
+// keeps the sums of the predictor within 32 bits.
+func encodeShift(bits int) uint {
+	switch bits {
+	case 24:
+		return 8
+	case 32:
+		return 16
+	}
+	return 0
+}
+
+// Config returns the config of the stream the encoder makes.
+func (e *Encoder) Config() Config {
+	return e.cfg
+}
+
+// MagicCookie returns the ALACSpecificConfig of the stream, see
+// Config.MagicCookie. Once frames are encoded it has their largest size,
+// and their average bit rate, so muxers which write the cookie after the
+// frames, such as the 'moov' atom at the end of an M4A file, should get it
+// when the stream is done.
+func (e *Encoder) MagicCookie() []byte {
+	return e.streamConfig().MagicCookie()
+}
+
+// SampleEntry returns the MP4 sample entry of the stream, see
+// Config.SampleEntry. Like MagicCookie, it's complete when the stream is
+// done.
+func (e *Encoder) SampleEntry() []byte {
+	return e.streamConfig().SampleEntry()
+}
+
+// streamConfig is the config with the frame size and bit rate of the frames
+// so far.
+func (e *Encoder) streamConfig() Config {
+	cfg := e.cfg
+	if e.stats.Samples > 0 {
+		cfg.MaxFrameBytes = e.maxFrameBytes
+		cfg.AvgBitRate = int(e.stats.BytesOut * 8 * int64(cfg.SampleRate) / e.stats.Samples)
+	}
+	return cfg
+}
+
+// Encode compresses the PCM of one frame: at most FrameSize samples per
+// channel. Frames with fewer samples, such as the last one of a stream,
+// store their sample count. Frames which don't compress, such as those of
+// white noise, are stored uncompressed, so a frame is never more than
+// MaxFrameOverhead bytes larger than its PCM. It fails with ErrInvalidPCM
+// for empty PCM, PCM which isn't a whole number of samples for every
+// channel, more than a frame, or 20 bit samples with any of their low 4 bits
+// set.
+func (e *Encoder) Encode(pcm []byte) ([]byte, error) {
+	return e.AppendEncode(nil, pcm)
+}
+
+// AppendEncode is Encode, appending the frame to dst. With room in dst it
+// doesn't allocate a frame.
+func (e *Encoder) AppendEncode(dst, pcm []byte) ([]byte, error) {
+	n, err := e.loadPCM(pcm)
+	if err != nil {
+		return nil, err
+	}
+	return e.appendFrame(dst, n)
+}
+
+// appendFrame encodes the first n samples of e.samples, adds the frame to
+// the stream, and appends it to dst.
+func (e *Encoder) appendFrame(dst []byte, n int) ([]byte, error) {
+	frame, err := e.encode(n)
+	if err != nil {
+		return nil, err
+	}
+	e.addFrame(e.frame, frame)
+	return append(dst, frame...), nil
+}
+
+// loadPCM reads the samples of a frame of PCM into e.samples, and returns
+// the number of samples per channel.
+func (e *Encoder) loadPCM(pcm []byte) (int, error) {
+	var (
+		channels = e.cfg.NumChannels
+		stride   = e.width * channels
+		n        = len(pcm) / stride
+	)
+	if n == 0 || len(pcm)%stride != 0 || n > e.cfg.FrameSize {
+		return 0, fmt.Errorf("%w: %d bytes for %d channels of %d bit samples, and %d samples per frame", ErrInvalidPCM, len(pcm), channels, e.cfg.SampleSize, e.cfg.FrameSize)
+	}
+	for c := range channels {
+		samples := e.samples[c][:n]
+		for i := range samples {
+			b := pcm[i*stride+c*e.width:]
+			switch e.cfg.SampleSize {
+			case 16:
+				samples[i] = int32(int16(uint16(b[0]) | uint16(b[1])<<8))
+			case 20:
+				if b[0]&0xf != 0 {
+					return 0, fmt.Errorf("%w: 20 bit sample %d has low bits set", ErrInvalidPCM, i)
+				}
+				samples[i] = signExtend24(int32(b[0])|int32(b[1])<<8|int32(b[2])<<16) >> 4
+			case 24:
+				samples[i] = signExtend24(int32(b[0]) | int32(b[1])<<8 | int32(b[2])<<16)
+			default:
+				samples[i] = int32(uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24)
+			}
+		}
+	}
+	return n, nil
+}
+
+// encode encodes the first n samples of e.samples, and verifies the frame
+// WithVerify. The frame is in the buffer of e.w, and its stats in e.frame,
+// until the next frame is encoded. They don't count for the stream until
+// addFrame.
+func (e *Encoder) encode(n int) ([]byte, error) {
+	channels := e.cfg.NumChannels
+	if e.shift > 0 {
+		for c := range channels {
+			for i, s := range e.samples[c][:n] {
+				e.shifted[c][i] = s >> e.shift
+			}
+		}
+	}
+
+	e.w.reset()
+	e.frame = EncoderStats{
+		Frames:  1,
+		Samples: int64(n),
+		BytesIn: int64(n * channels * e.width),
+	}
+	var (
+		c         = 0
+		instances [2]int // of the SCEs and the CPEs
+	)
+	for _, k := range channelLayouts[channels-1].elements {
+		e.encodeElement(c, k, n, instances[k-1])
+		instances[k-1]++
+		c += k
+	}
+	return e.frameDone(n)
+}
+
+// encodeElement writes the element of the first n samples of the k
+// channels from channel c to e.w: an SCE for 1 channel, a CPE for 2.
+func (e *Encoder) encodeElement(c, k, n, instance int) {
+	var (
+		samples = e.samples[c : c+k]
+		input   = samples
+		mixes   = e.search.mixes
+	)
+	if e.shift > 0 {
+		input = e.shifted[c : c+k]
+	}
+	if k == 1 {
+		mixes = []stereoMix{{}}
+	} else if e.search.estimate && len(mixes) > 1 {
+		mixes = []stereoMix{e.estimateMix(input, mixes, n)}
+	}
+
+	// a CPE stores its channels with a spare bit, for the stereo mixing
+	readSampleSize := e.cfg.SampleSize - int(e.shift) + k - 1
+	best := math.MaxInt
+	for _, mix := range mixes {
+		var (
+			input   = e.stereoMix(input, mix, n)
+			codings [2]coding
+			size    int
+		)
+		for c := range k {
+			var bits int
+			codings[c], bits = e.analyze(input[c], &e.candidate[c], readSampleSize)
+			size += bits
+		}
+		if size < best {
+			best = size
+			e.mix, e.codings = mix, codings
+			e.residuals, e.candidate = e.candidate, e.residuals
+		}
+	}
+
+	// audio which doesn't compress, such as noise, is stored as it is.
+	// The mix and the predictor headers are counted in best.
+	verbatim := best+16+n*k*int(e.shift) >= n*k*e.cfg.SampleSize
+	shiftBytes := e.shift / 8
+	if verbatim {
+		shiftBytes = 0
+	}
+
+	w := &e.w
+	w.write(uint32(k-1), 3)      // element: SCE or CPE
+	w.write(uint32(instance), 4) // element instance
+	w.write(0, 12)               // unused
+	partial := n != e.cfg.FrameSize
+	w.writeBool(partial)           // has size
+	w.write(uint32(shiftBytes), 2) // uncompressed bytes
+	w.writeBool(verbatim)          // not compressed
+	if partial {
+		w.write(uint32(n), 32)
+	}
+	if verbatim {
+		e.frame.VerbatimFrames = 1
+		for i := range n {
+			for _, ch := range samples {
+				w.write(uint32(ch[i]), e.cfg.SampleSize)
+			}
+		}
+		return
+	}
+	w.write(uint32(e.mix.bits), 8)
+	w.write(uint32(e.mix.res), 8)
+	for _, cod := range e.codings[:k] {
+		e.frame.Orders[len(cod.coefs)]++
+		e.frame.RiceModifiers[cod.riceModifier]++
+		w.write(0, 4) // prediction type
+		w.write(uint32(cod.quantization), 4)
+		w.write(uint32(cod.riceModifier), 3)
+		w.write(uint32(len(cod.coefs)), 5)
+		for _, v := range cod.coefs {
+			w.write(uint32(uint16(v)), 16)
+		}
+	}
+	if e.shift > 0 {
+		for i := range n {
+			for _, ch := range samples {
+				w.write(uint32(ch[i]), int(e.shift))
+			}
+		}
+	}
+	for c, cod := range e.codings[:k] {
+		e.riceEncode(w, e.residuals[c][:n], readSampleSize, cod.riceModifier)
+	}
+}
+
+// frameDone ends the frame of n samples in e.w, and verifies it WithVerify.
+func (e *Encoder) frameDone(n int) ([]byte, error) {
+	e.w.write(ElementEND, 3)
+	frame := e.w.bytes()
+	if e.verify {
+		if err := e.verifyFrame(frame, n); err != nil {
+			return nil, err
+		}
+	}
+
+	e.frame.BytesOut = int64(len(frame))
+	return frame, nil
+}
+
+// stereoMix returns the first n samples of the channels of an element,
+// mixed.
+func (e *Encoder) stereoMix(samples [][]int32, mix stereoMix, n int) [2][]int32 {
+	if len(samples) == 1 {
+		return [2][]int32{samples[0][:n]}
+	}
+	if mix == (stereoMix{}) {
+		return [2][]int32{samples[0][:n], samples[1][:n]}
+	}
+	var (
+		left, right = samples[0][:n], samples[1][:n]
+		a, b        = e.mixed[0][:n], e.mixed[1][:n]
+	)
+	for i, l := range left {
+		r := right[i]
+		a[i] = r + (l-r)*int32(mix.res)>>mix.bits
+		b[i] = l - r
+	}
+	return [2][]int32{a, b}
+}
+
+// estimateMix picks the mix of a channel pair, of the first n samples, for
+// which the predictors of the highest order of the search leave the least
+// error. The product of the errors of the channels is about what the
+// residuals take in bits, and it's a lot faster to fit the predictors than
+// to analyze every mix. Ties go to the first mix.
+func (e *Encoder) estimateMix(samples [][]int32, mixes []stereoMix, n int) stereoMix {
+	var (
+		order  = e.search.orders[len(e.search.orders)-1]
+		best   = math.Inf(1)
+		chosen stereoMix
+		lpc    [encodeMaxOrder + 1][]float64
+	)
+	for _, mix := range mixes {
+		est := 1.0
+		for _, ch := range e.stereoMix(samples, mix, n) {
+			est = float64(est * (1 + levinson(autocorrelate(ch, order), lpc[:order+1])))
+		}
+		if est < best {
+			best, chosen = est, mix
+		}
+	}
+	return chosen
+}
+
+// analyze picks the coding of a channel which takes the fewest bits, of
+// the ones the search allows. It returns the coding and its size, and
+// leaves its residuals in out.
+func (e *Encoder) analyze(samples []int32, out *[]int32, readSampleSize int) (coding, int) {
+	var (
+		n      = len(samples)
+		best   = math.MaxInt
+		chosen coding
+		lpc    [encodeMaxOrder + 1][]float64
+		orders = e.search.orders
+	)
+	levinson(autocorrelate(samples, orders[len(orders)-1]), lpc[:])
+	for _, order := range orders {
+		for _, q := range e.search.quantizations {
+			var (
+				coefs = quantize(lpc[order], q)
+				trial = e.trial[:n]
+				found = false
+			)
+			residuals(samples, trial, readSampleSize, coefs, q)
+			for _, rm := range e.search.riceModifiers {
+				e.count.reset()
+				e.riceEncode(&e.count, trial, readSampleSize, rm)
+				if size := 16 + 16*order + e.count.len(); size < best {
+					best, found = size, true
+					chosen = coding{coefs: coefs, quantization: q, riceModifier: rm}
+				}
+			}
+			if found {
+				e.trial, *out = *out, e.trial
+			}
+		}
+	}
+	return chosen, best
+}
+
+// autocorrelate returns the autocorrelation of the first difference of
+// samples, windowed, for lags 0 to order. ALAC's predictor always passes
+// the previous sample, so it's the difference which is predicted, see
+// levinson.
+//
+// The float64 conversions of the products keep the compiler from fusing
+// them with the sums into FMA instructions, which round differently, and
+// only exist on some CPUs. Without them an arm64 machine could pick other
+// coefficients than an amd64 one, and make other frames.
+func autocorrelate(samples []int32, order int) []float64 {
+	r := make([]float64, order+1)
+	if len(samples) < 2 {
+		return r
+	}
+	d := make([]float64, len(samples)-1)
+	for i := range d {
+		// a Welch window
+		x := float64(2*float64(i)/float64(len(d))) - 1
+		d[i] = float64(samples[i+1]-samples[i]) * (1 - float64(x*x))
+	}
+	for lag := range r {
+		var sum float64
+		for i := lag; i < len(d); i++ {
+			sum += float64(d[i] * d[i-lag])
+		}
+		r[lag] = sum
+	}
+	return r
+}
+
+// levinson fills lpc[p] with the p coefficients of the predictor of order
+// p, for all p up to len(r)-1, fitted with the Levinson-Durbin recursion.
+//
+// The recursion fits g to predict the difference signal d from its last
+// p values: d[n] ~ sum g[m] d[n-m]. ALAC predicts the samples s from the
+// differences to an older sample b = s[n-p-1]: s[n] ~ b + sum a[j] (s[n-j]
+// - b), which comes down to the same thing with a[j] = g[j] - g[j-1], and
+// g[0] = -1. Like autocorrelate, it doesn't fuse products. It returns the
+// error left by the predictor of the highest order.
+func levinson(r []float64, lpc [][]float64) float64 {
+	var (
+		g   = make([]float64, len(r))
+		tmp = make([]float64, len(r))
+		err = r[0]
+	)
+	for p := 1; p < len(r); p++ {
+		lpc[p] = make([]float64, p)
+		if err <= 0 {
+			// silence, or the signal is fully predicted: keep the
+			// predictor of the lower order
+		} else {
+			acc := r[p]
+			for m := 1; m < p; m++ {
+				acc -= float64(g[m] * r[p-m])
+			}
+			k := acc / err
+			copy(tmp, g)
+			for m := 1; m < p; m++ {
+				g[m] = tmp[m] - float64(k*tmp[p-m])
+			}
+			g[p] = k
+			err *= 1 - float64(k*k)
+		}
+		prev := -1.0
+		for j := 1; j <= p; j++ {
+			lpc[p][j-1] = g[j] - prev
+			prev = g[j]
+		}
+	}
+	return max(err, 0)
+}
+
+// quantize turns lpc into the coefficient table of a frame: fixed point,
+// with q fractional bits, clipped to 16 bits.
+func quantize(lpc []float64, q int) []int16 {
+	coefs := make([]int16, len(lpc))
+	for i, a := range lpc {
+		coefs[i] = int16(max(math.MinInt16, min(math.MaxInt16, math.Round(a*float64(int(1)<<q)))))
+	}
+	return coefs
+}
+
+// residuals is the inverse of predictorDecompressFirAdapt: it writes the
+// prediction errors of samples to out, adapting the coefficients the way
+// the decoder will.
+func residuals(samples, out []int32, readsamplesize int, table []int16, q int) {
+	var (
+		n     = len(samples)
+		order = len(table)
+	)
+	out = out[:n]
+	out[0] = samples[0]
+	for i := 1; i <= order && i < n; i++ {
+		out[i] = sign_extended32(samples[i]-samples[i-1], readsamplesize)
+	}
+
+	var coefs [32]int32
+	for k := range order {
+		coefs[k] = int32(table[order-1-k])
+	}
+	c := coefs[:order]
+	for i := order + 1; i < n; i++ {
+		var (
+			window = samples[i-order-1 : i]
+			base   = window[0]
+			x      = window[1:][:len(c)]
+			pred   = ((1<<uint(q-1))+int(firSum(x, c, base)))>>uint(q) + int(base)
+			errval = sign_extended32(int32(int(samples[i])-pred), readsamplesize)
+		)
+		out[i] = errval
+
+		// the adaptation of predictorDecompressFirAdapt
+		if errval > 0 {
+			for k := 0; k < len(c) && errval > 0; k++ {
+				val := int(base - x[k])
+				sign := sign_only(val)
+				c[k] = int32(int16(c[k] - int32(sign)))
+				val *= sign
+				errval -= int32((val >> uint(q)) * (k + 1))
+			}
+		} else if errval < 0 {
+			for k := 0; k < len(c) && errval < 0; k++ {
+				val := int(base - x[k])
+				sign := -sign_only(val)
+				c[k] = int32(int16(c[k] - int32(sign)))
+				val *= sign
+				errval -= int32((val >> uint(q)) * (k + 1))
+			}
+		}
+	}
+}
+
+// riceEncode writes residuals with the adaptive Golomb-Rice code which
+// entropyRiceDecode reads.
+func (e *Encoder) riceEncode(w *bitstream, residuals []int32, readSampleSize, riceModifier int) {
+	var (
+		historyMult = orDefault(e.cfg.HistoryMult, 40) * riceModifier / 4
+		kModifier   = orDefault(e.cfg.KModifier, 14)
+		mask        = uint32(1)<<kModifier - 1
+		history     = orDefault(e.cfg.InitialHistory, 10)
+		signMod     = uint32(0)
+	)
+	for i := 0; i < len(residuals); {
+		k := min(kModifier, 31-bits.LeadingZeros32(uint32(history>>9+3)))
+		value := zigzag(residuals[i])
+		riceWrite(w, value-signMod, k, 0xFFFFFFFF, readSampleSize)
+		signMod = 0
+
+		history += int(value)*historyMult - (history*historyMult)>>9
+		if value > 0xFFFF {
+			history = 0xFFFF
+		}
+		i++
+
+		if history < 128 && i < len(residuals) {
+			// a run of zeros. They are at most a frame long, so the count
+			// fits in its 16 bits.
+			run := 0
+			for i+run < len(residuals) && residuals[i+run] == 0 {
+				run++
+			}
+			k := bits.LeadingZeros32(uint32(history)) + (history+16)/64 - 24
+			riceWrite(w, uint32(run), k, mask, 16)
+			i += run
+			history = 0
+			signMod = 1
+		}
+	}
+}
+
+// riceWrite writes one value in the code of entropyDecodeValue: the
+// quotient in unary, and the remainder in k bits, or an escape followed by
+// the value in escapeBits bits.
+func riceWrite(w *bitstream, v uint32, k int, mask uint32, escapeBits int) {
+	m := (uint32(1)<<k - 1) & mask
+	if k == 1 {
+		m = 1
+	}
+	q, r := v/m, v%m
+	if q > rice_threshold {
+		w.write(1<<(rice_threshold+1)-1, rice_threshold+1)
+		w.write(v, escapeBits)
+		return
+	}
+	w.write(1<<(q+1)-2, int(q)+1) // q ones and a zero
+	switch {
+	case k == 1:
+	case r == 0:
+		// entropyDecodeValue leaves the last bit for the next value
+		w.write(0, k-1)
+	default:
+		w.write(r+1, k)
+	}
+}
+
+// zigzag is the sign folding of entropyRiceDecode: 0, -1, 1, -2, ... become
+// 0, 1, 2, 3, ...
+func zigzag(v int32) uint32 {
+	return uint32(v<<1) ^ uint32(v>>31)
+}
+
+// bitstream writes big endian bitstreams.
+type bitstream struct {
+	buf       []byte
+	acc       uint64 // the last n bits are pending
+	n         int
+	total     int
+	countOnly bool // only count the bits
+}
+
+func (b *bitstream) reset() {
+	b.buf, b.acc, b.n, b.total = b.buf[:0], 0, 0, 0
+}
+
+// write writes the low bits of v, at most 32 of them.
+func (b *bitstream) write(v uint32, bits int) {
+	if b.countOnly {
+		b.total += bits
+		return
+	}
+	b.acc = b.acc<<uint(bits) | uint64(v)&(1<<uint(bits)-1)
+	b.n += bits
+	b.total += bits
+	for b.n >= 8 {
+		b.n -= 8
+		b.buf = append(b.buf, byte(b.acc>>uint(b.n)))
+	}
+}
+
+func (b *bitstream) writeBool(v bool) {
+	if v {
+		b.write(1, 1)
+	} else {
+		b.write(0, 1)
+	}
+}
+
+// len is the number of bits written.
+func (b *bitstream) len() int {
+	return b.total
+}
+
+// bytes pads the bitstream with zeros to a whole byte, and returns it.
+func (b *bitstream) bytes() []byte {
+	if b.n > 0 {
+		b.write(0, 8-b.n)
+	}
+	return b.buf
+}
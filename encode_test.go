@@ -0,0 +1,757 @@
+package alac
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"testing"
+)
+
+// testSignals are channels of n samples of bits bits, which exercise the
+// encoder: silence, tones, noise, and full scale extremes.
+func testSignals(n, bits int) map[string][]int32 {
+	var (
+		rng  = rand.New(rand.NewPCG(1, 2))
+		peak = int32(1)<<(bits-1) - 1
+		gen  = func(f func(i int) int32) []int32 {
+			s := make([]int32, n)
+			for i := range s {
+				s[i] = f(i)
+			}
+			return s
+		}
+	)
+	return map[string][]int32{
+		"silence":  gen(func(int) int32 { return 0 }),
+		"constant": gen(func(int) int32 { return -peak / 3 }),
+		"sine": gen(func(i int) int32 {
+			return int32(float64(peak) * 0.8 * math.Sin(float64(i)*2*math.Pi*1000/44100))
+		}),
+		"noise": gen(func(int) int32 { return int32(rng.Uint32()) >> (32 - bits) }),
+		"square": gen(func(i int) int32 {
+			if i/7%2 == 0 {
+				return peak
+			}
+			return -peak - 1
+		}),
+		"sparse": gen(func(i int) int32 {
+			if i%500 == 3 {
+				return 1000
+			}
+			return 0
+		}),
+	}
+}
+
+// interleavePCM makes the PCM Decode gives for the channels.
+func interleavePCM(bits int, channels ...[]int32) []byte {
+	var out []byte
+	for i := range channels[0] {
+		for _, ch := range channels {
+			s := ch[i]
+			switch bits {
+			case 16:
+				out = append(out, byte(s), byte(s>>8))
+			case 20:
+				out = append(out, byte(s<<4), byte(s>>4), byte(s>>12))
+			case 24:
+				out = append(out, byte(s), byte(s>>8), byte(s>>16))
+			case 32:
+				out = append(out, byte(s), byte(s>>8), byte(s>>16), byte(s>>24))
+			}
+		}
+	}
+	return out
+}
+
+func TestEncode(t *testing.T) {
+	for _, c := range []struct {
+		bits, channels int
+		preset         Preset
+	}{
+		{16, 1, PresetNormal},
+		{16, 2, PresetNormal},
+		{24, 1, PresetNormal},
+		{24, 2, PresetNormal},
+		{20, 1, PresetNormal},
+		{20, 2, PresetNormal},
+		{32, 1, PresetNormal},
+		{32, 2, PresetNormal},
+		{16, 2, PresetFast},
+		{24, 2, PresetFast},
+		{16, 2, PresetMax},
+		{24, 1, PresetMax},
+		{32, 2, PresetMax},
+	} {
+		signals := testSignals(4096, c.bits)
+		cfg := Config{SampleRate: 44100, SampleSize: c.bits, NumChannels: c.channels, FrameSize: 4096}
+		e, err := NewEncoder(cfg, WithPreset(c.preset))
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := NewFromMagicCookie(e.Config().MagicCookie(), WithStrict())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, left := range signals {
+			pcm := interleavePCM(c.bits, [][]int32{left, signals["sine"]}[:c.channels]...)
+			// a whole frame, and short ones
+			for _, n := range []int{4096, 1000, 1} {
+				pcm := pcm[:n*len(pcm)/4096]
+				frame, err := e.Encode(pcm)
+				if err != nil {
+					t.Fatal(err)
+				}
+				have, err := d.DecodeFrame(frame)
+				if err != nil {
+					t.Fatalf("%+v, %s, %d samples: %v", c, name, n, err)
+				}
+				if !bytes.Equal(have, pcm) {
+					t.Errorf("%+v, %s, %d samples: output differs", c, name, n)
+				}
+			}
+		}
+	}
+
+	t.Run("compression", func(t *testing.T) {
+		b, err := os.ReadFile("testdata/samples/jane_eyre_5s.wav")
+		if err != nil {
+			t.Fatal(err)
+		}
+		pcm := b[bytes.Index(b, []byte("data"))+8:] // mono, stored as stereo
+		pcm = pcm[:2*44100*4]
+		cfg := DefaultConfig()
+		cfg.FrameSize = 4096
+		d, err := NewWithConfig(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ratio := map[Preset]float64{}
+		for _, p := range []Preset{PresetFast, PresetNormal, PresetMax} {
+			e, err := NewEncoder(cfg, WithPreset(p))
+			if err != nil {
+				t.Fatal(err)
+			}
+			size := 0
+			for in := pcm; len(in) > 0; {
+				n := min(len(in), cfg.FrameSize*4)
+				frame, err := e.Encode(in[:n])
+				if err != nil {
+					t.Fatal(err)
+				}
+				size += len(frame)
+				have, err := d.DecodeFrame(frame)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(have, in[:n]) {
+					t.Fatal("output differs")
+				}
+				in = in[n:]
+			}
+			ratio[p] = float64(size) / float64(len(pcm))
+		}
+		if have, want := ratio[PresetFast], 0.32; have > want {
+			t.Errorf("have ratio %.3f, want at most %.2f", have, want)
+		}
+		if have, want := ratio[PresetNormal], 0.16; have > want {
+			t.Errorf("have ratio %.3f, want at most %.2f", have, want)
+		}
+		if have, want := ratio[PresetMax], ratio[PresetNormal]; have >= want {
+			t.Errorf("have ratio %.3f, want less than %.3f", have, want)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		cfg := DefaultConfig()
+		e, err := NewEncoder(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, n := range []int{0, 3, 4*cfg.FrameSize + 4} {
+			if _, err := e.Encode(make([]byte, n)); !errors.Is(err, ErrInvalidPCM) {
+				t.Errorf("%d bytes: have %v, want %v", n, err, ErrInvalidPCM)
+			}
+		}
+
+		if _, err := NewEncoder(cfg, WithPreset(-1)); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("have %v, want %v", err, ErrInvalidConfig)
+		}
+		cfg.FrameSize = DefaultMaxFrameSize + 1
+		if _, err := NewEncoder(cfg); !errors.Is(err, ErrLimitsExceeded) {
+			t.Errorf("have %v, want %v", err, ErrLimitsExceeded)
+		}
+		cfg.SampleSize = 12
+		if _, err := NewEncoder(cfg); !errors.Is(err, ErrUnsupportedBitDepth) {
+			t.Errorf("have %v, want %v", err, ErrUnsupportedBitDepth)
+		}
+
+		e, err = NewEncoder(Config{SampleRate: 44100, SampleSize: 20, NumChannels: 1, FrameSize: 4096})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := e.Encode([]byte{0, 0, 0, 1, 0, 0}); !errors.Is(err, ErrInvalidPCM) {
+			t.Errorf("have %v, want %v", err, ErrInvalidPCM)
+		}
+	})
+}
+
+func TestEncoderMagicCookie(t *testing.T) {
+	cfg := DefaultConfig()
+	e, err := NewEncoder(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := e.MagicCookie(), cfg.MagicCookie(); !bytes.Equal(have, want) {
+		t.Errorf("have %x, want %x", have, want)
+	}
+
+	signals := testSignals(cfg.FrameSize, 16)
+	var sizes []int
+	for _, pcm := range [][]byte{
+		interleavePCM(16, signals["noise"], signals["noise"]),
+		interleavePCM(16, signals["silence"], signals["silence"]),
+	} {
+		frame, err := e.Encode(pcm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes = append(sizes, len(frame))
+	}
+	stream, err := ParseMagicCookie(e.MagicCookie())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := stream.MaxFrameBytes, sizes[0]; have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+	if have, want := stream.AvgBitRate, (sizes[0]+sizes[1])*8*44100/(2*cfg.FrameSize); have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+
+	entry := e.SampleEntry()
+	if have, want := entry[36:], append([]byte{0, 0, 0, 36, 'a', 'l', 'a', 'c', 0, 0, 0, 0}, e.MagicCookie()...); !bytes.Equal(have, want) {
+		t.Errorf("have %x, want %x", have, want)
+	}
+	if _, err := NewFromMagicCookie(entry[36:]); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEncodeVerbatim(t *testing.T) {
+	for _, bits := range []int{16, 20, 24, 32} {
+		cfg := Config{SampleRate: 44100, SampleSize: bits, NumChannels: 2, FrameSize: 4096}
+		e, err := NewEncoder(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := NewWithConfig(cfg, WithStrict())
+		if err != nil {
+			t.Fatal(err)
+		}
+		signals := testSignals(cfg.FrameSize, bits)
+		noise := interleavePCM(bits, signals["noise"], reversed(signals["noise"]))
+		for _, c := range []struct {
+			pcm      []byte
+			overhead int
+		}{
+			{noise, 4},
+			{noise[:len(noise)/2], MaxFrameOverhead},
+		} {
+			frame, err := e.Encode(c.pcm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 20 bit samples take 3 bytes of PCM, but 20 bits of a frame
+			samples := len(c.pcm) / ((bits + 7) / 8)
+			if have, want := len(frame), samples*bits/8+c.overhead; have != want {
+				t.Errorf("have %d, want %d", have, want)
+			}
+			info, err := d.InspectFrame(frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !info.Verbatim {
+				t.Errorf("have a compressed frame")
+			}
+			have, err := d.DecodeFrame(frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(have, c.pcm) {
+				t.Errorf("output differs")
+			}
+		}
+
+		// compressible frames stay compressed
+		frame, err := e.Encode(interleavePCM(bits, signals["sine"], signals["silence"]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := d.InspectFrame(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Verbatim {
+			t.Errorf("have a verbatim frame")
+		}
+		// like Apple's encoder, the low bits of 24 and 32 bit samples are
+		// stored as they are
+		if have, want := info.ShiftBits, map[int]int{24: 8, 32: 16}[bits]; have != want {
+			t.Errorf("%d bits: have %d, want %d", bits, have, want)
+		}
+	}
+
+	// random lengths of random data
+	rng := rand.New(rand.NewPCG(3, 4))
+	e, err := NewEncoder(DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 200 {
+		pcm := make([]byte, 4*(1+rng.IntN(DefaultConfig().FrameSize)))
+		for i := range pcm {
+			pcm[i] = byte(rng.Uint32())
+		}
+		frame, err := e.Encode(pcm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := len(frame), len(pcm)+MaxFrameOverhead; have > want {
+			t.Fatalf("have %d, want at most %d", have, want)
+		}
+	}
+}
+
+func TestEncodeMultichannel(t *testing.T) {
+	for _, bits := range []int{16, 24} {
+		for channels := 3; channels <= 8; channels++ {
+			cfg := Config{SampleRate: 48000, SampleSize: bits, NumChannels: channels, FrameSize: 4096}
+			e, err := NewEncoder(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var (
+				signals = testSignals(cfg.FrameSize, bits)
+				names   = []string{"sine", "noise", "silence", "square", "sparse", "constant"}
+				input   [][]int32
+			)
+			for c := range channels {
+				input = append(input, signals[names[c%len(names)]])
+			}
+			d, err := NewFromMagicCookie(e.MagicCookie())
+			if err != nil {
+				t.Fatal(err)
+			}
+			reverse := make([]int, channels)
+			for c := range reverse {
+				reverse[c] = channels - 1 - c
+			}
+			mapped, err := NewFromMagicCookie(e.MagicCookie(), WithChannelMap(reverse))
+			if err != nil {
+				t.Fatal(err)
+			}
+			planar, err := NewFromMagicCookie(e.MagicCookie(), WithOutput(OutputSpec{Layout: Planar}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, n := range []int{cfg.FrameSize, 100} {
+				var in [][]int32
+				for _, ch := range input {
+					in = append(in, ch[:n])
+				}
+				pcm := interleavePCM(bits, in...)
+				frame, err := e.Encode(pcm)
+				if err != nil {
+					t.Fatal(err)
+				}
+				elements := channelLayouts[channels-1].elements
+				if have, want := len(frame), len(pcm)+MaxFrameOverhead+7*(len(elements)-1); have > want {
+					t.Errorf("have %d, want at most %d", have, want)
+				}
+
+				// whole frames with a decoder of the stream
+				if have, err := d.DecodeFrame(frame); err != nil || !bytes.Equal(have, pcm) {
+					t.Errorf("%d bit, %d channels, %d samples: have %d bytes, %v, want %d", bits, channels, n, len(have), err, len(pcm))
+				}
+				samples := make([]int32, channels*cfg.FrameSize)
+				got, err := d.DecodeToInt32(frame, samples)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if have, want := got, channels*n; have != want {
+					t.Errorf("have %d, want %d", have, want)
+				}
+				for i, s := range samples[:got] {
+					if want := in[i%channels][i/channels]; s != want {
+						t.Fatalf("%d bit, %d channels: sample %d is %d, want %d", bits, channels, i, s, want)
+					}
+				}
+				rev := slices.Clone(in)
+				slices.Reverse(rev)
+				if have, err := mapped.DecodeFrame(frame); err != nil || !bytes.Equal(have, interleavePCM(bits, rev...)) {
+					t.Errorf("%d bit, %d channels: mapped output differs: %v", bits, channels, err)
+				}
+				var want []byte
+				for _, ch := range in {
+					want = append(want, interleavePCM(bits, ch)...)
+				}
+				if have, err := planar.DecodeFrame(frame); err != nil || !bytes.Equal(have, want) {
+					t.Errorf("%d bit, %d channels: planar output differs: %v", bits, channels, err)
+				}
+
+				// decode the elements in turn, with mono and stereo decoders
+				var instances [2]int
+				for _, k := range elements {
+					c := cfg
+					c.NumChannels = k
+					d, err := NewWithConfig(c)
+					if err != nil {
+						t.Fatal(err)
+					}
+					info, err := d.InspectFrame(frame)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if have, want := info.Instance, instances[k-1]; have != want {
+						t.Errorf("have instance %d, want %d", have, want)
+					}
+					instances[k-1]++
+					have, err := d.DecodeFrame(frame)
+					if err != nil {
+						t.Fatalf("%d bit, %d channels: %v", bits, channels, err)
+					}
+					if want := interleavePCM(bits, in[:k]...); !bytes.Equal(have, want) {
+						t.Errorf("%d bit, %d channels, %d samples: output differs", bits, channels, n)
+					}
+					in = in[k:]
+					frame = shiftBits(frame, 8*d.input_buffer_index+d.input_buffer_bitaccumulator)
+				}
+				if frame[0]>>5 != ElementEND {
+					t.Errorf("have element %d, want END", frame[0]>>5)
+				}
+			}
+
+			cookie := e.MagicCookie()
+			if have, want := len(cookie), cookieSize+channelLayoutSize; have != want {
+				t.Fatalf("have %d, want %d", have, want)
+			}
+			if have, want := string(cookie[28:32]), "chan"; have != want {
+				t.Errorf("have %q, want %q", have, want)
+			}
+			if have, want := binary.BigEndian.Uint32(cookie[36:]), ChannelLayoutTag(channels); have != want {
+				t.Errorf("have %x, want %x", have, want)
+			}
+			if have, want := ChannelLayoutTag(channels)&0xFFFF, uint32(channels); have != want {
+				t.Errorf("have %d, want %d", have, want)
+			}
+			stream, err := ParseMagicCookie(cookie)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have, want := stream.NumChannels, channels; have != want {
+				t.Errorf("have %d, want %d", have, want)
+			}
+			if have, want := e.SampleEntry()[36:], append([]byte{0, 0, 0, 60, 'a', 'l', 'a', 'c', 0, 0, 0, 0}, cookie...); !bytes.Equal(have, want) {
+				t.Errorf("have %x, want %x", have, want)
+			}
+		}
+	}
+
+	if have, want := len(DefaultConfig().MagicCookie()), cookieSize; have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+	cfg := DefaultConfig()
+	cfg.NumChannels = 9
+	if _, err := NewEncoder(cfg); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("have %v, want %v", err, ErrInvalidConfig)
+	}
+	if have := ChannelLayoutTag(9); have != 0 {
+		t.Errorf("have %x, want 0", have)
+	}
+}
+
+// shiftBits returns b without its first n bits.
+func shiftBits(b []byte, n int) []byte {
+	b = b[n/8:]
+	out := make([]byte, len(b))
+	for i := range b {
+		out[i] = b[i] << (n % 8)
+		if i+1 < len(b) && n%8 != 0 {
+			out[i] |= b[i+1] >> (8 - n%8)
+		}
+	}
+	return out
+}
+
+func reversed(s []int32) []int32 {
+	s = slices.Clone(s)
+	slices.Reverse(s)
+	return s
+}
+
+func TestEncodeVerify(t *testing.T) {
+	for _, bits := range []int{16, 20, 24, 32} {
+		for _, channels := range []int{1, 2, 6} {
+			cfg := Config{SampleRate: 44100, SampleSize: bits, NumChannels: channels, FrameSize: 1024}
+			e, err := NewEncoder(cfg, WithVerify())
+			if err != nil {
+				t.Fatal(err)
+			}
+			plain, err := NewEncoder(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var (
+				signals = testSignals(cfg.FrameSize, bits)
+				names   = []string{"sine", "noise", "square", "silence", "sparse", "constant"}
+				in      [][]int32
+			)
+			for c := range channels {
+				in = append(in, signals[names[c]][:1000])
+			}
+			pcm := interleavePCM(bits, in...)
+			have, err := e.Encode(pcm)
+			if err != nil {
+				t.Fatalf("%d bit, %d channels: %v", bits, channels, err)
+			}
+			want, err := plain.Encode(pcm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(have, want) {
+				t.Errorf("%d bit, %d channels: frames differ", bits, channels)
+			}
+
+			// a frame of other samples
+			e.samples[channels-1][999]++
+			if err := e.verifyFrame(have, 1000); !errors.Is(err, ErrVerify) {
+				t.Errorf("have %v, want %v", err, ErrVerify)
+			}
+		}
+	}
+}
+
+func TestEncodeFloat(t *testing.T) {
+	for _, bits := range []int{16, 20, 24, 32} {
+		cfg := Config{SampleRate: 44100, SampleSize: bits, NumChannels: 2, FrameSize: 1024}
+		e, err := NewEncoder(cfg, WithVerify())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var (
+			signals     = testSignals(1000, bits)
+			left, right = signals["sine"], signals["square"]
+			scale       = math.Ldexp(1, 1-bits)
+			f32         []float32
+			f64         []float64
+		)
+		for i := range left {
+			f64 = append(f64, float64(left[i])*scale, float64(right[i])*scale)
+			f32 = append(f32, float32(float64(left[i])*scale), float32(float64(right[i])*scale))
+		}
+		want, err := e.Encode(interleavePCM(bits, left, right))
+		if err != nil {
+			t.Fatal(err)
+		}
+		have, err := e.EncodeFloat64(f64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(have, want) {
+			t.Errorf("%d bit: float64 frame differs", bits)
+		}
+		if bits <= 24 {
+			// float32 has 24 bits of precision
+			have, err := e.EncodeFloat32(f32)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(have, want) {
+				t.Errorf("%d bit: float32 frame differs", bits)
+			}
+		}
+	}
+
+	t.Run("clip", func(t *testing.T) {
+		cfg := Config{SampleRate: 44100, SampleSize: 16, NumChannels: 1, FrameSize: 1024}
+		e, err := NewEncoder(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		have, err := e.EncodeFloat32([]float32{1, -1.5, 0.5, float32(math.Inf(1)), 0.00002})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := e.Encode(interleavePCM(16, []int32{math.MaxInt16, math.MinInt16, 16384, math.MaxInt16, 1}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(have, want) {
+			t.Errorf("have %x, want %x", have, want)
+		}
+	})
+
+	t.Run("dither", func(t *testing.T) {
+		for _, dither := range []Dither{DitherTPDF, DitherShaped} {
+			cfg := Config{SampleRate: 44100, SampleSize: 16, NumChannels: 1, FrameSize: 4096}
+			e, err := NewEncoder(cfg, WithFloatDither(dither))
+			if err != nil {
+				t.Fatal(err)
+			}
+			in := make([]float64, cfg.FrameSize)
+			for i := range in {
+				if i >= 100 { // and silence before
+					in[i] = 0.3 * math.Sin(float64(i)*0.01)
+				}
+			}
+			frame, err := e.EncodeFloat64(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d, err := NewWithConfig(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := make([]int32, cfg.FrameSize)
+			if _, err := d.DecodeToInt32(frame, out); err != nil {
+				t.Fatal(err)
+			}
+			var sum, changed float64
+			for i, s := range out {
+				x := in[i] * 32768
+				if i < 100 && s != 0 {
+					t.Fatalf("dither %d: have %d, want silence", dither, s)
+				}
+				if diff := float64(s) - x; math.Abs(diff) > 3 {
+					t.Fatalf("dither %d: sample %d is %d, want about %f", dither, i, s, x)
+				} else {
+					sum += diff
+				}
+				if float64(s) != math.Round(x) {
+					changed++
+				}
+			}
+			if mean := sum / float64(len(out)); math.Abs(mean) > 0.1 {
+				t.Errorf("dither %d: have mean error %f", dither, mean)
+			}
+			if changed < 1000 {
+				t.Errorf("dither %d: have %f dithered samples", dither, changed)
+			}
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		e, err := NewEncoder(DefaultConfig())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, samples := range [][]float32{nil, {0.5}, {0, float32(math.NaN())}, make([]float32, 2*4097)} {
+			if _, err := e.EncodeFloat32(samples); !errors.Is(err, ErrInvalidPCM) {
+				t.Errorf("have %v, want %v", err, ErrInvalidPCM)
+			}
+		}
+		if _, err := NewEncoder(DefaultConfig(), WithFloatDither(Dither(7))); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("have %v, want %v", err, ErrInvalidConfig)
+		}
+	})
+}
+
+func TestEncodeStereoMix(t *testing.T) {
+	var (
+		rng   = rand.New(rand.NewPCG(1, 2))
+		n     = 4096
+		tone  = make([]int32, n)
+		quiet = make([]int32, n)
+		loud  = make([]int32, n)
+	)
+	for i := range n {
+		tone[i] = int32(8000*math.Sin(float64(i)*0.05) + 3000*math.Sin(float64(i)*0.013))
+		quiet[i] = tone[i] + rng.Int32N(21) - 10
+		loud[i] = tone[i] + rng.Int32N(401) - 200
+	}
+	cfg := DefaultConfig()
+	cfg.FrameSize = n
+	d, err := NewWithConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name        string
+		left, right []int32
+		preset      Preset
+		want        int // MixRes
+	}{
+		{"panned", quiet, loud, PresetNormal, 4},
+		{"panned", quiet, loud, PresetMax, 4},
+		{"panned", loud, quiet, PresetNormal, 0},
+		{"independent", loud, testSignals(n, 16)["noise"], PresetNormal, 0},
+		{"panned fast", quiet, loud, PresetFast, 0},
+	} {
+		e, err := NewEncoder(cfg, WithPreset(c.preset))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pcm := interleavePCM(16, c.left, c.right)
+		frame, err := e.Encode(pcm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := d.InspectFrame(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := info.MixRes, c.want; have != want {
+			t.Errorf("%s, preset %d: have %d, want %d", c.name, c.preset, have, want)
+		}
+		have, err := d.DecodeFrame(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(have, pcm) {
+			t.Errorf("%s, preset %d: output differs", c.name, c.preset)
+		}
+	}
+}
+
+// TestEncodeDeterministic pins the frames of every preset, so platforms
+// which round floats differently show up.
+func TestEncodeDeterministic(t *testing.T) {
+	wav, err := os.ReadFile("testdata/samples/jane_eyre_5s.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcm := wav[bytes.Index(wav, []byte("data"))+8:]
+	for _, c := range []struct {
+		preset Preset
+		want   string
+	}{
+		{PresetFast, "8b9d46d3784c5e01b5cdc2614a3e81d66e2a3272008e6b395ede2bfd066e50ab"},
+		{PresetNormal, "7a4d8534538c569ba42230ca07ecd932a372e01574bd5139c5683a18b16f5b01"},
+		{PresetMax, "d10145734d418030bdbf3347b0dfe07db3b7c934afaabc04b7d696663b8d9287"},
+	} {
+		e, err := NewEncoder(DefaultConfig(), WithPreset(c.preset))
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := sha256.New()
+		for b := pcm; len(b) > 0; {
+			n := min(len(b), 4*e.Config().FrameSize)
+			frame, err := e.Encode(b[:n])
+			if err != nil {
+				t.Fatal(err)
+			}
+			h.Write(frame)
+			b = b[n:]
+		}
+		if have := hex.EncodeToString(h.Sum(nil)); have != c.want {
+			t.Errorf("preset %d: have %s, want %s", c.preset, have, c.want)
+		}
+	}
+}
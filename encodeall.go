@@ -0,0 +1,34 @@
+package alac
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// EncodeAll encodes PCM in memory in frames of FrameSize samples, the last
+// frame with the rest, and returns the frames. It's ParallelEncoder.EncodeAll
+// on the goroutine of the caller. ctx is checked before every frame, so a
+// cancelled ctx stops the encode within one frame. On error the frames
+// encoded so far are returned together with the error.
+func (e *Encoder) EncodeAll(ctx context.Context, pcm []byte) ([][]byte, error) {
+	var (
+		frames [][]byte
+		size   = e.width * e.cfg.NumChannels * e.cfg.FrameSize
+	)
+	for i := 0; len(pcm) > 0; i++ {
+		if err := ctx.Err(); err != nil {
+			return frames, err
+		}
+		n := min(len(pcm), size)
+		err := e.EncodeFrames(pcm[:n], func(frame []byte, _ int) error {
+			frames = append(frames, slices.Clone(frame))
+			return nil
+		})
+		if err != nil {
+			return frames, fmt.Errorf("%w (frame %d)", err, i)
+		}
+		pcm = pcm[n:]
+	}
+	return frames, nil
+}
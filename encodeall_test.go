@@ -0,0 +1,59 @@
+package alac
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestEncodeAll(t *testing.T) {
+	var (
+		signals = testSignals(5000, 16)
+		pcm     = interleavePCM(16, signals["sine"], signals["noise"])
+		cfg     = DefaultConfig()
+		ctx     = context.Background()
+	)
+	e, err := NewEncoder(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	have, err := e.EncodeAll(ctx, pcm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewEncoder(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := NewParallelEncoder(p, 2).EncodeAll(ctx, pcm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(have), len(want); have != want {
+		t.Fatalf("have %d frames, want %d", have, want)
+	}
+	for i := range have {
+		if !bytes.Equal(have[i], want[i]) {
+			t.Errorf("frame %d differs", i)
+		}
+	}
+
+	t.Run("error", func(t *testing.T) {
+		have, err := e.EncodeAll(ctx, pcm[:3*4*cfg.FrameSize+3])
+		if !errors.Is(err, ErrInvalidPCM) {
+			t.Errorf("have %v, want %v", err, ErrInvalidPCM)
+		}
+		if have, want := len(have), 3; have != want {
+			t.Errorf("have %d, want %d", have, want)
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		if _, err := e.EncodeAll(ctx, pcm); !errors.Is(err, context.Canceled) {
+			t.Errorf("have %v, want %v", err, context.Canceled)
+		}
+	})
+}
@@ -0,0 +1,95 @@
+package alac
+
+// EncoderOption configures optional encoder behaviour. Pass them to
+// NewEncoder.
+type EncoderOption func(*Encoder)
+
+// Preset trades encoding speed for compression, see WithPreset. All
+// presets make frames any decoder takes; only the choices the encoder tries
+// for every frame differ.
+type Preset int
+
+const (
+	// PresetNormal tries the two predictor orders of Apple's encoder, on
+	// the stereo mix which looks the most predictable. This is the
+	// default.
+	PresetNormal Preset = iota
+	// PresetFast tries a single predictor and stores stereo channels as
+	// they are. It's about twice as fast as PresetNormal, but does a lot
+	// worse on stereo with much in common, such as mono recordings stored
+	// in two channels.
+	PresetFast
+	// PresetMax tries predictor orders up to 30, several coefficient
+	// precisions, and rice parameters, on every stereo mix. It's over ten times slower than
+	// PresetNormal, for files about a percent smaller.
+	PresetMax
+)
+
+// WithPreset sets how hard the encoder searches for the smallest coding of
+// every frame. Unknown presets fail with ErrInvalidConfig.
+func WithPreset(p Preset) EncoderOption {
+	return func(e *Encoder) {
+		e.preset = p
+	}
+}
+
+// WithVerify makes the encoder decode every frame it encodes, and compare
+// the samples with its PCM, like flac --verify. Frames which differ fail
+// with ErrVerify. It's a safety net for archiving, which makes encoding a
+// little slower.
+func WithVerify() EncoderOption {
+	return func(e *Encoder) {
+		e.verify = true
+	}
+}
+
+// WithFloatDither sets how EncodeFloat32 and EncodeFloat64 round float
+// samples to the SampleSize of the stream: to the nearest value with
+// NoDither, the default, or with the noise of the Dither. The dither state
+// carries over from frame to frame, so frames should be encoded in order.
+// Digital silence stays silent. Unknown values fail with ErrInvalidConfig.
+func WithFloatDither(d Dither) EncoderOption {
+	return func(e *Encoder) {
+		e.quantizer.dither = d
+	}
+}
+
+// search is what the encoder tries for every frame: every combination of
+// the predictor orders, the quantizations of the predictor coefficients,
+// and the rice modifiers, for every channel of every stereo mix.
+// Codings of the same size go to the first one tried, in the order of the
+// slices. With estimate only the mix estimateMix picks is tried.
+type search struct {
+	orders        []int // ascending
+	quantizations []int
+	riceModifiers []int
+	mixes         []stereoMix
+	estimate      bool
+}
+
+// appleMixes are the stereo mixes of Apple's encoder: the channels as they
+// are, and the weights of 1/4 to 4/4 of the left channel in the first
+// channel. 2/4 is mid/side.
+var appleMixes = []stereoMix{{}, {2, 1}, {2, 2}, {2, 3}, {2, 4}}
+
+var presets = map[Preset]search{
+	PresetFast: {
+		orders:        []int{8},
+		quantizations: []int{9},
+		riceModifiers: []int{4},
+		mixes:         []stereoMix{{}},
+	},
+	PresetNormal: {
+		orders:        []int{4, 8},
+		quantizations: []int{9},
+		riceModifiers: []int{4},
+		mixes:         appleMixes,
+		estimate:      true,
+	},
+	PresetMax: {
+		orders:        []int{4, 8, 12, 16, 24, 30},
+		quantizations: []int{8, 9, 10},
+		riceModifiers: []int{2, 3, 4, 5, 6},
+		mixes:         appleMixes,
+	},
+}
@@ -0,0 +1,75 @@
+package alac
+
+// EncoderStats counts what an Encoder has encoded, see Encoder.Stats. The
+// predictor orders and rice modifiers are counted for every channel of the
+// compressed elements.
+type EncoderStats struct {
+	Frames         int   // encoded frames
+	VerbatimFrames int   // frames with an element stored uncompressed
+	Samples        int64 // encoded samples per channel
+	BytesIn        int64 // of PCM, for float input of the PCM it was rounded to
+	BytesOut       int64 // of the frames
+
+	Orders        [encodeMaxOrder + 1]int // channels by predictor order
+	RiceModifiers [8]int                  // channels by rice modifier
+}
+
+// Ratio is BytesOut over BytesIn: 0.6 for frames of 60% the size of their
+// PCM. It's 0 without frames.
+func (s EncoderStats) Ratio() float64 {
+	if s.BytesIn == 0 {
+		return 0
+	}
+	return float64(s.BytesOut) / float64(s.BytesIn)
+}
+
+// AvgOrder is the average predictor order of the compressed channels.
+func (s EncoderStats) AvgOrder() float64 {
+	var n, sum int
+	for order, c := range s.Orders {
+		n += c
+		sum += order * c
+	}
+	if n == 0 {
+		return 0
+	}
+	return float64(sum) / float64(n)
+}
+
+func (s *EncoderStats) add(o EncoderStats) {
+	s.Frames += o.Frames
+	s.VerbatimFrames += o.VerbatimFrames
+	s.Samples += o.Samples
+	s.BytesIn += o.BytesIn
+	s.BytesOut += o.BytesOut
+	for i, c := range o.Orders {
+		s.Orders[i] += c
+	}
+	for i, c := range o.RiceModifiers {
+		s.RiceModifiers[i] += c
+	}
+}
+
+// Stats returns the stats of the frames encoded so far.
+func (e *Encoder) Stats() EncoderStats {
+	return e.stats
+}
+
+// OnFrame registers fn to be called with every frame the encoder makes,
+// and its stats, before Encode returns. For a ParallelEncoder it's called
+// in stream order. The frame is only valid until fn returns. It replaces
+// any earlier hook, and nil removes it.
+func (e *Encoder) OnFrame(fn func(stats EncoderStats, frame []byte)) {
+	e.onFrame = fn
+}
+
+// addFrame adds the stats of a frame to those of the stream, and calls the
+// OnFrame hook.
+func (e *Encoder) addFrame(s EncoderStats, frame []byte) {
+	e.maxFrameBytes = max(e.maxFrameBytes, len(frame))
+	e.lastSamples = int(s.Samples)
+	e.stats.add(s)
+	if e.onFrame != nil {
+		e.onFrame(s, frame)
+	}
+}
@@ -0,0 +1,77 @@
+package alac
+
+import "testing"
+
+func TestEncoderStats(t *testing.T) {
+	cfg := Config{SampleRate: 44100, SampleSize: 16, NumChannels: 2, FrameSize: 4096}
+	e, err := NewEncoder(cfg, WithPreset(PresetFast))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		frames []EncoderStats
+		bytes  int64
+	)
+	e.OnFrame(func(s EncoderStats, frame []byte) {
+		frames = append(frames, s)
+		bytes += int64(len(frame))
+	})
+	if have, want := e.Stats().Ratio(), 0.0; have != want {
+		t.Errorf("have %v, want %v", have, want)
+	}
+
+	signals := testSignals(cfg.FrameSize, 16)
+	for _, c := range []struct {
+		left, right string
+		n           int
+	}{
+		{"sine", "sine", 4096},
+		{"noise", "noise", 4096},
+		{"sine", "square", 1000},
+	} {
+		pcm := interleavePCM(16, signals[c.left][:c.n], signals[c.right][:c.n])
+		if _, err := e.Encode(pcm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := e.Stats()
+	if have, want := len(frames), 3; have != want {
+		t.Fatalf("have %d, want %d", have, want)
+	}
+	if have, want := frames[1].VerbatimFrames, 1; have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+	var sum EncoderStats
+	for _, f := range frames {
+		sum.add(f)
+	}
+	if sum != s {
+		t.Errorf("have %+v, want %+v", sum, s)
+	}
+	for _, c := range []struct {
+		name       string
+		have, want int64
+	}{
+		{"frames", int64(s.Frames), 3},
+		{"verbatim", int64(s.VerbatimFrames), 1},
+		{"samples", s.Samples, 4096 + 4096 + 1000},
+		{"in", s.BytesIn, 4 * (4096 + 4096 + 1000)},
+		{"out", s.BytesOut, bytes},
+		{"orders", int64(s.Orders[8]), 4}, // PresetFast only tries order 8
+		{"rice", int64(s.RiceModifiers[4]), 4},
+	} {
+		if c.have != c.want {
+			t.Errorf("%s: have %d, want %d", c.name, c.have, c.want)
+		}
+	}
+	if have, want := s.AvgOrder(), 8.0; have != want {
+		t.Errorf("have %v, want %v", have, want)
+	}
+	if have, want := s.Ratio(), float64(bytes)/float64(s.BytesIn); have != want {
+		t.Errorf("have %v, want %v", have, want)
+	}
+	if have, want := e.Gapless().Samples, s.Samples; have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+}
@@ -0,0 +1,46 @@
+package alac
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by the decoder and the encoder. They are usually wrapped
+// with more detail, so test for them with errors.Is.
+var (
+	// ErrInvalidConfig is returned for configs and magic cookies the decoder
+	// can't use.
+	ErrInvalidConfig = errors.New("alac: invalid config")
+	// ErrUnsupportedBitDepth is returned for sample sizes other than 16,
+	// 20, 24, and 32 bits.
+	ErrUnsupportedBitDepth = errors.New("alac: unsupported bit depth")
+	// ErrConfigMismatch is returned for frames which don't fit the config
+	// of the decoder, unless it was created WithAutoReconfigure.
+	ErrConfigMismatch = errors.New("alac: frame doesn't match config")
+	// ErrChannelMismatch is the ErrConfigMismatch for frames with a
+	// different number of channels.
+	ErrChannelMismatch = fmt.Errorf("%w: channel count", ErrConfigMismatch)
+	// ErrInvalidFrame is returned for frames which violate the bitstream
+	// format.
+	ErrInvalidFrame = errors.New("alac: invalid frame")
+	// ErrTruncatedBitstream is returned when a frame ends before all its
+	// data has been read.
+	ErrTruncatedBitstream = errors.New("alac: truncated bitstream")
+	// ErrLimitsExceeded is returned for configs above the limits set with
+	// WithMaxFrameSize or WithMaxChannels.
+	ErrLimitsExceeded = errors.New("alac: limits exceeded")
+	// ErrShortBuffer is returned when the destination slice can't hold a
+	// decoded frame.
+	ErrShortBuffer = errors.New("alac: destination too small")
+	// ErrInvalidPCM is returned by the Encoder for PCM which doesn't make
+	// a frame.
+	ErrInvalidPCM = errors.New("alac: invalid PCM")
+	// ErrVerify is returned by an Encoder created WithVerify for frames
+	// which don't decode to their PCM.
+	ErrVerify = errors.New("alac: frame doesn't decode to its PCM")
+	// ErrClosed is returned when decoding after Close.
+	ErrClosed = errors.New("alac: decoder is closed")
+	// ErrUnknownFormat is returned by Open for files of a format nobody
+	// registered with RegisterFormat.
+	ErrUnknownFormat = errors.New("alac: unknown container format")
+)
@@ -0,0 +1,25 @@
+//go:build !purego
+
+package alac
+
+func firSum(x, c []int32, base int32) int64 {
+	x = x[:len(c)]
+	switch dispatch.firSum {
+	case avx2:
+		return firSumAVX2(&x[0], &c[0], len(c), base)
+	case sse41:
+		return firSumSSE41(&x[0], &c[0], len(c), base)
+	default:
+		return firSumGeneric(x, c, base)
+	}
+}
+
+// firSumAVX2 is firSumGeneric for n > 0 values.
+//
+//go:noescape
+func firSumAVX2(x, c *int32, n int, base int32) int64
+
+// firSumSSE41 is firSumGeneric for n > 0 values.
+//
+//go:noescape
+func firSumSSE41(x, c *int32, n int, base int32) int64
@@ -0,0 +1,117 @@
+//go:build !purego
+
+#include "textflag.h"
+
+// func firSumAVX2(x, c *int32, n int, base int32) int64
+TEXT ·firSumAVX2(SB), NOSPLIT, $0-40
+	MOVQ x+0(FP), SI
+	MOVQ c+8(FP), DI
+	MOVQ n+16(FP), CX
+	MOVL base+24(FP), BX
+	MOVD BX, X1
+	VPBROADCASTD X1, Y1
+	VPXOR Y0, Y0, Y0 // 4 int64 sums
+
+loop8:
+	CMPQ CX, $8
+	JL   tail4
+	VMOVDQU (SI), Y2
+	VPSUBD  Y1, Y2, Y2
+	VMOVDQU (DI), Y3
+	VPMULLD Y3, Y2, Y2 // the low 32 bits, so it wraps like the Go code
+	VPMOVSXDQ X2, Y4
+	VEXTRACTI128 $1, Y2, X2
+	VPMOVSXDQ X2, Y2
+	VPADDQ  Y4, Y0, Y0
+	VPADDQ  Y2, Y0, Y0
+	ADDQ    $32, SI
+	ADDQ    $32, DI
+	SUBQ    $8, CX
+	JMP     loop8
+
+tail4:
+	CMPQ CX, $4
+	JL   reduce
+	VMOVDQU (SI), X2
+	VPSUBD  X1, X2, X2
+	VMOVDQU (DI), X3
+	VPMULLD X3, X2, X2
+	VPMOVSXDQ X2, Y4
+	VPADDQ  Y4, Y0, Y0
+	ADDQ    $16, SI
+	ADDQ    $16, DI
+	SUBQ    $4, CX
+
+reduce:
+	VEXTRACTI128 $1, Y0, X2
+	VPADDQ  X2, X0, X0
+	VPSHUFD $0x4e, X0, X2
+	VPADDQ  X2, X0, X0
+	VMOVQ   X0, AX
+	VZEROUPPER
+
+tail1:
+	TESTQ CX, CX
+	JZ    done
+	MOVL  (SI), DX
+	SUBL  BX, DX
+	IMULL (DI), DX
+	MOVLQSX DX, DX
+	ADDQ  DX, AX
+	ADDQ  $4, SI
+	ADDQ  $4, DI
+	DECQ  CX
+	JMP   tail1
+
+done:
+	MOVQ AX, ret+32(FP)
+	RET
+
+// func firSumSSE41(x, c *int32, n int, base int32) int64
+TEXT ·firSumSSE41(SB), NOSPLIT, $0-40
+	MOVQ x+0(FP), SI
+	MOVQ c+8(FP), DI
+	MOVQ n+16(FP), CX
+	MOVL base+24(FP), BX
+	MOVD BX, X1
+	PSHUFD $0, X1, X1
+	PXOR X0, X0 // 2 int64 sums
+
+loop4:
+	CMPQ CX, $4
+	JL   reduce
+	MOVOU (SI), X2
+	PSUBL X1, X2
+	MOVOU (DI), X3
+	PMULLD X3, X2
+	PMOVSXDQ X2, X4
+	PSHUFD $0x4e, X2, X2
+	PMOVSXDQ X2, X2
+	PADDQ X4, X0
+	PADDQ X2, X0
+	ADDQ  $16, SI
+	ADDQ  $16, DI
+	SUBQ  $4, CX
+	JMP   loop4
+
+reduce:
+	PSHUFD $0x4e, X0, X2
+	PADDQ X2, X0
+	MOVQ  X0, AX
+
+tail1:
+	TESTQ CX, CX
+	JZ    done
+	MOVL  (SI), DX
+	SUBL  BX, DX
+	IMULL (DI), DX
+	MOVLQSX DX, DX
+	ADDQ  DX, AX
+	ADDQ  $4, SI
+	ADDQ  $4, DI
+	DECQ  CX
+	JMP   tail1
+
+done:
+	MOVQ AX, ret+32(FP)
+	RET
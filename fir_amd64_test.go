@@ -0,0 +1,69 @@
+//go:build !purego
+
+package alac
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestFirSum(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	values := func(n int, r func() int32) []int32 {
+		v := make([]int32, n)
+		for i := range v {
+			v[i] = r()
+		}
+		return v
+	}
+	for n := 1; n <= 32; n++ {
+		for _, r := range []func() int32{
+			func() int32 { return int32(rng.IntN(1<<16)) - 1<<15 },
+			func() int32 { return int32(rng.Uint32()) }, // wraps
+			func() int32 { return []int32{math.MinInt32, math.MaxInt32, -1, 0, 1}[rng.IntN(5)] },
+		} {
+			x, c, base := values(n, r), values(n, r), r()
+			want := firSumGeneric(x, c, base)
+			if supported(sse41) {
+				if have := firSumSSE41(&x[0], &c[0], n, base); have != want {
+					t.Errorf("sse4.1, n=%d: have %d, want %d", n, have, want)
+				}
+			}
+			if supported(avx2) {
+				if have := firSumAVX2(&x[0], &c[0], n, base); have != want {
+					t.Errorf("avx2, n=%d: have %d, want %d", n, have, want)
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkFirSum(b *testing.B) {
+	x := make([]int32, 32)
+	c := make([]int32, 32)
+	for i := range x {
+		x[i], c[i] = int32(i*1000), int32(i-16)
+	}
+	for _, n := range []int{4, 8, 16, 31} {
+		b.Run("generic/"+string(rune('0'+n/10))+string(rune('0'+n%10)), func(b *testing.B) {
+			for b.Loop() {
+				firSumGeneric(x[:n], c[:n], 7)
+			}
+		})
+		if supported(sse41) {
+			b.Run("sse4.1/"+string(rune('0'+n/10))+string(rune('0'+n%10)), func(b *testing.B) {
+				for b.Loop() {
+					firSumSSE41(&x[0], &c[0], n, 7)
+				}
+			})
+		}
+		if supported(avx2) {
+			b.Run("avx2/"+string(rune('0'+n/10))+string(rune('0'+n%10)), func(b *testing.B) {
+				for b.Loop() {
+					firSumAVX2(&x[0], &c[0], n, 7)
+				}
+			})
+		}
+	}
+}
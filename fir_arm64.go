@@ -0,0 +1,33 @@
+//go:build !purego
+
+package alac
+
+func firSum(x, c []int32, base int32) int64 {
+	x = x[:len(c)]
+	if dispatch.firSum == neon {
+		return firSumNEON(&x[0], &c[0], len(c), base)
+	}
+	return firSumGeneric(x, c, base)
+}
+
+// mix16 does the start of deinterlace_16 for little endian stereo, and
+// returns the number of samples done.
+func mix16(out []byte, a, b []int32, n int, shift, weight uint8) int {
+	m := n &^ 3
+	if dispatch.mix16 != neon || m == 0 {
+		return 0
+	}
+	_, _, _ = out[4*m-1], a[m-1], b[m-1]
+	mix16NEON(&out[0], &a[0], &b[0], m, int(shift), int(weight))
+	return m
+}
+
+// firSumNEON is firSumGeneric for n > 0 values.
+//
+//go:noescape
+func firSumNEON(x, c *int32, n int, base int32) int64
+
+// mix16NEON is deinterlace_16 for n samples, n a multiple of 4.
+//
+//go:noescape
+func mix16NEON(out *byte, a, b *int32, n, shift, weight int)
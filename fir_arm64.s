@@ -0,0 +1,89 @@
+//go:build !purego
+
+#include "textflag.h"
+
+// func firSumNEON(x, c *int32, n int, base int32) int64
+TEXT ·firSumNEON(SB), NOSPLIT, $0-40
+	MOVD x+0(FP), R0
+	MOVD c+8(FP), R1
+	MOVD n+16(FP), R2
+	MOVW base+24(FP), R3
+	VDUP R3, V1.S4
+	VEOR V0.B16, V0.B16, V0.B16 // 2 int64 sums
+	VEOR V5.B16, V5.B16, V5.B16 // 2 more
+
+loop4:
+	CMP  $4, R2
+	BLT  reduce
+	VLD1.P 16(R0), [V2.S4]
+	VLD1.P 16(R1), [V3.S4]
+	VSUB V1.S4, V2.S4, V2.S4
+	VMUL V3.S4, V2.S4, V2.S4 // the low 32 bits, so it wraps like the Go code
+	VSXTL  V2.S2, V4.D2
+	VSXTL2 V2.S4, V6.D2
+	VADD V4.D2, V0.D2, V0.D2
+	VADD V6.D2, V5.D2, V5.D2
+	SUB  $4, R2
+	B    loop4
+
+reduce:
+	VADD  V5.D2, V0.D2, V0.D2
+	VADDP V0.D2, V0.D2, V0.D2
+	VMOV  V0.D[0], R4
+
+tail1:
+	CBZ    R2, done
+	MOVW.P 4(R0), R5
+	MOVW.P 4(R1), R6
+	SUBW   R3, R5, R5
+	MULW   R6, R5, R5
+	SXTW   R5, R5
+	ADD    R5, R4, R4
+	SUB    $1, R2
+	B      tail1
+
+done:
+	MOVD R4, ret+32(FP)
+	RET
+
+// func mix16NEON(out *byte, a, b *int32, n, shift, weight int)
+TEXT ·mix16NEON(SB), NOSPLIT, $0-48
+	MOVD out+0(FP), R0
+	MOVD a+8(FP), R1
+	MOVD b+16(FP), R2
+	MOVD n+24(FP), R3
+	MOVD shift+32(FP), R4
+	MOVD weight+40(FP), R5
+	CBZ  R5, plain
+	VDUP R5, V7.S4
+	NEG  R4, R4
+	VDUP R4, V6.S4 // a negative SSHL is an arithmetic shift right
+
+weighted:
+	CBZ    R3, done
+	VLD1.P 16(R1), [V0.S4] // midright
+	VLD1.P 16(R2), [V1.S4] // difference
+	VMUL   V7.S4, V1.S4, V2.S4
+	VSSHL  V6.S4, V2.S4, V2.S4
+	VSUB   V2.S4, V0.S4, V3.S4 // right
+	VADD   V1.S4, V3.S4, V4.S4 // left
+	VZIP1  V3.S4, V4.S4, V8.S4 // l0 r0 l1 r1
+	VZIP2  V3.S4, V4.S4, V9.S4 // l2 r2 l3 r3
+	VUZP1  V9.H8, V8.H8, V10.H8 // the low halves
+	VST1.P [V10.H8], 16(R0)
+	SUB    $4, R3
+	B      weighted
+
+plain:
+	CBZ    R3, done
+	VLD1.P 16(R1), [V0.S4] // left
+	VLD1.P 16(R2), [V1.S4] // right
+	VZIP1  V1.S4, V0.S4, V8.S4
+	VZIP2  V1.S4, V0.S4, V9.S4
+	VUZP1  V9.H8, V8.H8, V10.H8
+	VST1.P [V10.H8], 16(R0)
+	SUB    $4, R3
+	B      plain
+
+done:
+	RET
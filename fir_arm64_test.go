@@ -0,0 +1,77 @@
+//go:build !purego
+
+package alac
+
+import (
+	"bytes"
+	"math"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestFirSum(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	values := func(n int, r func() int32) []int32 {
+		v := make([]int32, n)
+		for i := range v {
+			v[i] = r()
+		}
+		return v
+	}
+	for n := 1; n <= 32; n++ {
+		for _, r := range []func() int32{
+			func() int32 { return int32(rng.IntN(1<<16)) - 1<<15 },
+			func() int32 { return int32(rng.Uint32()) }, // wraps
+			func() int32 { return []int32{math.MinInt32, math.MaxInt32, -1, 0, 1}[rng.IntN(5)] },
+		} {
+			x, c, base := values(n, r), values(n, r), r()
+			want := firSumGeneric(x, c, base)
+			if have := firSumNEON(&x[0], &c[0], n, base); have != want {
+				t.Errorf("n=%d: have %d, want %d", n, have, want)
+			}
+		}
+	}
+}
+
+func TestMix16(t *testing.T) {
+	saved := dispatch
+	defer func() { dispatch = saved }()
+
+	rng := rand.New(rand.NewPCG(3, 4))
+	for _, n := range []int{1, 3, 4, 5, 8, 33, 352} {
+		for _, mix := range [][2]uint8{{0, 0}, {1, 1}, {2, 1}, {4, 3}, {31, 255}} {
+			a, b := make([]int32, n), make([]int32, n)
+			for i := range a {
+				a[i], b[i] = int32(rng.Uint32()), int32(rng.IntN(1<<17))-1<<16
+			}
+			have, want := make([]byte, 4*n), make([]byte, 4*n)
+			dispatch.mix16 = scalar
+			deinterlace_16(a, b, want, 2, n, mix[0], mix[1], false)
+			dispatch.mix16 = neon
+			deinterlace_16(a, b, have, 2, n, mix[0], mix[1], false)
+			if !bytes.Equal(have, want) {
+				t.Errorf("n=%d, shift=%d, weight=%d: have %x, want %x", n, mix[0], mix[1], have, want)
+			}
+		}
+	}
+}
+
+func BenchmarkFirSum(b *testing.B) {
+	x := make([]int32, 32)
+	c := make([]int32, 32)
+	for i := range x {
+		x[i], c[i] = int32(i*1000), int32(i-16)
+	}
+	for _, n := range []int{4, 8, 16, 31} {
+		b.Run("generic/"+string(rune('0'+n/10))+string(rune('0'+n%10)), func(b *testing.B) {
+			for b.Loop() {
+				firSumGeneric(x[:n], c[:n], 7)
+			}
+		})
+		b.Run("neon/"+string(rune('0'+n/10))+string(rune('0'+n%10)), func(b *testing.B) {
+			for b.Loop() {
+				firSumNEON(&x[0], &c[0], n, 7)
+			}
+		})
+	}
+}
@@ -0,0 +1,7 @@
+//go:build (!amd64 && !arm64) || purego
+
+package alac
+
+func firSum(x, c []int32, base int32) int64 {
+	return firSumGeneric(x, c, base)
+}
@@ -0,0 +1,83 @@
+package alac
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+// TestFirDecode decodes the same frames with every predictor
+// implementation.
+func TestFirDecode(t *testing.T) {
+	var frames [][]byte
+	for enc := range testFrames {
+		frames = append(frames, mustHex(enc))
+	}
+	for i, coefs := range [][]int16{
+		{160, -190, 170, -130, 80, -30, 10, -5},
+		{1200, -900, 300, 20, -100, 3, 4, -5, 6, -7, 8, -9, 10},
+		make([]int16, 30),
+	} {
+		frames = append(frames, compressedFrame(coefs, [][]int32{noise(1000, int32(2*i)), noise(1000, int32(2*i+1))}))
+	}
+
+	decode := func() [][]byte {
+		a, err := NewWithConfig(Config{SampleRate: 44100, SampleSize: 16, NumChannels: 2, FrameSize: 352}, WithAutoReconfigure())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out [][]byte
+		for _, f := range frames {
+			pcm, err := a.DecodeFrame(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out = append(out, pcm)
+		}
+		return out
+	}
+
+	var want [][]byte
+	kernelVariants(t, func(t testing.TB, name string) {
+		have := decode()
+		if want == nil {
+			want = have
+			return
+		}
+		for i := range want {
+			if !bytes.Equal(have[i], want[i]) {
+				t.Errorf("%s: frame %d differs", name, i)
+			}
+		}
+	})
+}
+
+// TestFirMatrix is TestFirDecode for the generated test matrix.
+func TestFirMatrix(t *testing.T) {
+	paths, _ := filepath.Glob("testdata/generated/*/*.m4a")
+	if len(paths) == 0 {
+		t.Skip("Test data not generated, run TestMatrix with FFmpeg installed.")
+	}
+	for _, path := range paths {
+		frames, cfg, err := readM4A(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var want []byte
+		kernelVariants(t, func(t testing.TB, name string) {
+			a, err := NewWithConfig(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var have []byte
+			for _, f := range frames {
+				have = append(have, a.Decode(f)...)
+			}
+			if want == nil {
+				want = have
+			} else if !bytes.Equal(have, want) {
+				t.Errorf("%s: %s differs", path, name)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package alac
+
+import (
+	"fmt"
+	"math"
+)
+
+// quantizer is the state of WithFloatDither, which carries over from
+// frame to frame.
+type quantizer struct {
+	dither Dither
+	seed   uint32
+	err    [maxChannels]float64 // rounding error of the last sample, per channel
+}
+
+// quantize rounds x, in LSBs of the stream, to a sample of channel ch
+// within lo and hi.
+func (q *quantizer) quantize(x float64, ch int, lo, hi float64) int32 {
+	if x == 0 {
+		// digital silence stays silent
+		return 0
+	}
+	if q.dither == DitherShaped {
+		x -= q.err[ch]
+	}
+	y := x
+	if q.dither != NoDither {
+		// triangular noise of ±1 LSB, as ditherer adds
+		q.seed = q.seed*1664525 + 1013904223
+		noise := float64(int32(q.seed>>24) - int32(q.seed>>16&0xff))
+		y += float64(noise / 256) // not fused, see autocorrelate
+	}
+	y = math.Round(y)
+	if q.dither == DitherShaped {
+		q.err[ch] = y - x
+	}
+	return int32(min(max(y, lo), hi))
+}
+
+// EncodeFloat32 is Encode for interleaved float samples, of at most
+// FrameSize samples per channel, with full scale at ±1.0. They are rounded
+// to the SampleSize of the stream, see WithFloatDither, and clipped. It
+// fails with ErrInvalidPCM for samples which aren't a whole number for
+// every channel, more than a frame, or NaN.
+func (e *Encoder) EncodeFloat32(samples []float32) ([]byte, error) {
+	return e.AppendEncodeFloat32(nil, samples)
+}
+
+// AppendEncodeFloat32 is EncodeFloat32, appending the frame to dst.
+func (e *Encoder) AppendEncodeFloat32(dst []byte, samples []float32) ([]byte, error) {
+	n, err := loadFloats(e, samples)
+	if err != nil {
+		return nil, err
+	}
+	return e.appendFrame(dst, n)
+}
+
+// EncodeFloat64 is EncodeFloat32 for float64 samples.
+func (e *Encoder) EncodeFloat64(samples []float64) ([]byte, error) {
+	return e.AppendEncodeFloat64(nil, samples)
+}
+
+// AppendEncodeFloat64 is EncodeFloat64, appending the frame to dst.
+func (e *Encoder) AppendEncodeFloat64(dst []byte, samples []float64) ([]byte, error) {
+	n, err := loadFloats(e, samples)
+	if err != nil {
+		return nil, err
+	}
+	return e.appendFrame(dst, n)
+}
+
+// loadFloats quantizes interleaved float samples into e.samples, and
+// returns the number of samples per channel.
+func loadFloats[T float32 | float64](e *Encoder, samples []T) (int, error) {
+	var (
+		channels = e.cfg.NumChannels
+		n        = len(samples) / channels
+		scale    = math.Ldexp(1, e.cfg.SampleSize-1)
+	)
+	if n == 0 || len(samples)%channels != 0 || n > e.cfg.FrameSize {
+		return 0, fmt.Errorf("%w: %d samples for %d channels, and %d samples per frame", ErrInvalidPCM, len(samples), channels, e.cfg.FrameSize)
+	}
+	for i, s := range samples {
+		x := float64(s)
+		if math.IsNaN(x) {
+			return 0, fmt.Errorf("%w: sample %d is NaN", ErrInvalidPCM, i)
+		}
+		c := i % channels
+		e.samples[c][i/channels] = e.quantizer.quantize(float64(x*scale), c, -scale, scale-1)
+	}
+	return n, nil
+}
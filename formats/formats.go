@@ -0,0 +1,41 @@
+// Package formats registers the container formats this module reads with
+// alac.Open, when it's imported:
+//
+//	import _ "github.com/alicebob/alac/formats"
+//
+//	s, err := alac.OpenFile("song.m4a")
+//	...
+//	defer s.Close()
+//	_, err = io.Copy(w, s) // the PCM
+//
+// The formats are:
+//
+//   - "mp4": MP4 and QuickTime files, of the mp4 package
+//
+// It's a package of its own because the container packages don't depend on
+// the decoder.
+package formats
+
+import (
+	"io"
+
+	"github.com/alicebob/alac"
+	"github.com/alicebob/alac/mp4"
+)
+
+// mp4Magics are the top level atoms MP4 and QuickTime files start with.
+var mp4Magics = []string{"????ftyp", "????moov", "????mdat", "????wide", "????free", "????skip"}
+
+func init() {
+	for _, magic := range mp4Magics {
+		alac.RegisterFormat("mp4", magic, openMP4)
+	}
+}
+
+func openMP4(r io.ReadSeeker) (alac.Container, error) {
+	f, err := mp4.Open(r)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
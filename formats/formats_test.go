@@ -0,0 +1,76 @@
+package formats
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/alac"
+	"github.com/alicebob/alac/alacm4a"
+)
+
+func TestOpenFile(t *testing.T) {
+	wav, err := os.ReadFile("../testdata/samples/jane_eyre_5s.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcm := wav[bytes.Index(wav, []byte("data"))+8:]
+	path := t.TempDir() + "/out.m4a"
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := alacm4a.Encode(f, bytes.NewReader(pcm), alac.DefaultConfig()); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := alac.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if have, want := s.Format(), "mp4"; have != want {
+		t.Errorf("have %q, want %q", have, want)
+	}
+	if have, want := s.SampleRate(), 44100; have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+	if have, want := s.Channels(), 2; have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+	if have, want := s.Duration(), time.Duration(len(pcm)/4)*time.Second/44100; have != want {
+		t.Errorf("have %v, want %v", have, want)
+	}
+	if have, want := s.TotalSamples(), int64(len(pcm)/4); have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+	have, err := io.ReadAll(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(have, pcm) {
+		t.Errorf("have %d bytes, want %d", len(have), len(pcm))
+	}
+
+	at := int64(len(pcm) / 4 / 3 * 4)
+	if pos, err := s.Seek(at, io.SeekStart); err != nil || pos != at {
+		t.Fatalf("have %d, %v, want %d", pos, err, at)
+	}
+	have, err = io.ReadAll(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(have, pcm[at:]) {
+		t.Errorf("have %d bytes, want %d", len(have), len(pcm[at:]))
+	}
+
+	if _, err := alac.OpenFile("formats.go"); !errors.Is(err, alac.ErrUnknownFormat) {
+		t.Errorf("have %v, want %v", err, alac.ErrUnknownFormat)
+	}
+}
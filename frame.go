@@ -0,0 +1,97 @@
+package alac
+
+import (
+	"math"
+)
+
+// Element types, the first 3 bits of every element in a frame.
+const (
+	ElementSCE = 0 // single channel element
+	ElementCPE = 1 // channel pair element
+	ElementCCE = 2 // coupling channel element, not used by ALAC
+	ElementLFE = 3 // low frequency effects channel
+	ElementDSE = 4 // data stream element
+	ElementPCE = 5 // program config element, not used by ALAC
+	ElementFIL = 6 // fill element
+	ElementEND = 7 // end of frame
+)
+
+// FrameInfo describes the header of an ALAC frame, that of its first
+// element for frames of more than one.
+type FrameInfo struct {
+	Element   int  // ElementSCE, ElementCPE or ElementLFE
+	Instance  int  // element instance tag
+	Channels  int  // 1 or 2, of all the elements once the frame is decoded
+	HasSize   bool // the frame stores its sample count, as short frames do
+	Samples   int  // samples per channel
+	Verbatim  bool // uncompressed ("escape") frame
+	ShiftBits int  // low bits per sample stored uncompressed, 0, 8 or 16
+	MixBits   int  // stereo interlacing shift, 0 when not mixed
+	MixRes    int  // stereo interlacing left weight, 0 when not mixed
+
+	// Levels of the first 2 decoded channels, for the OnFrame hook of
+	// decoders WithLevels. Zero otherwise.
+	Levels [2]Level
+}
+
+// Level is the level of a channel in a frame, relative to full scale.
+// 20*log10 gives dBFS.
+type Level struct {
+	Peak float64 // largest absolute sample
+	RMS  float64 // root mean square of the samples
+}
+
+// measureLevels sets the levels of samples, relative to full scale for bits
+// bits.
+func measureLevels(l *Level, samples []int32, bits uint8) {
+	peak, sum := int64(0), 0.0
+	for _, s := range samples {
+		v := int64(s)
+		peak = max(peak, v, -v)
+		sum += float64(v * v)
+	}
+	scale := 1 / float64(int64(1)<<(bits-1))
+	*l = Level{Peak: float64(peak) * scale}
+	if len(samples) > 0 {
+		l.RMS = math.Sqrt(sum/float64(len(samples))) * scale
+	}
+}
+
+// Stats counts the frames a decoder has decoded.
+type Stats struct {
+	Frames         int   // decoded frames
+	VerbatimFrames int   // decoded frames which were stored uncompressed
+	Samples        int64 // decoded samples per channel
+}
+
+// InspectFrame reads the header of a frame without decoding its samples. It
+// is cheap enough to index or diagnose whole files.
+func (a *Alac) InspectFrame(data []byte) (FrameInfo, error) {
+	a.setInput(data)
+
+	return a.readFrameHeader()
+}
+
+// FrameLength decodes the frame at the start of data, and returns its
+// length in bytes, up to and with its END element. Bytes after it are
+// fine, so it finds the frames of data without framing, such as the
+// 'mdat' atom of an MP4 file which lost its sample tables. Any deviation
+// from the bitstream format fails with ErrInvalidFrame, as for strict
+// decoders, so what isn't a frame rarely passes. It's a decode of its own,
+// so it doesn't count in the Stats, or call the OnFrame hook.
+func (a *Alac) FrameLength(data []byte) (int, error) {
+	a.scanning = true
+	defer func(last int) { a.scanning, a.lastSamples = false, last }(a.lastSamples)
+	if _, err := a.decodeSamples(data); err != nil {
+		return 0, err
+	}
+	return a.input_buffer_index, nil
+}
+
+// OnFrame registers fn to be called after every successfully decoded frame,
+// with the frame's header and its PCM, as returned by Decode. fn is called
+// before Decode returns, so it should be quick; it replaces any earlier
+// hook, and nil removes it. Clones share the hook.
+func (a *Alac) OnFrame(fn func(info FrameInfo, pcm []byte)) {
+	a.onFrame = fn
+}
@@ -0,0 +1,257 @@
+package alac
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestInspectFrame(t *testing.T) {
+	a, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		frame []byte
+		want  FrameInfo
+	}{
+		{
+			frame: mustHex("2000000408130809b5f91bffe20058130809cbf9380006006bff109c0f63"),
+			want: FrameInfo{
+				Element:  ElementCPE,
+				Channels: 2,
+				Samples:  352,
+				MixBits:  2,
+				MixRes:   4,
+			},
+		},
+		{
+			frame: verbatimFrame(16, 100, [][]int32{make([]int32, 100), make([]int32, 100)}),
+			want: FrameInfo{
+				Element:  ElementCPE,
+				Channels: 2,
+				HasSize:  true,
+				Samples:  100,
+				Verbatim: true,
+			},
+		},
+		{
+			frame: verbatimFrame(16, 12, [][]int32{make([]int32, 12)}),
+			want: FrameInfo{
+				Element:  ElementSCE,
+				Channels: 1,
+				HasSize:  true,
+				Samples:  12,
+				Verbatim: true,
+			},
+		},
+	} {
+		have, err := a.InspectFrame(c.frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have != c.want {
+			t.Errorf("have %+v, want %+v", have, c.want)
+		}
+	}
+
+	for frame, want := range map[string]error{
+		"":               ErrTruncatedBitstream,
+		"2000":           ErrTruncatedBitstream,
+		"200010":         ErrTruncatedBitstream,
+		"200000":         ErrTruncatedBitstream,
+		"4000000000":     ErrInvalidFrame,
+		"20001000002000": ErrConfigMismatch,
+	} {
+		if _, err := a.InspectFrame(mustHex(frame)); !errors.Is(err, want) {
+			t.Errorf("%q: have %v, want %v", frame, err, want)
+		}
+	}
+}
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestVerbatim(t *testing.T) {
+	const n = 352
+
+	noise := func(seed uint32, bits uint) []int32 {
+		s := make([]int32, n)
+		for i := range s {
+			seed = seed*1103515245 + 12345
+			s[i] = int32(seed) >> (32 - bits)
+		}
+		return s
+	}
+
+	for _, c := range []struct {
+		sampleSize int
+		channels   [][]int32
+	}{
+		{16, [][]int32{noise(1, 16)}},
+		{16, [][]int32{noise(2, 16), noise(3, 16)}},
+		{24, [][]int32{noise(4, 24)}},
+		{24, [][]int32{noise(5, 24), noise(6, 24)}},
+	} {
+		a, err := NewWithConfig(Config{SampleRate: 44100, SampleSize: c.sampleSize, NumChannels: len(c.channels), FrameSize: n}, WithStrict())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var want []byte
+		for i := 0; i < n; i++ {
+			for _, ch := range c.channels {
+				v := ch[i]
+				want = append(want, byte(v), byte(v>>8))
+				if c.sampleSize == 24 {
+					want = append(want, byte(v>>16))
+				}
+			}
+		}
+
+		frame := escapeFrame(c.sampleSize, false, n, c.channels)
+		info, err := a.InspectFrame(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.Verbatim || info.HasSize || info.Samples != n {
+			t.Errorf("unexpected info: %+v", info)
+		}
+
+		have, err := a.DecodeFrame(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(have, want) {
+			t.Errorf("%d bits, %d channels: have\n  %x\nwant\n  %x\n", c.sampleSize, len(c.channels), have, want)
+		}
+
+		// the same samples, but the frame is cut short
+		short := frame[:len(frame)-10]
+		if _, err := a.DecodeFrame(short); !errors.Is(err, ErrTruncatedBitstream) {
+			t.Errorf("have %v, want %v", err, ErrTruncatedBitstream)
+		}
+
+		// a size field claiming more samples than the frame holds
+		lying := verbatimFrame(c.sampleSize, n-1, c.channels)
+		setBits(lying, 23, 32, n)
+		if _, err := a.DecodeFrame(lying); !errors.Is(err, ErrTruncatedBitstream) {
+			t.Errorf("have %v, want %v", err, ErrTruncatedBitstream)
+		}
+
+		if have, want := a.Stats(), (Stats{Frames: 1, VerbatimFrames: 1, Samples: n}); have != want {
+			t.Errorf("have %+v, want %+v", have, want)
+		}
+	}
+
+	a, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for enc := range testFrames {
+		a.Decode(mustHex(enc))
+	}
+	if have, want := a.Stats(), (Stats{Frames: len(testFrames), Samples: int64(len(testFrames)) * 352}); have != want {
+		t.Errorf("have %+v, want %+v", have, want)
+	}
+	a.Reset()
+	if have, want := a.Stats(), (Stats{}); have != want {
+		t.Errorf("have %+v, want %+v", have, want)
+	}
+}
+
+// setBits overwrites bits bits of b at bit offset off with v.
+func setBits(b []byte, off, bits int, v uint32) {
+	for i := 0; i < bits; i++ {
+		pos := off + i
+		mask := byte(0x80) >> uint(pos%8)
+		if v>>uint(bits-1-i)&1 != 0 {
+			b[pos/8] |= mask
+		} else {
+			b[pos/8] &^= mask
+		}
+	}
+}
+
+func TestOnFrame(t *testing.T) {
+	a, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		infos []FrameInfo
+		pcms  [][]byte
+	)
+	a.OnFrame(func(info FrameInfo, pcm []byte) {
+		infos = append(infos, info)
+		pcms = append(pcms, pcm)
+	})
+
+	out := a.Decode(testFrame("20"))
+	if have, want := len(infos), 1; have != want {
+		t.Fatalf("have %d, want %d", have, want)
+	}
+	if have, want := infos[0].Samples, 352; have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+	if !bytes.Equal(pcms[0], out) {
+		t.Errorf("hook and Decode disagree")
+	}
+
+	a.Decode([]byte{0x20})
+	if have, want := len(infos), 1; have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+
+	a.OnFrame(nil)
+	a.Decode(testFrame("20"))
+	if have, want := len(infos), 1; have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+}
+
+func TestFrameLength(t *testing.T) {
+	cfg := DefaultConfig()
+	e, err := NewEncoder(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signals := testSignals(5000, 16)
+	frames, err := e.EncodeAll(context.Background(), interleavePCM(16, signals["sine"], signals["noise"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewWithConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Join(frames, nil)
+	for i, frame := range frames {
+		n, err := a.FrameLength(data)
+		if err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		if have, want := n, len(frame); have != want {
+			t.Fatalf("frame %d: have %d, want %d", i, have, want)
+		}
+		data = data[n:]
+	}
+	if have, want := a.Stats().Frames, 0; have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+
+	if _, err := a.FrameLength(frames[0][:len(frames[0])-1]); !errors.Is(err, ErrTruncatedBitstream) && !errors.Is(err, ErrInvalidFrame) {
+		t.Errorf("have %v, want %v", err, ErrTruncatedBitstream)
+	}
+	if _, err := a.FrameLength(bytes.Repeat([]byte{0x20}, 100)); err == nil {
+		t.Errorf("have no error for what isn't a frame")
+	}
+}
@@ -0,0 +1,67 @@
+package alac
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Framing is how a FrameWriter marks where its frames start and end.
+type Framing int
+
+const (
+	// FramingLength writes the size of every frame before it, in 4 bytes
+	// big endian, so a reader of a byte stream, such as a pipe or a TCP
+	// connection, can split the frames again.
+	FramingLength Framing = iota
+	// FramingNone writes the frames as they are, one Write call per frame,
+	// for writers which keep the boundaries of writes themselves, such as
+	// a UDP connection or a websocket.
+	FramingNone
+)
+
+// FrameWriter is an io.Writer which encodes the PCM written to it, and
+// writes the frames to an io.Writer as soon as they are complete, with
+// their Framing. It's a StreamEncoder which writes to an io.Writer.
+type FrameWriter struct {
+	w       io.Writer
+	framing Framing
+	stream  *StreamEncoder
+	buf     []byte // the frame with its size, FramingLength
+}
+
+// NewFrameWriter returns a FrameWriter which encodes with enc and writes
+// the frames to w. Unknown framings fail with ErrInvalidConfig.
+func NewFrameWriter(enc *Encoder, w io.Writer, framing Framing) (*FrameWriter, error) {
+	if framing != FramingLength && framing != FramingNone {
+		return nil, fmt.Errorf("%w: framing %d", ErrInvalidConfig, framing)
+	}
+	fw := &FrameWriter{
+		w:       w,
+		framing: framing,
+	}
+	fw.stream = NewStreamEncoder(enc, fw.writeFrame)
+	return fw, nil
+}
+
+// Write encodes PCM, in pieces of any size. The first error of the encoder
+// or of w stops the writer: it's returned by all later calls.
+func (fw *FrameWriter) Write(pcm []byte) (int, error) {
+	return fw.stream.Write(pcm)
+}
+
+// Flush encodes and writes the pending PCM as a short frame, such as at the
+// end of a stream, see StreamEncoder.Flush. It doesn't close w.
+func (fw *FrameWriter) Flush() error {
+	return fw.stream.Flush()
+}
+
+func (fw *FrameWriter) writeFrame(frame []byte) error {
+	if fw.framing == FramingLength {
+		fw.buf = binary.BigEndian.AppendUint32(fw.buf[:0], uint32(len(frame)))
+		fw.buf = append(fw.buf, frame...)
+		frame = fw.buf
+	}
+	_, err := fw.w.Write(frame)
+	return err
+}
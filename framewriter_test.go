@@ -0,0 +1,112 @@
+package alac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// packets keeps every Write as a packet.
+type packets [][]byte
+
+func (p *packets) Write(b []byte) (int, error) {
+	*p = append(*p, slices.Clone(b))
+	return len(b), nil
+}
+
+type failingWriter struct{ err error }
+
+func (w failingWriter) Write([]byte) (int, error) {
+	return 0, w.err
+}
+
+func TestFrameWriter(t *testing.T) {
+	cfg := DefaultConfig()
+	e, err := NewEncoder(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := NewWithConfig(cfg, WithStrict())
+	if err != nil {
+		t.Fatal(err)
+	}
+	signals := testSignals(5000, 16)
+	pcm := interleavePCM(16, signals["sine"], signals["noise"])
+
+	decode := func(t *testing.T, frames [][]byte) {
+		t.Helper()
+		if have, want := len(frames), 5000/352+1; have != want {
+			t.Errorf("have %d frames, want %d", have, want)
+		}
+		var out []byte
+		for _, f := range frames {
+			b, err := d.DecodeFrame(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out = append(out, b...)
+		}
+		if !bytes.Equal(out, pcm) {
+			t.Errorf("output differs")
+		}
+	}
+	write := func(t *testing.T, fw *FrameWriter) {
+		t.Helper()
+		for in := pcm; len(in) > 0; {
+			n := min(len(in), 1001)
+			if have, err := fw.Write(in[:n]); err != nil || have != n {
+				t.Fatalf("have %d, %v, want %d", have, err, n)
+			}
+			in = in[n:]
+		}
+		if err := fw.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("length", func(t *testing.T) {
+		var buf bytes.Buffer
+		fw, err := NewFrameWriter(e, &buf, FramingLength)
+		if err != nil {
+			t.Fatal(err)
+		}
+		write(t, fw)
+		var frames [][]byte
+		for b := buf.Bytes(); len(b) > 0; {
+			n := int(binary.BigEndian.Uint32(b))
+			frames = append(frames, b[4:4+n])
+			b = b[4+n:]
+		}
+		decode(t, frames)
+	})
+
+	t.Run("none", func(t *testing.T) {
+		var p packets
+		fw, err := NewFrameWriter(e, &p, FramingNone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		write(t, fw)
+		decode(t, p)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		if _, err := NewFrameWriter(e, &bytes.Buffer{}, 2); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("have %v, want %v", err, ErrInvalidConfig)
+		}
+
+		errStop := errors.New("stop")
+		fw, err := NewFrameWriter(e, failingWriter{errStop}, FramingLength)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write(pcm); !errors.Is(err, errStop) {
+			t.Errorf("have %v, want %v", err, errStop)
+		}
+		if err := fw.Flush(); !errors.Is(err, errStop) {
+			t.Errorf("have %v, want %v", err, errStop)
+		}
+	})
+}
@@ -0,0 +1,19 @@
+package alac
+
+// gainOne is a gain of 1 in the 16.16 fixed point of applyGain.
+const gainOne = 1 << 16
+
+// maxGain is the largest gain WithGain accepts. It keeps the products in
+// applyGain within 64 bits.
+const maxGain = 256
+
+// applyGain multiplies samples by the fixed point gain q, and clips them to
+// bits bits.
+func applyGain(samples []int32, q int64, bits uint8) {
+	hi := int64(1)<<(bits-1) - 1
+	lo := -hi - 1
+	for i, s := range samples {
+		v := (int64(s)*q + gainOne/2) >> 16
+		samples[i] = int32(min(max(v, lo), hi))
+	}
+}
@@ -0,0 +1,48 @@
+package alac
+
+import "fmt"
+
+// Gapless is the gapless playback info of an encoded stream: the samples
+// to play are the Samples after the first Priming samples. All frames but
+// the last have FrameSize samples, unless WithMaxPacketSize or
+// WithAdaptiveFrames split them, and Padding is what the last one is short
+// of that. ALAC has no encoder delay, so there is only priming
+// WithPriming.
+type Gapless struct {
+	Priming int
+	Padding int
+	Samples int64
+}
+
+// WithPriming marks the first n samples of the PCM as priming, to be
+// skipped on playback, such as the delay of a lossy decoder the PCM came
+// from. See Encoder.Gapless.
+func WithPriming(n int) EncoderOption {
+	return func(e *Encoder) {
+		e.priming = n
+	}
+}
+
+// Gapless returns the gapless info of the frames encoded so far. Like
+// MagicCookie, it's complete when the stream is done.
+func (e *Encoder) Gapless() Gapless {
+	var (
+		s       = e.stats
+		priming = int(min(int64(e.priming), s.Samples))
+		padding = 0
+	)
+	if s.Frames > 0 {
+		padding = e.cfg.FrameSize - e.lastSamples
+	}
+	return Gapless{
+		Priming: priming,
+		Padding: padding,
+		Samples: s.Samples - int64(priming),
+	}
+}
+
+// ITunSMPB returns the iTunes gapless info tag of g, which iTunes and
+// Music read from the metadata of M4A files.
+func (g Gapless) ITunSMPB() string {
+	return fmt.Sprintf(" 00000000 %08X %08X %016X 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000", g.Priming, g.Padding, g.Samples)
+}
@@ -0,0 +1,46 @@
+package alac
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGapless(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.FrameSize = 4096
+	e, err := NewEncoder(cfg, WithPriming(2112))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := e.Gapless(), (Gapless{}); have != want {
+		t.Errorf("have %+v, want %+v", have, want)
+	}
+	for _, n := range []int{4096, 4096, 1000} {
+		if _, err := e.Encode(make([]byte, 4*n)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g := e.Gapless()
+	if have, want := g, (Gapless{Priming: 2112, Padding: 3096, Samples: 9192 - 2112}); have != want {
+		t.Errorf("have %+v, want %+v", have, want)
+	}
+	if have, want := g.ITunSMPB(), " 00000000 00000840 00000C18 0000000000001BA8 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000"; have != want {
+		t.Errorf("have %q, want %q", have, want)
+	}
+
+	// priming longer than the stream
+	e, err = NewEncoder(cfg, WithPriming(5000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Encode(make([]byte, 4*1000)); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := e.Gapless(), (Gapless{Priming: 1000, Padding: 3096}); have != want {
+		t.Errorf("have %+v, want %+v", have, want)
+	}
+
+	if _, err := NewEncoder(cfg, WithPriming(-1)); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("have %v, want %v", err, ErrInvalidConfig)
+	}
+}
@@ -1,3 +1,5 @@
 module github.com/alicebob/alac
 
 go 1.25.5
+
+require github.com/go-audio/audio v1.0.0
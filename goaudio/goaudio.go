@@ -0,0 +1,61 @@
+// Package goaudio decodes ALAC to the buffers of github.com/go-audio/audio,
+// for go-audio's encoders, transforms, and analysis tools.
+package goaudio
+
+import (
+	"github.com/go-audio/audio"
+
+	"github.com/alicebob/alac"
+)
+
+// Decoder decodes ALAC frames to audio.IntBuffers.
+type Decoder struct {
+	dec     *alac.Alac
+	samples []int32
+}
+
+// NewDecoder returns a Decoder which decodes with dec.
+func NewDecoder(dec *alac.Alac) *Decoder {
+	return &Decoder{dec: dec}
+}
+
+// Format returns the format of the buffers. It changes with the stream for
+// decoders WithAutoReconfigure.
+func (d *Decoder) Format() *audio.Format {
+	return &audio.Format{
+		NumChannels: d.dec.Channels(),
+		SampleRate:  d.dec.SampleRate(),
+	}
+}
+
+// DecodeFrame decodes a frame into buf, and returns buf. buf.Data is reused
+// if it has room for the frame, and a nil buf is allocated. The samples
+// keep their range, see alac.Alac.DecodeToInt32, and SourceBitDepth is set
+// accordingly.
+func (d *Decoder) DecodeFrame(frame []byte, buf *audio.IntBuffer) (*audio.IntBuffer, error) {
+	info, err := d.dec.InspectFrame(frame)
+	if err != nil {
+		return nil, err
+	}
+	if n := max(info.Samples, d.dec.FrameSize()) * max(info.Channels, d.dec.Channels()); len(d.samples) < n {
+		d.samples = make([]int32, n)
+	}
+	n, err := d.dec.DecodeToInt32(frame, d.samples)
+	if err != nil {
+		return nil, err
+	}
+
+	if buf == nil {
+		buf = &audio.IntBuffer{}
+	}
+	buf.Format = d.Format()
+	buf.SourceBitDepth = d.dec.BitDepth()
+	if cap(buf.Data) < n {
+		buf.Data = make([]int, n)
+	}
+	buf.Data = buf.Data[:n]
+	for i, s := range d.samples[:n] {
+		buf.Data[i] = int(s)
+	}
+	return buf, nil
+}
@@ -0,0 +1,81 @@
+package goaudio
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/go-audio/audio"
+
+	"github.com/alicebob/alac"
+)
+
+// verbatimFrame builds an uncompressed 16 bit frame, the samples
+// interleaved.
+func verbatimFrame(channels int, samples []int32) []byte {
+	var (
+		buf  []byte
+		bits uint64
+		n    uint
+	)
+	write := func(v uint32, size uint) {
+		bits = bits<<size | uint64(v)&(1<<size-1)
+		n += size
+		for n >= 8 {
+			n -= 8
+			buf = append(buf, byte(bits>>n))
+		}
+	}
+	write(uint32(channels-1), 3) // element: SCE or CPE
+	write(0, 4+12)               // instance, unused
+	write(1, 1)                  // has size
+	write(0, 2)                  // uncompressed bytes
+	write(1, 1)                  // verbatim
+	write(uint32(len(samples)/channels), 32)
+	for _, s := range samples {
+		write(uint32(s), 16)
+	}
+	write(7, 3) // END
+	if n > 0 {
+		buf = append(buf, byte(bits<<(8-n)))
+	}
+	return buf
+}
+
+func TestDecoder(t *testing.T) {
+	dec, err := alac.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDecoder(dec)
+	if have, want := *d.Format(), (audio.Format{NumChannels: 2, SampleRate: 44100}); have != want {
+		t.Errorf("have %v, want %v", have, want)
+	}
+
+	samples := []int32{1, -1, 300, -300, 32767, -32768}
+	buf, err := d.DecodeFrame(verbatimFrame(2, samples), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := buf.Data, []int{1, -1, 300, -300, 32767, -32768}; !slices.Equal(have, want) {
+		t.Errorf("have %v, want %v", have, want)
+	}
+	if have, want := buf.NumFrames(), 3; have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+	if have, want := buf.SourceBitDepth, 16; have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+
+	// buffers are reused
+	data := &buf.Data[0]
+	if buf, err = d.DecodeFrame(verbatimFrame(2, samples[:2]), buf); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(buf.Data), 2; have != want || &buf.Data[0] != data {
+		t.Errorf("buffer not reused")
+	}
+
+	if _, err := d.DecodeFrame([]byte{0x20}, buf); err == nil {
+		t.Errorf("no error")
+	}
+}
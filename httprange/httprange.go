@@ -0,0 +1,283 @@
+// Package httprange reads files over HTTP with range requests, so players
+// can demux and decode files from object storage and CDNs without
+// downloading them first:
+//
+//	r, err := httprange.Open(ctx, "https://example.com/song.m4a")
+//	...
+//	defer r.Close()
+//	s, err := alac.Open(r)
+//
+// A Reader is an io.ReadSeeker. Reads go on with the response of the read
+// before, so reading through a file takes one request, and small reads are
+// served from a read ahead buffer. Seeking back, or far ahead, takes a new
+// request, and so do servers which answer with part of the range, and
+// responses which break off.
+package httprange
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DefaultReadAhead is the default of WithReadAhead.
+const DefaultReadAhead = 256 << 10
+
+var (
+	// ErrNoRanges is returned by Open for servers which don't do range
+	// requests of the file.
+	ErrNoRanges = errors.New("httprange: no range requests")
+	// ErrChanged is returned by Read when the file changed on the server
+	// since Open.
+	ErrChanged = errors.New("httprange: the file changed")
+)
+
+// Option is an option of Open.
+type Option func(*Reader)
+
+// WithClient makes the Reader use c instead of http.DefaultClient.
+func WithClient(c *http.Client) Option {
+	return func(r *Reader) {
+		r.client = c
+	}
+}
+
+// WithReadAhead sets the size of the reads from the responses, and so the
+// least a read reads. Reads ahead of the response by less than this are
+// read from it, instead of with a new request. The default is
+// DefaultReadAhead.
+func WithReadAhead(n int) Option {
+	return func(r *Reader) {
+		r.readAhead = n
+	}
+}
+
+// Reader is a file on an HTTP server, see Open.
+type Reader struct {
+	ctx       context.Context
+	client    *http.Client
+	url       string
+	readAhead int
+	size      int64
+	validator string // ETag or Last-Modified, for If-Range
+	pos       int64  // of Read
+	body      io.ReadCloser
+	bodyPos   int64  // offset of the next byte of body
+	bodyEnd   int64  // offset after the last byte of body
+	buf       []byte // read from base
+	base      int64
+	requests  int
+}
+
+// Open returns the Reader of the file at url. It makes the first request,
+// which has to be answered with a range: servers which don't do range
+// requests fail with ErrNoRanges. ctx is of all the requests of the
+// Reader.
+func Open(ctx context.Context, url string, opts ...Option) (*Reader, error) {
+	r := &Reader{
+		ctx:       ctx,
+		client:    http.DefaultClient,
+		url:       url,
+		readAhead: DefaultReadAhead,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	r.readAhead = max(r.readAhead, 1)
+	if err := r.request(0); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Size returns the size of the file.
+func (r *Reader) Size() int64 {
+	return r.size
+}
+
+// Requests returns the number of requests the Reader made so far.
+func (r *Reader) Requests() int {
+	return r.requests
+}
+
+// request starts a response of the file from offset on.
+func (r *Reader) request(offset int64) error {
+	r.closeBody()
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	if r.validator != "" {
+		req.Header.Set("If-Range", r.validator)
+	}
+	r.requests++
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+	case resp.StatusCode == http.StatusOK && r.validator != "":
+		resp.Body.Close()
+		return ErrChanged
+	case resp.StatusCode == http.StatusOK:
+		resp.Body.Close()
+		return ErrNoRanges
+	default:
+		resp.Body.Close()
+		return fmt.Errorf("httprange: %s: %s", r.url, resp.Status)
+	}
+	start, end, size, err := contentRange(resp.Header.Get("Content-Range"))
+	if err != nil || start != offset || end < start || end >= size {
+		resp.Body.Close()
+		return fmt.Errorf("%w: Content-Range %q for offset %d", ErrNoRanges, resp.Header.Get("Content-Range"), offset)
+	}
+	if r.validator == "" {
+		r.size = size
+		r.validator = resp.Header.Get("ETag")
+		if strings.HasPrefix(r.validator, "W/") {
+			r.validator = "" // weak ETags don't go in If-Range
+		}
+		if r.validator == "" {
+			r.validator = resp.Header.Get("Last-Modified")
+		}
+	} else if size != r.size {
+		resp.Body.Close()
+		return ErrChanged
+	}
+	r.body, r.bodyPos, r.bodyEnd = resp.Body, offset, end+1
+	return nil
+}
+
+// contentRange returns the first and the last byte, and the size of the
+// file, of a Content-Range header, "bytes start-end/size".
+func contentRange(h string) (int64, int64, int64, error) {
+	rng, ok := strings.CutPrefix(h, "bytes ")
+	if !ok {
+		return 0, 0, 0, ErrNoRanges
+	}
+	rng, total, ok := strings.Cut(rng, "/")
+	if !ok {
+		return 0, 0, 0, ErrNoRanges
+	}
+	first, last, ok := strings.Cut(rng, "-")
+	if !ok {
+		return 0, 0, 0, ErrNoRanges
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	end, err := strconv.ParseInt(last, 10, 64)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	size, err := strconv.ParseInt(total, 10, 64)
+	if err != nil {
+		return 0, 0, 0, err // also for an unknown size, "*"
+	}
+	return start, end, size, nil
+}
+
+// Read reads from the file.
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.pos >= r.size {
+		return 0, io.EOF
+	}
+	if i := r.pos - r.base; i < 0 || i >= int64(len(r.buf)) {
+		if err := r.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.buf[r.pos-r.base:])
+	r.pos += int64(n)
+	return n, nil
+}
+
+// fill reads the read ahead from pos on into buf, from the response if
+// pos is in it or not far ahead, and otherwise from a new one. A response
+// which breaks off before pos is requested again, once.
+func (r *Reader) fill() error {
+	for retried := false; ; retried = true {
+		if r.body == nil || r.pos < r.bodyPos || r.pos-r.bodyPos > int64(r.readAhead) || r.pos >= r.bodyEnd {
+			if err := r.request(r.pos); err != nil {
+				return err
+			}
+		}
+		err := r.read()
+		if err == nil {
+			return nil
+		}
+		r.closeBody()
+		if retried || r.ctx.Err() != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+	}
+}
+
+// read reads the read ahead from pos on into buf, from the response. It
+// fails only when there's nothing to read; a response which breaks off
+// after some bytes is closed, for the next fill.
+func (r *Reader) read() error {
+	if skip := r.pos - r.bodyPos; skip > 0 {
+		n, err := io.CopyN(io.Discard, r.body, skip)
+		r.bodyPos += n
+		if err != nil {
+			return err
+		}
+	}
+	size := min(int64(r.readAhead), r.bodyEnd-r.pos)
+	if int64(cap(r.buf)) < size {
+		r.buf = make([]byte, size)
+	}
+	n, err := io.ReadFull(r.body, r.buf[:size])
+	r.buf, r.base = r.buf[:n], r.pos
+	r.bodyPos += int64(n)
+	if err != nil {
+		if n == 0 {
+			return err
+		}
+		r.closeBody()
+	}
+	return nil
+}
+
+// Seek sets the offset of the next Read. It doesn't make a request, Read
+// does when it has to.
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, fmt.Errorf("httprange: seek whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("httprange: seek to %d", offset)
+	}
+	r.pos = offset
+	return offset, nil
+}
+
+func (r *Reader) closeBody() {
+	if r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+}
+
+// Close closes the response the Reader reads from, if any.
+func (r *Reader) Close() error {
+	r.closeBody()
+	return nil
+}
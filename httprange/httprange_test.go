@@ -0,0 +1,250 @@
+package httprange
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/alac"
+	"github.com/alicebob/alac/alacm4a"
+	_ "github.com/alicebob/alac/formats"
+)
+
+// server serves file, with ranges, and counts the requests.
+func server(t testing.TB, file *atomic.Pointer[[]byte], requests *atomic.Int64) string {
+	t.Helper()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		b := *file.Load()
+		w.Header().Set("ETag", `"`+string(rune('a'+len(b)%26))+`"`)
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(b))
+	}))
+	t.Cleanup(s.Close)
+	return s.URL
+}
+
+func TestReader(t *testing.T) {
+	data := make([]byte, 100000)
+	rnd := rand.New(rand.NewPCG(1, 2))
+	for i := range data {
+		data[i] = byte(rnd.Int())
+	}
+	var (
+		file     atomic.Pointer[[]byte]
+		requests atomic.Int64
+	)
+	file.Store(&data)
+	url := server(t, &file, &requests)
+
+	r, err := Open(context.Background(), url, WithReadAhead(4096))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if have, want := r.Size(), int64(len(data)); have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+
+	// reading through, with small reads and skips, takes the one request
+	for pos := int64(0); ; pos += 1000 {
+		b := make([]byte, 100)
+		n, err := r.Read(b)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b[:n], data[pos:pos+int64(n)]) {
+			t.Fatalf("at %d: have %x, want %x", pos, b[:n], data[pos:pos+int64(n)])
+		}
+		if _, err := r.Seek(pos+1000, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if have, want := requests.Load(), int64(1); have != want {
+		t.Errorf("have %d requests, want %d", have, want)
+	}
+
+	for range 100 {
+		offset := rnd.Int64N(int64(len(data)) + 10)
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		b := make([]byte, rnd.IntN(10000))
+		n, err := io.ReadFull(r, b)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			t.Fatal(err)
+		}
+		want := data[min(offset, int64(len(data))):min(offset+int64(len(b)), int64(len(data)))]
+		if !bytes.Equal(b[:n], want) {
+			t.Fatalf("at %d: have %d bytes, want %d", offset, n, len(want))
+		}
+	}
+	if have, want := r.Requests(), int(requests.Load()); have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+
+	t.Run("changed", func(t *testing.T) {
+		r, err := Open(context.Background(), url, WithReadAhead(4096))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		changed := append(bytes.Clone(data), 1)
+		file.Store(&changed)
+		defer file.Store(&data)
+		if _, err := r.Seek(int64(len(data)-10), io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.Read(make([]byte, 10)); !errors.Is(err, ErrChanged) {
+			t.Errorf("have %v, want %v", err, ErrChanged)
+		}
+	})
+
+	t.Run("no ranges", func(t *testing.T) {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(data)
+		}))
+		defer s.Close()
+		if _, err := Open(context.Background(), s.URL); !errors.Is(err, ErrNoRanges) {
+			t.Errorf("have %v, want %v", err, ErrNoRanges)
+		}
+	})
+}
+
+// capped serves data with at most limit bytes for every range request,
+// and breaks off every other response halfway, if drop.
+func capped(t testing.TB, data []byte, limit int64, drop bool, requests *atomic.Int64) string {
+	t.Helper()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		var start int64
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &start); err != nil {
+			t.Errorf("Range %q: %v", r.Header.Get("Range"), err)
+			return
+		}
+		end := min(start+limit, int64(len(data)))
+		w.Header().Set("ETag", `"x"`)
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end-1, len(data)))
+		w.Header().Set("Content-Length", strconv.FormatInt(end-start, 10))
+		w.WriteHeader(http.StatusPartialContent)
+		if !drop || n%2 == 1 {
+			w.Write(data[start:end])
+			return
+		}
+		w.Write(data[start : start+(end-start)/2])
+		w.(http.Flusher).Flush()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conn.Close()
+	}))
+	t.Cleanup(s.Close)
+	return s.URL
+}
+
+func TestBrokenResponses(t *testing.T) {
+	data := make([]byte, 100000)
+	rnd := rand.New(rand.NewPCG(3, 4))
+	for i := range data {
+		data[i] = byte(rnd.Int())
+	}
+	for name, drop := range map[string]bool{
+		"capped":  false,
+		"dropped": true,
+	} {
+		var requests atomic.Int64
+		url := capped(t, data, 30000, drop, &requests)
+		r, err := Open(context.Background(), url, WithReadAhead(4096))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		have, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(have, data) {
+			t.Errorf("%s: have %d bytes, which aren't the file", name, len(have))
+		}
+		if _, err := r.Seek(10, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		have, err = io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(have, data[10:]) {
+			t.Errorf("%s: have %d bytes, which aren't the file", name, len(have))
+		}
+		// 4 requests of 30000 bytes for every pass, and those again which
+		// break off
+		if have, want := requests.Load(), int64(8); have != want && !drop || have <= want && drop {
+			t.Errorf("%s: have %d requests, want %d, and more which break off", name, have, want)
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	wav, err := os.ReadFile("../testdata/samples/jane_eyre_5s.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcm := wav[bytes.Index(wav, []byte("data"))+8:]
+	path := t.TempDir() + "/out.m4a"
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := alacm4a.Encode(f, bytes.NewReader(pcm), alac.DefaultConfig()); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	m4a, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		file     atomic.Pointer[[]byte]
+		requests atomic.Int64
+	)
+	file.Store(&m4a)
+	url := server(t, &file, &requests)
+
+	r, err := Open(context.Background(), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	s, err := alac.Open(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	have, err := io.ReadAll(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(have, pcm) {
+		t.Errorf("have %d bytes, want %d", len(have), len(pcm))
+	}
+	// the header, the moov atom, and the frames
+	if have, want := requests.Load(), int64(3); have > want {
+		t.Errorf("have %d requests, want at most %d", have, want)
+	}
+}
@@ -0,0 +1,44 @@
+package alac
+
+import (
+	"log/slog"
+)
+
+// SetLogger makes the decoder log bitstream diagnostics to l: the frame
+// header, the predictor and rice parameters of every channel, and the
+// elements after the audio, all at slog.LevelDebug. Deviations the decoder
+// works around, see WithStrict, are logged at slog.LevelWarn. This is meant
+// for debugging files which don't decode as expected; nil, the default,
+// disables logging.
+func (a *Alac) SetLogger(l *slog.Logger) {
+	a.logger = l
+}
+
+func (a *Alac) traceFrame(info FrameInfo) {
+	if a.logger == nil {
+		return
+	}
+	a.logger.Debug("alac: frame",
+		"element", info.Element,
+		"instance", info.Instance,
+		"samples", info.Samples,
+		"verbatim", info.Verbatim,
+		"shift_bits", info.ShiftBits,
+		"mix_bits", info.MixBits,
+		"mix_res", info.MixRes,
+	)
+}
+
+func (a *Alac) traceChannel(ch, predictionType, quant, riceModifier, coefs int) {
+	if a.logger == nil {
+		return
+	}
+	a.logger.Debug("alac: channel",
+		"channel", ch,
+		"prediction_type", predictionType,
+		"quantization", quant,
+		"rice_modifier", riceModifier,
+		"rice_kmodifier", a.setinfo_rice_kmodifier,
+		"coefs", coefs,
+	)
+}
@@ -0,0 +1,41 @@
+package alac
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSetLogger(t *testing.T) {
+	var buf bytes.Buffer
+	a, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.SetLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	frame := testFrame("20")
+	if _, err := a.DecodeFrame(append(frame, 0)); err != nil {
+		t.Fatal(err)
+	}
+	log := buf.String()
+	for _, want := range []string{
+		`msg="alac: frame" element=1 instance=0 samples=352 verbatim=false shift_bits=0`,
+		`msg="alac: channel" channel=0 prediction_type=0`,
+		`msg="alac: channel" channel=1 prediction_type=0`,
+		`msg="alac: element" tag=7`,
+		`level=WARN msg="alac: deviation" err="alac: invalid frame: 1 bytes after END element"`,
+	} {
+		if !strings.Contains(log, want) {
+			t.Errorf("missing %q in:\n%s", want, log)
+		}
+	}
+
+	buf.Reset()
+	a.SetLogger(nil)
+	a.Decode(frame)
+	if have := buf.String(); have != "" {
+		t.Errorf("have %q, want nothing", have)
+	}
+}
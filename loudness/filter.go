@@ -0,0 +1,66 @@
+package loudness
+
+import (
+	"math"
+)
+
+// biquad is a second order IIR filter, in direct form I.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+func (f *biquad) next(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x1, f.x2 = x, f.x1
+	f.y1, f.y2 = y, f.y1
+	return y
+}
+
+// kWeighting is the K-weighting filter of BS.1770: a high shelf for the
+// effect of the head, followed by a high pass. BS.1770 gives coefficients
+// for 48kHz only; these are derived from the analog filters, so they work
+// for any sample rate, and match at 48kHz.
+type kWeighting struct {
+	shelf, highPass biquad
+}
+
+func newKWeighting(rate float64) kWeighting {
+	var k kWeighting
+
+	const (
+		shelfF0   = 1681.974450955533
+		shelfGain = 3.999843853973347
+		shelfQ    = 0.7071752369554196
+	)
+	K := math.Tan(math.Pi * shelfF0 / rate)
+	vh := math.Pow(10, shelfGain/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + K/shelfQ + K*K
+	k.shelf = biquad{
+		b0: (vh + vb*K/shelfQ + K*K) / a0,
+		b1: 2 * (K*K - vh) / a0,
+		b2: (vh - vb*K/shelfQ + K*K) / a0,
+		a1: 2 * (K*K - 1) / a0,
+		a2: (1 - K/shelfQ + K*K) / a0,
+	}
+
+	const (
+		highPassF0 = 38.13547087602444
+		highPassQ  = 0.5003270373238773
+	)
+	K = math.Tan(math.Pi * highPassF0 / rate)
+	a0 = 1 + K/highPassQ + K*K
+	k.highPass = biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (K*K - 1) / a0,
+		a2: (1 - K/highPassQ + K*K) / a0,
+	}
+	return k
+}
+
+func (k *kWeighting) next(x float64) float64 {
+	return k.highPass.next(k.shelf.next(x))
+}
@@ -0,0 +1,174 @@
+// Package loudness measures the loudness of decoded ALAC, per ITU-R
+// BS.1770 and EBU R128, and the ReplayGain 2.0 values which follow from it.
+// It also finds silence, see SilenceDetector.
+//
+// A Meter is fed the PCM of a decoder, so a file can be tagged while it's
+// decoded:
+//
+//	m, err := loudness.NewMeter(cfg)
+//	...
+//	dec.OnFrame(m.OnFrame)
+//	// decode the file
+//	gain, peak := m.ReplayGain()
+//
+// Loudness is in LUFS, peaks are relative to full scale; 20*log10 gives
+// dBFS and dBTP.
+package loudness
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/alicebob/alac"
+)
+
+// ReplayGainReference is the loudness ReplayGain 2.0 normalizes to, in LUFS.
+const ReplayGainReference = -18
+
+// Meter measures the loudness of PCM. The zero value is not usable, use
+// NewMeter.
+type Meter struct {
+	in      pcm
+	filters []kWeighting
+	peaks   []truePeak
+
+	step  int       // samples in 100ms
+	n     int       // samples in the current 100ms step
+	sum   float64   // sum of the squared, weighted samples of the step
+	steps []float64 // mean square of every completed step
+	peak  float64
+}
+
+// NewMeter returns a Meter for PCM of the format of cfg, which is how a
+// decoder for cfg returns it without output options: little endian, with
+// 24 bit samples packed in 3 bytes. All channels get the same weight.
+func NewMeter(cfg alac.Config) (*Meter, error) {
+	if cfg.SampleRate < 10 {
+		return nil, fmt.Errorf("%w: sample rate %d", alac.ErrInvalidConfig, cfg.SampleRate)
+	}
+	in, err := newPCM(cfg)
+	if err != nil {
+		return nil, err
+	}
+	m := &Meter{
+		in:      in,
+		filters: make([]kWeighting, cfg.NumChannels),
+		peaks:   make([]truePeak, cfg.NumChannels),
+		step:    cfg.SampleRate / 10,
+	}
+	for i := range m.filters {
+		m.filters[i] = newKWeighting(float64(cfg.SampleRate))
+	}
+	return m, nil
+}
+
+// Write adds PCM to the measurement. It never fails.
+func (m *Meter) Write(pcm []byte) (int, error) {
+	m.in.write(pcm, m.add)
+	return len(pcm), nil
+}
+
+// OnFrame is Write with the signature of alac.Alac.OnFrame, to measure
+// everything a decoder decodes.
+func (m *Meter) OnFrame(_ alac.FrameInfo, pcm []byte) {
+	m.Write(pcm)
+}
+
+// add measures a sample frame.
+func (m *Meter) add(frame []float64) {
+	for c, v := range frame {
+		m.peak = max(m.peak, math.Abs(v))
+		m.peaks[c].next(v)
+		x := m.filters[c].next(v)
+		m.sum += x * x
+	}
+	m.n++
+	if m.n == m.step {
+		m.steps = append(m.steps, m.sum/float64(m.step))
+		m.sum, m.n = 0, 0
+	}
+}
+
+// Integrated returns the gated loudness of all PCM so far, in LUFS. It is
+// -Inf if there are less than 400ms of PCM, or if it's all silent.
+func (m *Meter) Integrated() float64 {
+	// 400ms blocks, overlapping by 75%, above the absolute gate
+	var blocks []float64
+	for i := 3; i < len(m.steps); i++ {
+		z := (m.steps[i-3] + m.steps[i-2] + m.steps[i-1] + m.steps[i]) / 4
+		if lufs(z) > -70 {
+			blocks = append(blocks, z)
+		}
+	}
+	if len(blocks) == 0 {
+		return math.Inf(-1)
+	}
+	relative := lufs(mean(blocks)) - 10
+	var gated []float64
+	for _, z := range blocks {
+		if lufs(z) > relative {
+			gated = append(gated, z)
+		}
+	}
+	return lufs(mean(gated))
+}
+
+// Momentary returns the loudness of the last 400ms, in LUFS, updated every
+// 100ms. It is -Inf before there are 400ms of PCM.
+func (m *Meter) Momentary() float64 {
+	return m.window(4)
+}
+
+// ShortTerm returns the loudness of the last 3s, in LUFS, updated every
+// 100ms. It is -Inf before there are 3s of PCM.
+func (m *Meter) ShortTerm() float64 {
+	return m.window(30)
+}
+
+// window is the ungated loudness of the last n 100ms steps.
+func (m *Meter) window(n int) float64 {
+	if len(m.steps) < n {
+		return math.Inf(-1)
+	}
+	return lufs(mean(m.steps[len(m.steps)-n:]))
+}
+
+// TruePeak returns the largest absolute value of the signal so far,
+// including between the samples, relative to full scale. It is estimated
+// by oversampling 4 times, as BS.1770 does, and so can be above 1 for
+// clipped PCM.
+func (m *Meter) TruePeak() float64 {
+	p := 0.0
+	for _, c := range m.peaks {
+		p = max(p, c.peak)
+	}
+	return p
+}
+
+// Peak returns the largest absolute sample so far, relative to full scale.
+func (m *Meter) Peak() float64 {
+	return m.peak
+}
+
+// ReplayGain returns the ReplayGain 2.0 track gain, in dB, and the track
+// peak, relative to full scale, of the PCM so far. The gain is 0 if the
+// loudness can't be measured, see Integrated.
+func (m *Meter) ReplayGain() (gain, peak float64) {
+	l := m.Integrated()
+	if math.IsInf(l, -1) {
+		return 0, m.peak
+	}
+	return ReplayGainReference - l, m.peak
+}
+
+func lufs(meanSquare float64) float64 {
+	return -0.691 + 10*math.Log10(meanSquare)
+}
+
+func mean(v []float64) float64 {
+	s := 0.0
+	for _, x := range v {
+		s += x
+	}
+	return s / float64(len(v))
+}
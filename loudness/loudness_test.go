@@ -0,0 +1,177 @@
+package loudness
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/alicebob/alac"
+)
+
+// sine returns interleaved 16 bit PCM of a 1kHz sine with the peak at dbfs,
+// on every channel.
+func sine(cfg alac.Config, seconds, dbfs float64) []byte {
+	var (
+		amp = math.Pow(10, dbfs/20) * 32767
+		n   = int(seconds * float64(cfg.SampleRate))
+		pcm []byte
+	)
+	for i := range n {
+		s := int16(math.Round(amp * math.Sin(2*math.Pi*1000*float64(i)/float64(cfg.SampleRate))))
+		for range cfg.NumChannels {
+			pcm = binary.LittleEndian.AppendUint16(pcm, uint16(s))
+		}
+	}
+	return pcm
+}
+
+func TestKWeighting(t *testing.T) {
+	// the 48kHz coefficients from BS.1770
+	k := newKWeighting(48000)
+	for _, c := range []struct{ have, want float64 }{
+		{k.shelf.b0, 1.53512485958697},
+		{k.shelf.b1, -2.69169618940638},
+		{k.shelf.b2, 1.19839281085285},
+		{k.shelf.a1, -1.69065929318241},
+		{k.shelf.a2, 0.73248077421585},
+		{k.highPass.a1, -1.99004745483398},
+		{k.highPass.a2, 0.99007225036621},
+	} {
+		if math.Abs(c.have-c.want) > 1e-8 {
+			t.Errorf("have %v, want %v", c.have, c.want)
+		}
+	}
+}
+
+func TestMeter(t *testing.T) {
+	cfg := alac.Config{SampleRate: 48000, SampleSize: 16, NumChannels: 2}
+	near := func(t *testing.T, have, want float64) {
+		t.Helper()
+		if math.Abs(have-want) > 0.1 {
+			t.Errorf("have %v, want %v", have, want)
+		}
+	}
+
+	// EBU Tech 3341 test case 1: -23 dBFS stereo is -23 LUFS
+	m, err := NewMeter(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Write(sine(cfg, 20, -23))
+	near(t, m.Integrated(), -23)
+	gain, peak := m.ReplayGain()
+	near(t, gain, 5)
+	if want := math.Pow(10, -23.0/20); math.Abs(peak-want) > 1e-4 {
+		t.Errorf("have %v, want %v", peak, want)
+	}
+
+	t.Run("gating", func(t *testing.T) {
+		// EBU Tech 3341 test case 3: the silence, and the -36 dBFS part,
+		// are below the gates
+		m, err := NewMeter(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Write(sine(cfg, 10, -36))
+		m.Write(sine(cfg, 60, -23))
+		m.Write(make([]byte, 10*48000*4))
+		m.Write(sine(cfg, 10, -36))
+		near(t, m.Integrated(), -23)
+	})
+
+	t.Run("split writes", func(t *testing.T) {
+		m, err := NewMeter(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pcm := sine(cfg, 1, -20)
+		for len(pcm) > 0 {
+			n := min(len(pcm), 333)
+			m.Write(pcm[:n])
+			pcm = pcm[n:]
+		}
+		near(t, m.Integrated(), -20)
+	})
+
+	t.Run("24 bit", func(t *testing.T) {
+		cfg := alac.Config{SampleRate: 44100, SampleSize: 24, NumChannels: 1}
+		m, err := NewMeter(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var (
+			pcm   []byte
+			pcm16 = sine(cfg, 2, -20)
+		)
+		for i := 0; i < len(pcm16); i += 2 {
+			pcm = append(pcm, 0, pcm16[i], pcm16[i+1])
+		}
+		m.Write(pcm)
+		// a mono channel counts once, so 3dB under stereo
+		near(t, m.Integrated(), -23)
+	})
+
+	t.Run("silence", func(t *testing.T) {
+		m, err := NewMeter(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Write(make([]byte, 48000*4))
+		if have := m.Integrated(); !math.IsInf(have, -1) {
+			t.Errorf("have %v, want -Inf", have)
+		}
+		if gain, peak := m.ReplayGain(); gain != 0 || peak != 0 {
+			t.Errorf("have %v %v, want 0 0", gain, peak)
+		}
+	})
+}
+
+func TestWindows(t *testing.T) {
+	cfg := alac.Config{SampleRate: 48000, SampleSize: 16, NumChannels: 2}
+	m, err := NewMeter(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.OnFrame(alac.FrameInfo{}, sine(cfg, 0.3, -20))
+	if have := m.Momentary(); !math.IsInf(have, -1) {
+		t.Errorf("have %v, want -Inf", have)
+	}
+
+	m.OnFrame(alac.FrameInfo{}, sine(cfg, 3, -20))
+	for _, have := range []float64{m.Momentary(), m.ShortTerm()} {
+		if math.Abs(have+20) > 0.1 {
+			t.Errorf("have %v, want -20", have)
+		}
+	}
+
+	// 1s of silence is all of the momentary window, a third of the short
+	// term one
+	m.Write(make([]byte, 48000*4))
+	if have := m.Momentary(); have > -70 {
+		t.Errorf("have %v, want silence", have)
+	}
+	if have, want := m.ShortTerm(), -20+10*math.Log10(2.0/3); math.Abs(have-want) > 0.1 {
+		t.Errorf("have %v, want %v", have, want)
+	}
+}
+
+func TestTruePeak(t *testing.T) {
+	// a quarter of the sample rate, shifted by 45 degrees, so every sample
+	// misses the peak by 3dB
+	var pcm []byte
+	for i := range 48000 {
+		s := 0.5 * math.Sin(math.Pi/2*float64(i)+math.Pi/4)
+		pcm = binary.LittleEndian.AppendUint16(pcm, uint16(int16(math.Round(s*32767))))
+	}
+	m, err := NewMeter(alac.Config{SampleRate: 48000, SampleSize: 16, NumChannels: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Write(pcm)
+	if have, want := m.Peak(), 0.5/math.Sqrt2; math.Abs(have-want) > 1e-3 {
+		t.Errorf("have %v, want %v", have, want)
+	}
+	if have, want := m.TruePeak(), 0.5; math.Abs(20*math.Log10(have/want)) > 0.3 {
+		t.Errorf("have %v, want %v", have, want)
+	}
+}
@@ -0,0 +1,70 @@
+package loudness
+
+import (
+	"fmt"
+
+	"github.com/alicebob/alac"
+)
+
+// pcm cuts PCM, as a decoder returns it, into sample frames, also when a
+// frame is split over writes.
+type pcm struct {
+	width int       // bytes per sample
+	scale float64   // 1 over full scale
+	frame []float64 // the current frame, relative to full scale
+	rest  []byte    // an incomplete frame from the last write
+}
+
+// newPCM returns a pcm for the little endian, packed, PCM of cfg.
+func newPCM(cfg alac.Config) (pcm, error) {
+	if cfg.SampleRate <= 0 {
+		return pcm{}, fmt.Errorf("%w: sample rate %d", alac.ErrInvalidConfig, cfg.SampleRate)
+	}
+	if cfg.SampleSize != 16 && cfg.SampleSize != 24 {
+		return pcm{}, fmt.Errorf("%w: %d bit samples", alac.ErrUnsupportedBitDepth, cfg.SampleSize)
+	}
+	if cfg.NumChannels < 1 {
+		return pcm{}, fmt.Errorf("%w: %d channels", alac.ErrInvalidConfig, cfg.NumChannels)
+	}
+	return pcm{
+		width: cfg.SampleSize / 8,
+		scale: 1 / float64(int(1)<<(cfg.SampleSize-1)),
+		frame: make([]float64, cfg.NumChannels),
+	}, nil
+}
+
+// write calls fn for every complete frame in b, and keeps what's left for
+// the next write.
+func (p *pcm) write(b []byte, fn func(frame []float64)) {
+	size := p.width * len(p.frame)
+	if len(p.rest) > 0 {
+		k := min(size-len(p.rest), len(b))
+		p.rest = append(p.rest, b[:k]...)
+		b = b[k:]
+		if len(p.rest) < size {
+			return
+		}
+		p.frames(p.rest, fn)
+		p.rest = p.rest[:0]
+	}
+	whole := len(b) - len(b)%size
+	p.frames(b[:whole], fn)
+	p.rest = append(p.rest, b[whole:]...)
+}
+
+// frames calls fn for every frame in b, which holds whole frames.
+func (p *pcm) frames(b []byte, fn func(frame []float64)) {
+	for len(b) > 0 {
+		for c := range p.frame {
+			var s int32
+			if p.width == 2 {
+				s = int32(int16(uint16(b[0]) | uint16(b[1])<<8))
+			} else {
+				s = int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+			}
+			b = b[p.width:]
+			p.frame[c] = float64(s) * p.scale
+		}
+		fn(p.frame)
+	}
+}
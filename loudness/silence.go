@@ -0,0 +1,94 @@
+package loudness
+
+import (
+	"math"
+	"time"
+
+	"github.com/alicebob/alac"
+)
+
+// Region is a stretch of PCM, in sample frames from the start of the
+// stream. End is exclusive.
+type Region struct {
+	Start, End int64
+}
+
+// SilenceDetector finds the silent regions in PCM, such as the pauses
+// between the songs of a concert recording, or the silence before and after
+// a track. The zero value is not usable, use NewSilenceDetector.
+type SilenceDetector struct {
+	in         pcm
+	rate       int
+	threshold  float64 // linear
+	minSamples int64
+
+	pos     int64 // sample frames so far
+	start   int64 // of the current silence, -1 if not silent
+	regions []Region
+}
+
+// NewSilenceDetector returns a SilenceDetector for PCM of the format of
+// cfg, see NewMeter. A sample frame is silent when no channel goes above
+// threshold, in dBFS, and a region needs at least minDuration of silent
+// sample frames to count.
+func NewSilenceDetector(cfg alac.Config, threshold float64, minDuration time.Duration) (*SilenceDetector, error) {
+	in, err := newPCM(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &SilenceDetector{
+		in:         in,
+		rate:       cfg.SampleRate,
+		threshold:  math.Pow(10, threshold/20),
+		minSamples: max(1, int64(minDuration.Seconds()*float64(cfg.SampleRate))),
+		start:      -1,
+	}, nil
+}
+
+// Write adds PCM to the detection. It never fails.
+func (d *SilenceDetector) Write(pcm []byte) (int, error) {
+	d.in.write(pcm, d.add)
+	return len(pcm), nil
+}
+
+// OnFrame is Write with the signature of alac.Alac.OnFrame, to find the
+// silence in everything a decoder decodes.
+func (d *SilenceDetector) OnFrame(_ alac.FrameInfo, pcm []byte) {
+	d.Write(pcm)
+}
+
+func (d *SilenceDetector) add(frame []float64) {
+	silent := true
+	for _, v := range frame {
+		if math.Abs(v) > d.threshold {
+			silent = false
+			break
+		}
+	}
+	switch {
+	case silent && d.start < 0:
+		d.start = d.pos
+	case !silent && d.start >= 0:
+		if d.pos-d.start >= d.minSamples {
+			d.regions = append(d.regions, Region{d.start, d.pos})
+		}
+		d.start = -1
+	}
+	d.pos++
+}
+
+// Regions returns the silent regions so far, in order. A silence which is
+// still going on is included up to the current position, once it's long
+// enough; that's the trailing silence when the stream has ended.
+func (d *SilenceDetector) Regions() []Region {
+	r := d.regions[:len(d.regions):len(d.regions)]
+	if d.start >= 0 && d.pos-d.start >= d.minSamples {
+		r = append(r, Region{d.start, d.pos})
+	}
+	return r
+}
+
+// Time returns the time at sample frame n.
+func (d *SilenceDetector) Time(n int64) time.Duration {
+	return time.Duration(n) * time.Second / time.Duration(d.rate)
+}
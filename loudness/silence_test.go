@@ -0,0 +1,44 @@
+package loudness
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alicebob/alac"
+)
+
+func TestSilenceDetector(t *testing.T) {
+	cfg := alac.Config{SampleRate: 48000, SampleSize: 16, NumChannels: 2}
+	d, err := NewSilenceDetector(cfg, -60, 500*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Write(make([]byte, 48000*4))                     // 1s silence at the start
+	d.Write(sine(cfg, 2, -20))                         // 2s tone
+	d.Write(make([]byte, 23000*4))                     // too short
+	d.Write(sine(cfg, 1, -20))                         // 1s tone
+	d.OnFrame(alac.FrameInfo{}, make([]byte, 48000*4)) // 1s silence at the end
+
+	// the sines start at 0, which is silent
+	have := d.Regions()
+	if want := []Region{{0, 48001}, {215000, 263000}}; !slices.Equal(have, want) {
+		t.Fatalf("have %v, want %v", have, want)
+	}
+	if have, want := d.Time(48000), time.Second; have != want {
+		t.Errorf("have %v, want %v", have, want)
+	}
+
+	// the trailing silence is only there while it lasts
+	d.Write(sine(cfg, 0.1, -20))
+	if have, want := len(d.Regions()), 2; have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+	if !slices.Equal(d.Regions()[:1], have[:1]) {
+		t.Errorf("regions changed")
+	}
+
+	if _, err := NewSilenceDetector(alac.Config{SampleRate: 48000, SampleSize: 20, NumChannels: 2}, -60, time.Second); err == nil {
+		t.Errorf("no error")
+	}
+}
@@ -0,0 +1,33 @@
+package loudness
+
+import (
+	"math"
+)
+
+// truePeakTaps are the phases of the 4x oversampling filter BS.1770-4 Annex
+// 2 suggests for true peak measurement.
+var truePeakTaps = [4][12]float64{
+	{0.0017089843750, 0.0109863281250, -0.0196533203125, 0.0332031250000, -0.0594482421875, 0.1373291015625, 0.9721679687500, -0.1022949218750, 0.0476074218750, -0.0266113281250, 0.0148925781250, -0.0083007812500},
+	{-0.0291748046875, 0.0292968750000, -0.0517578125000, 0.0891113281250, -0.1665039062500, 0.4650878906250, 0.7797851562500, -0.2003173828125, 0.1015625000000, -0.0582275390625, 0.0330810546875, -0.0189208984375},
+	{-0.0189208984375, 0.0330810546875, -0.0582275390625, 0.1015625000000, -0.2003173828125, 0.7797851562500, 0.4650878906250, -0.1665039062500, 0.0891113281250, -0.0517578125000, 0.0292968750000, -0.0291748046875},
+	{-0.0083007812500, 0.0148925781250, -0.0266113281250, 0.0476074218750, -0.1022949218750, 0.9721679687500, 0.1373291015625, -0.0594482421875, 0.0332031250000, -0.0196533203125, 0.0109863281250, 0.0017089843750},
+}
+
+// truePeak finds the peak of one channel between its samples, by
+// oversampling it 4 times.
+type truePeak struct {
+	history [12]float64 // the last samples, newest first
+	peak    float64
+}
+
+func (p *truePeak) next(x float64) {
+	copy(p.history[1:], p.history[:11])
+	p.history[0] = x
+	for _, taps := range &truePeakTaps {
+		y := 0.0
+		for k, c := range taps {
+			y += c * p.history[k]
+		}
+		p.peak = max(p.peak, math.Abs(y))
+	}
+}
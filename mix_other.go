@@ -0,0 +1,9 @@
+//go:build !arm64 || purego
+
+package alac
+
+// mix16 is the SIMD start of deinterlace_16. This platform doesn't have
+// one, so it does nothing.
+func mix16(out []byte, a, b []int32, n int, shift, weight uint8) int {
+	return 0
+}
@@ -0,0 +1,42 @@
+package mp4
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DamageError is what ReadFrame of a File opened WithLenient returns after
+// the last frame it could read of a damaged file.
+type DamageError struct {
+	Frame int   // the first frame which is lost
+	Err   error // what's wrong
+}
+
+func (e *DamageError) Error() string {
+	return fmt.Sprintf("mp4: damaged file, lost the frames from %d on: %v", e.Frame, e.Err)
+}
+
+func (e *DamageError) Unwrap() error {
+	return e.Err
+}
+
+// damaged drops the frames from frame on, for err. It returns err for
+// strict Files, and nil for lenient ones, which have ReadFrame return the
+// DamageError.
+func (f *File) damaged(frame int, err error) error {
+	if !f.lenient {
+		return err
+	}
+	if f.damage == nil {
+		f.damage = &DamageError{Frame: frame, Err: err}
+	}
+	f.table.n = min(f.table.n, frame)
+	f.frag = nil
+	return nil
+}
+
+// cut is whether err is of a file which is cut short.
+func cut(err error) bool {
+	return err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF)
+}
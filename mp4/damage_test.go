@@ -0,0 +1,89 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/alicebob/alac"
+)
+
+func TestLenient(t *testing.T) {
+	var (
+		pcm   = wavPCM(t, "jane_eyre_5s.wav")
+		file  = encodeM4A(t, pcm, alac.DefaultConfig())
+		fast  = faststart(t, file)
+		frame = 352 * 4
+	)
+	moov := file[bytes.Index(file, []byte("moov"))+4:]
+	stco, err := find(moov, "trak", "mdia", "minf", "stbl", "stco")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the last chunk is somewhere else
+	badChunk := bytes.Clone(file)
+	binary.BigEndian.PutUint32(badChunk[len(file)-len(moov)+bytes.Index(moov, stco)+len(stco)-4:], 0x7f000000)
+	// stsz has more frames than sizes
+	stsz, err := find(moov, "trak", "mdia", "minf", "stbl", "stsz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	badSizes := bytes.Clone(file)
+	at := len(file) - len(moov) + bytes.Index(moov, stsz) + 8
+	binary.BigEndian.PutUint32(badSizes[at:], binary.BigEndian.Uint32(file[at:])+5)
+
+	frames := (len(pcm) + frame - 1) / frame
+	for name, c := range map[string]struct {
+		file   []byte
+		stream bool
+		frame  int // the first one lost
+	}{
+		"cut":            {fast[:len(fast)*6/10], false, -1},
+		"cut stream":     {fast[:len(fast)*6/10], true, -1},
+		"bad chunk":      {badChunk, false, -1},
+		"too many sizes": {badSizes, false, frames},
+	} {
+		var f *File
+		if c.stream {
+			f, err = OpenReader(bytes.NewReader(c.file), WithLenient())
+		} else {
+			f, err = Open(bytes.NewReader(c.file), WithLenient())
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		dec := mustDecoder(t, f)
+		// not the Trimmer, which stops before the lost frames of the edit
+		have, err := io.ReadAll(alac.NewPCMReader(dec, struct{ alac.FrameReader }{f}))
+		var damage *DamageError
+		if !errors.As(err, &damage) {
+			t.Fatalf("%s: have %v, want a DamageError", name, err)
+		}
+		if c.frame >= 0 && damage.Frame != c.frame {
+			t.Errorf("%s: have frame %d, want %d", name, damage.Frame, c.frame)
+		}
+		if damage.Frame == 0 || damage.Frame > frames {
+			t.Errorf("%s: have frame %d of %d", name, damage.Frame, frames)
+		}
+		if want := pcm[:min(len(pcm), damage.Frame*frame)]; !bytes.Equal(have, want) {
+			t.Errorf("%s: have %d bytes, want %d", name, len(have), len(want))
+		}
+		if _, err := f.ReadFrame(); err != damage {
+			t.Errorf("%s: have %v, want %v", name, err, damage)
+		}
+	}
+
+	// without WithLenient
+	if _, err := Open(bytes.NewReader(badChunk)); !errors.Is(err, ErrFormat) {
+		t.Errorf("have %v, want %v", err, ErrFormat)
+	}
+	f, err := Open(bytes.NewReader(fast[:len(fast)*6/10]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(alac.NewPCMReader(mustDecoder(t, f), f)); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("have %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
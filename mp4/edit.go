@@ -0,0 +1,125 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// edit returns the samples to skip and to play of the track, from its edit
+// list, or else from the iTunSMPB tag of iTunes. The length is -1 if it's
+// the rest of the track.
+func edit(moov, trak []byte, media int) (int64, int64, error) {
+	elst, err := find(trak, "edts", "elst")
+	if err != nil {
+		return 0, 0, err
+	}
+	if elst == nil {
+		return itunSMPB(moov)
+	}
+	mvhd, err := find(moov, "mvhd")
+	if err != nil {
+		return 0, 0, err
+	}
+	movie, err := timescale(mvhd)
+	if err != nil {
+		return 0, 0, err
+	}
+	if movie == 0 {
+		movie = media
+	}
+
+	// elst: version(1) flags(3) count(4) entries of segmentDuration
+	// mediaTime(signed) rate(4), of 4 bytes in version 0 and 8 in version
+	// 1. Empty edits, with a media time of -1, delay the track, which
+	// doesn't change what plays; only the first edit of the media is used.
+	if len(elst) < 8 {
+		return 0, 0, fmt.Errorf("%w: 'elst' atom of %d bytes", ErrFormat, len(elst))
+	}
+	var (
+		be    = binary.BigEndian
+		n     = be.Uint32(elst[4:])
+		width = 4
+	)
+	if elst[0] == 1 {
+		width = 8
+	}
+	if !fits(elst[8:], n, 2*width+4) {
+		return 0, 0, fmt.Errorf("%w: 'elst' atom of %d bytes for %d entries", ErrFormat, len(elst), n)
+	}
+	entries := int(n)
+	for e := range entries {
+		var (
+			b             = elst[8+e*(2*width+4):]
+			duration, tim int64
+		)
+		if width == 4 {
+			duration, tim = int64(be.Uint32(b)), int64(int32(be.Uint32(b[4:])))
+		} else {
+			duration, tim = int64(be.Uint64(b)), int64(be.Uint64(b[8:]))
+		}
+		if tim < 0 {
+			continue
+		}
+		length := int64(-1) // fragmented files may not know
+		if duration > 0 {
+			length = duration * int64(media) / int64(movie)
+		}
+		return tim, length, nil
+	}
+	return 0, -1, nil
+}
+
+// itunSMPB returns the samples to skip and to play of the iTunSMPB tag in
+// the iTunes metadata of moov, if any: " 00000000 priming padding samples
+// ...", in hex.
+func itunSMPB(moov []byte) (int64, int64, error) {
+	meta, err := find(moov, "udta", "meta")
+	if err != nil || meta == nil {
+		return 0, -1, err
+	}
+	if len(meta) >= 4 && binary.BigEndian.Uint32(meta) == 0 {
+		meta = meta[4:] // the version and flags of MP4, not of QuickTime
+	}
+	ilst, err := find(meta, "ilst")
+	if err != nil {
+		return 0, -1, err
+	}
+	var value []byte
+	err = atoms(ilst, func(typ string, tag []byte) bool {
+		if typ != "----" {
+			return true
+		}
+		name, _ := find(tag, "name")
+		data, _ := find(tag, "data")
+		// name: version and flags(4) name, data: type(4) locale(4) value
+		if len(name) >= 4 && string(name[4:]) == "iTunSMPB" && len(data) >= 8 {
+			value = data[8:]
+			return false
+		}
+		return true
+	})
+	if err != nil || value == nil {
+		return 0, -1, err
+	}
+	var (
+		priming, padding uint32
+		samples          uint64
+	)
+	_, err = fmt.Fscanf(bytes.NewReader(value), " %x %x %x %x", new(uint32), &priming, &padding, &samples)
+	if err != nil {
+		return 0, -1, nil // not for this package to fail on
+	}
+	return int64(priming), int64(samples), nil
+}
+
+// Trim returns the samples per channel to skip at the start of the track,
+// its priming, and the samples to play after that, from the edit list of
+// the track, or else from the iTunSMPB tag of iTunes. The length is -1 for
+// the rest of the track. Without either it's 0 and -1.
+//
+// The File is an alac.Trimmer: alac.NewPCMReader trims its PCM, for
+// gapless playback.
+func (f *File) Trim() (skip, length int64) {
+	return f.skip, f.length
+}
@@ -0,0 +1,38 @@
+package mp4
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/alicebob/alac"
+)
+
+func TestTrim(t *testing.T) {
+	var (
+		pcm     = wavPCM(t, "jane_eyre_5s.wav")
+		samples = int64(len(pcm) / 4)
+		file    = encodeM4A(t, pcm, alac.DefaultConfig(), alac.WithPriming(1000))
+		noEdit  = bytes.Replace(bytes.Clone(file), []byte("edts"), []byte("free"), 1)
+		noTag   = bytes.Replace(bytes.Clone(noEdit), []byte("iTunSMPB"), []byte("iTunNORM"), 1)
+	)
+	for name, c := range map[string]struct {
+		file         []byte
+		skip, length int64
+	}{
+		"elst":     {file, 1000, samples - 1000},
+		"iTunSMPB": {noEdit, 1000, samples - 1000},
+		"neither":  {noTag, 0, -1},
+	} {
+		f, err := Open(bytes.NewReader(c.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		skip, length := f.Trim()
+		if skip != c.skip || length != c.length {
+			t.Errorf("%s: have %d %d, want %d %d", name, skip, length, c.skip, c.length)
+		}
+		if have, want := decode(t, f), pcm[4*c.skip:]; !bytes.Equal(have, want) {
+			t.Errorf("%s: have %d bytes, want %d", name, len(have), len(want))
+		}
+	}
+}
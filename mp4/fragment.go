@@ -0,0 +1,324 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// fragments is the state of the track of a fragmented file, as HLS and
+// DASH serve them: the 'moov' atom has no frames, and every fragment is a
+// 'moof' atom with the sample table of the frames in the 'mdat' atom after
+// it. Other top level atoms of fragmented files, such as 'styp' and
+// 'sidx', say nothing the frames need, and are skipped.
+type fragments struct {
+	trackID  uint32
+	size     uint32 // default sample size of the 'trex' atom
+	duration uint32 // default sample duration of the 'trex' atom
+	time     int64  // decode time of the next frame
+	total    int64  // duration of the 'mehd' atom, in the timescale of the track
+	next     int64  // offset of the next top level atom, for streams
+}
+
+// newFragments returns the fragments of the track with the ID, of a file
+// with an 'mvex' atom.
+func newFragments(id int, mvex []byte) (*fragments, error) {
+	fr := &fragments{trackID: uint32(id)}
+	err := atoms(mvex, func(typ string, trex []byte) bool {
+		// trex: version and flags(4) trackID(4) sampleDescriptionIndex(4)
+		// duration(4) size(4) flags(4)
+		if typ == "trex" && len(trex) >= 24 && binary.BigEndian.Uint32(trex[4:]) == fr.trackID {
+			fr.duration = binary.BigEndian.Uint32(trex[12:])
+			fr.size = binary.BigEndian.Uint32(trex[16:])
+			return false
+		}
+		return true
+	})
+	return fr, err
+}
+
+// fragmentDuration returns the duration of all fragments of the 'mehd'
+// atom in mvex, in the media timescale, or 0 without one.
+func fragmentDuration(moov, mvex []byte, media int) (int64, error) {
+	mehd, err := find(mvex, "mehd")
+	if err != nil || mehd == nil {
+		return 0, err
+	}
+	mvhd, err := find(moov, "mvhd")
+	if err != nil {
+		return 0, err
+	}
+	movie, err := timescale(mvhd)
+	if err != nil {
+		return 0, err
+	}
+	if movie == 0 {
+		movie = media
+	}
+	// mehd: version(1) flags(3) fragmentDuration, of 4 bytes in version 0
+	// and 8 in version 1
+	var duration uint64
+	switch {
+	case len(mehd) >= 12 && mehd[0] == 1:
+		duration = binary.BigEndian.Uint64(mehd[4:])
+	case len(mehd) >= 8 && mehd[0] == 0:
+		duration = uint64(binary.BigEndian.Uint32(mehd[4:]))
+	default:
+		return 0, fmt.Errorf("%w: 'mehd' atom of %d bytes", ErrFormat, len(mehd))
+	}
+	if duration > math.MaxInt64/uint64(media) {
+		return 0, fmt.Errorf("%w: 'mehd' duration %d", ErrFormat, duration)
+	}
+	return int64(duration) * int64(media) / int64(movie), nil
+}
+
+// readFragment reads the 'moof' atom of size bytes at offset from r, which
+// is at its content, and adds its frames. For streams it also reads the
+// header of the 'mdat' atom after it, so the frames can be read without
+// going back.
+func (f *File) readFragment(r io.ReadSeeker, offset, size int64, stream bool) error {
+	if err := f.limits.atom("'moof' atom", size); err != nil {
+		return err
+	}
+	moof, err := readAtom(r, "moof", size)
+	if err != nil {
+		return err
+	}
+	n := f.table.n
+	if err := f.addFragment(offset, moof); err != nil {
+		return err
+	}
+	if !stream {
+		return nil
+	}
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	typ, hdr, size, err := readHeader(r)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return fmt.Errorf("%w: fragment without data: %w", ErrFormat, err)
+	}
+	if typ != "mdat" || size < 0 {
+		return fmt.Errorf("%w: fragment followed by a %q atom", ErrFormat, typ)
+	}
+	f.frag.next = start + int64(hdr) + size
+	mdat := []extent{{start + int64(hdr), f.frag.next}}
+	for i := n; i < f.table.n; i++ {
+		if !inside(mdat, f.table.offset(i), f.table.size(i)) {
+			return fmt.Errorf("%w: frame %d is outside of the mdat atom of its fragment", ErrFormat, i)
+		}
+	}
+	return nil
+}
+
+// nextFragment reads the top level atoms of a stream up to the next
+// fragment. It returns io.EOF at the end of the stream.
+func (f *File) nextFragment() error {
+	f.pos = -1
+	if _, err := f.r.Seek(f.frag.next, io.SeekStart); err != nil {
+		return err
+	}
+	for {
+		typ, hdr, size, err := readHeader(f.r)
+		if err == io.EOF {
+			f.frag = nil
+		}
+		if err != nil {
+			return err
+		}
+		if size < 0 {
+			return fmt.Errorf("%w: %q atom of a stream goes on until its end", ErrFormat, typ)
+		}
+		if typ == "moof" {
+			return f.readFragment(f.r, f.frag.next, size, true)
+		}
+		f.frag.next += int64(hdr) + size
+		if _, err := f.r.Seek(size, io.SeekCurrent); err != nil {
+			return err
+		}
+	}
+}
+
+// addFragment adds the frames of the track in the 'moof' atom at offset.
+func (f *File) addFragment(offset int64, moof []byte) error {
+	var ferr error
+	err := atoms(moof, func(typ string, traf []byte) bool {
+		if typ == "traf" {
+			ferr = f.addTrackFragment(offset, traf)
+		}
+		return ferr == nil
+	})
+	if err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// tfhd and trun flags
+const (
+	tfhdBaseDataOffset   = 0x01
+	tfhdDescriptionIndex = 0x02
+	tfhdDuration         = 0x08
+	tfhdSize             = 0x10
+	tfhdFlags            = 0x20
+
+	trunDataOffset       = 0x01
+	trunFirstSampleFlags = 0x04
+	trunDuration         = 0x100
+	trunSize             = 0x200
+	trunFlags            = 0x400
+	trunCompositionTime  = 0x800
+)
+
+// addTrackFragment adds the frames of a 'traf' atom of the 'moof' atom at
+// moof, if it's of the track.
+func (f *File) addTrackFragment(moof int64, traf []byte) error {
+	be := binary.BigEndian
+	tfhd, err := find(traf, "tfhd")
+	if err != nil {
+		return err
+	}
+	// tfhd: version(1) flags(3) trackID(4), and the optional fields of the
+	// flags
+	if len(tfhd) < 8 {
+		return fmt.Errorf("%w: 'tfhd' atom of %d bytes", ErrFormat, len(tfhd))
+	}
+	if be.Uint32(tfhd[4:]) != f.frag.trackID {
+		return nil
+	}
+	var (
+		flags = be.Uint32(tfhd) & 0xffffff
+		base  = moof // also with the default-base-is-moof flag
+		def   = defaults{f.frag.size, f.frag.duration}
+		field = tfhd[8:]
+	)
+	for _, fl := range []uint32{tfhdBaseDataOffset, tfhdDescriptionIndex, tfhdDuration, tfhdSize, tfhdFlags} {
+		if flags&fl == 0 {
+			continue
+		}
+		n := 4
+		if fl == tfhdBaseDataOffset {
+			n = 8
+		}
+		if len(field) < n {
+			return fmt.Errorf("%w: 'tfhd' atom of %d bytes", ErrFormat, len(tfhd))
+		}
+		switch fl {
+		case tfhdBaseDataOffset:
+			if base = int64(be.Uint64(field)); base < 0 {
+				return fmt.Errorf("%w: base data offset %d", ErrFormat, uint64(base))
+			}
+		case tfhdDuration:
+			def.duration = be.Uint32(field)
+		case tfhdSize:
+			def.size = be.Uint32(field)
+		}
+		field = field[n:]
+	}
+
+	// tfdt: version(1) flags(3) baseMediaDecodeTime, of 4 bytes in version
+	// 0 and 8 in version 1. Without it the fragment follows the last one.
+	tfdt, err := find(traf, "tfdt")
+	if err != nil {
+		return err
+	}
+	switch {
+	case len(tfdt) >= 12 && tfdt[0] == 1:
+		f.frag.time = int64(be.Uint64(tfdt[4:]))
+	case len(tfdt) >= 8:
+		f.frag.time = int64(be.Uint32(tfdt[4:]))
+	}
+
+	var (
+		offset = base
+		rerr   error
+	)
+	err = atoms(traf, func(typ string, trun []byte) bool {
+		if typ == "trun" {
+			offset, rerr = f.addRun(trun, base, offset, def)
+		}
+		return rerr == nil
+	})
+	if err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// defaults are the size and the duration of the frames of a fragment
+// without their own.
+type defaults struct {
+	size, duration uint32
+}
+
+// addRun adds the frames of a 'trun' atom. Its frames start at offset,
+// unless it has a data offset from base, and have the size and duration of
+// def unless it has their own. It returns the end of its frames.
+func (f *File) addRun(trun []byte, base, offset int64, def defaults) (int64, error) {
+	// trun: version(1) flags(3) sampleCount(4) dataOffset(4)
+	// firstSampleFlags(4), and for every sample duration(4) size(4)
+	// flags(4) compositionTimeOffset(4), of the flags
+	be := binary.BigEndian
+	if len(trun) < 8 {
+		return 0, fmt.Errorf("%w: 'trun' atom of %d bytes", ErrFormat, len(trun))
+	}
+	var (
+		flags = be.Uint32(trun) & 0xffffff
+		n     = be.Uint32(trun[4:])
+		b     = trun[8:]
+	)
+	for _, fl := range []uint32{trunDataOffset, trunFirstSampleFlags} {
+		if flags&fl == 0 {
+			continue
+		}
+		if len(b) < 4 {
+			return 0, fmt.Errorf("%w: 'trun' atom of %d bytes", ErrFormat, len(trun))
+		}
+		if fl == trunDataOffset {
+			offset = base + int64(int32(be.Uint32(b)))
+		}
+		b = b[4:]
+	}
+	var (
+		stride = 0
+		at     = map[uint32]int{} // of the fields of a sample
+	)
+	for _, fl := range []uint32{trunDuration, trunSize, trunFlags, trunCompositionTime} {
+		if flags&fl == 0 {
+			continue
+		}
+		at[fl] = stride
+		stride += 4
+	}
+	if !fits(b, n, stride) {
+		return 0, fmt.Errorf("%w: 'trun' atom of %d bytes for %d samples", ErrFormat, len(trun), n)
+	}
+	if err := f.limits.table("sample table with the fragments", uint64(f.table.n)+uint64(n)); err != nil {
+		return 0, err
+	}
+	count := int(n)
+	field := func(i int, fl uint32, def uint32) uint32 {
+		if a, ok := at[fl]; ok {
+			return be.Uint32(b[i*stride+a:])
+		}
+		return def
+	}
+	if count > 0 {
+		f.table.chunks = append(f.table.chunks, chunk{f.table.n, offset})
+	}
+	for i := range count {
+		var (
+			size     = field(i, trunSize, def.size)
+			duration = field(i, trunDuration, def.duration)
+		)
+		f.table.add(size, f.frag.time, duration, int32(field(i, trunCompositionTime, 0)))
+		offset += int64(size)
+		f.frag.time += int64(duration)
+	}
+	return offset, nil
+}
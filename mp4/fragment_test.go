@@ -0,0 +1,163 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/alicebob/alac"
+)
+
+// atom returns an atom of the contents.
+func atom(typ string, content ...[]byte) []byte {
+	b := binary.BigEndian.AppendUint32(nil, 0)
+	b = append(b, typ...)
+	for _, c := range content {
+		b = append(b, c...)
+	}
+	binary.BigEndian.PutUint32(b, uint32(len(b)))
+	return b
+}
+
+// be32 returns the big endian bytes of the values.
+func be32(vs ...uint32) []byte {
+	var b []byte
+	for _, v := range vs {
+		b = binary.BigEndian.AppendUint32(b, v)
+	}
+	return b
+}
+
+// fragment returns an alacm4a file as a fragmented file, with per frames
+// in every fragment and an empty sample table in its 'moov' atom.
+func fragment(t *testing.T, file []byte, per int) []byte {
+	t.Helper()
+	f, err := Open(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := bytes.Index(file, []byte("moov")) - 4
+	stsd, err := find(file[i+8:], "trak", "mdia", "minf", "stbl", "stsd")
+	if err != nil || stsd == nil {
+		t.Fatalf("no stsd: %v", err)
+	}
+	var (
+		empty = be32(0, 0)
+		tkhd  = append(be32(0, 0, 0, 1), make([]byte, 68)...) // track 1
+		stbl  = atom("stbl", atom("stsd", stsd), atom("stts", empty), atom("stsc", empty), atom("stsz", be32(0, 0, 0)), atom("stco", empty))
+		trak  = atom("trak", atom("tkhd", tkhd), atom("mdia", atom("minf", stbl)))
+		mvex  = atom("mvex", atom("trex", be32(0, 1, 1, uint32(f.frameSize), 0, 0)))
+		ftyp  = int(binary.BigEndian.Uint32(file))
+		out   = append(bytes.Clone(file[:ftyp]), atom("moov", trak, mvex)...)
+	)
+	all := samples(f)
+	for n := 0; n*per < len(all); n++ {
+		var (
+			part  = all[n*per : min(len(all), (n+1)*per)]
+			mdat  []byte
+			sizes []uint32 // and durations
+			both  []uint32
+		)
+		for _, s := range part {
+			mdat = append(mdat, file[s.offset:s.offset+int64(s.size)]...)
+			sizes = append(sizes, s.size)
+			both = append(both, s.duration, s.size)
+		}
+		other := atom("traf", atom("tfhd", be32(0, 2))) // not the track
+		var moof []byte
+		if n%2 == 0 {
+			// frames relative to the moof atom, with their durations
+			tfhd := atom("tfhd", be32(0x020000, 1))
+			tfdt := atom("tfdt", be32(0), binary.BigEndian.AppendUint32(nil, uint32(part[0].time)))
+			trun := func(offset uint32) []byte {
+				return atom("trun", be32(0x301, uint32(len(sizes)), offset), be32(both...))
+			}
+			size := len(atom("moof", other, atom("traf", tfhd, tfdt, trun(0))))
+			moof = atom("moof", other, atom("traf", tfhd, tfdt, trun(uint32(size+8))))
+		} else {
+			// frames at an absolute offset, of the duration of the trex
+			// atom, after the last fragment
+			tfhd := func(base uint64) []byte {
+				return atom("tfhd", be32(1, 1), binary.BigEndian.AppendUint64(nil, base))
+			}
+			trun := atom("trun", be32(0x200, uint32(len(sizes))), be32(sizes...))
+			if part[len(part)-1].duration != uint32(f.frameSize) {
+				trun = atom("trun", be32(0x300, uint32(len(sizes))), be32(both...))
+			}
+			size := len(atom("moof", atom("traf", tfhd(0), trun)))
+			moof = atom("moof", atom("traf", tfhd(uint64(len(out)+size+8)), trun))
+		}
+		out = append(out, moof...)
+		out = append(out, atom("mdat", mdat)...)
+	}
+	return out
+}
+
+func TestFragments(t *testing.T) {
+	var (
+		pcm  = wavPCM(t, "jane_eyre_5s.wav")
+		m4a  = encodeM4A(t, pcm, alac.DefaultConfig())
+		file = fragment(t, m4a, 50)
+	)
+	orig, err := Open(bytes.NewReader(m4a))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := Open(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frameBytes := 352 * 2 * 2
+	if have, want := f.Frames(), (len(pcm)+frameBytes-1)/frameBytes; have != want {
+		t.Errorf("have %d frames, want %d", have, want)
+	}
+	for i := range f.Frames() {
+		start, duration := f.FrameTime(i)
+		wantStart, wantDuration := orig.FrameTime(i)
+		if start != wantStart || duration != wantDuration {
+			t.Fatalf("frame %d: have %v %v, want %v %v", i, start, duration, wantStart, wantDuration)
+		}
+	}
+	if have := decode(t, f); !bytes.Equal(have, pcm) {
+		t.Errorf("have %d bytes, want %d", len(have), len(pcm))
+	}
+
+	s, err := OpenReader(bytes.NewBuffer(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := s.Frames(), 50; have != want {
+		t.Errorf("have %d frames, want %d", have, want)
+	}
+	if have := decode(t, s); !bytes.Equal(have, pcm) {
+		t.Errorf("have %d bytes, want %d", len(have), len(pcm))
+	}
+
+	t.Run("seek", func(t *testing.T) {
+		s, err := OpenReader(bytes.NewBuffer(file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		i, err := s.SeekTime(3 * time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := i, 3*44100/352; have != want {
+			t.Errorf("have %d, want %d", have, want)
+		}
+		have, err := s.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		orig.next = i
+		want, err := orig.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(have, want) {
+			t.Errorf("have another frame")
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/alicebob/alac"
+)
+
+// atom64 returns an atom of the contents with a 64 bit size.
+func atom64(typ string, content ...[]byte) []byte {
+	b := binary.BigEndian.AppendUint32(nil, 1)
+	b = append(b, typ...)
+	b = binary.BigEndian.AppendUint64(b, 0)
+	for _, c := range content {
+		b = append(b, c...)
+	}
+	binary.BigEndian.PutUint64(b[8:], uint64(len(b)))
+	return b
+}
+
+// large returns the start of an alacm4a file made larger than 4GB, with
+// gap zero bytes before its frames, which follow. All atoms have 64 bit
+// sizes, and the chunk offsets are in a 'co64' atom.
+func large(t *testing.T, file []byte, gap int64) ([]byte, []byte) {
+	t.Helper()
+	f, err := Open(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		frames []byte
+		sizes  = be32(0, 0, uint32(f.Frames()))
+	)
+	for _, s := range samples(f) {
+		frames = append(frames, file[s.offset:s.offset+int64(s.size)]...)
+		sizes = append(sizes, be32(s.size)...)
+	}
+	stbl, err := find(file[bytes.Index(file, []byte("moov"))+4:], "trak", "mdia", "minf", "stbl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stsd, _ := find(stbl, "stsd")
+	stts, _ := find(stbl, "stts")
+	ftyp := atom64("ftyp", []byte("M4A \x00\x00\x00\x00M4A mp42isom"))
+	moov := func(offset uint64) []byte {
+		return atom64("moov", atom64("trak",
+			atom64("tkhd", be32(0, 0, 0, 1), make([]byte, 68)),
+			atom64("mdia", atom64("minf", atom64("stbl",
+				atom64("stsd", stsd),
+				atom64("stts", stts),
+				atom64("stsc", be32(0, 1, 1, uint32(f.Frames()), 1)),
+				atom64("stsz", sizes),
+				atom64("co64", be32(0, 1), binary.BigEndian.AppendUint64(nil, offset)),
+			))),
+		))
+	}
+	n := int64(len(ftyp) + len(moov(0)) + 16) // the mdat header
+	head := append(ftyp, moov(uint64(n+gap))...)
+	head = binary.BigEndian.AppendUint32(head, 1)
+	head = append(head, "mdat"...)
+	head = binary.BigEndian.AppendUint64(head, uint64(16+gap)+uint64(len(frames)))
+	return head, frames
+}
+
+// zeros is an io.Reader of zero bytes.
+type zeros struct{}
+
+func (zeros) Read(b []byte) (int, error) {
+	clear(b)
+	return len(b), nil
+}
+
+func TestLargeFile(t *testing.T) {
+	var (
+		pcm          = wavPCM(t, "jane_eyre_5s.wav")[:200000]
+		gap          = int64(5 << 30)
+		head, frames = large(t, encodeM4A(t, pcm, alac.DefaultConfig()), gap)
+	)
+
+	t.Run("sparse file", func(t *testing.T) {
+		file, err := os.Create(t.TempDir() + "/large.m4a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		if _, err := file.Write(head); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := file.WriteAt(frames, int64(len(head))+gap); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		f, err := Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have := decode(t, f); !bytes.Equal(have, pcm) {
+			t.Errorf("have %d bytes, want %d", len(have), len(pcm))
+		}
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		r := io.MultiReader(bytes.NewReader(head), io.LimitReader(zeros{}, gap), bytes.NewReader(frames))
+		f, err := OpenReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have := decode(t, f); !bytes.Equal(have, pcm) {
+			t.Errorf("have %d bytes, want %d", len(have), len(pcm))
+		}
+	})
+}
@@ -0,0 +1,655 @@
+// Package mp4 reads the ALAC frames of MP4 files, such as the M4A files of
+// iTunes, Music, ffmpeg, and alacm4a, and of QuickTime MOV files.
+//
+//	f, err := mp4.Open(r)
+//	...
+//	dec, err := alac.NewFromMagicCookie(f.MagicCookie())
+//	...
+//	pcm := alac.NewPCMReader(dec, f)
+//
+// Fragmented files, as HLS and DASH serve them, read the same way, also
+// from a stream of their segments.
+//
+// The package only knows about the container, so it doesn't depend on the
+// decoder: alac.ParseMagicCookie of the magic cookie gives the alac.Config
+// of the stream. The formats package registers the format with alac.Open,
+// which does all of the above.
+package mp4
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// ErrFormat is returned by Open for files which aren't MP4 files with an
+// ALAC track, or which are damaged.
+var ErrFormat = errors.New("mp4: not an MP4 file with ALAC audio")
+
+// ErrLimitsExceeded is returned for files above the limits set with
+// WithMaxAtomSize or WithMaxTableEntries.
+var ErrLimitsExceeded = errors.New("mp4: limits exceeded")
+
+// cookieSize is the size of a bare ALACSpecificConfig.
+const cookieSize = 24
+
+// File is the ALAC track of an MP4 file. Its ReadFrame makes it an
+// alac.FrameReader.
+type File struct {
+	r          io.ReadSeeker
+	pos        int64 // of r, -1 when unknown
+	cookie     []byte
+	sampleRate int
+	channels   int
+	sampleSize int
+	frameSize  int
+	timescale  int
+	skip       int64 // samples of the edit, see Trim
+	length     int64
+	table      *table
+	lenient    bool
+	limits     limits
+	damage     *DamageError // for ReadFrame, see WithLenient
+	tracks     []Track
+	track      int        // index of the track of the File in tracks
+	frag       *fragments // of fragmented streams, still to read
+	buf        []byte     // of the frames of ReadFrame
+	bufAt      int64      // offset of buf
+	next       int        // frame for ReadFrame
+}
+
+// Open reads the header of the MP4 file from r, from the current position,
+// and returns its first ALAC track, or the one of WithTrack. Only the 'moov' atom with the sample
+// tables is read into memory: ReadFrame reads the frames from r as they
+// are needed, so r belongs to the File. See OpenReader for streams which
+// can't seek.
+func Open(r io.ReadSeeker, opts ...Option) (*File, error) {
+	return open(r, nil, opts)
+}
+
+// open reads the top level atoms of the file until it has the sample
+// tables. For a stream it stops at the 'mdat' atom after the 'moov' atom,
+// or after the 'moov' atom which follows the 'mdat' atom, which the stream
+// keeps then. Fragmented files are read up to their first fragment, and
+// the fragments of streams are read as ReadFrame gets to them.
+func open(r io.ReadSeeker, stream *progressive, opts []Option) (*File, error) {
+	var (
+		f    *File
+		mdat []extent // of the content of the mdat atoms
+		o    options
+	)
+	for _, opt := range opts {
+		opt(&o)
+	}
+	end := int64(math.MaxInt64) // of the file, for lenient Files
+	if o.lenient && stream == nil {
+		here, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		if end, err = r.Seek(0, io.SeekEnd); err != nil {
+			return nil, err
+		}
+		if _, err := r.Seek(here, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+top:
+	for {
+		offset, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		typ, hdr, size, err := readHeader(r)
+		if err == io.EOF || err != nil && o.lenient && f != nil {
+			break // what follows the moov atom of lenient Files doesn't matter
+		}
+		if err != nil {
+			return nil, err
+		}
+		start := offset + int64(hdr)
+		if stream != nil && typ == "mdat" && f != nil {
+			// the frames follow, up to the end of the stream
+			mdat = append(mdat, extent{start, math.MaxInt64})
+			break top
+		}
+		if size < 0 {
+			if stream != nil {
+				return nil, fmt.Errorf("%w: %q atom of a stream goes on until its end", ErrFormat, typ)
+			}
+			end, err := r.Seek(0, io.SeekEnd)
+			if err != nil {
+				return nil, err
+			}
+			size = end - start
+			if _, err := r.Seek(start, io.SeekStart); err != nil {
+				return nil, err
+			}
+		}
+		switch typ {
+		case "moov":
+			if err := o.limits.atom("'moov' atom", size); err != nil {
+				return nil, err
+			}
+			moov, err := readAtom(r, typ, size)
+			if err != nil {
+				return nil, err
+			}
+			if f, err = track(moov, o); err != nil {
+				return nil, err
+			}
+			if stream != nil {
+				stream.keep = false
+				if mdat != nil {
+					break top
+				}
+			}
+			continue
+		case "moof":
+			if f == nil || f.frag == nil {
+				return nil, fmt.Errorf("%w: fragment of a file which isn't fragmented", ErrFormat)
+			}
+			if err := f.readFragment(r, offset, size, stream != nil); err != nil {
+				if err := f.damaged(f.table.n, err); err != nil {
+					return nil, err
+				}
+				break top
+			}
+			if stream != nil {
+				// the rest goes as ReadFrame gets to it
+				break top
+			}
+			continue
+		case "mdat":
+			mdat = append(mdat, extent{start, min(start+size, end)})
+			if stream != nil && !stream.keep {
+				if err := o.limits.atom("'mdat' atom before the 'moov' atom", size); err != nil {
+					return nil, err
+				}
+				stream.keepFrom(start)
+			}
+		}
+		if _, err := r.Seek(size, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+	}
+	if f == nil {
+		return nil, fmt.Errorf("%w: no moov atom", ErrFormat)
+	}
+	if f.frag == nil && mdat == nil {
+		return nil, fmt.Errorf("%w: no mdat atom", ErrFormat)
+	}
+	if f.frag != nil && (stream == nil || f.frag.next == 0) {
+		f.frag = nil // all read, or no fragments at all
+	}
+	if f.frag == nil {
+		// readFragment checks the frames of the fragments of streams
+		for i := range f.table.n {
+			if !inside(mdat, f.table.offset(i), f.table.size(i)) {
+				if err := f.damaged(i, fmt.Errorf("%w: frame %d is outside of the mdat atoms", ErrFormat, i)); err != nil {
+					return nil, err
+				}
+				break
+			}
+		}
+	}
+	f.r, f.pos = r, -1
+	return f, nil
+}
+
+// track returns the File of the ALAC track of moov of the options.
+func track(moov []byte, o options) (*File, error) {
+	f, trak, err := findTrack(moov, o.track)
+	if err != nil {
+		return nil, err
+	}
+	stbl, err := find(trak, "mdia", "minf", "stbl")
+	if err != nil {
+		return nil, err
+	}
+	f.lenient, f.limits = o.lenient, o.limits
+	if f.table, err = sampleTable(stbl, o.limits); err != nil {
+		if f.table == nil {
+			return nil, err
+		}
+		if err := f.damaged(f.table.n, err); err != nil {
+			return nil, err
+		}
+	}
+	if err := f.table.addTimes(stbl); err != nil {
+		if !f.lenient {
+			return nil, err
+		}
+		if f.table.runs == nil {
+			f.table.runs = []run{{0, 0, uint32(f.frameSize)}}
+		}
+	}
+	mdhd, err := find(trak, "mdia", "mdhd")
+	if err != nil {
+		return nil, err
+	}
+	if f.timescale, err = timescale(mdhd); err != nil {
+		return nil, err
+	}
+	if f.timescale == 0 {
+		f.timescale = f.sampleRate
+	}
+	if f.timescale == 0 {
+		return nil, fmt.Errorf("%w: no timescale", ErrFormat)
+	}
+	mvex, err := find(moov, "mvex")
+	if err != nil {
+		return nil, err
+	}
+	if mvex != nil && f.damage == nil {
+		if f.frag, err = newFragments(f.Track().ID, mvex); err != nil {
+			return nil, err
+		}
+		if f.frag.total, err = fragmentDuration(moov, mvex, f.timescale); err != nil {
+			return nil, err
+		}
+		if n := f.table.n; n > 0 {
+			// the fragments follow the frames of the moov atom
+			r := f.table.runs[len(f.table.runs)-1]
+			f.frag.time = r.time + int64(n-r.first)*int64(r.duration)
+		}
+	}
+	if f.skip, f.length, err = edit(moov, trak, f.timescale); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// readAtom reads the content of an atom of size bytes from r. Large atoms
+// are read as they come, so an atom which claims to be larger than the
+// file fails with ErrFormat instead of taking all memory.
+func readAtom(r io.Reader, typ string, size int64) ([]byte, error) {
+	if size <= 1<<20 {
+		b := make([]byte, size)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, fmt.Errorf("%w: %q atom: %w", ErrFormat, typ, err)
+		}
+		return b, nil
+	}
+	b, err := io.ReadAll(io.LimitReader(r, size))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) < size {
+		return nil, fmt.Errorf("%w: %q atom: %w", ErrFormat, typ, io.ErrUnexpectedEOF)
+	}
+	return b, nil
+}
+
+// fits is whether b has room for n entries of size bytes.
+func fits(b []byte, n uint32, size int) bool {
+	return uint64(len(b)) >= uint64(n)*uint64(size)
+}
+
+// extent is a range of bytes of the file.
+type extent struct {
+	start, end int64
+}
+
+// inside is whether the size bytes at offset are in one of the extents.
+func inside(extents []extent, offset int64, size uint32) bool {
+	for _, e := range extents {
+		if offset >= e.start && offset+int64(size) <= e.end {
+			return true
+		}
+	}
+	return false
+}
+
+// readHeader reads an atom header, and returns the type of the atom, the
+// size of the header, and the size of the content, which is -1 for atoms
+// which go on until the end of the file.
+func readHeader(r io.Reader) (string, int, int64, error) {
+	var b [16]byte
+	if _, err := io.ReadFull(r, b[:8]); err != nil {
+		return "", 0, 0, err
+	}
+	typ := string(b[4:8])
+	switch size := int64(binary.BigEndian.Uint32(b[:])); size {
+	case 0:
+		return typ, 8, -1, nil
+	case 1:
+		if _, err := io.ReadFull(r, b[8:]); err != nil {
+			return "", 0, 0, fmt.Errorf("%w: %q atom: %w", ErrFormat, typ, err)
+		}
+		size := int64(binary.BigEndian.Uint64(b[8:]))
+		if size < 16 {
+			return "", 0, 0, fmt.Errorf("%w: %q atom of %d bytes", ErrFormat, typ, size)
+		}
+		return typ, 16, size - 16, nil
+	default:
+		if size < 8 {
+			return "", 0, 0, fmt.Errorf("%w: %q atom of %d bytes", ErrFormat, typ, size)
+		}
+		return typ, 8, size - 8, nil
+	}
+}
+
+// atoms calls fn with the type and the content of every atom in b, until
+// fn returns false. It fails with ErrFormat for atoms which don't fit.
+func atoms(b []byte, fn func(typ string, content []byte) bool) error {
+	for len(b) > 0 {
+		if len(b) < 8 {
+			return fmt.Errorf("%w: %d bytes after the last atom", ErrFormat, len(b))
+		}
+		var (
+			typ  = string(b[4:8])
+			size = uint64(binary.BigEndian.Uint32(b))
+			hdr  = uint64(8)
+		)
+		switch size {
+		case 0:
+			size = uint64(len(b))
+		case 1:
+			if len(b) < 16 {
+				return fmt.Errorf("%w: %q atom is cut short", ErrFormat, typ)
+			}
+			size, hdr = binary.BigEndian.Uint64(b[8:]), 16
+		}
+		if size < hdr || size > uint64(len(b)) {
+			return fmt.Errorf("%w: %q atom of %d bytes in %d", ErrFormat, typ, size, len(b))
+		}
+		if !fn(typ, b[hdr:size]) {
+			return nil
+		}
+		b = b[size:]
+	}
+	return nil
+}
+
+// find returns the content of the first atom at the path in b, or nil.
+func find(b []byte, path ...string) ([]byte, error) {
+	for _, name := range path {
+		var found []byte
+		err := atoms(b, func(typ string, content []byte) bool {
+			if typ == name {
+				found = content
+				return false
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		if found == nil {
+			return nil, nil
+		}
+		b = found
+	}
+	return b, nil
+}
+
+// sampleEntry returns the File of the 'alac' sample entry of stbl, or nil
+// if it has none.
+func sampleEntry(stbl []byte) (*File, error) {
+	stsd, err := find(stbl, "stsd")
+	if err != nil || len(stsd) < 8 {
+		return nil, err
+	}
+	entry, err := find(stsd[8:], "alac") // after the version, flags, and count
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	s, err := soundDescription(entry)
+	if err != nil {
+		return nil, err
+	}
+	a, err := find(s.atoms, "alac")
+	if err == nil && a == nil {
+		// QuickTime files have it in a 'wave' atom
+		a, err = find(s.atoms, "wave", "alac")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(a) < 4+cookieSize {
+		return nil, fmt.Errorf("%w: 'alac' atom of %d bytes", ErrFormat, len(a))
+	}
+	return newFile(a[4:]), nil // after the version and flags
+}
+
+// newFile returns the File of a magic cookie, of at least cookieSize
+// bytes.
+func newFile(cookie []byte) *File {
+	return &File{
+		cookie:     bytes.Clone(cookie), // of its own, for MagicCookie
+		frameSize:  int(binary.BigEndian.Uint32(cookie)),
+		sampleSize: int(cookie[5]),
+		channels:   int(cookie[9]),
+		sampleRate: int(binary.BigEndian.Uint32(cookie[20:])),
+	}
+}
+
+// sampleTable returns the table of the 'stsz', 'stsc', and 'stco' or
+// 'co64' atoms of stbl, without times. For tables which are cut short, or
+// don't add up, it returns the frames they have with the error. Tables
+// above the limits fail with ErrLimitsExceeded.
+func sampleTable(stbl []byte, l limits) (*table, error) {
+	var tables [4][]byte
+	for i, name := range []string{"stsz", "stsc", "stco", "co64"} {
+		t, err := find(stbl, name)
+		if err != nil {
+			return nil, err
+		}
+		tables[i] = t
+	}
+	stsz, stsc, stco, co64 := tables[0], tables[1], tables[2], tables[3]
+	if stsz == nil || stsc == nil || stco == nil && co64 == nil {
+		return nil, fmt.Errorf("%w: no sample table", ErrFormat)
+	}
+
+	// stsz: version and flags(4) sampleSize(4) sampleCount(4) sizes(4 each)
+	if len(stsz) < 12 {
+		return nil, fmt.Errorf("%w: 'stsz' atom of %d bytes", ErrFormat, len(stsz))
+	}
+	var (
+		be     = binary.BigEndian
+		fixed  = be.Uint32(stsz[4:])
+		n      = be.Uint32(stsz[8:])
+		damage error
+	)
+	if uint64(n) > math.MaxInt {
+		return nil, fmt.Errorf("%w: 'stsz' atom of %d sizes", ErrFormat, n)
+	}
+	if err := l.table("'stsz' atom", uint64(n)); err != nil {
+		return nil, err
+	}
+	count := int(n)
+	if fixed == 0 && !fits(stsz[12:], n, 4) {
+		damage = fmt.Errorf("%w: 'stsz' atom of %d bytes for %d sizes", ErrFormat, len(stsz), n)
+		count = (len(stsz) - 12) / 4
+	}
+
+	// stco: version and flags(4) count(4) offsets(4 each), co64 has 8 byte
+	// offsets
+	offsets, width := stco, 4
+	if offsets == nil {
+		offsets, width = co64, 8
+	}
+	if len(offsets) < 8 {
+		return nil, fmt.Errorf("%w: chunk offset atom of %d bytes", ErrFormat, len(offsets))
+	}
+	if err := l.table("chunk offset atom", uint64(be.Uint32(offsets[4:]))); err != nil {
+		return nil, err
+	}
+	chunks := int(be.Uint32(offsets[4:]))
+	if n := be.Uint32(offsets[4:]); !fits(offsets[8:], n, width) {
+		damage = cmp.Or(damage, fmt.Errorf("%w: chunk offset atom of %d bytes for %d chunks", ErrFormat, len(offsets), n))
+		chunks = (len(offsets) - 8) / width
+	}
+
+	// stsc: version and flags(4) count(4) entries of firstChunk(4)
+	// samplesPerChunk(4) sampleDescriptionIndex(4)
+	if len(stsc) < 8 {
+		return nil, fmt.Errorf("%w: 'stsc' atom of %d bytes", ErrFormat, len(stsc))
+	}
+	if err := l.table("'stsc' atom", uint64(be.Uint32(stsc[4:]))); err != nil {
+		return nil, err
+	}
+	entries := int(be.Uint32(stsc[4:]))
+	if n := be.Uint32(stsc[4:]); !fits(stsc[8:], n, 12) {
+		damage = cmp.Or(damage, fmt.Errorf("%w: 'stsc' atom of %d bytes for %d entries", ErrFormat, len(stsc), n))
+		entries = (len(stsc) - 8) / 12
+	}
+
+	t := &table{n: count, fixed: fixed, chunks: make([]chunk, 0, min(chunks, count))}
+	if fixed == 0 {
+		t.sizes = stsz[12 : 12+4*count : 12+4*count] // appends don't go into moov
+	}
+	frames := 0
+	for c, e := 0, 0; c < chunks && frames < count; c++ {
+		for e+1 < entries && int64(be.Uint32(stsc[8+12*(e+1):])) <= int64(c)+1 {
+			e++
+		}
+		per := int64(0)
+		if entries > 0 {
+			per = int64(be.Uint32(stsc[8+12*e+4:]))
+		}
+		if per == 0 {
+			continue
+		}
+		var offset int64
+		if width == 4 {
+			offset = int64(be.Uint32(offsets[8+4*c:]))
+		} else {
+			offset = int64(be.Uint64(offsets[8+8*c:]))
+		}
+		t.chunks = append(t.chunks, chunk{frames, offset})
+		frames += int(min(per, int64(count-frames)))
+	}
+	if frames < count {
+		damage = cmp.Or(damage, fmt.Errorf("%w: %d of %d frames are in chunks", ErrFormat, frames, count))
+		t.n = frames
+	}
+	return t, damage
+}
+
+// MagicCookie returns the ALACSpecificConfig of the track, with the
+// channel layout which follows it, if any. alac.NewFromMagicCookie takes
+// it as it is.
+func (f *File) MagicCookie() []byte {
+	return f.cookie
+}
+
+// SpecificConfig returns the bare 24 byte ALACSpecificConfig of the track,
+// byte for byte as in its 'alac' atom, to pass on as it is, such as to an
+// AirPlay receiver or another muxer.
+func (f *File) SpecificConfig() []byte {
+	return f.cookie[:cookieSize:cookieSize]
+}
+
+// SampleRate returns the sample rate of the track, from its magic cookie.
+func (f *File) SampleRate() int {
+	return f.sampleRate
+}
+
+// Channels returns the number of channels of the track.
+func (f *File) Channels() int {
+	return f.channels
+}
+
+// SampleSize returns the bit depth of the track.
+func (f *File) SampleSize() int {
+	return f.sampleSize
+}
+
+// FrameSize returns the samples per channel of the frames of the track;
+// the last frame can be shorter.
+func (f *File) FrameSize() int {
+	return f.frameSize
+}
+
+// Frames returns the number of frames of the track. For fragmented files
+// from OpenReader it's the frames of the fragments read so far.
+func (f *File) Frames() int {
+	return f.table.n
+}
+
+// ReadFrame reads the next frame of the track from r, and returns io.EOF
+// after the last one. The frame is only valid until the next call, which
+// reuses its buffer. The frames of a chunk are read at once, up to
+// readAhead bytes of them, so there is a read for every chunk instead of
+// every frame.
+func (f *File) ReadFrame() ([]byte, error) {
+	for f.next >= f.table.n {
+		if f.damage != nil {
+			return nil, f.damage
+		}
+		if f.frag == nil {
+			return nil, io.EOF
+		}
+		if err := f.nextFragment(); err != nil && (err == io.EOF || f.damaged(f.table.n, err) != nil) {
+			return nil, err
+		}
+	}
+	var (
+		offset = f.table.offset(f.next)
+		size   = f.table.size(f.next)
+	)
+	if err := f.limits.atom(fmt.Sprintf("frame %d", f.next), int64(size)); err != nil {
+		return nil, err
+	}
+	if i := offset - f.bufAt; i < 0 || i+int64(size) > int64(len(f.buf)) {
+		if err := f.readChunk(offset, size); err != nil {
+			err = fmt.Errorf("mp4: frame %d: %w", f.next, err)
+			if cut(err) && f.damaged(f.next, err) == nil {
+				return nil, f.damage
+			}
+			return nil, err
+		}
+	}
+	i := offset - f.bufAt
+	f.next++
+	return f.buf[i : i+int64(size)], nil
+}
+
+// readAhead is the most ReadFrame reads at once, unless a frame is larger.
+const readAhead = 1 << 20
+
+// readChunk reads the frames of the chunk of frame f.next, from the frame
+// at offset of size bytes on, into buf. What buf has of them already, after
+// a read which was cut short, is kept, so streams don't have to go back.
+func (f *File) readChunk(offset int64, size uint32) error {
+	var (
+		end = f.table.chunkEnd(f.next)
+		n   = int64(size)
+	)
+	for i := f.next + 1; i < end && n+int64(f.table.size(i)) <= readAhead; i++ {
+		n += int64(f.table.size(i))
+	}
+	buf := f.buf
+	if n > int64(cap(buf)) {
+		buf = make([]byte, n)
+	}
+	keep := 0
+	if i := offset - f.bufAt; i >= 0 && i < int64(len(f.buf)) && f.pos == f.bufAt+int64(len(f.buf)) {
+		keep = copy(buf, f.buf[i:])
+	}
+	f.buf, f.bufAt = buf[:n], offset
+	if at := offset + int64(keep); f.pos != at {
+		f.pos = -1
+		if _, err := f.r.Seek(at, io.SeekStart); err != nil {
+			f.buf = nil
+			return err
+		}
+	}
+	read, err := io.ReadFull(f.r, f.buf[keep:])
+	read += keep
+	f.buf, f.pos = f.buf[:read], offset+int64(read)
+	if read >= int(size) {
+		return nil // the frames which are cut short fail when ReadFrame gets to them
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
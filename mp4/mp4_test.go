@@ -0,0 +1,276 @@
+package mp4
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/alac"
+	"github.com/alicebob/alac/alacm4a"
+)
+
+// wavPCM returns the PCM of a sample WAV file.
+func wavPCM(t testing.TB, name string) []byte {
+	t.Helper()
+	wav, err := os.ReadFile("../testdata/samples/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wav[bytes.Index(wav, []byte("data"))+8:]
+}
+
+// encodeM4A returns an M4A file of pcm, made by alacm4a.
+func encodeM4A(t testing.TB, pcm []byte, cfg alac.Config, opts ...alac.EncoderOption) []byte {
+	t.Helper()
+	f, err := os.Create(t.TempDir() + "/out.m4a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := alacm4a.Encode(f, bytes.NewReader(pcm), cfg, opts...); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// sample is a frame of the table of a File.
+type sample struct {
+	offset, time   int64
+	size, duration uint32
+}
+
+// samples returns the frames of the table of f.
+func samples(f *File) []sample {
+	var s []sample
+	for i := range f.table.n {
+		ts, duration := f.table.time(i)
+		s = append(s, sample{f.table.offset(i), ts, f.table.size(i), duration})
+	}
+	return s
+}
+
+// mustDecoder returns a strict decoder of the track of f.
+func mustDecoder(t testing.TB, f *File) *alac.Alac {
+	t.Helper()
+	dec, err := alac.NewFromMagicCookie(f.MagicCookie(), alac.WithStrict())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dec
+}
+
+// decode decodes all frames of f.
+func decode(t testing.TB, f *File) []byte {
+	t.Helper()
+	pcm, err := io.ReadAll(alac.NewPCMReader(mustDecoder(t, f), f))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pcm
+}
+
+func TestOpen(t *testing.T) {
+	pcm := wavPCM(t, "jane_eyre_5s.wav")
+	for _, c := range []struct {
+		cfg alac.Config
+		pcm []byte
+	}{
+		{alac.DefaultConfig(), pcm},
+		{alac.Config{SampleRate: 44100, SampleSize: 16, NumChannels: 2, FrameSize: 4096}, pcm},
+		{alac.Config{SampleRate: 96000, SampleSize: 16, NumChannels: 1, FrameSize: 4096}, pcm[:100000]},
+		{alac.DefaultConfig(), nil},
+	} {
+		file := encodeM4A(t, c.pcm, c.cfg)
+		f, err := Open(bytes.NewReader(file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := f.SampleRate(), c.cfg.SampleRate; have != want {
+			t.Errorf("have %d, want %d", have, want)
+		}
+		if have, want := f.Channels(), c.cfg.NumChannels; have != want {
+			t.Errorf("have %d, want %d", have, want)
+		}
+		if have, want := f.SampleSize(), c.cfg.SampleSize; have != want {
+			t.Errorf("have %d, want %d", have, want)
+		}
+		if have, want := f.FrameSize(), c.cfg.FrameSize; have != want {
+			t.Errorf("have %d, want %d", have, want)
+		}
+		frameBytes := c.cfg.FrameSize * c.cfg.NumChannels * 2
+		if have, want := f.Frames(), (len(c.pcm)+frameBytes-1)/frameBytes; have != want {
+			t.Errorf("have %d frames, want %d", have, want)
+		}
+		if atom := append([]byte("alac\x00\x00\x00\x00"), f.SpecificConfig()...); !bytes.Contains(file, atom) {
+			t.Errorf("have %x, which isn't in the file", f.SpecificConfig())
+		}
+		if have, want := len(f.SpecificConfig()), 24; have != want {
+			t.Errorf("have %d, want %d", have, want)
+		}
+		if have, want := f.Timescale(), c.cfg.SampleRate; have != want {
+			t.Errorf("have %d, want %d", have, want)
+		}
+		var (
+			rate = time.Duration(c.cfg.SampleRate)
+			end  = time.Duration(len(c.pcm)/(2*c.cfg.NumChannels)) * time.Second / rate
+		)
+		for i := range f.Frames() {
+			start, duration := f.FrameTime(i)
+			if have, want := start, time.Duration(i*c.cfg.FrameSize)*time.Second/rate; have != want {
+				t.Fatalf("frame %d: have %v, want %v", i, have, want)
+			}
+			if have, want := duration, time.Duration(c.cfg.FrameSize)*time.Second/rate; have > want {
+				t.Fatalf("frame %d: have %v, want at most %v", i, have, want)
+			}
+		}
+		if have := decode(t, f); !bytes.Equal(have, c.pcm) {
+			t.Errorf("have %d bytes, want %d", len(have), len(c.pcm))
+		}
+		if _, err := f.ReadFrame(); err != io.EOF {
+			t.Errorf("have %v, want %v", err, io.EOF)
+		}
+		if n := f.Frames(); n > 0 {
+			start, _ := f.FrameTime(n / 2)
+			if i, err := f.SeekTime(start); err != nil || i != n/2 {
+				t.Errorf("have %d, %v, want %d", i, err, n/2)
+			}
+		}
+		if i, err := f.SeekTime(end + time.Millisecond); err != nil || i != f.Frames() {
+			t.Errorf("have %d, %v, want %d", i, err, f.Frames())
+		}
+		if _, err := f.ReadFrame(); err != io.EOF {
+			t.Errorf("have %v, want %v", err, io.EOF)
+		}
+	}
+
+	t.Run("streaming", func(t *testing.T) {
+		file := encodeM4A(t, pcm, alac.DefaultConfig())
+		r := &countingReader{r: bytes.NewReader(file)}
+		f, err := Open(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := r.n, int64(len(file))/10; have > want {
+			t.Errorf("have %d bytes read by Open, want at most %d", have, want)
+		}
+		r.reads = 0
+		if have := decode(t, f); !bytes.Equal(have, pcm) {
+			t.Errorf("have %d bytes, want %d", len(have), len(pcm))
+		}
+		if have, want := r.reads, len(f.table.chunks)+1; have > want {
+			t.Errorf("have %d reads of %d chunks, want at most %d", have, len(f.table.chunks), want)
+		}
+		if have, want := r.seeks, 3; have > want {
+			t.Errorf("have %d seeks, want at most %d", have, want)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		file := encodeM4A(t, pcm[:40000], alac.DefaultConfig())
+		moov := bytes.Index(file, []byte("moov")) - 4
+		stco := bytes.Index(file, []byte("stco"))
+		badOffset := bytes.Clone(file)
+		badOffset[stco+12] = 0x7f // the first chunk offset
+
+		for name, file := range map[string][]byte{
+			"empty":      nil,
+			"wav":        []byte("RIFF\x00\x00\x00\x00WAVE"),
+			"no moov":    file[:moov],
+			"bad atom":   append(bytes.Clone(file[:moov]), 0, 0, 0, 4, 'f', 'r', 'e', 'e'),
+			"bad offset": badOffset,
+			"not alac":   bytes.Replace(bytes.Clone(file), []byte("alac"), []byte("mp4a"), -1),
+		} {
+			if _, err := Open(bytes.NewReader(file)); !errors.Is(err, ErrFormat) {
+				t.Errorf("%s: have %v, want %v", name, err, ErrFormat)
+			}
+		}
+	})
+}
+
+func TestParallelDecoder(t *testing.T) {
+	// frames larger than the readAhead of ReadFrame, which reuses its buffer
+	var pcm []byte
+	for range 8 {
+		pcm = append(pcm, wavPCM(t, "jane_eyre_5s.wav")...)
+		pcm = append(pcm, wavPCM(t, "monte_cristo_5s.wav")...)
+	}
+	file := encodeM4A(t, pcm, alac.DefaultConfig())
+	serial, err := Open(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := decode(t, serial)
+	if !bytes.Equal(want, pcm) {
+		t.Fatalf("have %d bytes, want %d", len(want), len(pcm))
+	}
+
+	f, err := Open(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := f.Frames() - 1
+	if n := f.table.offset(last) + int64(f.table.size(last)) - f.table.offset(0); n < 2*readAhead {
+		t.Fatalf("have %d bytes of frames, want more than %d", n, 2*readAhead)
+	}
+	var have []byte
+	err = alac.NewParallelDecoder(mustDecoder(t, f), 4).DecodeReader(context.Background(), f, func(b []byte) error {
+		have = append(have, b...)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(have, want) {
+		t.Errorf("have %d bytes, want %d", len(have), len(want))
+	}
+}
+
+// countingReader counts the bytes read, the reads, and the seeks to an
+// offset.
+type countingReader struct {
+	r     io.ReadSeeker
+	n     int64
+	reads int
+	seeks int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	r.reads++
+	return n, err
+}
+
+func (r *countingReader) Seek(offset int64, whence int) (int64, error) {
+	if whence == io.SeekStart {
+		r.seeks++
+	}
+	return r.r.Seek(offset, whence)
+}
+
+// BenchmarkReadHeader is the BenchmarkReadAtomHeader of the M4A reader of
+// the tests of the decoder, which readHeader replaced.
+func BenchmarkReadHeader(b *testing.B) {
+	for name, header := range map[string][]byte{
+		"size":     {0, 0, 0, 16, 'f', 't', 'y', 'p'},
+		"extended": {0, 0, 0, 1, 'm', 'd', 'a', 't', 0, 0, 0, 1, 0, 0, 0, 0},
+	} {
+		b.Run(name, func(b *testing.B) {
+			r := bytes.NewReader(header)
+			for b.Loop() {
+				r.Reset(header)
+				if _, _, _, err := readHeader(r); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
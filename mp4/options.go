@@ -0,0 +1,85 @@
+package mp4
+
+import (
+	"cmp"
+	"fmt"
+)
+
+// Default limits, see WithMaxAtomSize and WithMaxTableEntries.
+const (
+	DefaultMaxAtomSize     = 1 << 26
+	DefaultMaxTableEntries = 1 << 24
+)
+
+// Option is an option of Open and OpenReader.
+type Option func(*options)
+
+type options struct {
+	track   func(Track) bool
+	lenient bool
+	limits  limits
+}
+
+// WithTrack makes Open use the first ALAC track for which fn returns true,
+// such as the one with an ID or a language, instead of the first ALAC
+// track.
+func WithTrack(fn func(Track) bool) Option {
+	return func(o *options) {
+		o.track = fn
+	}
+}
+
+// WithLenient makes Open take damaged files, such as partial downloads,
+// instead of failing with ErrFormat. The frames from the first one which
+// isn't in the file, or which sample tables that don't add up lose, are
+// dropped: ReadFrame returns the frames before the damage, and then a
+// *DamageError instead of io.EOF. Timestamps missing in the tables go on
+// with the duration of the last ones. The 'moov' atom has to be whole.
+func WithLenient() Option {
+	return func(o *options) {
+		o.lenient = true
+	}
+}
+
+// WithMaxAtomSize limits the size of what Open and ReadFrame read into
+// memory: the 'moov' and 'moof' atoms, frames, and the 'mdat' atom which
+// OpenReader keeps until the 'moov' atom after it. Sizes come from the
+// file, so servers reading untrusted files should keep this low. The
+// default is DefaultMaxAtomSize.
+func WithMaxAtomSize(n int64) Option {
+	return func(o *options) {
+		o.limits.atomSize = n
+	}
+}
+
+// WithMaxTableEntries limits the entries of every sample table of the
+// track, such as its frames, which the fragments of fragmented files add
+// up to. A table of frames of the same size takes no room in the file,
+// but does in memory. The default is DefaultMaxTableEntries.
+func WithMaxTableEntries(n int) Option {
+	return func(o *options) {
+		o.limits.entries = n
+	}
+}
+
+// limits are the WithMaxAtomSize and WithMaxTableEntries limits.
+type limits struct {
+	atomSize int64
+	entries  int
+}
+
+// atom refuses what of size bytes above the WithMaxAtomSize limit.
+func (l limits) atom(what string, size int64) error {
+	if limit := cmp.Or(l.atomSize, DefaultMaxAtomSize); size > limit {
+		return fmt.Errorf("%w: %s of %d bytes, the limit is %d", ErrLimitsExceeded, what, size, limit)
+	}
+	return nil
+}
+
+// table refuses tables of n entries above the WithMaxTableEntries limit.
+func (l limits) table(what string, n uint64) error {
+	if limit := cmp.Or(l.entries, DefaultMaxTableEntries); n > uint64(limit) {
+		return fmt.Errorf("%w: %s of %d entries, the limit is %d", ErrLimitsExceeded, what, n, limit)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/alicebob/alac"
+)
+
+func TestLimits(t *testing.T) {
+	var (
+		pcm  = wavPCM(t, "jane_eyre_5s.wav")
+		file = encodeM4A(t, pcm, alac.DefaultConfig())
+		moov = int64(binary.BigEndian.Uint32(file[bytes.Index(file, []byte("moov"))-4:]))
+	)
+	f, err := Open(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames := f.Frames()
+
+	for name, c := range map[string]struct {
+		file   []byte
+		stream bool
+		opt    Option
+	}{
+		"moov":          {file, false, WithMaxAtomSize(moov - 9)},
+		"frames":        {file, false, WithMaxTableEntries(frames - 1)},
+		"kept mdat":     {file, true, WithMaxAtomSize(moov)},
+		"fragments":     {fragment(t, file, 100), false, WithMaxTableEntries(frames - 1)},
+		"fragment moof": {fragment(t, file, 100), true, WithMaxAtomSize(100)},
+	} {
+		if c.stream {
+			_, err = OpenReader(bytes.NewReader(c.file), c.opt)
+		} else {
+			_, err = Open(bytes.NewReader(c.file), c.opt)
+		}
+		if !errors.Is(err, ErrLimitsExceeded) {
+			t.Errorf("%s: have %v, want %v", name, err, ErrLimitsExceeded)
+		}
+	}
+
+	f, err = Open(bytes.NewReader(file), WithMaxAtomSize(moov), WithMaxTableEntries(frames))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have := decode(t, f); !bytes.Equal(have, pcm) {
+		t.Errorf("have %d bytes, want %d", len(have), len(pcm))
+	}
+}
@@ -0,0 +1,238 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Splitter returns the function which returns the length of the ALAC
+// frame at the start of data, for a magic cookie. The FrameLength of an
+// alac decoder of the cookie is such a function, see Salvage.
+type Splitter func(cookie []byte) (func(data []byte) (int, error), error)
+
+// salvageSync is the number of frames in a row which a found frame has to
+// start, after damage, so random data which happens to parse as a frame
+// isn't taken as one.
+const salvageSync = 4
+
+// Salvage returns the ALAC frames in the 'mdat' atoms of an MP4 file of
+// which the 'moov' atom is lost or useless, such as an interrupted
+// recording or a corrupt download. Without the sample tables there is no
+// index of the frames, so Salvage scans the 'mdat' atoms for them, from
+// where a frame ends to the next place which reads as a run of frames.
+// Data after a damaged atom header is scanned like an 'mdat' atom.
+//
+// split reads frames: the FrameLength of an alac decoder does.
+//
+//	f, err := mp4.Salvage(r, cookie, func(cookie []byte) (func([]byte) (int, error), error) {
+//		dec, err := alac.NewFromMagicCookie(cookie)
+//		if err != nil {
+//			return nil, err
+//		}
+//		return dec.FrameLength, nil
+//	})
+//
+// The magic cookie is the config of the frames, such as the one of another
+// file of the same recorder. With a nil cookie Salvage tries the usual
+// configs: mono and stereo, of 16, 20, 24, and 32 bits, with frames of
+// 4096 and 352 samples, and takes the one which reads the most frames at
+// the start. Such a guess can't know the sample rate, and says 44100;
+// SampleRate and the timestamps are only right for files of that rate.
+//
+// The frames all have FrameSize samples, as far as the File knows, and it
+// has no Trim. Of the options only the limits apply.
+func Salvage(r io.ReadSeeker, cookie []byte, split Splitter, opts ...Option) (*File, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	mdat, err := salvageExtents(r)
+	if err != nil {
+		return nil, err
+	}
+	if mdat == nil {
+		return nil, fmt.Errorf("%w: no mdat atom", ErrFormat)
+	}
+	s := &scanner{r: r}
+	if cookie == nil {
+		best := 0
+		for _, c := range guessCookies() {
+			length, err := split(c)
+			if err != nil {
+				continue // a config split doesn't take
+			}
+			s.setCookie(c, length)
+			if n := s.run(mdat[0], mdat[0].start, 32); n > best {
+				best, cookie = n, c
+			}
+		}
+		if best == 0 {
+			return nil, fmt.Errorf("%w: no ALAC frames of a config Salvage knows", ErrFormat)
+		}
+	}
+	if len(cookie) < cookieSize {
+		return nil, fmt.Errorf("%w: magic cookie of %d bytes", ErrFormat, len(cookie))
+	}
+	length, err := split(cookie)
+	if err != nil {
+		return nil, err
+	}
+	s.setCookie(cookie, length)
+
+	f := newFile(cookie)
+	f.r, f.pos = r, -1
+	f.timescale, f.length = f.sampleRate, -1
+	f.limits = o.limits
+	f.tracks = []Track{{ID: 1, Handler: "soun", Codec: "alac", Language: "und", SampleRate: f.sampleRate, Channels: f.channels}}
+	f.table = &table{}
+	for _, e := range mdat {
+		synced := false
+		for offset := e.start; offset < e.end; {
+			n, ok := s.frame(e, offset)
+			if ok && !synced {
+				ok = s.run(e, offset, salvageSync) == salvageSync
+			}
+			if !ok {
+				offset++
+				synced = false
+				continue
+			}
+			if err := f.limits.table("salvaged frames", uint64(f.table.n)+1); err != nil {
+				return nil, err
+			}
+			if !synced {
+				f.table.chunks = append(f.table.chunks, chunk{f.table.n, offset})
+			}
+			f.table.add(uint32(n), int64(f.table.n)*int64(f.frameSize), uint32(f.frameSize), 0)
+			offset += int64(n)
+			synced = true
+		}
+	}
+	if f.table.n == 0 {
+		return nil, fmt.Errorf("%w: no ALAC frames in the mdat atoms", ErrFormat)
+	}
+	return f, nil
+}
+
+// salvageExtents returns the content of the 'mdat' atoms of r, from its
+// current position. Where the atoms don't add up the rest of the file
+// counts as an 'mdat' atom.
+func salvageExtents(r io.ReadSeeker) ([]extent, error) {
+	here, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	var mdat []extent
+	for offset := here; offset < end; {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		typ, hdr, size, err := readHeader(r)
+		if size < 0 {
+			size = end - offset - int64(hdr)
+		}
+		start := offset + int64(hdr)
+		if err != nil || start+size > end && typ != "mdat" {
+			// damage, or an 'mdat' atom of which the size wasn't written
+			return append(mdat, extent{offset, end}), nil
+		}
+		if typ == "mdat" {
+			mdat = append(mdat, extent{start, min(start+size, end)})
+		}
+		offset = start + size
+	}
+	return mdat, nil
+}
+
+// guessCookies returns the magic cookies of the configs of Salvage without
+// one.
+func guessCookies() [][]byte {
+	var cookies [][]byte
+	for _, frameSize := range []uint32{4096, 352} {
+		for _, channels := range []byte{2, 1} {
+			for _, bits := range []byte{16, 24, 20, 32} {
+				// frameLength(4) compatibleVersion(1) bitDepth(1) pb(1)
+				// mb(1) kb(1) numChannels(1) maxRun(2) maxFrameBytes(4)
+				// avgBitRate(4) sampleRate(4), with the defaults of
+				// Apple's encoder
+				c := binary.BigEndian.AppendUint32(nil, frameSize)
+				c = append(c, 0, bits, 40, 10, 14, channels, 0, 255)
+				c = append(c, make([]byte, 8)...)
+				cookies = append(cookies, binary.BigEndian.AppendUint32(c, 44100))
+			}
+		}
+	}
+	return cookies
+}
+
+// scanner reads the data of frames from r, through a window large enough
+// for any frame of its cookie.
+type scanner struct {
+	r      io.ReadSeeker
+	length func([]byte) (int, error)
+	window int
+	buf    []byte
+	base   int64 // offset of buf
+}
+
+// setCookie makes the scanner read frames of the cookie.
+func (s *scanner) setCookie(cookie []byte, length func([]byte) (int, error)) {
+	var (
+		frameSize = int(binary.BigEndian.Uint32(cookie))
+		bits      = int(cookie[5])
+		channels  = int(cookie[9])
+	)
+	// the largest frame is an escape frame, of all samples as they are,
+	// after a header of a few bytes for every channel pair
+	s.length, s.window = length, frameSize*channels*(bits+7)/8+16*channels+16
+}
+
+// frame returns the length of the frame at offset in e, if there is one.
+func (s *scanner) frame(e extent, offset int64) (int, bool) {
+	data, err := s.at(e, offset)
+	if err != nil || len(data) == 0 {
+		return 0, false
+	}
+	n, err := s.length(data)
+	return n, err == nil && n > 0 && n <= len(data)
+}
+
+// run returns the number of frames in a row from offset in e, up to n.
+// The end of e counts as frames which go on.
+func (s *scanner) run(e extent, offset int64, n int) int {
+	for i := range n {
+		if offset >= e.end {
+			return n
+		}
+		size, ok := s.frame(e, offset)
+		if !ok {
+			return i
+		}
+		offset += int64(size)
+	}
+	return n
+}
+
+// at returns the data of e from offset on, up to the window size.
+func (s *scanner) at(e extent, offset int64) ([]byte, error) {
+	want := min(int64(s.window), e.end-offset)
+	if i := offset - s.base; i >= 0 && i+want <= int64(len(s.buf)) {
+		return s.buf[i : i+want], nil
+	}
+	if _, err := s.r.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(s.buf[:0])
+	_, err := io.CopyN(buf, s.r, min(int64(4*s.window), e.end-offset))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	s.buf, s.base = buf.Bytes(), offset
+	return s.buf[:min(int64(len(s.buf)), want)], nil
+}
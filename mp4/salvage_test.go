@@ -0,0 +1,76 @@
+package mp4
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/alicebob/alac"
+)
+
+// split is the Splitter of alac decoders.
+func split(cookie []byte) (func([]byte) (int, error), error) {
+	dec, err := alac.NewFromMagicCookie(cookie)
+	if err != nil {
+		return nil, err
+	}
+	return dec.FrameLength, nil
+}
+
+func TestSalvage(t *testing.T) {
+	var (
+		pcm  = wavPCM(t, "jane_eyre_5s.wav")
+		cfg  = alac.Config{SampleRate: 44100, SampleSize: 16, NumChannels: 2, FrameSize: 4096}
+		file = encodeM4A(t, pcm, cfg)
+		moov = bytes.Index(file, []byte("moov")) - 4
+	)
+	orig, err := Open(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		frames = samples(orig)
+		lost   = bytes.Clone(file[:moov]) // without its moov atom
+		mid    = frames[len(frames)/2]
+	)
+	damaged := bytes.Clone(lost)
+	copy(damaged[mid.offset+10:], bytes.Repeat([]byte{0x5a}, 300))
+
+	for name, c := range map[string]struct {
+		file   []byte
+		cookie []byte
+		lost   int // frames
+	}{
+		"cookie":  {lost, orig.MagicCookie(), 0},
+		"guess":   {lost, nil, 0},
+		"damaged": {damaged, nil, 1},
+	} {
+		f, err := Salvage(bytes.NewReader(c.file), c.cookie, split)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if have, want := f.Frames(), len(frames)-c.lost; have != want {
+			t.Errorf("%s: have %d frames, want %d", name, have, want)
+		}
+		if have, want := f.SampleRate(), 44100; have != want {
+			t.Errorf("%s: have %d, want %d", name, have, want)
+		}
+		if have, want := f.FrameSize(), cfg.FrameSize; have != want {
+			t.Errorf("%s: have %d, want %d", name, have, want)
+		}
+		have := decode(t, f)
+		if c.lost == 0 && !bytes.Equal(have, pcm) {
+			t.Errorf("%s: have %d bytes, want %d", name, len(have), len(pcm))
+		}
+		if frame := cfg.FrameSize * 4; c.lost > 0 && !bytes.Equal(have[:len(frames)/2*frame], pcm[:len(frames)/2*frame]) {
+			t.Errorf("%s: the frames before the damage differ", name)
+		}
+	}
+
+	if _, err := Salvage(bytes.NewReader(bytes.Repeat([]byte{0x5a}, 10000)), nil, split); !errors.Is(err, ErrFormat) {
+		t.Errorf("have %v, want %v", err, ErrFormat)
+	}
+	if _, err := Salvage(bytes.NewReader(lost), nil, split, WithMaxTableEntries(10)); !errors.Is(err, ErrLimitsExceeded) {
+		t.Errorf("have %v, want %v", err, ErrLimitsExceeded)
+	}
+}
@@ -0,0 +1,37 @@
+package mp4
+
+import "time"
+
+// Sample is a frame of the track with what the sample table says about
+// it, as Next returns it.
+type Sample struct {
+	Frame   []byte        // only valid until the next Next or ReadFrame
+	Index   int           // of the frame in the track
+	Samples int           // samples per channel, of the duration of the frame
+	Time    time.Duration // presentation time from the start of the track
+	Offset  int64         // of the frame in the file
+}
+
+// Next is ReadFrame, which also returns where the frame is in the track
+// and in the file. It reads one frame at a time, like ReadFrame, so a
+// pipeline of Next takes the same memory for any length of file, and can
+// stop anywhere. It returns io.EOF after the last frame.
+func (f *File) Next() (Sample, error) {
+	i := f.next
+	frame, err := f.ReadFrame()
+	if err != nil {
+		return Sample{}, err
+	}
+	ts, duration := f.table.time(i)
+	samples := int64(duration)
+	if f.sampleRate > 0 && f.sampleRate != f.timescale {
+		samples = samples * int64(f.sampleRate) / int64(f.timescale)
+	}
+	return Sample{
+		Frame:   frame,
+		Index:   i,
+		Samples: int(samples),
+		Time:    f.duration(ts),
+		Offset:  f.table.offset(i),
+	}, nil
+}
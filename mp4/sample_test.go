@@ -0,0 +1,75 @@
+package mp4
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/alicebob/alac"
+)
+
+func TestNext(t *testing.T) {
+	var (
+		pcm  = wavPCM(t, "jane_eyre_5s.wav")
+		cfg  = alac.DefaultConfig()
+		file = encodeM4A(t, pcm, cfg)
+	)
+	for name, c := range map[string]struct {
+		file   []byte
+		stream bool
+	}{
+		"file":   {file, false},
+		"stream": {fragment(t, file, 100), true},
+	} {
+		var (
+			f   *File
+			err error
+		)
+		if c.stream {
+			f, err = OpenReader(bytes.NewReader(c.file))
+		} else {
+			f, err = Open(bytes.NewReader(c.file))
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		dec := mustDecoder(t, f)
+		var (
+			have    []byte
+			samples int
+		)
+		for i := 0; ; i++ {
+			s, err := f.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if have, want := s.Index, i; have != want {
+				t.Fatalf("%s: have %d, want %d", name, have, want)
+			}
+			if start, _ := f.FrameTime(i); s.Time != start {
+				t.Errorf("%s: frame %d: have %v, want %v", name, i, s.Time, start)
+			}
+			if !bytes.Equal(c.file[s.Offset:s.Offset+int64(len(s.Frame))], s.Frame) {
+				t.Errorf("%s: frame %d isn't at %d", name, i, s.Offset)
+			}
+			pcm, err := dec.DecodeFrame(s.Frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have, want := s.Samples, len(pcm)/4; have != want {
+				t.Errorf("%s: frame %d: have %d samples, want %d", name, i, have, want)
+			}
+			have = append(have, pcm...)
+			samples += s.Samples
+		}
+		if !bytes.Equal(have, pcm) {
+			t.Errorf("%s: have %d bytes, want %d", name, len(have), len(pcm))
+		}
+		if have, want := samples, len(pcm)/4; have != want {
+			t.Errorf("%s: have %d samples, want %d", name, have, want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// sound is what the SoundDescription of a sound sample entry says about
+// its audio.
+type sound struct {
+	channels   int
+	sampleRate int
+	atoms      []byte // after the description, such as the 'alac' atom
+}
+
+// soundDescription reads the SoundDescription at the start of a sound
+// sample entry. MP4 files have version 0, QuickTime files also versions 1
+// and 2, which are longer.
+func soundDescription(entry []byte) (sound, error) {
+	// all versions: reserved(6) dataReferenceIndex(2) version(2)
+	// revision(2) vendor(4)
+	//
+	// version 0: channels(2) sampleSize(2) compressionID(2) packetSize(2)
+	// sampleRate(4), in 16.16 fixed point
+	//
+	// version 1: version 0, and samplesPerPacket(4) bytesPerPacket(4)
+	// bytesPerFrame(4) bytesPerSample(4)
+	//
+	// version 2: always3(2) always16(2) alwaysMinus2(2) always0(2)
+	// always65536(4) sizeOfStructOnly(4) sampleRate(8), a float64,
+	// channels(4) always7F000000(4) bitsPerChannel(4) flags(4)
+	// bytesPerPacket(4) framesPerPacket(4)
+	var (
+		be   = binary.BigEndian
+		size = 28
+	)
+	if len(entry) < 10 {
+		return sound{}, fmt.Errorf("%w: sample entry of %d bytes", ErrFormat, len(entry))
+	}
+	version := be.Uint16(entry[8:])
+	switch version {
+	case 0:
+	case 1:
+		size = 44
+	case 2:
+		size = 64
+	default:
+		return sound{}, fmt.Errorf("%w: sound description version %d", ErrFormat, version)
+	}
+	if len(entry) < size {
+		return sound{}, fmt.Errorf("%w: version %d sample entry of %d bytes", ErrFormat, version, len(entry))
+	}
+	if version == 2 {
+		return sound{
+			channels:   int(be.Uint32(entry[40:])),
+			sampleRate: int(math.Round(math.Float64frombits(be.Uint64(entry[32:])))),
+			atoms:      entry[size:],
+		}, nil
+	}
+	return sound{
+		channels:   int(be.Uint16(entry[16:])),
+		sampleRate: int(be.Uint32(entry[24:]) >> 16),
+		atoms:      entry[size:],
+	}, nil
+}
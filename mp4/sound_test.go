@@ -0,0 +1,83 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/alicebob/alac"
+)
+
+// rewrite returns the atoms of b, with the content of the atom at the path
+// replaced with fn of it.
+func rewrite(t *testing.T, b []byte, fn func([]byte) []byte, path ...string) []byte {
+	t.Helper()
+	var out []byte
+	err := atoms(b, func(typ string, content []byte) bool {
+		switch {
+		case typ != path[0]:
+		case len(path) == 1:
+			content = fn(content)
+		default:
+			content = rewrite(t, content, fn, path[1:]...)
+		}
+		out = append(out, atom(typ, content)...)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// quicktime returns an alacm4a file with a QuickTime sample entry of the
+// version, with the 'alac' atom in a 'wave' atom.
+func quicktime(t *testing.T, file []byte, version uint16) []byte {
+	t.Helper()
+	return rewrite(t, file, func(stsd []byte) []byte {
+		var (
+			be    = binary.BigEndian
+			entry = stsd[16:] // of the one 'alac' entry
+			a     = entry[28:]
+			desc  = bytes.Clone(entry[:28])
+		)
+		be.PutUint16(desc[8:], version)
+		switch version {
+		case 1:
+			desc = append(desc, be32(4096, 0, 0, 2)...)
+		case 2:
+			desc = append(desc[:16], 0, 3, 0, 16, 0xff, 0xfe, 0, 0)
+			desc = append(desc, be32(65536, 72)...)
+			desc = be.AppendUint64(desc, math.Float64bits(44100))
+			desc = append(desc, be32(2, 0x7f000000, 16, 0, 0, 4096)...)
+		}
+		wave := atom("wave", atom("frma", []byte("alac")), a, be32(8, 0))
+		return append(bytes.Clone(stsd[:8]), atom("alac", desc, wave)...)
+	}, "moov", "trak", "mdia", "minf", "stbl", "stsd")
+}
+
+func TestQuickTime(t *testing.T) {
+	var (
+		pcm  = wavPCM(t, "jane_eyre_5s.wav")
+		file = encodeM4A(t, pcm, alac.DefaultConfig())
+	)
+	for _, version := range []uint16{1, 2} {
+		f, err := Open(bytes.NewReader(quicktime(t, file, version)))
+		if err != nil {
+			t.Fatalf("version %d: %v", version, err)
+		}
+		if have, want := f.SampleRate(), 44100; have != want {
+			t.Errorf("version %d: have %d, want %d", version, have, want)
+		}
+		if have, want := f.Track(), (Track{1, "soun", "alac", "und", 44100, 2}); have != want {
+			t.Errorf("version %d: have %v, want %v", version, have, want)
+		}
+		if have := decode(t, f); !bytes.Equal(have, pcm) {
+			t.Errorf("version %d: have %d bytes, want %d", version, len(have), len(pcm))
+		}
+	}
+	if _, err := soundDescription(append(make([]byte, 8), 0, 3)); err == nil {
+		t.Error("have no error for version 3")
+	}
+}
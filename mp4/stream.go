@@ -0,0 +1,92 @@
+package mp4
+
+import (
+	"fmt"
+	"io"
+)
+
+// OpenReader is Open for streams which can't seek, such as network radio
+// or a pipe. Files with the 'moov' atom before the 'mdat' atom, as
+// streaming muxers write them, are read as they come. For files with the
+// 'moov' atom at the end, such as those of alacm4a, the 'mdat' atom is kept
+// in memory until the sample tables show where its frames are. Frames
+// have to be in the order of the stream, which they are in all files but
+// those of odd muxers.
+func OpenReader(r io.Reader, opts ...Option) (*File, error) {
+	p := &progressive{r: r}
+	return open(p, p, opts)
+}
+
+// progressive is an io.ReadSeeker of a stream, which only seeks forward,
+// except in the part of the stream it keeps.
+type progressive struct {
+	r    io.Reader
+	pos  int64 // of r
+	off  int64 // of Read
+	keep bool  // whether to keep what's read from r
+	base int64 // offset of kept
+	kept []byte
+}
+
+// keepFrom keeps the stream from offset on, until keep is set to false.
+func (p *progressive) keepFrom(offset int64) {
+	p.keep, p.base, p.kept = true, offset, nil
+}
+
+func (p *progressive) Read(b []byte) (int, error) {
+	if i := p.off - p.base; i >= 0 && i < int64(len(p.kept)) {
+		n := copy(b, p.kept[i:])
+		p.off += int64(n)
+		return n, nil
+	}
+	if p.off < p.pos {
+		return 0, fmt.Errorf("mp4: can't go back to %d in a stream at %d", p.off, p.pos)
+	}
+	if p.off > p.pos {
+		var skip io.Writer = io.Discard
+		if p.keep {
+			skip = (*keeper)(p)
+		}
+		n, err := io.CopyN(skip, p.r, p.off-p.pos)
+		p.pos += n
+		if err == io.EOF {
+			return 0, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := p.r.Read(b)
+	if p.keep {
+		p.kept = append(p.kept, b[:n]...)
+	}
+	p.pos += int64(n)
+	p.off = p.pos
+	return n, err
+}
+
+// keeper is the io.Writer of the parts of the stream a progressive skips
+// while it keeps them.
+type keeper progressive
+
+func (k *keeper) Write(b []byte) (int, error) {
+	k.kept = append(k.kept, b...)
+	return len(b), nil
+}
+
+// Seek sets the offset of the next Read. Offsets before the stream which
+// weren't kept fail in Read.
+func (p *progressive) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += p.off
+	default:
+		return 0, fmt.Errorf("mp4: can't seek to the end of a stream")
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("mp4: seek to %d", offset)
+	}
+	p.off = offset
+	return offset, nil
+}
@@ -0,0 +1,73 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/alicebob/alac"
+)
+
+// faststart moves the 'moov' atom of an alacm4a file before the 'mdat'
+// atom, as streaming muxers write it.
+func faststart(t *testing.T, file []byte) []byte {
+	t.Helper()
+	var (
+		i    = bytes.Index(file, []byte("moov")) - 4
+		moov = bytes.Clone(file[i:])
+	)
+	stco, err := find(moov[8:], "trak", "mdia", "minf", "stbl", "stco")
+	if err != nil || stco == nil {
+		t.Fatalf("no stco: %v", err)
+	}
+	for c := range int(binary.BigEndian.Uint32(stco[4:])) {
+		b := stco[8+4*c:]
+		binary.BigEndian.PutUint32(b, binary.BigEndian.Uint32(b)+uint32(len(moov)))
+	}
+	ftyp := int(binary.BigEndian.Uint32(file))
+	out := append(bytes.Clone(file[:ftyp]), moov...)
+	return append(out, file[ftyp:i]...)
+}
+
+func TestOpenReader(t *testing.T) {
+	pcm := wavPCM(t, "monte_cristo_5s.wav")
+	file := encodeM4A(t, pcm, alac.DefaultConfig())
+	for name, file := range map[string][]byte{
+		"moov last":  file,
+		"moov first": faststart(t, file),
+	} {
+		for _, open := range []func([]byte) (*File, error){
+			func(b []byte) (*File, error) { return OpenReader(struct{ io.Reader }{bytes.NewReader(b)}) },
+			func(b []byte) (*File, error) { return Open(bytes.NewReader(b)) },
+		} {
+			f, err := open(file)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if have := decode(t, f); !bytes.Equal(have, pcm) {
+				t.Errorf("%s: have %d bytes, want %d", name, len(have), len(pcm))
+			}
+		}
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		if _, err := OpenReader(bytes.NewReader(file[:len(file)-10])); !errors.Is(err, ErrFormat) {
+			t.Errorf("have %v, want %v", err, ErrFormat)
+		}
+
+		// cut in the frames
+		f, err := OpenReader(bytes.NewReader(faststart(t, file)[:len(file)/2]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dec, err := alac.NewFromMagicCookie(f.MagicCookie())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadAll(alac.NewPCMReader(dec, f)); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("have %v, want %v", err, io.ErrUnexpectedEOF)
+		}
+	})
+}
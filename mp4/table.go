@@ -0,0 +1,122 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"sort"
+)
+
+// table is the sample table of a track, in about as little memory as in
+// the file: the sizes of the frames are the entries of the 'stsz' atom,
+// and frames are found from the offset of their chunk, in which they are
+// back to back. Times are runs of frames of the same duration.
+type table struct {
+	n      int     // frames
+	fixed  uint32  // size of every frame, if not 0
+	sizes  []byte  // of all frames unless fixed, 4 bytes each, big endian
+	chunks []chunk // in the order of the frames
+	runs   []run   // in the order of the frames
+	shifts []shift // of composition times, in the order of the frames
+	cur    cursor  // of the last offset
+}
+
+// chunk is a chunk of frames from frame first on.
+type chunk struct {
+	first  int
+	offset int64
+}
+
+// run is a run of frames of the same duration from frame first on, of
+// which the first plays at time.
+type run struct {
+	first    int
+	time     int64
+	duration uint32
+}
+
+// shift is the composition time offset of the frames from frame first on.
+type shift struct {
+	first  int
+	offset int32
+}
+
+// cursor is the offset of frame i in chunk c, so going through the frames
+// of a chunk in order doesn't add up their sizes every time.
+type cursor struct {
+	ok     bool
+	i, c   int
+	offset int64
+}
+
+// size returns the size of frame i.
+func (t *table) size(i int) uint32 {
+	if t.fixed != 0 {
+		return t.fixed
+	}
+	return binary.BigEndian.Uint32(t.sizes[4*i:])
+}
+
+// offset returns the offset of frame i in the file.
+func (t *table) offset(i int) int64 {
+	cur := t.cur
+	switch {
+	case cur.ok && i == cur.i:
+	case cur.ok && i == cur.i+1 && (cur.c+1 == len(t.chunks) || i < t.chunks[cur.c+1].first):
+		cur = cursor{true, i, cur.c, cur.offset + int64(t.size(cur.i))}
+	default:
+		c := sort.Search(len(t.chunks), func(c int) bool { return t.chunks[c].first > i }) - 1
+		cur = cursor{true, i, c, t.chunks[c].offset}
+		for j := t.chunks[c].first; j < i; j++ {
+			cur.offset += int64(t.size(j))
+		}
+	}
+	t.cur = cur
+	return cur.offset
+}
+
+// chunkEnd returns the frame after the chunk of frame i.
+func (t *table) chunkEnd(i int) int {
+	c := sort.Search(len(t.chunks), func(c int) bool { return t.chunks[c].first > i })
+	if c < len(t.chunks) {
+		return t.chunks[c].first
+	}
+	return t.n
+}
+
+// time returns the presentation time of frame i, and its duration.
+func (t *table) time(i int) (int64, uint32) {
+	r := t.runs[sort.Search(len(t.runs), func(r int) bool { return t.runs[r].first > i })-1]
+	ts := r.time + int64(i-r.first)*int64(r.duration)
+	if s := sort.Search(len(t.shifts), func(s int) bool { return t.shifts[s].first > i }) - 1; s >= 0 {
+		ts += int64(t.shifts[s].offset)
+	}
+	return ts, r.duration
+}
+
+// end returns the time at which frame i is done playing.
+func (t *table) end(i int) int64 {
+	ts, duration := t.time(i)
+	return ts + int64(duration)
+}
+
+// add adds a frame of the size, which is decoded at time, and plays after
+// the composition time offset. The frame is in the last chunk.
+func (t *table) add(size uint32, time int64, duration uint32, offset int32) {
+	if t.fixed != 0 && size != t.fixed {
+		for range t.n {
+			t.sizes = binary.BigEndian.AppendUint32(t.sizes, t.fixed)
+		}
+		t.fixed = 0
+	}
+	if t.fixed == 0 {
+		t.sizes = binary.BigEndian.AppendUint32(t.sizes, size)
+	}
+	if n := len(t.runs); n == 0 ||
+		t.runs[n-1].duration != duration ||
+		t.runs[n-1].time+int64(t.n-t.runs[n-1].first)*int64(duration) != time {
+		t.runs = append(t.runs, run{t.n, time, duration})
+	}
+	if n := len(t.shifts); n > 0 && t.shifts[n-1].offset != offset || n == 0 && offset != 0 {
+		t.shifts = append(t.shifts, shift{t.n, offset})
+	}
+	t.n++
+}
@@ -0,0 +1,109 @@
+package mp4
+
+import (
+	"math/rand/v2"
+	"testing"
+)
+
+// hour returns the 'stbl' atom of an hour of frames of 352 samples at
+// 44.1kHz, in chunks of 20 frames.
+func hour() ([]byte, int) {
+	const n = 3600 * 44100 / 352
+	var (
+		rnd    = rand.New(rand.NewPCG(1, 2))
+		sizes  = be32(0, 0, n)
+		chunks = be32(0, (n+19)/20)
+		offset = uint32(1000)
+	)
+	for i := range n {
+		size := 500 + rnd.Uint32N(1000)
+		sizes = append(sizes, be32(size)...)
+		if i%20 == 0 {
+			chunks = append(chunks, be32(offset)...)
+		}
+		offset += size
+	}
+	return atom("stbl",
+		atom("stts", be32(0, 1, n, 352)),
+		atom("stsc", be32(0, 1, 1, 20, 1)),
+		atom("stsz", sizes),
+		atom("stco", chunks),
+	)[8:], n
+}
+
+func TestTable(t *testing.T) {
+	stbl, n := hour()
+	tab, err := sampleTable(stbl, limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tab.addTimes(stbl); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := tab.n, n; have != want {
+		t.Fatalf("have %d, want %d", have, want)
+	}
+	if have, want := len(tab.chunks), (n+19)/20; have != want {
+		t.Errorf("have %d chunks, want %d", have, want)
+	}
+	if have, want := len(tab.runs), 1; have != want {
+		t.Errorf("have %d runs, want %d", have, want)
+	}
+
+	offsets := make([]int64, n)
+	for i := range n {
+		offsets[i] = tab.offset(i)
+		if i > 0 && offsets[i] != offsets[i-1]+int64(tab.size(i-1)) {
+			t.Fatalf("frame %d: have %d, want %d", i, offsets[i], offsets[i-1]+int64(tab.size(i-1)))
+		}
+	}
+	rnd := rand.New(rand.NewPCG(3, 4))
+	for range 1000 {
+		i := rnd.IntN(n)
+		if have, want := tab.offset(i), offsets[i]; have != want {
+			t.Fatalf("frame %d: have %d, want %d", i, have, want)
+		}
+		if ts, duration := tab.time(i); ts != int64(352*i) || duration != 352 {
+			t.Fatalf("frame %d: have %d %d", i, ts, duration)
+		}
+	}
+
+	t.Run("add", func(t *testing.T) {
+		tab := &table{n: 2, fixed: 100, chunks: []chunk{{0, 10}}, runs: []run{{0, 0, 352}}}
+		tab.add(100, 704, 352, 0)
+		if tab.sizes != nil {
+			t.Errorf("have sizes")
+		}
+		tab.chunks = append(tab.chunks, chunk{3, 1000})
+		tab.add(50, 1056, 100, 0)
+		tab.add(60, 2000, 100, 5)
+		for i, want := range []struct {
+			offset, time   int64
+			size, duration uint32
+		}{
+			{10, 0, 100, 352},
+			{110, 352, 100, 352},
+			{210, 704, 100, 352},
+			{1000, 1056, 50, 100},
+			{1050, 2005, 60, 100},
+		} {
+			ts, duration := tab.time(i)
+			if tab.offset(i) != want.offset || ts != want.time || tab.size(i) != want.size || duration != want.duration {
+				t.Errorf("frame %d: have %d %d %d %d, want %v", i, tab.offset(i), ts, tab.size(i), duration, want)
+			}
+		}
+	})
+}
+
+func BenchmarkSampleTable(b *testing.B) {
+	stbl, _ := hour()
+	for b.Loop() {
+		tab, err := sampleTable(stbl, limits{})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := tab.addTimes(stbl); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// timescale returns the timescale of an 'mvhd' or 'mdhd' atom, or 0
+// without one.
+func timescale(hd []byte) (int, error) {
+	if hd == nil {
+		return 0, nil
+	}
+	// version(1) flags(3), creation and modification time, 4 bytes each in
+	// version 0 and 8 in version 1, and the timescale
+	at := 12
+	if len(hd) > 0 && hd[0] == 1 {
+		at = 20
+	}
+	if len(hd) < at+4 {
+		return 0, fmt.Errorf("%w: header atom of %d bytes", ErrFormat, len(hd))
+	}
+	return int(binary.BigEndian.Uint32(hd[at:])), nil
+}
+
+// addTimes adds the runs of the 'stts' atom of stbl to the table, and the
+// composition time offsets of its 'ctts' atom.
+func (t *table) addTimes(stbl []byte) error {
+	stts, err := find(stbl, "stts")
+	if err != nil {
+		return err
+	}
+	ctts, err := find(stbl, "ctts")
+	if err != nil {
+		return err
+	}
+
+	// stts: version and flags(4) count(4) entries of sampleCount(4)
+	// sampleDelta(4)
+	be := binary.BigEndian
+	if len(stts) < 8 {
+		if t.n == 0 {
+			return nil
+		}
+		return fmt.Errorf("%w: no 'stts' atom", ErrFormat)
+	}
+	if n := be.Uint32(stts[4:]); !fits(stts[8:], n, 8) {
+		return fmt.Errorf("%w: 'stts' atom of %d bytes for %d entries", ErrFormat, len(stts), n)
+	}
+	var (
+		entries = int(be.Uint32(stts[4:]))
+		i       = 0
+		ts      int64
+	)
+	for e := 0; e < entries && i < t.n; e++ {
+		n, delta := int(min(be.Uint32(stts[8+8*e:]), uint32(t.n-i))), be.Uint32(stts[12+8*e:])
+		if n == 0 {
+			continue
+		}
+		t.runs = append(t.runs, run{i, ts, delta})
+		ts += int64(n) * int64(delta)
+		i += n
+	}
+	if i < t.n {
+		return fmt.Errorf("%w: 'stts' atom has %d of %d frames", ErrFormat, i, t.n)
+	}
+
+	// ctts: version and flags(4) count(4) entries of sampleCount(4)
+	// sampleOffset(4), which is signed in version 1
+	if ctts == nil {
+		return nil
+	}
+	if len(ctts) < 8 {
+		return fmt.Errorf("%w: 'ctts' atom of %d bytes", ErrFormat, len(ctts))
+	}
+	if n := be.Uint32(ctts[4:]); !fits(ctts[8:], n, 8) {
+		return fmt.Errorf("%w: 'ctts' atom of %d bytes for %d entries", ErrFormat, len(ctts), n)
+	}
+	entries, i = int(be.Uint32(ctts[4:])), 0
+	for e := 0; e < entries && i < t.n; e++ {
+		n, offset := int(min(be.Uint32(ctts[8+8*e:]), uint32(t.n-i))), int32(be.Uint32(ctts[12+8*e:]))
+		if n == 0 {
+			continue
+		}
+		t.shifts = append(t.shifts, shift{i, offset})
+		i += n
+	}
+	return nil
+}
+
+// Timescale returns the units per second of the timestamps of the track,
+// usually its sample rate.
+func (f *File) Timescale() int {
+	return f.timescale
+}
+
+// FrameTime returns the presentation time of frame i, from the start of
+// the track, and its duration. i is less than Frames.
+func (f *File) FrameTime(i int) (time.Duration, time.Duration) {
+	ts, duration := f.table.time(i)
+	return f.duration(ts), f.duration(int64(duration))
+}
+
+// TotalSamples returns the samples per channel the track plays, from the
+// end of its last frame in the sample table, after its Trim. It's known
+// before any frame is read. Fragmented streams of OpenReader know it from
+// their edit list or their 'mehd' atom; without either it's the samples
+// of the fragments read so far.
+func (f *File) TotalSamples() int64 {
+	ts := f.played()
+	if f.timescale == f.sampleRate {
+		return ts
+	}
+	rate, scale := int64(f.sampleRate), int64(f.timescale)
+	return ts/scale*rate + (ts%scale*rate+scale/2)/scale
+}
+
+// Duration returns how long the track plays, see TotalSamples.
+func (f *File) Duration() time.Duration {
+	return f.duration(f.played())
+}
+
+// played returns how long the track plays, in its timescale.
+func (f *File) played() int64 {
+	var end int64
+	if n := f.table.n; n > 0 {
+		end = f.table.end(n - 1)
+	}
+	if f.frag != nil {
+		end = max(end, f.frag.total)
+	}
+	played := max(end-f.skip, 0)
+	if f.length >= 0 && (f.length < played || f.frag != nil) {
+		played = f.length // the edit, unless it's longer than the frames
+	}
+	return played
+}
+
+// SeekTime makes ReadFrame go on with the frame which plays at t, from the
+// start of the track, and returns its index. After the last frame it
+// returns Frames, and ReadFrame returns io.EOF. Streams can only go
+// forward.
+func (f *File) SeekTime(t time.Duration) (int, error) {
+	// rounded up, so FrameTime times seek to their frame
+	t = max(t, 0)
+	scale := time.Duration(f.timescale)
+	ts := int64(t/time.Second*scale + (t%time.Second*scale+time.Second-1)/time.Second)
+	for f.frag != nil {
+		if n := f.table.n; n > 0 && f.table.end(n-1) > ts {
+			break
+		}
+		if err := f.nextFragment(); err != nil && err != io.EOF {
+			return 0, err
+		}
+	}
+	f.next = sort.Search(f.table.n, func(i int) bool {
+		return f.table.end(i) > ts
+	})
+	return f.next, nil
+}
+
+// duration returns ts in the timescale of the track as a time.Duration.
+func (f *File) duration(ts int64) time.Duration {
+	scale := int64(f.timescale)
+	return time.Duration(ts/scale)*time.Second + time.Duration(ts%scale)*time.Second/time.Duration(scale)
+}
@@ -0,0 +1,72 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/alicebob/alac"
+)
+
+func TestTotalSamples(t *testing.T) {
+	var (
+		pcm     = wavPCM(t, "jane_eyre_5s.wav")
+		samples = int64(len(pcm) / 4)
+		primed  = encodeM4A(t, pcm, alac.DefaultConfig(), alac.WithPriming(1000))
+		noEdit  = bytes.Replace(bytes.Clone(primed), []byte("edts"), []byte("free"), 1)
+		noTag   = bytes.Replace(bytes.Clone(noEdit), []byte("iTunSMPB"), []byte("iTunNORM"), 1)
+		file    = encodeM4A(t, pcm, alac.DefaultConfig())
+		frag    = fragment(t, file, 50)
+	)
+	// frag with a 'mehd' atom, 16 bytes, which moves the fragments of an
+	// absolute offset
+	mehd := rewrite(t, frag, func(mvex []byte) []byte {
+		return append(atom("mehd", be32(0, uint32(samples))), mvex...)
+	}, "moov", "mvex")
+	mehd = rewrite(t, mehd, func(tfhd []byte) []byte {
+		tfhd = bytes.Clone(tfhd)
+		if binary.BigEndian.Uint32(tfhd)&tfhdBaseDataOffset != 0 {
+			binary.BigEndian.PutUint64(tfhd[8:], binary.BigEndian.Uint64(tfhd[8:])+16)
+		}
+		return tfhd
+	}, "moof", "traf", "tfhd")
+
+	for name, c := range map[string]struct {
+		file   []byte
+		stream bool
+		want   int64
+	}{
+		"plain":     {file, false, samples},
+		"elst":      {primed, false, samples - 1000},
+		"iTunSMPB":  {noEdit, false, samples - 1000},
+		"neither":   {noTag, false, samples},
+		"fragments": {frag, false, samples},
+		"stream":    {frag, true, 50 * 352},
+		"mehd":      {mehd, true, samples},
+	} {
+		var (
+			f   *File
+			err error
+		)
+		if c.stream {
+			f, err = OpenReader(bytes.NewReader(c.file))
+		} else {
+			f, err = Open(bytes.NewReader(c.file))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := f.TotalSamples(), c.want; have != want {
+			t.Errorf("%s: have %d, want %d", name, have, want)
+		}
+		if have, want := f.Duration(), time.Duration(c.want)*time.Second/44100; have != want {
+			t.Errorf("%s: have %v, want %v", name, have, want)
+		}
+		if name == "mehd" {
+			if have := decode(t, f); !bytes.Equal(have, pcm) {
+				t.Errorf("%s: have %d bytes, want %d", name, len(have), len(pcm))
+			}
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Track is a track of an MP4 file, of any codec.
+type Track struct {
+	ID         int
+	Handler    string // "soun" for audio
+	Codec      string // the type of the sample entry, such as "alac" or "mp4a" for AAC
+	Language   string // ISO 639-2, "und" if it's not set
+	SampleRate int    // of audio tracks
+	Channels   int    // of audio tracks
+}
+
+// Tracks returns all tracks of the file, in the order of the file.
+func (f *File) Tracks() []Track {
+	return f.tracks
+}
+
+// Track returns the track of the File.
+func (f *File) Track() Track {
+	return f.tracks[f.track]
+}
+
+// findTrack returns the first ALAC track of moov for which choose, if
+// any, returns true, with its 'trak' atom. The File has all tracks.
+func findTrack(moov []byte, choose func(Track) bool) (*File, []byte, error) {
+	var (
+		tracks []Track
+		f      *File
+		found  []byte
+		ferr   error
+	)
+	err := atoms(moov, func(typ string, trak []byte) bool {
+		if typ != "trak" {
+			return true
+		}
+		var t Track
+		if t, ferr = trackInfo(trak); ferr != nil {
+			return false
+		}
+		tracks = append(tracks, t)
+		if f != nil || t.Codec != "alac" || choose != nil && !choose(t) {
+			return true
+		}
+		var stbl []byte
+		if stbl, ferr = find(trak, "mdia", "minf", "stbl"); ferr != nil {
+			return false
+		}
+		if f, ferr = sampleEntry(stbl); ferr != nil {
+			return false
+		}
+		f.track, found = len(tracks)-1, trak
+		t.SampleRate, t.Channels = f.sampleRate, f.channels
+		tracks[f.track] = t
+		return true
+	})
+	if err == nil {
+		err = ferr
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if f == nil {
+		if choose != nil {
+			return nil, nil, fmt.Errorf("%w: no ALAC track of WithTrack", ErrFormat)
+		}
+		return nil, nil, fmt.Errorf("%w: no ALAC track", ErrFormat)
+	}
+	f.tracks = tracks
+	return f, found, nil
+}
+
+// trackInfo returns the Track of trak.
+func trackInfo(trak []byte) (Track, error) {
+	var (
+		t  Track
+		be = binary.BigEndian
+	)
+
+	// tkhd: version(1) flags(3), creation and modification time, 4 bytes
+	// each in version 0 and 8 in version 1, and the track ID
+	tkhd, err := find(trak, "tkhd")
+	if err != nil {
+		return t, err
+	}
+	id := 12
+	if len(tkhd) > 0 && tkhd[0] == 1 {
+		id = 20
+	}
+	if len(tkhd) < id+4 {
+		return t, fmt.Errorf("%w: 'tkhd' atom of %d bytes", ErrFormat, len(tkhd))
+	}
+	t.ID = int(be.Uint32(tkhd[id:]))
+
+	// hdlr: version and flags(4) predefined(4) handlerType(4)
+	hdlr, err := find(trak, "mdia", "hdlr")
+	if err != nil {
+		return t, err
+	}
+	if len(hdlr) >= 12 {
+		t.Handler = string(hdlr[8:12])
+	}
+
+	// mdhd: the timescale and the duration, 4 bytes in version 0 and 8 in
+	// version 1, are followed by the language: 3 letters of 5 bits, of
+	// 0x60 on
+	t.Language = "und"
+	mdhd, err := find(trak, "mdia", "mdhd")
+	if err != nil {
+		return t, err
+	}
+	lang := 20
+	if len(mdhd) > 0 && mdhd[0] == 1 {
+		lang = 32
+	}
+	if len(mdhd) >= lang+2 {
+		if l := be.Uint16(mdhd[lang:]); l != 0 {
+			t.Language = string([]byte{byte(l>>10&31) + 0x60, byte(l>>5&31) + 0x60, byte(l&31) + 0x60})
+		}
+	}
+
+	// stsd: version and flags(4) count(4), and the sample entries
+	stsd, err := find(trak, "mdia", "minf", "stbl", "stsd")
+	if err != nil || len(stsd) < 16 {
+		return t, err
+	}
+	var entry []byte
+	err = atoms(stsd[8:], func(typ string, content []byte) bool {
+		t.Codec, entry = typ, content
+		return false
+	})
+	if err != nil {
+		return t, err
+	}
+	if t.Handler == "soun" {
+		if s, err := soundDescription(entry); err == nil {
+			t.Channels, t.SampleRate = s.channels, s.sampleRate
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,90 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/alicebob/alac"
+)
+
+// multitrack returns an alacm4a file with three copies of its track: an
+// AAC one, and ALAC ones in English and French.
+func multitrack(t *testing.T, file []byte) []byte {
+	t.Helper()
+	i := bytes.Index(file, []byte("moov")) - 4
+	moov := file[i+8:]
+	mvhd, err := find(moov, "mvhd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	trak, err := find(moov, "trak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	track := func(id uint32, lang string, codec string) []byte {
+		b := atom("trak", trak)
+		tkhd, _ := find(b[8:], "tkhd")
+		binary.BigEndian.PutUint32(tkhd[12:], id)
+		mdhd, _ := find(b[8:], "mdia", "mdhd")
+		binary.BigEndian.PutUint16(mdhd[20:], uint16(lang[0]-0x60)<<10|uint16(lang[1]-0x60)<<5|uint16(lang[2]-0x60))
+		stsd, _ := find(b[8:], "mdia", "minf", "stbl", "stsd")
+		copy(stsd[12:], codec)
+		return b
+	}
+	return append(bytes.Clone(file[:i]), atom("moov",
+		atom("mvhd", mvhd),
+		track(1, "eng", "mp4a"),
+		track(2, "eng", "alac"),
+		track(3, "fra", "alac"),
+	)...)
+}
+
+func TestTracks(t *testing.T) {
+	var (
+		pcm  = wavPCM(t, "jane_eyre_5s.wav")
+		file = multitrack(t, encodeM4A(t, pcm, alac.DefaultConfig()))
+	)
+	f, err := Open(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Track{
+		{1, "soun", "mp4a", "eng", 44100, 2},
+		{2, "soun", "alac", "eng", 44100, 2},
+		{3, "soun", "alac", "fra", 44100, 2},
+	}
+	if have := f.Tracks(); !reflect.DeepEqual(have, want) {
+		t.Errorf("have %v, want %v", have, want)
+	}
+	if have, want := f.Track().ID, 2; have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+
+	french := WithTrack(func(t Track) bool { return t.Language == "fra" })
+	f, err = Open(bytes.NewReader(file), french)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := f.Track().ID, 3; have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+	if have := decode(t, f); !bytes.Equal(have, pcm) {
+		t.Errorf("have %d bytes, want %d", len(have), len(pcm))
+	}
+
+	s, err := OpenReader(bytes.NewBuffer(file), french)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := s.Track().ID, 3; have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+
+	aac := WithTrack(func(t Track) bool { return t.ID == 1 })
+	if _, err := Open(bytes.NewReader(file), aac); !errors.Is(err, ErrFormat) {
+		t.Errorf("have %v, want %v", err, ErrFormat)
+	}
+}
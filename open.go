@@ -0,0 +1,281 @@
+package alac
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Container is a file of ALAC frames, as the formats of RegisterFormat
+// open them, such as the mp4.File of the mp4 package. Times are from the
+// start of the track, before the Trim.
+type Container interface {
+	Trimmer
+	MagicCookie() []byte
+	Frames() int
+	FrameTime(i int) (start, duration time.Duration)
+	SeekTime(t time.Duration) (int, error)
+}
+
+// format is a container format of RegisterFormat.
+type format struct {
+	name, magic string
+	open        func(io.ReadSeeker) (Container, error)
+}
+
+var (
+	formatsMu sync.Mutex
+	formats   []format
+)
+
+// RegisterFormat registers a container format for Open. Files which start
+// with magic, in which '?' matches any byte, are opened with open. The
+// formats package registers the formats of this module when it's
+// imported, so programs which use Open import it for that:
+//
+//	import _ "github.com/alicebob/alac/formats"
+func RegisterFormat(name, magic string, open func(io.ReadSeeker) (Container, error)) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	formats = append(formats, format{name, magic, open})
+}
+
+// match is whether b starts with magic.
+func match(magic string, b []byte) bool {
+	if len(b) < len(magic) {
+		return false
+	}
+	for i := range len(magic) {
+		if magic[i] != '?' && magic[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// sniff returns the format of the file of which b is the start, and
+// whether any formats are registered at all.
+func sniff(b []byte) (format, bool, bool) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	for _, f := range formats {
+		if match(f.magic, b) {
+			return f, true, true
+		}
+	}
+	return format{}, false, len(formats) > 0
+}
+
+// Stream is the decoded PCM of a Container, see Open. Its Read and Seek
+// are in bytes of the PCM, which is trimmed to what plays.
+type Stream struct {
+	format string // of Open
+	c      Container
+	dec    *Alac
+	r      *PCMReader
+	closer io.Closer // of OpenFile
+	skip   int64     // of the Trim of c
+	length int64     // of the Trim of c, -1 if unknown
+	pos    int64     // of Read, in bytes of PCM
+}
+
+// OpenFile is Open of the file at path. Close closes the file.
+func OpenFile(path string, opts ...Option) (*Stream, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := Open(f, opts...)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	s.closer = f
+	return s, nil
+}
+
+// Open returns the Stream of the file in r, of a format of RegisterFormat,
+// which it finds from the first bytes of r, from its current position. The
+// options are those of the decoder. Files of formats nobody registered
+// fail with ErrUnknownFormat. The formats of this module are registered by
+// the formats package, which programs import for Open:
+//
+//	import _ "github.com/alicebob/alac/formats"
+func Open(r io.ReadSeeker, opts ...Option) (*Stream, error) {
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	var b [16]byte
+	n, err := io.ReadFull(r, b[:])
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	f, ok, registered := sniff(b[:n])
+	if !ok && !registered {
+		return nil, fmt.Errorf("%w: no formats are registered, import github.com/alicebob/alac/formats", ErrUnknownFormat)
+	}
+	if !ok {
+		return nil, ErrUnknownFormat
+	}
+	c, err := f.open(r)
+	if err != nil {
+		return nil, err
+	}
+	s, err := NewStream(c, opts...)
+	if err != nil {
+		return nil, err
+	}
+	s.format = f.name
+	return s, nil
+}
+
+// NewStream returns the Stream of c, with a decoder of its magic cookie
+// and the options.
+func NewStream(c Container, opts ...Option) (*Stream, error) {
+	dec, err := NewFromMagicCookie(c.MagicCookie(), opts...)
+	if err != nil {
+		return nil, err
+	}
+	skip, length := c.Trim()
+	return &Stream{
+		c:      c,
+		dec:    dec,
+		r:      NewPCMReader(dec, c),
+		skip:   max(skip, 0),
+		length: length,
+	}, nil
+}
+
+// Format returns the name of the format of the file of Open, as it's
+// registered, such as "mp4". It's "" for NewStream.
+func (s *Stream) Format() string {
+	return s.format
+}
+
+// SampleRate returns the sample rate of the stream.
+func (s *Stream) SampleRate() int {
+	return s.dec.SampleRate()
+}
+
+// Channels returns the number of channels of the stream.
+func (s *Stream) Channels() int {
+	return s.dec.Channels()
+}
+
+// BitDepth returns the bit depth of the samples of the stream.
+func (s *Stream) BitDepth() int {
+	return s.dec.BitDepth()
+}
+
+// Duration returns how long the stream plays. For containers which don't
+// know it yet, such as a fragmented file being streamed, it's how long what
+// they know so far plays.
+func (s *Stream) Duration() time.Duration {
+	return s.samplesTime(s.samples())
+}
+
+// TotalSamples returns the samples per channel the stream plays, see
+// Duration.
+func (s *Stream) TotalSamples() int64 {
+	return s.samples()
+}
+
+// samples returns the samples per channel of the stream. Containers with a
+// TotalSamples method, such as mp4.File, know it best.
+func (s *Stream) samples() int64 {
+	if c, ok := s.c.(interface{ TotalSamples() int64 }); ok {
+		return c.TotalSamples()
+	}
+	if s.length >= 0 {
+		return s.length
+	}
+	n := s.c.Frames()
+	if n == 0 {
+		return 0
+	}
+	start, duration := s.c.FrameTime(n - 1)
+	return max(s.timeSamples(start+duration)-s.skip, 0)
+}
+
+// timeSamples returns the sample at t.
+func (s *Stream) timeSamples(t time.Duration) int64 {
+	rate := int64(s.dec.SampleRate())
+	return int64(t/time.Second)*rate + (int64(t%time.Second)*rate+int64(time.Second)/2)/int64(time.Second)
+}
+
+// samplesTime returns the time of n samples.
+func (s *Stream) samplesTime(n int64) time.Duration {
+	rate := int64(s.dec.SampleRate())
+	return time.Duration(n/rate)*time.Second + time.Duration(n%rate)*time.Second/time.Duration(rate)
+}
+
+// Read reads decoded PCM, in the OutputSpec of the decoder. It returns
+// io.EOF at the end of the stream.
+func (s *Stream) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.pos += int64(n)
+	return n, err
+}
+
+// Seek sets the offset of the next Read, in bytes of PCM, rounded down to
+// whole samples. Decoding goes on from the frame of the offset, so seeks
+// are cheap. io.SeekEnd needs the Duration.
+func (s *Stream) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.pos
+	case io.SeekEnd:
+		offset += s.samples() * int64(s.dec.bytespersample)
+	default:
+		return 0, fmt.Errorf("alac: seek whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("alac: seek to %d", offset)
+	}
+	sample := offset / int64(s.dec.bytespersample)
+	i, err := s.c.SeekTime(s.samplesTime(s.skip + sample))
+	if err != nil {
+		return 0, err
+	}
+	t := trim{0, 0}
+	if i < s.c.Frames() {
+		start, _ := s.c.FrameTime(i)
+		t.skip = max(s.skip+sample-s.timeSamples(start), 0)
+		t.length = -1
+		if s.length >= 0 {
+			t.length = max(s.length-sample, 0)
+		}
+	}
+	s.r = &PCMReader{
+		dec:   s.dec,
+		src:   s.c,
+		buf:   s.r.buf,
+		trim:  t,
+		frame: i,
+	}
+	s.pos = sample * int64(s.dec.bytespersample)
+	return s.pos, nil
+}
+
+// WriteTo writes the rest of the PCM to w, see PCMReader.WriteTo.
+func (s *Stream) WriteTo(w io.Writer) (int64, error) {
+	n, err := s.r.WriteTo(w)
+	s.pos += n
+	return n, err
+}
+
+// Close closes the decoder, and the file of OpenFile.
+func (s *Stream) Close() error {
+	s.dec.Close()
+	if s.closer != nil {
+		return s.closer.Close()
+	}
+	return nil
+}
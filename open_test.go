@@ -0,0 +1,154 @@
+package alac
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// container is a Container of frames in memory, of FrameSize samples but
+// for the last one.
+type container struct {
+	frames       [][]byte
+	cfg          Config
+	last         int // samples of the last frame
+	next         int
+	skip, length int64
+}
+
+func (c *container) ReadFrame() ([]byte, error) {
+	if c.next >= len(c.frames) {
+		return nil, io.EOF
+	}
+	c.next++
+	return c.frames[c.next-1], nil
+}
+
+func (c *container) Trim() (int64, int64) { return c.skip, c.length }
+func (c *container) MagicCookie() []byte  { return c.cfg.MagicCookie() }
+func (c *container) Frames() int          { return len(c.frames) }
+
+func (c *container) FrameTime(i int) (time.Duration, time.Duration) {
+	samples := c.cfg.FrameSize
+	if i == len(c.frames)-1 {
+		samples = c.last
+	}
+	rate := time.Duration(c.cfg.SampleRate)
+	return time.Duration(i*c.cfg.FrameSize) * time.Second / rate, time.Duration(samples) * time.Second / rate
+}
+
+func (c *container) SeekTime(t time.Duration) (int, error) {
+	c.next = sort.Search(len(c.frames), func(i int) bool {
+		start, duration := c.FrameTime(i)
+		return start+duration > t
+	})
+	return c.next, nil
+}
+
+func TestStream(t *testing.T) {
+	var (
+		signals = testSignals(5000, 16)
+		pcm     = interleavePCM(16, signals["sine"], signals["noise"])
+		cfg     = DefaultConfig()
+	)
+	e, err := NewEncoder(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames, err := e.EncodeAll(context.Background(), pcm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newContainer := func(skip, length int64) *container {
+		return &container{frames: frames, cfg: cfg, last: 5000 % cfg.FrameSize, skip: skip, length: length}
+	}
+
+	formatsMu.Lock()
+	registered := formats
+	formats = nil
+	formatsMu.Unlock()
+	if _, err := Open(bytes.NewReader([]byte("TEST FILE"))); !errors.Is(err, ErrUnknownFormat) || !strings.Contains(err.Error(), "alac/formats") {
+		t.Errorf("have %v, want %v, about the formats package", err, ErrUnknownFormat)
+	}
+	formatsMu.Lock()
+	formats = registered
+	formatsMu.Unlock()
+
+	RegisterFormat("test", "TEST????", func(r io.ReadSeeker) (Container, error) {
+		return newContainer(100, 4000), nil
+	})
+	if _, err := Open(bytes.NewReader([]byte("NOT A TEST FILE"))); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("have %v, want %v", err, ErrUnknownFormat)
+	}
+	s, err := Open(bytes.NewReader([]byte("TEST FILE")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := s.Format(), "test"; have != want {
+		t.Errorf("have %q, want %q", have, want)
+	}
+	if have, want := s.Duration(), 4000*time.Second/44100; have != want {
+		t.Errorf("have %v, want %v", have, want)
+	}
+	if have, want := s.TotalSamples(), int64(4000); have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+	have, err := io.ReadAll(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := pcm[4*100 : 4*4100]; !bytes.Equal(have, want) {
+		t.Errorf("have %d bytes, want %d", len(have), len(want))
+	}
+
+	for _, c := range []struct {
+		skip, length int64
+	}{
+		{0, -1},
+		{100, -1},
+		{100, 4000},
+	} {
+		s, err := NewStream(newContainer(c.skip, c.length))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := pcm[4*c.skip:]
+		if c.length >= 0 {
+			want = want[:4*c.length]
+		}
+		if have, want := s.Duration(), time.Duration(len(want)/4)*time.Second/44100; have != want {
+			t.Errorf("%v: have %v, want %v", c, have, want)
+		}
+		for _, seek := range []struct {
+			offset int64
+			whence int
+			pos    int64
+		}{
+			{4 * 1000, io.SeekStart, 4 * 1000},
+			{4*352 + 2, io.SeekStart, 4 * 352},
+			{-4 * 10, io.SeekEnd, int64(len(want)) - 4*10},
+			{-4 * 10, io.SeekCurrent, int64(len(want)) - 4*10},
+			{0, io.SeekStart, 0},
+		} {
+			pos, err := s.Seek(seek.offset, seek.whence)
+			if err != nil || pos != seek.pos {
+				t.Fatalf("%v: have %d, %v, want %d", c, pos, err, seek.pos)
+			}
+			have, err := io.ReadAll(io.LimitReader(s, 4*500))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := want[pos:min(pos+4*500, int64(len(want)))]; !bytes.Equal(have, want) {
+				t.Errorf("%v: at %d: have %d bytes, want %d", c, pos, len(have), len(want))
+			}
+		}
+	}
+	if _, err := s.Seek(-1, io.SeekStart); err == nil {
+		t.Error("have no error for a seek before the start")
+	}
+}
@@ -0,0 +1,284 @@
+package alac
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+// Default limits, see WithMaxFrameSize and WithMaxChannels.
+const (
+	DefaultMaxFrameSize = 1 << 16
+	DefaultMaxChannels  = 8
+)
+
+// Option configures optional decoder behaviour. Pass them to New,
+// NewWithConfig, or NewFromMagicCookie.
+type Option func(*Alac)
+
+// WithStrict makes the decoder fail with ErrInvalidFrame on any deviation
+// from the bitstream format, such as unknown prediction types, unexpected
+// elements, or data after the END element. This is what archival tools want.
+//
+// By default the decoder is lenient: it decodes what it can, and reports the
+// deviations to the WithWarningHandler function, if any.
+func WithStrict() Option {
+	return func(a *Alac) {
+		a.strict = true
+	}
+}
+
+// WithWarningHandler sets a function which is called for every deviation a
+// lenient decoder works around. The errors wrap ErrInvalidFrame.
+func WithWarningHandler(fn func(error)) Option {
+	return func(a *Alac) {
+		a.warn = fn
+	}
+}
+
+// WithMaxFrameSize limits the frame size, in samples per channel, the decoder
+// accepts. The decoder allocates buffers proportional to the frame size, so
+// servers decoding untrusted files should keep this low. The default is
+// DefaultMaxFrameSize; Apple's encoder uses 4096.
+func WithMaxFrameSize(n int) Option {
+	return func(a *Alac) {
+		a.maxFrameSize = n
+	}
+}
+
+// WithMaxChannels limits the number of channels the decoder accepts, of
+// the config and of every frame. The default is DefaultMaxChannels, the
+// most ALAC has layouts for.
+func WithMaxChannels(n int) Option {
+	return func(a *Alac) {
+		a.maxChannels = n
+	}
+}
+
+// checkLimits refuses configs above the WithMaxFrameSize and
+// WithMaxChannels limits.
+func (a *Alac) checkLimits(cfg Config) error {
+	if limit := orDefault(a.maxFrameSize, DefaultMaxFrameSize); cfg.FrameSize > limit {
+		return fmt.Errorf("%w: frame size %d, the limit is %d", ErrLimitsExceeded, cfg.FrameSize, limit)
+	}
+	if limit := orDefault(a.maxChannels, DefaultMaxChannels); cfg.NumChannels > limit {
+		return fmt.Errorf("%w: %d channels, the limit is %d", ErrLimitsExceeded, cfg.NumChannels, limit)
+	}
+	return nil
+}
+
+// WithBigEndian makes Decode return big endian PCM, as used by AIFF files
+// and network protocols, instead of little endian. It's short for setting
+// Endianness to BigEndian in the OutputSpec.
+func WithBigEndian() Option {
+	return func(a *Alac) {
+		a.output.Endianness = BigEndian
+	}
+}
+
+// Packing is the layout of 24 bit samples in the PCM from Decode, see
+// WithPacking. 20 bit samples are packed like 24 bit ones, 16 bit samples
+// always take 2 bytes and 32 bit samples 4.
+type Packing int
+
+const (
+	// Packed stores 24 bit samples in 3 bytes. This is the default.
+	Packed Packing = iota
+	// MSB32 stores 24 bit samples in the top 3 bytes of a 32 bit word,
+	// with the low byte zero. This is plain 32 bit PCM, which is what
+	// CoreAudio and PortAudio want.
+	MSB32
+	// LSB32 stores 24 bit samples sign extended to 32 bits. This is ALSA's
+	// S24_LE, or S24_BE with WithBigEndian.
+	LSB32
+)
+
+// WithPacking sets the layout of 24 bit samples. With MSB32 and LSB32 every
+// sample takes 4 bytes. It's short for setting Packing in the OutputSpec.
+func WithPacking(p Packing) Option {
+	return func(a *Alac) {
+		a.output.Packing = p
+	}
+}
+
+// Dither is how WithDither reduces 24 bit samples to 16 bits, and how
+// WithFloatDither rounds float samples for the encoder.
+type Dither int
+
+const (
+	// NoDither keeps the 24 bit samples. This is the default.
+	NoDither Dither = iota
+	// DitherTPDF adds triangular noise of ±1 LSB before rounding to 16
+	// bits. This replaces the distortion of plain rounding, which follows
+	// the signal, with a constant noise floor.
+	DitherTPDF
+	// DitherShaped is DitherTPDF with first order noise shaping: the
+	// rounding error of a sample is subtracted from the next one. This
+	// moves the noise towards the high frequencies, where it is less
+	// audible, at the cost of more noise in total.
+	DitherShaped
+)
+
+// WithDither makes the decoder reduce 24 bit streams to 16 bit PCM, for
+// sinks which only take 16 bits. Digital silence stays silent. FrameBytes
+// reports the 16 bit size, BitDepth still reports the 24 bits of the stream.
+// WithPacking doesn't apply, and 16 bit streams aren't affected.
+func WithDither(d Dither) Option {
+	return func(a *Alac) {
+		a.dither = d
+	}
+}
+
+// WithDownmix makes the decoder mix streams of more than 2 channels to
+// stereo, for playback which only takes stereo: the center and surround
+// channels go to the sides 3 dB down, with the ITU-R BS.775 coefficients,
+// and the LFE is dropped. Samples which end up outside the range of the bit
+// depth are clipped. Mono and stereo streams are left as they are, and
+// Channels and FrameBytes report the stereo layout, which WithChannelMap
+// then maps. Decoders for sinks which take every channel go without it.
+func WithDownmix() Option {
+	return func(a *Alac) {
+		a.downmix = true
+	}
+}
+
+// WithChannelMap sets the channels of the PCM: output channel i is channel
+// m[i] of the stream. []int{1, 0} swaps left and right, []int{0} keeps only
+// the left channel of a stereo stream, as mono, and []int{0, 0} turns a mono
+// stream into stereo. Channels and FrameBytes report the mapped layout. The
+// map has at most DefaultMaxChannels entries; configs without the channels
+// it uses fail with ErrInvalidConfig, and so do frames with
+// WithAutoReconfigure, with ErrChannelMismatch.
+func WithChannelMap(m []int) Option {
+	return func(a *Alac) {
+		a.channelMap = slices.Clone(m)
+	}
+}
+
+// checkOptions refuses option values which don't make sense, or a
+// WithChannelMap map which doesn't fit streams of n channels.
+func (a *Alac) checkOptions(n int) error {
+	if !validChannelMap(a.channelMap, a.outputChannels(n)) {
+		return fmt.Errorf("%w: channel map %v for %d channels", ErrInvalidConfig, a.channelMap, a.outputChannels(n))
+	}
+	if !(a.gain >= 0 && a.gain <= maxGain) { // also catches NaN
+		return fmt.Errorf("%w: gain %v", ErrInvalidConfig, a.gain)
+	}
+	if err := a.output.check(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func validChannelMap(m []int, n int) bool {
+	if m == nil {
+		return true
+	}
+	if len(m) == 0 || len(m) > DefaultMaxChannels {
+		return false
+	}
+	for _, c := range m {
+		if c < 0 || c >= n {
+			return false
+		}
+	}
+	return true
+}
+
+// WithGain multiplies the samples by g, so 0.5 halves the volume. Samples
+// which end up outside the range of the bit depth are clipped. The gain is
+// applied as the samples are converted to PCM, so ReplayGain or volume
+// leveling needs no extra pass; it takes 16 bits of precision, and g can
+// be at most 256. A gain of exactly 1 leaves the samples as they are.
+func WithGain(g float64) Option {
+	return func(a *Alac) {
+		a.gain = g
+		a.hasGain = g != 1 && g >= 0 && g <= maxGain
+		if a.hasGain {
+			a.gainQ16 = int64(math.Round(g * gainOne))
+		}
+	}
+}
+
+// WithGainDB is WithGain for a gain in decibels, so -6 about halves the
+// volume.
+func WithGainDB(db float64) Option {
+	return WithGain(math.Pow(10, db/20))
+}
+
+// WithLevels makes the decoder measure the peak and RMS level of every
+// channel of every frame, for level meters. The levels are in the
+// FrameInfo passed to the OnFrame hook, and are those of the channels of
+// the stream, after WithGain.
+func WithLevels() Option {
+	return func(a *Alac) {
+		a.levels = true
+	}
+}
+
+// WithAutoReconfigure makes the decoder adapt to frames which don't fit its
+// config, instead of failing with ErrConfigMismatch. A frame with a different
+// number of channels changes the config, and so the layout of the PCM, from
+// that frame on; Channels reports the current value. A frame with more
+// samples than FrameSize grows the buffers, FrameSize itself doesn't change.
+// The WithMaxFrameSize and WithMaxChannels limits still apply.
+func WithAutoReconfigure() Option {
+	return func(a *Alac) {
+		a.autoReconfigure = true
+	}
+}
+
+// WithBufferPool makes Decode and DecodeFrame take their PCM slices from p,
+// see BufferPool. Slices passed to the OnFrame hook are the same slices.
+func WithBufferPool(p *BufferPool) Option {
+	return func(a *Alac) {
+		a.pool = p
+	}
+}
+
+// WithParallelChannels makes the decoder undo the prediction of the two
+// channels of a stereo frame concurrently. The residuals still have to be
+// read in order, so this only pays off for big frames, such as the 4096
+// samples Apple's encoder uses, on machines with cores to spare. Frames of
+// fewer than 1024 samples are always decoded on the calling goroutine.
+func WithParallelChannels() Option {
+	return func(a *Alac) {
+		a.parallel = true
+	}
+}
+
+// WithLowLatency sets the decoder up for real-time receivers, such as
+// AirPlay with its 352 sample frames. The PCM buffer is allocated up front,
+// sized for FrameSize samples, and Decode and DecodeFrame return slices of
+// it, so decoding a packet never allocates. The PCM is only valid until the
+// next call; copy it if it has to live longer. This takes precedence over
+// WithBufferPool.
+//
+// The decode time of a frame is bounded by its sample count. The worst case
+// for a 352 sample stereo frame, with 30 predictor coefficients and every
+// residual escaped, takes under 100µs on a server class x86-64 core (see
+// BenchmarkLowLatency), against the 8ms of audio in the frame.
+func WithLowLatency() Option {
+	return func(a *Alac) {
+		a.lowLatency = true
+	}
+}
+
+// ArenaSize returns the number of int32s WithArena needs for decoders of
+// cfg.
+func ArenaSize(cfg Config) int {
+	return arenaBuffers * cfg.FrameSize
+}
+
+// WithArena makes the decoder carve its sample buffers out of slab, which
+// should have at least ArenaSize elements, instead of allocating them. This
+// is for request scoped decoders: one slab per worker can serve every
+// decoder it creates, one after the other, which saves the allocations.
+// The decoder uses the slab until Close; decoders using the same slab must
+// not decode at the same time. Buffers which don't fit in the slab, such
+// as for larger frames with WithAutoReconfigure, are allocated as usual.
+func WithArena(slab []int32) Option {
+	return func(a *Alac) {
+		a.arena = slab
+	}
+}
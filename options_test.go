@@ -0,0 +1,727 @@
+package alac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestStrict(t *testing.T) {
+	good := testFrame("2000000408130809b5")
+
+	lenient, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := lenient.DecodeFrame(good)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	strict, err := New(WithStrict())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := strict.DecodeFrame(good); err != nil {
+		t.Fatalf("strict decoder rejects a valid frame: %s", err)
+	}
+
+	var warnings []error
+	warner, err := New(WithWarningHandler(func(err error) {
+		warnings = append(warnings, err)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, frame := range map[string][]byte{
+		"trailing data": append(bytes.Clone(good), 0, 0),
+		"unused bits":   patch(good, 1, 0x01),
+		"prediction":    patch(good, 5, good[5]|0x20), // type 1 for channel 1
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := strict.DecodeFrame(frame); !errors.Is(err, ErrInvalidFrame) {
+				t.Errorf("strict: have %v, want %v", err, ErrInvalidFrame)
+			}
+
+			// lenient decoders give the same output as for the valid frame
+			have, err := lenient.DecodeFrame(frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(have, want) {
+				t.Errorf("lenient: output differs")
+			}
+
+			warnings = nil
+			have, err = warner.DecodeFrame(frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(have, want) {
+				t.Errorf("warner: output differs")
+			}
+			if len(warnings) != 1 {
+				t.Fatalf("have %d warnings, want 1", len(warnings))
+			}
+			if !errors.Is(warnings[0], ErrInvalidFrame) {
+				t.Errorf("have %v, want %v", warnings[0], ErrInvalidFrame)
+			}
+		})
+	}
+}
+
+// patch returns a copy of b with b[i] set to v.
+func patch(b []byte, i int, v byte) []byte {
+	b = bytes.Clone(b)
+	b[i] = v
+	return b
+}
+
+func TestLimits(t *testing.T) {
+	huge := Config{SampleRate: 44100, SampleSize: 16, NumChannels: 2, FrameSize: 1 << 31}
+	if _, err := NewWithConfig(huge); !errors.Is(err, ErrLimitsExceeded) {
+		t.Errorf("have %v, want %v", err, ErrLimitsExceeded)
+	}
+
+	// a cookie with frameLength 0x80000000
+	cookie := mustHex("800000000010280a0e0200ff00000000000000000000ac44")
+	if _, err := NewFromMagicCookie(cookie); !errors.Is(err, ErrLimitsExceeded) {
+		t.Errorf("have %v, want %v", err, ErrLimitsExceeded)
+	}
+
+	cfg := Config{SampleRate: 44100, SampleSize: 16, NumChannels: 2, FrameSize: 4096}
+	if _, err := NewWithConfig(cfg, WithMaxFrameSize(352)); !errors.Is(err, ErrLimitsExceeded) {
+		t.Errorf("have %v, want %v", err, ErrLimitsExceeded)
+	}
+	if _, err := NewWithConfig(cfg, WithMaxChannels(1)); !errors.Is(err, ErrLimitsExceeded) {
+		t.Errorf("have %v, want %v", err, ErrLimitsExceeded)
+	}
+
+	a, err := NewWithConfig(cfg, WithMaxFrameSize(4096), WithMaxChannels(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.FrameSize = 4097
+	if err := a.ResetWithConfig(cfg); !errors.Is(err, ErrLimitsExceeded) {
+		t.Errorf("have %v, want %v", err, ErrLimitsExceeded)
+	}
+}
+
+func TestBigEndian(t *testing.T) {
+	a, err := New(WithBigEndian())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for in, out := range testFrames {
+		want := mustHex(out)
+		for i := 0; i < len(want); i += 2 {
+			want[i], want[i+1] = want[i+1], want[i]
+		}
+		if have := a.Decode(mustHex(in)); !bytes.Equal(have, want) {
+			t.Errorf("output differs for frame %s...", in[:16])
+		}
+	}
+
+	for _, channels := range [][][]int32{
+		{{0x123456, -2}},
+		{{0x123456, -2}, {-0x123456, 2}},
+	} {
+		a, err := NewWithConfig(Config{SampleRate: 44100, SampleSize: 24, NumChannels: len(channels), FrameSize: 2}, WithBigEndian())
+		if err != nil {
+			t.Fatal(err)
+		}
+		have, err := a.DecodeFrame(verbatimFrame(24, 2, channels))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var want []byte
+		for i := 0; i < 2; i++ {
+			for _, ch := range channels {
+				s := ch[i]
+				want = append(want, byte(s>>16), byte(s>>8), byte(s))
+			}
+		}
+		if !bytes.Equal(have, want) {
+			t.Errorf("have %x, want %x", have, want)
+		}
+	}
+}
+
+func TestPacking(t *testing.T) {
+	channels := [][]int32{{0x123456, -2}, {-0x123456, 2}}
+	frame := verbatimFrame(24, 2, channels)
+	cfg := Config{SampleRate: 44100, SampleSize: 24, NumChannels: 2, FrameSize: 2}
+
+	for _, c := range []struct {
+		opts []Option
+		want string
+	}{
+		{nil, "563412aacbedfeffff020000"},
+		{[]Option{WithPacking(Packed)}, "563412aacbedfeffff020000"},
+		{[]Option{WithPacking(MSB32)}, "00563412" + "00aacbed" + "00feffff" + "00020000"},
+		{[]Option{WithPacking(LSB32)}, "56341200" + "aacbedff" + "feffffff" + "02000000"},
+		{[]Option{WithPacking(MSB32), WithBigEndian()}, "12345600" + "edcbaa00" + "fffffe00" + "00000200"},
+		{[]Option{WithPacking(LSB32), WithBigEndian()}, "00123456" + "ffedcbaa" + "fffffffe" + "00000002"},
+	} {
+		a, err := NewWithConfig(cfg, c.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		have, err := a.DecodeFrame(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := mustHex(c.want); !bytes.Equal(have, want) {
+			t.Errorf("have %x, want %x", have, want)
+		}
+	}
+
+	// mono takes the other code path
+	a, err := NewWithConfig(Config{SampleRate: 44100, SampleSize: 24, NumChannels: 1, FrameSize: 2}, WithPacking(LSB32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	have, err := a.DecodeFrame(verbatimFrame(24, 2, channels[:1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := mustHex("56341200feffffff"); !bytes.Equal(have, want) {
+		t.Errorf("have %x, want %x", have, want)
+	}
+
+	// 16 bit samples are not affected
+	b, err := New(WithPacking(MSB32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(b.Decode(testFrame("20"))), 352*4; have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+}
+
+func TestAutoReconfigure(t *testing.T) {
+	mono := verbatimFrame(16, 3, [][]int32{{1, 2, 3}})
+	big := escapeFrame(16, true, 500, [][]int32{make([]int32, 500), make([]int32, 500)})
+
+	a, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.DecodeFrame(mono); !errors.Is(err, ErrConfigMismatch) {
+		t.Errorf("have %v, want %v", err, ErrConfigMismatch)
+	}
+	if _, err := a.DecodeFrame(big); !errors.Is(err, ErrConfigMismatch) {
+		t.Errorf("have %v, want %v", err, ErrConfigMismatch)
+	}
+
+	a, err = New(WithAutoReconfigure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := a.DecodeFrame(mono)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := mustHex("010002000300"); !bytes.Equal(out, want) {
+		t.Errorf("have %x, want %x", out, want)
+	}
+	if have, want := a.Channels(), 1; have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+
+	out, err = a.DecodeFrame(big)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(out), 500*4; have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+	if have, want := a.Channels(), 2; have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+	if have, want := a.FrameSize(), 352; have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+	if out := a.Decode(testFrame("20")); len(out) != 352*4 {
+		t.Errorf("have %d bytes", len(out))
+	}
+
+	// a frame of more elements
+	cfg := DefaultConfig()
+	cfg.NumChannels = 6
+	e, err := NewEncoder(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcm := make([]byte, 6*2*100)
+	for i := range pcm {
+		pcm[i] = byte(i * 7)
+	}
+	surround, err := e.Encode(pcm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := a.DecodeFrame(surround); err != nil || !bytes.Equal(out, pcm) {
+		t.Errorf("have %d bytes, %v, want %d", len(out), err, len(pcm))
+	}
+	if have, want := a.Channels(), 6; have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+
+	// limits still hold
+	a, err = New(WithAutoReconfigure(), WithMaxFrameSize(352))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.DecodeFrame(big); !errors.Is(err, ErrLimitsExceeded) {
+		t.Errorf("have %v, want %v", err, ErrLimitsExceeded)
+	}
+	a, err = New(WithAutoReconfigure(), WithMaxChannels(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.DecodeFrame(surround); !errors.Is(err, ErrLimitsExceeded) {
+		t.Errorf("have %v, want %v", err, ErrLimitsExceeded)
+	}
+}
+
+func TestParallelChannels(t *testing.T) {
+	cfg := Config{SampleRate: 44100, SampleSize: 16, NumChannels: 2, FrameSize: 4096}
+	frames := [][]byte{
+		compressedFrame([]int16{160, -190, 170, -130, 80, -30, 0, 0}, [][]int32{noise(4096, 1), noise(4096, 2)}),
+		compressedFrame([]int16{160, -190, 170, -130}, [][]int32{noise(100, 3), noise(100, 4)}),
+	}
+	seq, err := NewWithConfig(cfg, WithStrict())
+	if err != nil {
+		t.Fatal(err)
+	}
+	par, err := NewWithConfig(cfg, WithStrict(), WithParallelChannels())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range frames {
+		want, err := seq.DecodeFrame(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		have, err := par.DecodeFrame(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(have, want) {
+			t.Errorf("parallel output differs")
+		}
+	}
+}
+
+func TestLowLatency(t *testing.T) {
+	a, err := New(WithLowLatency())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var prev []byte
+	for in, out := range testFrames {
+		have, err := a.DecodeFrame(mustHex(in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := mustHex(out); !bytes.Equal(have, want) {
+			t.Errorf("output differs for frame %s...", in[:16])
+		}
+		if prev != nil && &have[0] != &prev[0] {
+			t.Errorf("PCM buffer not reused")
+		}
+		prev = have
+	}
+
+	frame := testFrame("20")
+	if allocs := testing.AllocsPerRun(10, func() { a.Decode(frame) }); allocs != 0 {
+		t.Errorf("have %v allocs/op, want 0", allocs)
+	}
+
+	// a clone has its own buffer
+	c := a.Clone()
+	if have := c.Decode(frame); &have[0] == &prev[0] {
+		t.Errorf("clone shares the PCM buffer")
+	}
+}
+
+func TestArena(t *testing.T) {
+	slab := make([]int32, ArenaSize(DefaultConfig()))
+	inSlab := func(b []int32) bool {
+		for i := 0; len(b) > 0 && i < len(slab); i += len(b) {
+			if &slab[i] == &b[0] {
+				return true
+			}
+		}
+		return false
+	}
+
+	a, err := New(WithArena(slab))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !inSlab(a.predicterror_buffer_a) || !inSlab(a.uncompressed_bytes_buffer_b) {
+		t.Fatal("buffers not in the arena")
+	}
+	for in, out := range testFrames {
+		have, err := a.DecodeFrame(mustHex(in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := mustHex(out); !bytes.Equal(have, want) {
+			t.Errorf("output differs for frame %s...", in[:16])
+		}
+	}
+
+	if c := a.Clone(); c.arena != nil || inSlab(c.predicterror_buffer_a) {
+		t.Errorf("clone uses the arena")
+	}
+
+	// the next decoder takes over the slab
+	a.Close()
+	allocs := testing.AllocsPerRun(10, func() {
+		b, _ := New(WithArena(slab))
+		b.Close()
+	})
+	if allocs > 1 {
+		t.Errorf("have %v allocs/op, want 1", allocs)
+	}
+
+	// too small, fall back to allocating
+	b, err := New(WithArena(slab[:10]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inSlab(b.predicterror_buffer_a) {
+		t.Errorf("buffers in a too small arena")
+	}
+	if _, err := b.DecodeFrame(testFrame("20")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDownmix(t *testing.T) {
+	// 5.1, C L R Ls Rs LFE, in an SCE, 2 CPEs, and an SCE
+	var (
+		cfg   = Config{SampleRate: 48000, SampleSize: 16, NumChannels: 6, FrameSize: 3}
+		frame = elementsFrame(16, 3,
+			[][]int32{{1000, 0, 30000}},
+			[][]int32{{100, 200, 30000}, {-100, 0, -30000}},
+			[][]int32{{2000, 0, 30000}, {0, 400, -30000}},
+			[][]int32{{5000, 5000, 5000}},
+		)
+		want = []int16{707 + 100 + 1414, 707 - 100, 200, 283, 32767, -30000} // clipped
+	)
+	a, err := NewWithConfig(cfg, WithDownmix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := a.Channels(), 2; have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+	if have, want := a.FrameBytes(), 3*4; have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+	have, err := a.DecodeFrame(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := pcm16(want); !bytes.Equal(have, want) {
+		t.Errorf("have %x, want %x", have, want)
+	}
+	dst := make([]int16, 6)
+	if _, err := a.DecodeToInt16(frame, dst); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(dst, want) {
+		t.Errorf("have %v, want %v", dst, want)
+	}
+
+	// the map is of the stereo mix
+	a, err = NewWithConfig(cfg, WithDownmix(), WithChannelMap([]int{1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, err := a.DecodeFrame(frame); err != nil || !bytes.Equal(have, pcm16([]int16{607, 283, -30000})) {
+		t.Errorf("have %x, %v, want %x", have, err, pcm16([]int16{607, 283, -30000}))
+	}
+	if _, err := NewWithConfig(cfg, WithDownmix(), WithChannelMap([]int{5})); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("have %v, want %v", err, ErrInvalidConfig)
+	}
+
+	// the gain is of the channels, before the mix
+	a, err = NewWithConfig(cfg, WithDownmix(), WithGain(0.5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.DecodeToInt16(frame, dst); err != nil {
+		t.Fatal(err)
+	}
+	for i, s := range dst {
+		if w := []int{1110, 303, 100, 141, 32767, -15000}[i]; int(s) < w-1 || int(s) > w+1 {
+			t.Errorf("sample %d: have %d, want %d", i, s, w)
+		}
+	}
+
+	// stereo stays as it is
+	a, err = New(WithDownmix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for in, out := range testFrames {
+		if have, err := a.DecodeFrame(mustHex(in)); err != nil || !bytes.Equal(have, mustHex(out)) {
+			t.Errorf("output differs for frame %s...: %v", in[:16], err)
+		}
+	}
+
+	// and so do the mono and stereo frames of a reconfigured stream
+	a, err = New(WithDownmix(), WithAutoReconfigure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		frame    []byte
+		channels int
+		want     []int16
+	}{
+		{frame, 2, want},
+		{verbatimFrame(16, 3, [][]int32{{1, 2, 3}}), 1, []int16{1, 2, 3}},
+		{frame, 2, want},
+		{verbatimFrame(16, 3, [][]int32{{1, 2, 3}, {4, 5, 6}}), 2, []int16{1, 4, 2, 5, 3, 6}},
+	} {
+		have, err := a.DecodeFrame(c.frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := pcm16(c.want); !bytes.Equal(have, want) {
+			t.Errorf("have %x, want %x", have, want)
+		}
+		if have := a.Channels(); have != c.channels {
+			t.Errorf("have %d, want %d", have, c.channels)
+		}
+	}
+}
+
+// elementsFrame builds an uncompressed frame of an element for every
+// entry of elements: an SCE for one channel, a CPE for two.
+func elementsFrame(sampleSize int, samples int, elements ...[][]int32) []byte {
+	w := &bitWriter{}
+	for _, channels := range elements {
+		w.write(uint32(len(channels)-1), 3) // element: SCE or CPE
+		w.write(0, 4)                       // element instance
+		w.write(0, 12)                      // unused
+		w.write(1, 1)                       // has size
+		w.write(0, 2)                       // uncompressed bytes
+		w.write(1, 1)                       // not compressed
+		w.write(uint32(samples), 32)
+		for i := range samples {
+			for _, ch := range channels {
+				w.write(uint32(ch[i]), sampleSize)
+			}
+		}
+	}
+	w.write(7, 3) // END
+	return w.buf
+}
+
+// pcm16 is the little endian PCM of samples.
+func pcm16(samples []int16) []byte {
+	b := make([]byte, 2*len(samples))
+	for i, s := range samples {
+		binary.LittleEndian.PutUint16(b[2*i:], uint16(s))
+	}
+	return b
+}
+
+func TestChannelMap(t *testing.T) {
+	// pick copies channels of interleaved 16 bit stereo PCM
+	pick := func(pcm []byte, m []int) []byte {
+		var out []byte
+		for i := 0; i < len(pcm); i += 4 {
+			for _, c := range m {
+				out = append(out, pcm[i+2*c:i+2*c+2]...)
+			}
+		}
+		return out
+	}
+
+	for _, m := range [][]int{{0, 1}, {1, 0}, {0}, {1}, {1, 1, 0}} {
+		a, err := New(WithChannelMap(m))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := a.Channels(), len(m); have != want {
+			t.Errorf("have %d, want %d", have, want)
+		}
+		for in, out := range testFrames {
+			have, err := a.DecodeFrame(mustHex(in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := pick(mustHex(out), m); !bytes.Equal(have, want) {
+				t.Errorf("%v: output differs for frame %s...", m, in[:16])
+			}
+
+			samples := make([]int16, 352*len(m))
+			n, err := a.DecodeToInt16(mustHex(in), samples)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var pcm []byte
+			for _, s := range samples[:n] {
+				pcm = binary.LittleEndian.AppendUint16(pcm, uint16(s))
+			}
+			if want := pick(mustHex(out), m); !bytes.Equal(pcm, want) {
+				t.Errorf("%v: DecodeToInt16 output differs for frame %s...", m, in[:16])
+			}
+		}
+	}
+
+	t.Run("24 bit", func(t *testing.T) {
+		left, right := []int32{1, -2, 0x123456}, []int32{-0x654321, 5, 6}
+		frame := verbatimFrame(24, 3, [][]int32{left, right})
+		cfg := Config{SampleRate: 48000, SampleSize: 24, NumChannels: 2, FrameSize: 3}
+		plain, err := NewWithConfig(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := plain.DecodeFrame(verbatimFrame(24, 3, [][]int32{right, left}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		a, err := NewWithConfig(cfg, WithChannelMap([]int{1, 0}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, err := a.DecodeFrame(frame); err != nil || !bytes.Equal(have, want) {
+			t.Errorf("have %x (%v), want %x", have, err, want)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, m := range [][]int{{}, {2}, {-1}, {0, 1, 0, 1, 0, 1, 0, 1, 0}} {
+			if _, err := New(WithChannelMap(m)); !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("%v: have %v, want %v", m, err, ErrInvalidConfig)
+			}
+		}
+		a, err := New(WithChannelMap([]int{1}), WithAutoReconfigure())
+		if err != nil {
+			t.Fatal(err)
+		}
+		mono := verbatimFrame(16, 352, [][]int32{make([]int32, 352)})
+		if _, err := a.DecodeFrame(mono); !errors.Is(err, ErrChannelMismatch) {
+			t.Errorf("have %v, want %v", err, ErrChannelMismatch)
+		}
+	})
+}
+
+func TestGain(t *testing.T) {
+	le16 := func(b []byte, i int) int {
+		return int(int16(binary.LittleEndian.Uint16(b[2*i:])))
+	}
+	for _, g := range []float64{0, 0.5, 1, 1.5, 4} {
+		a, err := New(WithGain(g))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for in, out := range testFrames {
+			have, err := a.DecodeFrame(mustHex(in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := mustHex(out)
+			for i := range len(want) / 2 {
+				w := min(max(int(math.Round(float64(le16(want, i))*g)), -32768), 32767)
+				if h := le16(have, i); h < w-1 || h > w+1 {
+					t.Fatalf("gain %v, sample %d: have %d, want %d", g, i, h, w)
+				}
+			}
+		}
+	}
+
+	t.Run("24 bit", func(t *testing.T) {
+		ch := []int32{1 << 20, -1 << 20, 1<<23 - 1, -1 << 23, 3}
+		cfg := Config{SampleRate: 44100, SampleSize: 24, NumChannels: 1, FrameSize: len(ch)}
+		a, err := NewWithConfig(cfg, WithGainDB(-6.0206)) // half
+		if err != nil {
+			t.Fatal(err)
+		}
+		dst := make([]int32, len(ch))
+		if _, err := a.DecodeToInt32(verbatimFrame(24, len(ch), [][]int32{ch}), dst); err != nil {
+			t.Fatal(err)
+		}
+		if have, want := dst, []int32{1 << 19, -1 << 19, 1 << 22, -1 << 22, 2}; !slices.Equal(have, want) {
+			t.Errorf("have %v, want %v", have, want)
+		}
+
+		b, err := NewWithConfig(cfg, WithGain(2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := b.DecodeToInt32(verbatimFrame(24, len(ch), [][]int32{ch}), dst); err != nil {
+			t.Fatal(err)
+		}
+		if have, want := dst, []int32{1 << 21, -1 << 21, 1<<23 - 1, -1 << 23, 6}; !slices.Equal(have, want) {
+			t.Errorf("have %v, want %v", have, want)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, g := range []float64{-1, 257, math.NaN(), math.Inf(1)} {
+			if _, err := New(WithGain(g)); !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("%v: have %v, want %v", g, err, ErrInvalidConfig)
+			}
+		}
+	})
+}
+
+func TestLevels(t *testing.T) {
+	var levels [2]Level
+	a, err := NewWithConfig(Config{SampleRate: 44100, SampleSize: 16, NumChannels: 2, FrameSize: 4}, WithLevels())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.OnFrame(func(info FrameInfo, _ []byte) { levels = info.Levels })
+
+	frame := verbatimFrame(16, 4, [][]int32{{16384, -16384, 16384, -16384}, {0, -32768, 0, 0}})
+	want := [2]Level{{Peak: 0.5, RMS: 0.5}, {Peak: 1, RMS: 0.5}}
+	if _, err := a.DecodeFrame(frame); err != nil {
+		t.Fatal(err)
+	}
+	if levels != want {
+		t.Errorf("have %v, want %v", levels, want)
+	}
+
+	if _, err := a.DecodeFrame(silentFrame(nil, 2, 4)); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := levels, [2]Level{}; have != want {
+		t.Errorf("have %v, want %v", have, want)
+	}
+
+	if _, err := a.DecodeToInt16(frame, make([]int16, 8)); err != nil {
+		t.Fatal(err)
+	}
+	if levels != want {
+		t.Errorf("have %v, want %v", levels, want)
+	}
+
+	t.Run("gain", func(t *testing.T) {
+		b, err := NewWithConfig(Config{SampleRate: 44100, SampleSize: 16, NumChannels: 2, FrameSize: 4}, WithLevels(), WithGain(0.5))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.OnFrame(func(info FrameInfo, _ []byte) { levels = info.Levels })
+		if _, err := b.DecodeFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+		if have, want := levels[0], (Level{Peak: 0.25, RMS: 0.25}); have != want {
+			t.Errorf("have %v, want %v", have, want)
+		}
+	})
+}
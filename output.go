@@ -0,0 +1,97 @@
+package alac
+
+import (
+	"fmt"
+	"math"
+)
+
+// OutputSpec is the format of the PCM from Decode, DecodeFrame, DecodeInto,
+// and the PCMReader; see WithOutput. The zero value is what the decoder
+// gives by default: interleaved little endian integers at the bit depth of
+// the stream, with 24 bit samples in 3 bytes. 20 bit samples are given as
+// 24 bit samples with the low 4 bits zero.
+type OutputSpec struct {
+	Format     SampleFormat
+	Layout     Layout
+	Endianness Endianness
+	// Packing applies to 20 and 24 bit samples with FormatInt, see
+	// WithPacking.
+	Packing Packing
+}
+
+// SampleFormat is the encoding of a sample in an OutputSpec.
+type SampleFormat int
+
+const (
+	// FormatInt gives signed integers at the bit depth of the stream, or
+	// at 16 bits with WithDither. This is the default.
+	FormatInt SampleFormat = iota
+	// FormatFloat32 gives IEEE 754 floats of 4 bytes, scaled so full
+	// scale is -1 to 1. Dither and Packing don't apply.
+	FormatFloat32
+)
+
+// Layout is the order of the channels in an OutputSpec.
+type Layout int
+
+const (
+	// Interleaved gives the samples of all channels for each instant in
+	// turn: LRLRLR. This is the default.
+	Interleaved Layout = iota
+	// Planar gives all samples of the first channel of a frame, then all
+	// samples of the second channel: LLLRRR. The PCMReader keeps the frames
+	// apart, so its output is planar per frame.
+	Planar
+)
+
+// Endianness is the byte order of the samples in an OutputSpec.
+type Endianness int
+
+const (
+	// LittleEndian is the byte order of WAV files. This is the default.
+	LittleEndian Endianness = iota
+	// BigEndian is the byte order of AIFF files and network protocols.
+	BigEndian
+)
+
+// WithOutput sets the format of the PCM. It replaces earlier WithBigEndian
+// and WithPacking options, and later ones change the fields they cover.
+// DecodeToInt16 and DecodeToInt32 only look at the Layout. Specs with
+// unknown values fail with ErrInvalidConfig.
+func WithOutput(spec OutputSpec) Option {
+	return func(a *Alac) {
+		a.output = spec
+	}
+}
+
+// Output returns the format of the PCM, see WithOutput.
+func (a *Alac) Output() OutputSpec {
+	return a.output
+}
+
+func (o OutputSpec) check() error {
+	if o.Format < FormatInt || o.Format > FormatFloat32 ||
+		o.Layout < Interleaved || o.Layout > Planar ||
+		o.Endianness < LittleEndian || o.Endianness > BigEndian ||
+		o.Packing < Packed || o.Packing > LSB32 {
+		return fmt.Errorf("%w: output %+v", ErrInvalidConfig, o)
+	}
+	return nil
+}
+
+func (a *Alac) bigEndian() bool {
+	return a.output.Endianness == BigEndian
+}
+
+// putFloat32 writes the samples of one channel to out as floats, starting
+// at offset and stride bytes apart.
+func putFloat32(out []byte, offset, stride int, samples []int32, bits uint8, bigendian bool) {
+	var (
+		scale = float32(math.Ldexp(1, 1-int(bits)))
+		wrap  = 32 - uint(bits)
+	)
+	for i, s := range samples {
+		f := float32(s<<wrap>>wrap) * scale
+		put32(out[offset+i*stride:], int32(math.Float32bits(f)), bigendian)
+	}
+}
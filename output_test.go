@@ -0,0 +1,174 @@
+package alac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"slices"
+	"testing"
+)
+
+// convert is the reference for the OutputSpec conversions.
+func convert(spec OutputSpec, bits int, channels [][]int32) []byte {
+	var order binary.AppendByteOrder = binary.LittleEndian
+	if spec.Endianness == BigEndian {
+		order = binary.BigEndian
+	}
+	sample := func(b []byte, s int32) []byte {
+		if bits == 20 && spec.Format == FormatInt {
+			s <<= 4 // as a 24 bit sample
+		}
+		switch {
+		case spec.Format == FormatFloat32:
+			return order.AppendUint32(b, math.Float32bits(float32(float64(s)/float64(int64(1)<<(bits-1)))))
+		case bits == 16:
+			return order.AppendUint16(b, uint16(s))
+		case bits == 32:
+			return order.AppendUint32(b, uint32(s))
+		case spec.Packing == MSB32:
+			return order.AppendUint32(b, uint32(s)<<8)
+		case spec.Packing == LSB32:
+			return order.AppendUint32(b, uint32(s))
+		default:
+			w := order.AppendUint32(nil, uint32(s)<<8)
+			if spec.Endianness == BigEndian {
+				return append(b, w[:3]...)
+			}
+			return append(b, w[1:]...)
+		}
+	}
+	var out []byte
+	if spec.Layout == Planar {
+		for _, ch := range channels {
+			for _, s := range ch {
+				out = sample(out, s)
+			}
+		}
+		return out
+	}
+	for i := range channels[0] {
+		for _, ch := range channels {
+			out = sample(out, ch[i])
+		}
+	}
+	return out
+}
+
+func TestOutputSpec(t *testing.T) {
+	var (
+		left  = []int32{0, 1, -1, 1000, -1000, 1<<15 - 1, -1 << 15}
+		right = []int32{-1 << 15, 7, 0, -7, 1 << 14, 3, 1<<15 - 1}
+		big   = func(ch []int32, bits int) []int32 {
+			out := slices.Clone(ch)
+			for i := range out {
+				out[i] = out[i]<<(bits-16) + int32(i)
+			}
+			return out
+		}
+		left20, right20 = big(left, 20), big(right, 20)
+		left24, right24 = big(left, 24), big(right, 24)
+		left32, right32 = big(left, 32), big(right, 32)
+	)
+
+	for _, spec := range []OutputSpec{
+		{},
+		{Endianness: BigEndian},
+		{Layout: Planar},
+		{Layout: Planar, Endianness: BigEndian},
+		{Packing: MSB32},
+		{Packing: LSB32, Endianness: BigEndian},
+		{Layout: Planar, Packing: LSB32},
+		{Format: FormatFloat32},
+		{Format: FormatFloat32, Endianness: BigEndian},
+		{Format: FormatFloat32, Layout: Planar, Packing: MSB32},
+	} {
+		for _, c := range []struct {
+			bits     int
+			channels [][]int32
+		}{
+			{16, [][]int32{left}},
+			{16, [][]int32{left, right}},
+			{24, [][]int32{left24}},
+			{24, [][]int32{left24, right24}},
+			{20, [][]int32{left20}},
+			{20, [][]int32{left20, right20}},
+			{32, [][]int32{left32}},
+			{32, [][]int32{left32, right32}},
+		} {
+			cfg := DefaultConfig()
+			cfg.SampleSize = c.bits
+			cfg.NumChannels = len(c.channels)
+			a, err := NewWithConfig(cfg, WithOutput(spec))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have := a.Output(); have != spec {
+				t.Errorf("have %+v, want %+v", have, spec)
+			}
+			frame := verbatimFrame(c.bits, len(left), c.channels)
+			have, err := a.DecodeFrame(frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := convert(spec, c.bits, c.channels); !bytes.Equal(have, want) {
+				t.Errorf("%+v, %d bit, %d channels:\nhave %x\nwant %x", spec, c.bits, len(c.channels), have, want)
+			}
+			if have, want := len(have), a.FrameBytes()*len(left)/cfg.FrameSize; have != want {
+				t.Errorf("have %d, want %d", have, want)
+			}
+
+			samples := make([]int32, len(left)*len(c.channels))
+			if _, err := a.DecodeToInt32(frame, samples); err != nil {
+				t.Fatal(err)
+			}
+			want := slices.Concat(c.channels...)
+			if spec.Layout == Interleaved {
+				want = want[:0]
+				for i := range c.channels[0] {
+					for _, ch := range c.channels {
+						want = append(want, ch[i])
+					}
+				}
+			}
+			if !slices.Equal(samples, want) {
+				t.Errorf("%+v: have %v, want %v", spec, samples, want)
+			}
+		}
+	}
+
+	t.Run("channel map", func(t *testing.T) {
+		a, err := New(WithChannelMap([]int{1, 0, 1}), WithOutput(OutputSpec{Layout: Planar}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		have, err := a.DecodeFrame(verbatimFrame(16, len(left), [][]int32{left, right}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := convert(OutputSpec{Layout: Planar}, 16, [][]int32{right, left, right}); !bytes.Equal(have, want) {
+			t.Errorf("have %x, want %x", have, want)
+		}
+	})
+
+	t.Run("options", func(t *testing.T) {
+		a, err := New(WithPacking(MSB32), WithOutput(OutputSpec{Layout: Planar}), WithBigEndian())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := a.Output(), (OutputSpec{Layout: Planar, Endianness: BigEndian}); have != want {
+			t.Errorf("have %+v, want %+v", have, want)
+		}
+
+		for _, spec := range []OutputSpec{
+			{Format: 2},
+			{Layout: -1},
+			{Endianness: 2},
+			{Packing: 3},
+		} {
+			if _, err := New(WithOutput(spec)); !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("%+v: have %v, want %v", spec, err, ErrInvalidConfig)
+			}
+		}
+	})
+}
@@ -0,0 +1,40 @@
+package alac
+
+import "time"
+
+// Packet is a frame, without a container, with what a sender needs to put
+// it in RTP packets, such as an AirPlay (RAOP) sender.
+type Packet struct {
+	Frame    []byte        // only valid until the fn of NewPacketEncoder returns
+	Samples  int           // samples per channel
+	Position int64         // of the first sample, in samples per channel since the start of the stream
+	Time     time.Duration // of the first sample since the start of the stream
+}
+
+// RTPTimestamp returns the RTP timestamp of the packet, in a stream of
+// which the first sample has timestamp base. RTP timestamps of audio count
+// samples per channel, and wrap around at 32 bits.
+func (p Packet) RTPTimestamp(base uint32) uint32 {
+	return base + uint32(p.Position)
+}
+
+// NewPacketEncoder is NewStreamEncoder, which calls fn with every frame as
+// a Packet. Positions count the frames enc encoded before, so enc should
+// be new, or the stream continues where it left off.
+func NewPacketEncoder(enc *Encoder, fn func(Packet) error) *StreamEncoder {
+	rate := int64(enc.cfg.SampleRate)
+	var s *StreamEncoder
+	s = NewStreamEncoder(enc, func(frame []byte) error {
+		var (
+			samples = s.FrameSamples()
+			pos     = enc.stats.Samples - int64(samples) // the frame is counted already
+		)
+		return fn(Packet{
+			Frame:    frame,
+			Samples:  samples,
+			Position: pos,
+			Time:     time.Duration(pos/rate)*time.Second + time.Duration(pos%rate)*time.Second/time.Duration(rate),
+		})
+	})
+	return s
+}
@@ -0,0 +1,68 @@
+package alac
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPacketEncoder(t *testing.T) {
+	cfg := DefaultConfig()
+	e, err := NewEncoder(cfg, WithMaxPacketSize(600))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := NewWithConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signals := testSignals(44100, 16)
+	pcm := interleavePCM(16, signals["noise"], signals["sine"])
+
+	var packets []Packet
+	s := NewPacketEncoder(e, func(p Packet) error {
+		p.Frame = slices.Clone(p.Frame)
+		packets = append(packets, p)
+		return nil
+	})
+	if _, err := s.Write(pcm); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		out []byte
+		pos int64
+	)
+	for i, p := range packets {
+		if have, want := p.Position, pos; have != want {
+			t.Fatalf("packet %d: have position %d, want %d", i, have, want)
+		}
+		if have, want := p.Time, time.Duration(pos)*time.Second/44100; have != want {
+			t.Errorf("packet %d: have %v, want %v", i, have, want)
+		}
+		samples, err := d.DecodeFrame(p.Frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := p.Samples, len(samples)/4; have != want {
+			t.Errorf("packet %d: have %d samples, want %d", i, have, want)
+		}
+		out = append(out, samples...)
+		pos += int64(p.Samples)
+	}
+	if have, want := len(packets), 44100/352+1; have <= want {
+		t.Errorf("have %d packets, want more than %d", have, want)
+	}
+	if !bytes.Equal(out, pcm) {
+		t.Errorf("output differs")
+	}
+
+	p := Packet{Position: 1000}
+	if have, want := p.RTPTimestamp(0xffffff00), uint32(1000-0x100); have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+}
@@ -0,0 +1,163 @@
+package alac
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// ParallelDecoder decodes the frames of a stream on several goroutines, and
+// hands the PCM back in stream order. ALAC frames don't depend on each
+// other, so this scales with the number of cores, which helps when
+// transcoding long recordings.
+//
+// Every worker has its own Clone of the decoder, so hooks and the warning
+// handler are called from the worker goroutines, concurrently.
+type ParallelDecoder struct {
+	decoders []*Alac
+}
+
+// NewParallelDecoder makes a ParallelDecoder with the configuration of a.
+// With workers < 1 it uses GOMAXPROCS workers.
+func NewParallelDecoder(a *Alac, workers int) *ParallelDecoder {
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	p := &ParallelDecoder{}
+	for range workers {
+		p.decoders = append(p.decoders, a.Clone())
+	}
+	return p
+}
+
+// DecodeReader reads frames from r until io.EOF, decodes them concurrently,
+// and calls fn with the PCM of every frame, in order. It stops at the first
+// error, or when ctx is cancelled. The frames are copied, since they are
+// decoded after the next ReadFrame, which may reuse their buffer, as the
+// one of mp4.File does. The PCM slices are never reused, so fn can keep
+// them. The PCM of a Trimmer is trimmed to
+// what it plays; fn isn't called for frames which are skipped as a whole.
+func (p *ParallelDecoder) DecodeReader(ctx context.Context, r FrameReader, fn func(pcm []byte) error) error {
+	type job struct {
+		frame []byte
+		pcm   []byte
+		err   error
+		done  chan struct{}
+	}
+	var (
+		jobs    = make(chan *job)
+		queue   = make(chan *job, 2*len(p.decoders)) // in stream order
+		readErr = make(chan error, 1)
+		wg      sync.WaitGroup
+		t       = newTrim(r)
+	)
+	ctx, cancel := context.WithCancel(ctx)
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	for _, a := range p.decoders {
+		wg.Go(func() {
+			for {
+				select {
+				case j, ok := <-jobs:
+					if !ok {
+						return
+					}
+					j.pcm, j.err = a.decodeFrame(j.frame)
+					close(j.done)
+				case <-ctx.Done():
+					return
+				}
+			}
+		})
+	}
+
+	wg.Go(func() {
+		defer close(queue)
+		defer close(jobs)
+		for {
+			f, err := r.ReadFrame()
+			if err != nil {
+				if err != io.EOF {
+					readErr <- err
+				}
+				return
+			}
+			j := &job{frame: bytes.Clone(f), done: make(chan struct{})}
+			select {
+			case jobs <- j:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case queue <- j:
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+
+	for i := 0; !t.done(); i++ {
+		var j *job
+		select {
+		case next, ok := <-queue:
+			if !ok {
+				select {
+				case err := <-readErr:
+					return err
+				default:
+				}
+				return ctx.Err()
+			}
+			j = next
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		select {
+		case <-j.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if j.err != nil {
+			return fmt.Errorf("%w (frame %d)", j.err, i)
+		}
+		pcm := t.apply(j.pcm, p.decoders[0].bytespersample)
+		if len(pcm) == 0 {
+			continue
+		}
+		if err := fn(pcm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DecodeAll is DecodeReader for frames in memory, returning the
+// concatenated PCM. On error the PCM decoded so far is returned together
+// with the error.
+func (p *ParallelDecoder) DecodeAll(ctx context.Context, frames [][]byte) ([]byte, error) {
+	var pcm []byte
+	r := frameSlice(frames)
+	err := p.DecodeReader(ctx, &r, func(b []byte) error {
+		pcm = append(pcm, b...)
+		return nil
+	})
+	return pcm, err
+}
+
+// frameSlice is a FrameReader over frames in memory.
+type frameSlice [][]byte
+
+func (f *frameSlice) ReadFrame() ([]byte, error) {
+	if len(*f) == 0 {
+		return nil, io.EOF
+	}
+	frame := (*f)[0]
+	*f = (*f)[1:]
+	return frame, nil
+}
@@ -0,0 +1,92 @@
+package alac
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+type failingReader struct{ err error }
+
+func (r failingReader) ReadFrame() ([]byte, error) {
+	return nil, r.err
+}
+
+func TestParallelDecoder(t *testing.T) {
+	var (
+		frames [][]byte
+		want   []byte
+		ctx    = context.Background()
+	)
+	for i := 0; i < 10; i++ {
+		for in, out := range testFrames {
+			frames = append(frames, mustHex(in))
+			want = append(want, mustHex(out)...)
+		}
+	}
+
+	a, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, workers := range []int{0, 1, 3} {
+		p := NewParallelDecoder(a, workers)
+		have, err := p.DecodeAll(ctx, frames)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(have, want) {
+			t.Errorf("%d workers: output differs", workers)
+		}
+	}
+
+	p := NewParallelDecoder(a, 3)
+
+	t.Run("error", func(t *testing.T) {
+		broken := append(append([][]byte{}, frames[:7]...), []byte{0x20})
+		broken = append(broken, frames[7:]...)
+		have, err := p.DecodeAll(ctx, broken)
+		if !errors.Is(err, ErrTruncatedBitstream) {
+			t.Fatalf("have %v, want %v", err, ErrTruncatedBitstream)
+		}
+		if want := "alac: truncated bitstream: frame header (frame 7)"; err.Error() != want {
+			t.Errorf("have %q, want %q", err, want)
+		}
+		if have, want := len(have), 7*352*4; have != want {
+			t.Errorf("have %d, want %d", have, want)
+		}
+	})
+
+	t.Run("reader error", func(t *testing.T) {
+		fail := errors.New("disk on fire")
+		err := p.DecodeReader(ctx, failingReader{fail}, func([]byte) error { return nil })
+		if have, want := err, fail; have != want {
+			t.Errorf("have %v, want %v", have, want)
+		}
+	})
+
+	t.Run("callback error", func(t *testing.T) {
+		stop := errors.New("stop")
+		r := frameSlice(frames)
+		n := 0
+		err := p.DecodeReader(ctx, &r, func([]byte) error {
+			n++
+			if n == 3 {
+				return stop
+			}
+			return nil
+		})
+		if have, want := err, stop; have != want {
+			t.Errorf("have %v, want %v", have, want)
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		if _, err := p.DecodeAll(ctx, frames); !errors.Is(err, context.Canceled) {
+			t.Errorf("have %v, want %v", err, context.Canceled)
+		}
+	})
+}
@@ -0,0 +1,154 @@
+package alac
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"slices"
+	"sync"
+)
+
+// ParallelEncoder encodes the frames of a stream on several goroutines, and
+// hands them back in stream order: the counterpart of ParallelDecoder.
+// Every frame is encoded on its own, so the frames are the same as those of
+// the Encoder, whatever the number of workers.
+type ParallelEncoder struct {
+	enc     *Encoder
+	workers []*Encoder
+}
+
+// NewParallelEncoder makes a ParallelEncoder with the config and options of
+// e. The frames it encodes count for the MagicCookie, Stats, and Gapless of
+// e, and go to its OnFrame hook. With workers < 1 it uses GOMAXPROCS
+// workers.
+func NewParallelEncoder(e *Encoder, workers int) *ParallelEncoder {
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	p := &ParallelEncoder{enc: e}
+	for range workers {
+		p.workers = append(p.workers, e.clone())
+	}
+	return p
+}
+
+// EncodeReader reads PCM from r until io.EOF, encodes it concurrently in
+// frames of FrameSize samples, and calls fn with every frame, in order. The
+// last frame has the rest of the PCM. Encoders WithMaxPacketSize or
+// WithAdaptiveFrames split frames, as EncodeFrames does. It stops at the
+// first error, or when ctx is cancelled. Errors from r are returned as-is.
+// The frames are never reused, so fn can keep them.
+func (p *ParallelEncoder) EncodeReader(ctx context.Context, r io.Reader, fn func(frame []byte) error) error {
+	type job struct {
+		pcm    []byte
+		frames []splitFrame
+		err    error
+		done   chan struct{}
+	}
+	var (
+		cfg     = p.enc.cfg
+		stride  = p.enc.width * cfg.NumChannels
+		jobs    = make(chan *job)
+		queue   = make(chan *job, 2*len(p.workers)) // in stream order
+		readErr = make(chan error, 1)
+		wg      sync.WaitGroup
+	)
+	ctx, cancel := context.WithCancel(ctx)
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	for _, e := range p.workers {
+		wg.Go(func() {
+			for {
+				select {
+				case j, ok := <-jobs:
+					if !ok {
+						return
+					}
+					j.frames, j.err = e.encodeFrames(j.pcm)
+					for i, f := range j.frames {
+						j.frames[i].frame = slices.Clone(f.frame)
+					}
+					close(j.done)
+				case <-ctx.Done():
+					return
+				}
+			}
+		})
+	}
+
+	wg.Go(func() {
+		defer close(queue)
+		defer close(jobs)
+		for {
+			pcm := make([]byte, stride*cfg.FrameSize)
+			n, err := io.ReadFull(r, pcm)
+			if n > 0 {
+				j := &job{pcm: pcm[:n], done: make(chan struct{})}
+				select {
+				case jobs <- j:
+				case <-ctx.Done():
+					return
+				}
+				select {
+				case queue <- j:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err != nil {
+				if err != io.EOF && err != io.ErrUnexpectedEOF {
+					readErr <- err
+				}
+				return
+			}
+		}
+	})
+
+	for i := 0; ; i++ {
+		var j *job
+		select {
+		case next, ok := <-queue:
+			if !ok {
+				select {
+				case err := <-readErr:
+					return err
+				default:
+				}
+				return ctx.Err()
+			}
+			j = next
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		select {
+		case <-j.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if j.err != nil {
+			return fmt.Errorf("%w (frame %d)", j.err, i)
+		}
+		for _, f := range j.frames {
+			p.enc.addFrame(f.stats, f.frame)
+			if err := fn(f.frame); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// EncodeAll is EncodeReader for PCM in memory, returning the frames. On
+// error the frames encoded so far are returned together with the error.
+func (p *ParallelEncoder) EncodeAll(ctx context.Context, pcm []byte) ([][]byte, error) {
+	var frames [][]byte
+	err := p.EncodeReader(ctx, bytes.NewReader(pcm), func(frame []byte) error {
+		frames = append(frames, frame)
+		return nil
+	})
+	return frames, err
+}
@@ -0,0 +1,115 @@
+package alac
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"testing"
+)
+
+type failingPCM struct{ err error }
+
+func (r failingPCM) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+func TestParallelEncoder(t *testing.T) {
+	wav, err := os.ReadFile("testdata/samples/jane_eyre_5s.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		pcm = wav[bytes.Index(wav, []byte("data"))+8:]
+		cfg = DefaultConfig()
+		ctx = context.Background()
+	)
+	cfg.FrameSize = 1024
+
+	seq, err := NewEncoder(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want [][]byte
+	for b := pcm; len(b) > 0; {
+		n := min(len(b), 4*cfg.FrameSize)
+		frame, err := seq.Encode(b[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, frame)
+		b = b[n:]
+	}
+
+	for _, workers := range []int{0, 1, 3} {
+		e, err := NewEncoder(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		have, err := NewParallelEncoder(e, workers).EncodeAll(ctx, pcm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := len(have), len(want); have != want {
+			t.Fatalf("%d workers: have %d frames, want %d", workers, have, want)
+		}
+		for i := range have {
+			if !bytes.Equal(have[i], want[i]) {
+				t.Errorf("%d workers: frame %d differs", workers, i)
+			}
+		}
+		if !bytes.Equal(e.MagicCookie(), seq.MagicCookie()) {
+			t.Errorf("%d workers: have cookie %x, want %x", workers, e.MagicCookie(), seq.MagicCookie())
+		}
+		if have, want := e.Stats(), seq.Stats(); have != want {
+			t.Errorf("%d workers: have %+v, want %+v", workers, have, want)
+		}
+	}
+
+	e, err := NewEncoder(cfg, WithPreset(PresetFast))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewParallelEncoder(e, 3)
+
+	t.Run("error", func(t *testing.T) {
+		have, err := p.EncodeAll(ctx, pcm[:7*4*cfg.FrameSize+3])
+		if !errors.Is(err, ErrInvalidPCM) {
+			t.Fatalf("have %v, want %v", err, ErrInvalidPCM)
+		}
+		if have, want := len(have), 7; have != want {
+			t.Errorf("have %d, want %d", have, want)
+		}
+	})
+
+	t.Run("reader error", func(t *testing.T) {
+		fail := errors.New("disk on fire")
+		err := p.EncodeReader(ctx, failingPCM{fail}, func([]byte) error { return nil })
+		if have, want := err, fail; have != want {
+			t.Errorf("have %v, want %v", have, want)
+		}
+	})
+
+	t.Run("callback error", func(t *testing.T) {
+		stop := errors.New("stop")
+		n := 0
+		err := p.EncodeReader(ctx, bytes.NewReader(pcm), func([]byte) error {
+			n++
+			if n == 3 {
+				return stop
+			}
+			return nil
+		})
+		if have, want := err, stop; have != want {
+			t.Errorf("have %v, want %v", have, want)
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		if _, err := p.EncodeAll(ctx, pcm); !errors.Is(err, context.Canceled) {
+			t.Errorf("have %v, want %v", err, context.Canceled)
+		}
+	})
+}
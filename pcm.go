@@ -0,0 +1,196 @@
+package alac
+
+import (
+	"fmt"
+)
+
+// DecodeToInt16 decodes a 16 bit frame into dst as interleaved samples, or
+// planar ones with a Planar OutputSpec, and returns the number of samples
+// written: LastFrameSamples() times Channels(). It fails with ErrShortBuffer if dst can't hold the frame, and
+// with ErrUnsupportedBitDepth for streams which aren't 16 bit.
+func (a *Alac) DecodeToInt16(frame []byte, dst []int16) (int, error) {
+	if a.samplesize != 16 {
+		return 0, fmt.Errorf("%w: DecodeToInt16 on a %d bit stream", ErrUnsupportedBitDepth, a.samplesize)
+	}
+	return decodeTo(a, frame, dst)
+}
+
+// DecodeToInt32 decodes a frame into dst as interleaved samples, or planar
+// ones with a Planar OutputSpec, and returns the number of samples written: LastFrameSamples() times Channels(). The
+// samples keep their original range, so a 24 bit stream gives values between
+// -1<<23 and 1<<23-1. It fails with ErrShortBuffer if dst can't hold the
+// frame. The samples go straight from the decoder to dst, without the byte
+// packing of DecodeInto, so this is the cheapest way to get 24 bit audio
+// out, see BenchmarkDecodeToInt32. Like DecodeInto, it doesn't allocate.
+func (a *Alac) DecodeToInt32(frame []byte, dst []int32) (int, error) {
+	return decodeTo(a, frame, dst)
+}
+
+func decodeTo[T int16 | int32](a *Alac, frame []byte, dst []T) (int, error) {
+	info, err := a.decodeSamples(frame)
+	if err != nil {
+		return 0, err
+	}
+	n := info.Samples * a.Channels()
+	if len(dst) < n {
+		return 0, fmt.Errorf("%w: frame has %d samples, dst has room for %d", ErrShortBuffer, n, len(dst))
+	}
+	interleave(a, info, dst[:n])
+	a.frameDone(info, nil)
+	return n, nil
+}
+
+// interleave is writeBytes for typed samples.
+func interleave[T int16 | int32](a *Alac, info FrameInfo, dst []T) {
+	var (
+		n        = info.Samples
+		channels = a.decoded(info)
+		// corrupt frames can overflow the sample size, wrap them the way
+		// writeBytes does
+		wrap = 32 - uint(a.setinfo_sample_size)
+	)
+	if a.channelMap != nil || a.output.Layout == Planar || len(channels) > 2 {
+		m := a.channelMap
+		if m == nil {
+			m = identity[:len(channels)]
+		}
+		step, offset := len(m), 1 // between samples, and between channels
+		if a.output.Layout == Planar {
+			step, offset = 1, n
+		}
+		for i, c := range m {
+			for j, s := range channels[c] {
+				dst[i*offset+j*step] = T(s << wrap >> wrap)
+			}
+		}
+		return
+	}
+
+	left := channels[0]
+	if len(channels) == 1 {
+		for i, s := range left {
+			dst[i] = T(s << wrap >> wrap)
+		}
+		return
+	}
+	right := channels[1]
+	dst = dst[:2*n]
+	for i := range left {
+		dst[2*i] = T(left[i] << wrap >> wrap)
+		dst[2*i+1] = T(right[i] << wrap >> wrap)
+	}
+}
+
+// identity is the channel map of the channels as they are.
+var identity = []int{0, 1, 2, 3, 4, 5, 6, 7}
+
+// decoded returns the channels of a frame, see unmixed.
+func (a *Alac) decoded(info FrameInfo) [][]int32 {
+	if a.multi && a.downmix && info.Channels > 2 {
+		return a.downmixed(a.channels[:info.Channels])
+	}
+	if a.multi {
+		return a.channels[:info.Channels]
+	}
+	a.pair[0], a.pair[1] = a.unmixed(info)
+	return a.pair[:info.Channels]
+}
+
+// unmixed undoes the channel mixing of a frame, in place, applies the gain,
+// measures the levels, and returns the channels. right is nil for mono
+// frames.
+func (a *Alac) unmixed(info FrameInfo) (left, right []int32) {
+	left, right = a.unmixElement(info)
+	if a.hasGain {
+		applyGain(left, a.gainQ16, a.setinfo_sample_size)
+		applyGain(right, a.gainQ16, a.setinfo_sample_size)
+	}
+	if a.levels {
+		measureLevels(&a.frameLevels[0], left, a.setinfo_sample_size)
+		measureLevels(&a.frameLevels[1], right, a.setinfo_sample_size)
+	}
+	return left, right
+}
+
+// unmixElement undoes the channel mixing of the element of the header
+// info, in place, and returns its channels. right is nil for mono
+// elements.
+func (a *Alac) unmixElement(info FrameInfo) (left, right []int32) {
+	n := info.Samples
+	shift := uint(info.ShiftBits)
+	if a.setinfo_sample_size == 16 {
+		shift = 0 // writeBytes ignores the shifted bits for 16 bit streams
+	}
+	left = a.outputsamples_buffer_a[:n]
+	if info.Channels == 2 {
+		right = a.outputsamples_buffer_b[:n]
+	}
+	unmix(left, right, a.uncompressed_bytes_buffer_a, a.uncompressed_bytes_buffer_b, shift, uint8(info.MixBits), uint8(info.MixRes))
+	return left, right
+}
+
+// keepChannels unmixes the element of the header info, which is decoded,
+// and copies its channels to a.channels from channel c on, with the gain
+// and the levels, so the buffers of the element are free for the next
+// one.
+func (a *Alac) keepChannels(c int, info FrameInfo) {
+	a.pair[0], a.pair[1] = a.unmixElement(info)
+	for i, samples := range a.pair[:info.Channels] {
+		if c+i == len(a.channels) {
+			a.channels = append(a.channels, nil)
+		}
+		kept := append(a.channels[c+i][:0], samples...)
+		if a.hasGain {
+			applyGain(kept, a.gainQ16, a.setinfo_sample_size)
+		}
+		if a.levels && c+i < len(a.frameLevels) {
+			measureLevels(&a.frameLevels[c+i], kept, a.setinfo_sample_size)
+		}
+		a.channels[c+i] = kept
+	}
+}
+
+// writeMapped is writeBytes for WithChannelMap, WithGain, WithLevels, 20 and
+// 32 bit streams, and the OutputSpec formats writeBytes doesn't do.
+func (a *Alac) writeMapped(info FrameInfo, outbuffer []byte) {
+	var (
+		channels = a.decoded(info)
+		m        = a.channelMap
+	)
+	if m == nil {
+		m = identity[:len(channels)]
+	}
+	if a.setinfo_sample_size == 20 && a.output.Format == FormatInt {
+		// like Apple's decoder, give 20 bit samples in the top of 24 bits
+		for _, samples := range channels {
+			for j := range samples {
+				samples[j] <<= 4
+			}
+		}
+	}
+	stride := a.bytespersample
+	width := stride / len(m)
+	for i, c := range m {
+		samples := channels[c]
+		offset := i * width
+		if a.output.Layout == Planar {
+			offset, stride = i*info.Samples*width, width
+		}
+		switch {
+		case a.output.Format == FormatFloat32:
+			putFloat32(outbuffer, offset, stride, samples, a.setinfo_sample_size, a.bigEndian())
+		case a.setinfo_sample_size == 16:
+			for j, s := range samples {
+				put16(outbuffer[offset+j*stride:], int16(s), a.bigEndian())
+			}
+		case a.setinfo_sample_size == 32:
+			for j, s := range samples {
+				put32(outbuffer[offset+j*stride:], s, a.bigEndian())
+			}
+		case a.dither != NoDither && a.setinfo_sample_size == 24:
+			a.ditherer.run(outbuffer, offset, stride, samples, i, a.dither == DitherShaped, a.bigEndian())
+		default:
+			pack24(outbuffer, offset, stride, samples, a.bigEndian(), a.output.Packing)
+		}
+	}
+}
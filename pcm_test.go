@@ -0,0 +1,87 @@
+package alac
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func TestDecodeToInt16(t *testing.T) {
+	a, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := make([]int16, 352*2)
+	for in, out := range testFrames {
+		n, err := a.DecodeToInt16(mustHex(in), dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := n, 352*2; have != want {
+			t.Fatalf("have %d, want %d", have, want)
+		}
+		want := mustHex(out)
+		for i, s := range dst[:n] {
+			if have, want := s, int16(binary.LittleEndian.Uint16(want[2*i:])); have != want {
+				t.Fatalf("sample %d: have %d, want %d", i, have, want)
+			}
+		}
+	}
+
+	if _, err := a.DecodeToInt16(testFrame("20"), dst[:100]); !errors.Is(err, ErrShortBuffer) {
+		t.Errorf("have %v, want %v", err, ErrShortBuffer)
+	}
+	if have, want := a.LastFrameSamples(), 0; have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+
+	b, err := NewWithConfig(Config{SampleRate: 44100, SampleSize: 24, NumChannels: 2, FrameSize: 352})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.DecodeToInt16(testFrame("20"), dst); !errors.Is(err, ErrUnsupportedBitDepth) {
+		t.Errorf("have %v, want %v", err, ErrUnsupportedBitDepth)
+	}
+}
+
+func TestDecodeToInt32(t *testing.T) {
+	a, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := make([]int32, 352*2)
+	for in, out := range testFrames {
+		n, err := a.DecodeToInt32(mustHex(in), dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := mustHex(out)
+		for i, s := range dst[:n] {
+			if have, want := s, int32(int16(binary.LittleEndian.Uint16(want[2*i:]))); have != want {
+				t.Fatalf("sample %d: have %d, want %d", i, have, want)
+			}
+		}
+	}
+
+	for _, channels := range [][][]int32{
+		{{1 << 20, -1 << 23, 1<<23 - 1}},
+		{{1 << 20, -1 << 23, 1<<23 - 1}, {-5, 0, 5}},
+	} {
+		b, err := NewWithConfig(Config{SampleRate: 44100, SampleSize: 24, NumChannels: len(channels), FrameSize: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := b.DecodeToInt32(verbatimFrame(24, 3, channels), dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := n, 3*len(channels); have != want {
+			t.Fatalf("have %d, want %d", have, want)
+		}
+		for i, s := range dst[:n] {
+			if have, want := s, channels[i%len(channels)][i/len(channels)]; have != want {
+				t.Errorf("sample %d: have %d, want %d", i, have, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package alac
+
+import (
+	"fmt"
+	"io"
+)
+
+// writeToSize is the size of the writes of PCMReader.WriteTo, unless frames
+// are larger.
+const writeToSize = 64 << 10
+
+// PCMReader is an io.Reader of the PCM of a stream of frames, see
+// NewPCMReader. It's also an io.WriterTo, which io.Copy uses.
+type PCMReader struct {
+	dec     *Alac
+	src     FrameReader
+	buf     []byte
+	pending []byte // decoded, but not read yet
+	trim    trim
+	frame   int
+	err     error
+}
+
+// NewPCMReader returns a reader of the PCM dec decodes from the frames of
+// src, such as a demuxer. Frames are decoded as the PCM is read, one at a
+// time. The reader returns io.EOF after the PCM of the last frame, and
+// otherwise the first error of src or dec; decode errors are wrapped with
+// the frame number. The PCM of a Trimmer is trimmed to what it plays.
+func NewPCMReader(dec *Alac, src FrameReader) *PCMReader {
+	return &PCMReader{
+		dec:  dec,
+		src:  src,
+		buf:  make([]byte, dec.FrameBytes()),
+		trim: newTrim(src),
+	}
+}
+
+// Read reads decoded PCM.
+func (r *PCMReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.next()
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// next decodes the next frame.
+func (r *PCMReader) next() {
+	if r.trim.done() {
+		r.err = io.EOF
+		return
+	}
+	f, err := r.src.ReadFrame()
+	if err != nil {
+		r.err = err
+		return
+	}
+	pcm, err := r.dec.decodeGrow(&r.buf, f)
+	if err != nil {
+		r.err = fmt.Errorf("%w (frame %d)", err, r.frame)
+		return
+	}
+	r.pending = r.trim.apply(pcm, r.dec.bytespersample)
+	r.frame++
+}
+
+// WriteTo writes the PCM of the rest of the stream to w, in writes of about
+// 64KB. The frames are decoded right into the buffer of the writes, so
+// there are no copies. It returns nil at the end of the stream, and
+// otherwise the first error of src, dec, or w.
+func (r *PCMReader) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	write := func(b []byte) error {
+		if len(b) == 0 {
+			return nil
+		}
+		n, err := w.Write(b)
+		total += int64(n)
+		if err != nil && r.err == nil {
+			r.err = err
+		}
+		return err
+	}
+
+	if err := write(r.pending); err != nil {
+		return total, err
+	}
+	r.pending = nil
+	if size := max(writeToSize, r.dec.FrameBytes()); len(r.buf) < size {
+		r.buf = make([]byte, size)
+	}
+	batch := r.buf[:0]
+	for r.err == nil {
+		if cap(batch)-len(batch) < r.dec.FrameBytes() {
+			if err := write(batch); err != nil {
+				return total, err
+			}
+			batch = batch[:0]
+		}
+		if r.trim.done() {
+			r.err = io.EOF
+			break
+		}
+		f, err := r.src.ReadFrame()
+		if err != nil {
+			r.err = err
+			break
+		}
+		free := batch[len(batch):cap(batch)]
+		pcm, err := r.dec.decodeGrow(&free, f)
+		if err != nil {
+			r.err = fmt.Errorf("%w (frame %d)", err, r.frame)
+			break
+		}
+		r.frame++
+		played := r.trim.apply(pcm, r.dec.bytespersample)
+		if cap(free) == cap(batch)-len(batch) {
+			if cap(played) != cap(pcm) {
+				copy(pcm, played) // the start is skipped
+			}
+			batch = batch[:len(batch)+len(played)]
+			continue
+		}
+		pcm = played
+		// too large for the batch, decodeGrow allocated
+		if err := write(batch); err != nil {
+			return total, err
+		}
+		if err := write(pcm); err != nil {
+			return total, err
+		}
+		batch = batch[:0]
+	}
+	if err := write(batch); err != nil {
+		return total, err
+	}
+	if r.err == io.EOF {
+		return total, nil
+	}
+	return total, r.err
+}
@@ -0,0 +1,130 @@
+package alac
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestPCMReader(t *testing.T) {
+	var (
+		frames [][]byte
+		want   []byte
+	)
+	for in, out := range testFrames {
+		frames = append(frames, mustHex(in))
+		want = append(want, mustHex(out)...)
+	}
+	a, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := frameSlice(frames)
+	have, err := io.ReadAll(NewPCMReader(a, &src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(have, want) {
+		t.Errorf("output differs")
+	}
+
+	src = frameSlice(frames)
+	if err := iotest.TestReader(NewPCMReader(a, &src), want); err != nil {
+		t.Error(err)
+	}
+
+	t.Run("error", func(t *testing.T) {
+		src := frameSlice(append([][]byte{frames[0], {0x20}}, frames[1:]...))
+		have, err := io.ReadAll(NewPCMReader(a, &src))
+		if !errors.Is(err, ErrTruncatedBitstream) {
+			t.Errorf("have %v, want %v", err, ErrTruncatedBitstream)
+		}
+		if have, want := len(have), 352*4; have != want {
+			t.Errorf("have %d, want %d", have, want)
+		}
+	})
+}
+
+// countWriter counts the writes to it.
+type countWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(p)
+}
+
+func TestPCMReaderWriteTo(t *testing.T) {
+	var (
+		frames [][]byte
+		want   []byte
+	)
+	for in, out := range testFrames {
+		frames = append(frames, mustHex(in))
+		want = append(want, mustHex(out)...)
+	}
+	a, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a partial read first
+	src := frameSlice(frames)
+	r := NewPCMReader(a, &src)
+	head := make([]byte, 100)
+	if _, err := io.ReadFull(r, head); err != nil {
+		t.Fatal(err)
+	}
+	var w countWriter
+	n, err := io.Copy(&w, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := n, int64(len(want)-100); have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+	if have := append(head, w.Bytes()...); !bytes.Equal(have, want) {
+		t.Errorf("output differs")
+	}
+	if have, want := w.writes, 2; have != want { // the rest of the first frame, the others
+		t.Errorf("have %d writes, want %d", have, want)
+	}
+	if n, err := r.Read(head); n != 0 || err != io.EOF {
+		t.Errorf("have %d, %v, want 0, EOF", n, err)
+	}
+
+	t.Run("batches", func(t *testing.T) {
+		var many [][]byte
+		for range 100 {
+			many = append(many, frames...)
+		}
+		src := frameSlice(many)
+		var w countWriter
+		if _, err := NewPCMReader(a, &src).WriteTo(&w); err != nil {
+			t.Fatal(err)
+		}
+		if have, want := w.Len(), 100*len(want); have != want {
+			t.Errorf("have %d, want %d", have, want)
+		}
+		if have, want := w.writes, (w.Len()+writeToSize-1)/writeToSize; have > want+1 {
+			t.Errorf("have %d writes, want about %d", have, want)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		src := frameSlice(append([][]byte{frames[0], {0x20}}, frames[1:]...))
+		var w bytes.Buffer
+		n, err := NewPCMReader(a, &src).WriteTo(&w)
+		if !errors.Is(err, ErrTruncatedBitstream) {
+			t.Errorf("have %v, want %v", err, ErrTruncatedBitstream)
+		}
+		if have, want := n, int64(352*4); have != want {
+			t.Errorf("have %d, want %d", have, want)
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package alac
+
+import (
+	"context"
+	"fmt"
+)
+
+// Chunk is the result of decoding one frame in a Pipeline.
+type Chunk struct {
+	PCM     []byte // nil on error
+	Samples int    // samples per channel
+	Err     error
+}
+
+// Pipeline decodes frames on its own goroutine: send frames on In, and
+// receive their Chunks, in the same order, on Out.
+//
+// The pipeline stops when In is closed, after the remaining chunks are
+// delivered, or when its context is cancelled. Either way Out is closed
+// then. After a cancel nothing reads In anymore, so senders should select
+// on the context too.
+type Pipeline struct {
+	in  chan []byte
+	out chan Chunk
+}
+
+// NewPipeline starts a Pipeline which decodes with a. In and Out have room
+// for buffer frames each, so a slow reader of Out holds up the senders
+// after that. a belongs to the pipeline until Out is closed.
+//
+// A frame which fails to decode gives a Chunk with Err set, and the
+// pipeline carries on with the next frame.
+func NewPipeline(ctx context.Context, a *Alac, buffer int) *Pipeline {
+	p := &Pipeline{
+		in:  make(chan []byte, buffer),
+		out: make(chan Chunk, buffer),
+	}
+	go p.run(ctx, a)
+	return p
+}
+
+// In is where the frames go. Close it after the last frame.
+func (p *Pipeline) In() chan<- []byte {
+	return p.in
+}
+
+// Out has a Chunk for every frame sent on In.
+func (p *Pipeline) Out() <-chan Chunk {
+	return p.out
+}
+
+func (p *Pipeline) run(ctx context.Context, a *Alac) {
+	defer close(p.out)
+	for i := 0; ; i++ {
+		var frame []byte
+		select {
+		case f, ok := <-p.in:
+			if !ok {
+				return
+			}
+			frame = f
+		case <-ctx.Done():
+			return
+		}
+
+		var c Chunk
+		if pcm, err := a.decodeFrame(frame); err != nil {
+			c.Err = fmt.Errorf("%w (frame %d)", err, i)
+		} else {
+			c.PCM, c.Samples = pcm, a.LastFrameSamples()
+		}
+
+		select {
+		case p.out <- c:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package alac
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestPipeline(t *testing.T) {
+	a, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		frames [][]byte
+		want   [][]byte
+	)
+	for in, out := range testFrames {
+		frames = append(frames, mustHex(in))
+		want = append(want, mustHex(out))
+	}
+	// a broken frame in the middle doesn't stop the pipeline
+	frames = append(frames[:2], append([][]byte{{0x20}}, frames[2:]...)...)
+	want = append(want[:2], append([][]byte{nil}, want[2:]...)...)
+
+	p := NewPipeline(context.Background(), a, 2)
+	go func() {
+		for _, f := range frames {
+			p.In() <- f
+		}
+		close(p.In())
+	}()
+
+	var i int
+	for c := range p.Out() {
+		if i == 2 {
+			if !errors.Is(c.Err, ErrTruncatedBitstream) {
+				t.Errorf("have %v, want %v", c.Err, ErrTruncatedBitstream)
+			}
+			if want := "alac: truncated bitstream: frame header (frame 2)"; c.Err == nil || c.Err.Error() != want {
+				t.Errorf("have %v, want %q", c.Err, want)
+			}
+		} else {
+			if c.Err != nil {
+				t.Fatal(c.Err)
+			}
+			if have, want := c.Samples, 352; have != want {
+				t.Errorf("have %d, want %d", have, want)
+			}
+		}
+		if !bytes.Equal(c.PCM, want[i]) {
+			t.Errorf("chunk %d differs", i)
+		}
+		i++
+	}
+	if have, want := i, len(frames); have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+
+	t.Run("cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		p := NewPipeline(ctx, a, 0)
+		p.In() <- frames[0]
+		if c := <-p.Out(); c.Err != nil {
+			t.Fatal(c.Err)
+		}
+		cancel()
+		if _, ok := <-p.Out(); ok {
+			t.Errorf("Out isn't closed")
+		}
+	})
+}
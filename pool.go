@@ -0,0 +1,32 @@
+package alac
+
+import (
+	"sync"
+)
+
+// BufferPool recycles the PCM slices returned by Decode and DecodeFrame, for
+// servers which run many decoders at once. Give it to the decoders with
+// WithBufferPool, and hand slices back with Release when you're done with
+// them. The zero value is ready to use, and it's safe for concurrent use.
+type BufferPool struct {
+	pool sync.Pool
+}
+
+// get returns a slice of n bytes, with undefined contents.
+func (p *BufferPool) get(n int) []byte {
+	if v, ok := p.pool.Get().(*[]byte); ok && cap(*v) >= n {
+		return (*v)[:n]
+	}
+	return make([]byte, n)
+}
+
+// Release returns a slice from Decode or DecodeFrame to the pool. The slice
+// must not be used afterwards. Slices from elsewhere are fine too, as long
+// as nothing else uses them.
+func (p *BufferPool) Release(b []byte) {
+	if cap(b) == 0 {
+		return
+	}
+	b = b[:cap(b)]
+	p.pool.Put(&b)
+}
@@ -0,0 +1,38 @@
+package alac
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBufferPool(t *testing.T) {
+	var pool BufferPool
+	a, err := New(WithBufferPool(&pool))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := New(WithBufferPool(&pool))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for in, out := range testFrames {
+		for _, dec := range []*Alac{a, b} {
+			have, err := dec.DecodeFrame(mustHex(in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := mustHex(out); !bytes.Equal(have, want) {
+				t.Errorf("output differs for frame %s...", in[:16])
+			}
+			pool.Release(have)
+		}
+	}
+
+	// a released slice which is too small is not reused
+	pool.Release(make([]byte, 10))
+	if have, want := len(a.Decode(testFrame("20"))), 352*4; have != want {
+		t.Errorf("have %d, want %d", have, want)
+	}
+	pool.Release(nil)
+}
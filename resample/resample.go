@@ -0,0 +1,211 @@
+// Package resample converts decoded ALAC to another sample rate, such as
+// 96kHz files for 48kHz only outputs. Resamplers take the interleaved
+// samples of alac.Alac.DecodeToInt32:
+//
+//	r, err := resample.NewPolyphase(cfg, 48000)
+//	...
+//	var out []int32
+//	for _, frame := range frames {
+//		n, err := dec.DecodeToInt32(frame, samples)
+//		...
+//		out = r.Resample(out[:0], samples[:n])
+//		// play out
+//	}
+//	out = r.Flush(out[:0])
+package resample
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/alicebob/alac"
+)
+
+// Resampler converts interleaved samples to another sample rate. It keeps
+// state between calls, so a stream can be fed in pieces of any size; the
+// output lags the input by a few samples, which Flush drains at the end of
+// the stream. Implementations other than the ones in this package are
+// welcome.
+type Resampler interface {
+	// Resample converts src and appends the result to dst.
+	Resample(dst, src []int32) []int32
+	// Flush appends the rest of the stream to dst, and resets the
+	// Resampler for a new stream.
+	Flush(dst []int32) []int32
+}
+
+// maxPhases limits the table of NewPolyphase.
+const maxPhases = 4096
+
+// NewLinear returns a Resampler which interpolates linearly between the
+// samples. It's cheap, and works for any pair of rates, but it doesn't
+// filter, so it aliases when lowering the rate, and it dulls the highs.
+func NewLinear(cfg alac.Config, to int) (Resampler, error) {
+	r, err := newResampler(cfg, to, 1)
+	if err != nil {
+		return nil, err
+	}
+	r.kernel = func(u float64) float64 { return max(0, 1-math.Abs(u)) }
+	return r, nil
+}
+
+// NewPolyphase returns a Resampler with a windowed sinc filter, which
+// keeps the audio clean, at about 64 multiplications per sample. The rates
+// must have a ratio which reduces to at most 4096 output samples per cycle;
+// all the usual rates do.
+func NewPolyphase(cfg alac.Config, to int) (Resampler, error) {
+	// cutoff somewhat below the lowest Nyquist frequency, relative to the
+	// input rate
+	cutoff := 0.95 * min(1, float64(to)/float64(cfg.SampleRate))
+	const zeroCrossings = 16 // per side, at the cutoff
+	r, err := newResampler(cfg, to, int(math.Ceil(zeroCrossings/cutoff)))
+	if err != nil {
+		return nil, err
+	}
+	if r.l > maxPhases {
+		return nil, fmt.Errorf("%w: can't resample %d Hz to %d Hz", alac.ErrInvalidConfig, cfg.SampleRate, to)
+	}
+	if r.l == r.m {
+		cutoff = 1 // no filter needed, which makes it an exact copy
+	}
+	h := float64(r.half)
+	r.kernel = func(u float64) float64 {
+		if math.Abs(u) >= h {
+			return 0
+		}
+		x := math.Pi * u / h // Blackman window
+		w := 0.42 + 0.5*math.Cos(x) + 0.08*math.Cos(2*x)
+		return cutoff * sinc(cutoff*u) * w
+	}
+	r.table = make([]float64, r.l*2*int64(r.half))
+	for p := range r.l {
+		r.taps(p, r.table[p*2*int64(r.half):][:2*r.half])
+	}
+	return r, nil
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// resampler converts the rate by l/m, with a kernel which spans half input
+// frames on each side of the output.
+type resampler struct {
+	channels int
+	lo, hi   float64 // range of the samples
+	l, m     int64
+	half     int
+	kernel   func(u float64) float64 // in input frames
+	table    []float64               // taps of every phase, or nil
+
+	buf     []float64 // interleaved input, from half-1 frames before the next output
+	pos     int64     // of the next output in buf, in 1/l frames
+	in      int64     // input frames of the stream
+	out     int64     // output frames of the stream
+	scratch []float64 // taps, without a table
+}
+
+func newResampler(cfg alac.Config, to, half int) (*resampler, error) {
+	if cfg.SampleRate <= 0 || to <= 0 {
+		return nil, fmt.Errorf("%w: can't resample %d Hz to %d Hz", alac.ErrInvalidConfig, cfg.SampleRate, to)
+	}
+	if cfg.SampleSize < 8 || cfg.SampleSize > 32 {
+		return nil, fmt.Errorf("%w: %d bit samples", alac.ErrUnsupportedBitDepth, cfg.SampleSize)
+	}
+	if cfg.NumChannels < 1 {
+		return nil, fmt.Errorf("%w: %d channels", alac.ErrInvalidConfig, cfg.NumChannels)
+	}
+	g := gcd(int64(cfg.SampleRate), int64(to))
+	r := &resampler{
+		channels: cfg.NumChannels,
+		hi:       float64(int64(1)<<(cfg.SampleSize-1) - 1),
+		lo:       -float64(int64(1) << (cfg.SampleSize - 1)),
+		l:        int64(to) / g,
+		m:        int64(cfg.SampleRate) / g,
+		half:     half,
+	}
+	r.reset()
+	return r, nil
+}
+
+func gcd(a, b int64) int64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+func (r *resampler) reset() {
+	// the first output is at input frame 0, which has half-1 frames before
+	// it
+	r.buf = append(r.buf[:0], make([]float64, (r.half-1)*r.channels)...)
+	r.pos = int64(r.half-1) * r.l
+	r.in, r.out = 0, 0
+}
+
+// taps sets the kernel of phase p, for the input frames from half-1 before
+// the output to half after it.
+func (r *resampler) taps(p int64, taps []float64) {
+	sum := 0.0
+	for j := range taps {
+		taps[j] = r.kernel(float64(p)/float64(r.l) + float64(r.half-1-j))
+		sum += taps[j]
+	}
+	for j := range taps {
+		taps[j] /= sum // no ripple at DC
+	}
+}
+
+func (r *resampler) Resample(dst, src []int32) []int32 {
+	for _, s := range src {
+		r.buf = append(r.buf, float64(s))
+	}
+	r.in += int64(len(src) / r.channels)
+	return r.run(dst, -1)
+}
+
+func (r *resampler) Flush(dst []int32) []int32 {
+	r.buf = append(r.buf, make([]float64, r.half*r.channels)...)
+	dst = r.run(dst, (r.in*r.l+r.m-1)/r.m)
+	r.reset()
+	return dst
+}
+
+// run appends the outputs for which there is enough input, up to frame
+// limit of the stream if limit >= 0, and drops the input which is no longer
+// needed.
+func (r *resampler) run(dst []int32, limit int64) []int32 {
+	width := 2 * r.half
+	frames := int64(len(r.buf) / r.channels)
+	for r.pos/r.l+int64(r.half) < frames && (limit < 0 || r.out < limit) {
+		base, p := r.pos/r.l, r.pos%r.l
+		var taps []float64
+		if r.table != nil {
+			taps = r.table[p*int64(width):][:width]
+		} else {
+			if len(r.scratch) != width {
+				r.scratch = make([]float64, width)
+			}
+			r.taps(p, r.scratch)
+			taps = r.scratch
+		}
+		first := (int(base) - r.half + 1) * r.channels
+		for c := range r.channels {
+			y := 0.0
+			for j, t := range taps {
+				y += t * r.buf[first+j*r.channels+c]
+			}
+			dst = append(dst, int32(min(max(math.Round(y), r.lo), r.hi)))
+		}
+		r.pos += r.m
+		r.out++
+	}
+	if drop := min(int(r.pos/r.l)-r.half+1, int(frames)); drop > 0 {
+		r.buf = r.buf[:copy(r.buf, r.buf[drop*r.channels:])]
+		r.pos -= int64(drop) * r.l
+	}
+	return dst
+}
@@ -0,0 +1,139 @@
+package resample
+
+import (
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/alicebob/alac"
+)
+
+// tone returns n interleaved stereo samples of a sine of freq Hz, at half
+// of 24 bit full scale.
+func tone(rate, freq float64, n int) []int32 {
+	var s []int32
+	for i := range n {
+		v := int32(math.Round(1 << 22 * math.Sin(2*math.Pi*freq*float64(i)/rate)))
+		s = append(s, v, v)
+	}
+	return s
+}
+
+// rms of the left channel, relative to the amplitude of tone, skipping the
+// edges.
+func rms(s []int32) float64 {
+	sum, n := 0.0, 0
+	for i := 2 * 200; i < len(s)-2*200; i += 2 {
+		sum += float64(s[i]) * float64(s[i])
+		n++
+	}
+	return math.Sqrt(sum/float64(n)) / (1 << 22)
+}
+
+func TestResample(t *testing.T) {
+	cfg := alac.Config{SampleRate: 96000, SampleSize: 24, NumChannels: 2}
+	db := func(v float64) float64 { return 20 * math.Log10(v) }
+
+	for name, newR := range map[string]func(alac.Config, int) (Resampler, error){
+		"linear":    NewLinear,
+		"polyphase": NewPolyphase,
+	} {
+		t.Run(name, func(t *testing.T) {
+			for _, c := range []struct{ from, to, freq float64 }{
+				{96000, 48000, 1000},
+				{44100, 48000, 1000},
+				{48000, 44100, 10000},
+				{48000, 48000, 1000},
+			} {
+				if name == "linear" && c.freq > 5000 {
+					continue // linear interpolation dulls the highs
+				}
+				cfg := cfg
+				cfg.SampleRate = int(c.from)
+				r, err := newR(cfg, int(c.to))
+				if err != nil {
+					t.Fatal(err)
+				}
+				in := tone(c.from, c.freq, 10000)
+				out := r.Resample(nil, in)
+				out = r.Flush(out)
+				if have, want := len(out), 2*int(math.Ceil(10000*c.to/c.from)); have != want {
+					t.Errorf("%v: have %d, want %d", c, have, want)
+				}
+				// the tone keeps its level, a sine has an RMS of 1/√2
+				if have := db(rms(out) * math.Sqrt2); math.Abs(have) > 0.3 {
+					t.Errorf("%v: level is %.2f dB", c, have)
+				}
+				// and its shape
+				limit := -80.0
+				if name == "linear" {
+					limit = -20
+				}
+				if want := tone(c.to, c.freq, len(out)/2); db(rmsDiff(out, want)) > limit {
+					t.Errorf("%v: differs by %.1f dB", c, db(rmsDiff(out, want)))
+				}
+			}
+		})
+	}
+
+	t.Run("copy", func(t *testing.T) {
+		r, err := NewPolyphase(cfg, 96000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		in := tone(96000, 1000, 1000)
+		if out := r.Flush(r.Resample(nil, in)); !slices.Equal(out, in) {
+			t.Errorf("output differs")
+		}
+	})
+
+	t.Run("alias", func(t *testing.T) {
+		// 30kHz folds to 18kHz at 48kHz, unless it is filtered out
+		r, err := NewPolyphase(cfg, 48000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := r.Flush(r.Resample(nil, tone(96000, 30000, 10000)))
+		if have := db(rms(out) * math.Sqrt2); have > -60 {
+			t.Errorf("alias at %.1f dB", have)
+		}
+	})
+
+	t.Run("pieces", func(t *testing.T) {
+		r, err := NewPolyphase(alac.Config{SampleRate: 44100, SampleSize: 24, NumChannels: 2}, 48000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		in := tone(44100, 1000, 5000)
+		want := r.Flush(r.Resample(nil, in))
+		var have []int32
+		for i := 0; i < len(in); i += 2 * 352 {
+			have = r.Resample(have, in[i:min(i+2*352, len(in))])
+		}
+		if have = r.Flush(have); !slices.Equal(have, want) {
+			t.Errorf("output differs")
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		if _, err := NewPolyphase(cfg, 0); err == nil {
+			t.Errorf("no error")
+		}
+		if _, err := NewPolyphase(cfg, 96001); err == nil {
+			t.Errorf("no error")
+		}
+		if _, err := NewLinear(cfg, 96001); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// rmsDiff is the rms of the difference of the left channels, relative to
+// the amplitude of tone, skipping the edges.
+func rmsDiff(a, b []int32) float64 {
+	d := make([]int32, len(a))
+	for i := range a {
+		d[i] = a[i] - b[i]
+	}
+	return rms(d)
+}
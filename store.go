@@ -0,0 +1,40 @@
+package alac
+
+// pack24LE is pack24 for packed little endian output, eight samples at a
+// time: left and right interleaved, or only left when right is nil. It
+// returns the number of samples per channel done, pack24 does the rest.
+func pack24LE(out []byte, left, right []int32) int {
+	if right == nil {
+		n := len(left) &^ 7
+		for i := 0; i < n; i += 8 {
+			s := left[i : i+8 : i+8]
+			w0, w1, w2 := words24(
+				low24(s[0]), low24(s[1]), low24(s[2]), low24(s[3]),
+				low24(s[4]), low24(s[5]), low24(s[6]), low24(s[7]),
+			)
+			store24x8(out, 3*i, w0, w1, w2)
+		}
+		return n
+	}
+
+	n := len(left) &^ 3
+	right = right[:len(left)]
+	for i := 0; i < n; i += 4 {
+		l, r := left[i:i+4:i+4], right[i:i+4:i+4]
+		w0, w1, w2 := words24(
+			low24(l[0]), low24(r[0]), low24(l[1]), low24(r[1]),
+			low24(l[2]), low24(r[2]), low24(l[3]), low24(r[3]),
+		)
+		store24x8(out, 6*i, w0, w1, w2)
+	}
+	return n
+}
+
+func low24(s int32) uint64 {
+	return uint64(uint32(s) & 0xffffff)
+}
+
+// words24 packs 8 24 bit values into 3 little endian words.
+func words24(a, b, c, d, e, f, g, h uint64) (w0, w1, w2 uint64) {
+	return a | b<<24 | c<<48, c>>16 | d<<8 | e<<32 | f<<56, f>>8 | g<<16 | h<<40
+}
@@ -0,0 +1,13 @@
+//go:build purego || !(amd64 || arm64)
+
+package alac
+
+import "encoding/binary"
+
+// store24x8 writes the words from words24 to out[off:off+24].
+func store24x8(out []byte, off int, w0, w1, w2 uint64) {
+	b := out[off : off+24]
+	binary.LittleEndian.PutUint64(b, w0)
+	binary.LittleEndian.PutUint64(b[8:], w1)
+	binary.LittleEndian.PutUint64(b[16:], w2)
+}
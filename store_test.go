@@ -0,0 +1,56 @@
+package alac
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPack24LE(t *testing.T) {
+	for n := 0; n <= 20; n++ {
+		left, right := make([]int32, n), make([]int32, n)
+		for i := range left {
+			left[i], right[i] = int32(i*313131-77), int32(i*-7777-900)<<8>>8
+		}
+		for _, channels := range []int{1, 2} {
+			r := right
+			if channels == 1 {
+				r = nil
+			}
+			want := make([]byte, 3*channels*n)
+			pack24(want, 0, 3*channels, left, false, Packed)
+			if r != nil {
+				pack24(want, 3, 3*channels, right, false, Packed)
+			}
+			have := make([]byte, len(want))
+			done := pack24LE(have, left, r)
+			pack24(have, 3*channels*done, 3*channels, left[done:], false, Packed)
+			if r != nil {
+				pack24(have, 3*channels*done+3, 3*channels, right[done:], false, Packed)
+			}
+			if !bytes.Equal(have, want) {
+				t.Errorf("%d channels, n=%d: have %x, want %x", channels, n, have, want)
+			}
+		}
+	}
+}
+
+func BenchmarkPack24(b *testing.B) {
+	left, right := make([]int32, 4096), make([]int32, 4096)
+	for i := range left {
+		left[i], right[i] = int32(i*3131), int32(i*7-900)
+	}
+	out := make([]byte, 6*4096)
+	b.Run("bytes", func(b *testing.B) {
+		b.SetBytes(int64(len(out)))
+		for b.Loop() {
+			pack24(out, 0, 6, left, false, Packed)
+			pack24(out, 3, 6, right, false, Packed)
+		}
+	})
+	b.Run("words", func(b *testing.B) {
+		b.SetBytes(int64(len(out)))
+		for b.Loop() {
+			pack24LE(out, left, right)
+		}
+	})
+}
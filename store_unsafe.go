@@ -0,0 +1,14 @@
+//go:build !purego && (amd64 || arm64)
+
+package alac
+
+import "unsafe"
+
+// store24x8 writes the words from words24 to out[off:off+24], as unaligned
+// word stores: these CPUs are little endian and fine with that. The one
+// bounds check covers all three.
+func store24x8(out []byte, off int, w0, w1, w2 uint64) {
+	_ = out[off+23]
+	p := (*[3]uint64)(unsafe.Add(unsafe.Pointer(unsafe.SliceData(out)), off))
+	p[0], p[1], p[2] = w0, w1, w2
+}
@@ -0,0 +1,89 @@
+package alac
+
+// StreamEncoder is an io.Writer which encodes the PCM written to it, in
+// pieces of any size, into frames of the FrameSize of its Encoder. It's
+// made for senders with small fixed frame sizes, such as the 352 samples
+// of AirPlay: every frame goes out as soon as its PCM is complete, in a
+// buffer which is reused for the next frame. Encoders WithMaxPacketSize or
+// WithAdaptiveFrames can make shorter frames, see FrameSamples.
+type StreamEncoder struct {
+	enc     *Encoder
+	fn      func(frame []byte) error
+	samples int    // of the frame passed to fn
+	pending []byte // PCM of less than a frame
+	err     error
+}
+
+// NewStreamEncoder returns a StreamEncoder which calls fn with every frame
+// enc encodes, on the goroutine of Write and Flush. The frame is only valid
+// until fn returns.
+func NewStreamEncoder(enc *Encoder, fn func(frame []byte) error) *StreamEncoder {
+	return &StreamEncoder{
+		enc:     enc,
+		fn:      fn,
+		pending: make([]byte, 0, enc.width*enc.cfg.NumChannels*enc.cfg.FrameSize),
+	}
+}
+
+// FrameSamples returns the number of samples per channel of the frame
+// passed to fn, for fn to call.
+func (s *StreamEncoder) FrameSamples() int {
+	return s.samples
+}
+
+// Write encodes the whole frames of the pending PCM and pcm, and keeps the
+// rest for later. The first error of the Encoder or of fn stops the
+// stream: it's returned by all later calls.
+func (s *StreamEncoder) Write(pcm []byte) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	size := cap(s.pending)
+	n := len(pcm)
+	if len(s.pending) > 0 {
+		m := min(len(pcm), size-len(s.pending))
+		s.pending = append(s.pending, pcm[:m]...)
+		pcm = pcm[m:]
+		if len(s.pending) < size {
+			return n, nil
+		}
+		if err := s.encode(s.pending); err != nil {
+			return 0, err
+		}
+		s.pending = s.pending[:0]
+	}
+	for len(pcm) >= size {
+		if err := s.encode(pcm[:size]); err != nil {
+			return n - len(pcm), err
+		}
+		pcm = pcm[size:]
+	}
+	s.pending = append(s.pending, pcm...)
+	return n, nil
+}
+
+// Flush encodes the pending PCM as a short frame, such as the last frame of
+// a stream. It does nothing without pending PCM, and fails with
+// ErrInvalidPCM when it isn't a whole number of samples for every channel.
+// Later writes start a new frame.
+func (s *StreamEncoder) Flush() error {
+	if s.err != nil {
+		return s.err
+	}
+	if len(s.pending) == 0 {
+		return nil
+	}
+	if err := s.encode(s.pending); err != nil {
+		return err
+	}
+	s.pending = s.pending[:0]
+	return nil
+}
+
+func (s *StreamEncoder) encode(pcm []byte) error {
+	s.err = s.enc.EncodeFrames(pcm, func(frame []byte, samples int) error {
+		s.samples = samples
+		return s.fn(frame)
+	})
+	return s.err
+}
@@ -0,0 +1,94 @@
+package alac
+
+import (
+	"bytes"
+	"errors"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func TestStreamEncoder(t *testing.T) {
+	cfg := DefaultConfig() // AirPlay's 352 samples
+	e, err := NewEncoder(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := NewWithConfig(cfg, WithStrict())
+	if err != nil {
+		t.Fatal(err)
+	}
+	signals := testSignals(10000, 16)
+	pcm := interleavePCM(16, signals["sine"], signals["noise"])
+
+	var (
+		frames [][]byte
+		s      = NewStreamEncoder(e, func(frame []byte) error {
+			frames = append(frames, slices.Clone(frame))
+			return nil
+		})
+		rng = rand.New(rand.NewPCG(5, 6))
+	)
+	for in := pcm; len(in) > 0; {
+		n := min(len(in), rng.IntN(3000))
+		if have, err := s.Write(in[:n]); err != nil || have != n {
+			t.Fatalf("have %d, %v, want %d", have, err, n)
+		}
+		in = in[n:]
+	}
+	if have, want := len(frames), 10000/352; have != want {
+		t.Errorf("have %d frames, want %d", have, want)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(frames), 10000/352+1; have != want {
+		t.Errorf("have %d frames, want %d", have, want)
+	}
+
+	var out []byte
+	for i, f := range frames {
+		info, err := d.InspectFrame(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := info.HasSize, i == len(frames)-1; have != want {
+			t.Errorf("frame %d: have %t, want %t", i, have, want)
+		}
+		pcm, err := d.DecodeFrame(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, pcm...)
+	}
+	if !bytes.Equal(out, pcm) {
+		t.Errorf("output differs")
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		errStop := errors.New("stop")
+		calls := 0
+		s := NewStreamEncoder(e, func([]byte) error {
+			calls++
+			return errStop
+		})
+		if have, err := s.Write(pcm[:3*352*4]); !errors.Is(err, errStop) || have != 0 {
+			t.Errorf("have %d, %v, want 0, %v", have, err, errStop)
+		}
+		if _, err := s.Write(pcm); !errors.Is(err, errStop) {
+			t.Errorf("have %v, want %v", err, errStop)
+		}
+		if have, want := calls, 1; have != want {
+			t.Errorf("have %d calls, want %d", have, want)
+		}
+
+		s = NewStreamEncoder(e, func([]byte) error { return nil })
+		s.Write(pcm[:3])
+		if err := s.Flush(); !errors.Is(err, ErrInvalidPCM) {
+			t.Errorf("have %v, want %v", err, ErrInvalidPCM)
+		}
+	})
+}
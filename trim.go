@@ -0,0 +1,44 @@
+package alac
+
+// Trimmer is a FrameReader with the gapless info of its container, such as
+// the edit list of an mp4.File: the PCM to play is the length samples per
+// channel after the first skip, or the rest after skip if length is
+// negative. NewPCMReader, and the DecodeReader methods of Alac and
+// ParallelDecoder, trim the PCM of a Trimmer.
+type Trimmer interface {
+	FrameReader
+	Trim() (skip, length int64)
+}
+
+// trim is what's left of the edit of a Trimmer, in samples per channel.
+type trim struct {
+	skip, length int64
+}
+
+// newTrim returns the trim of src, which plays everything unless it's a
+// Trimmer.
+func newTrim(src FrameReader) trim {
+	if t, ok := src.(Trimmer); ok {
+		skip, length := t.Trim()
+		return trim{max(skip, 0), length}
+	}
+	return trim{0, -1}
+}
+
+// done is whether nothing is left to play.
+func (t *trim) done() bool {
+	return t.length == 0
+}
+
+// apply returns what plays of the PCM of the next frame, with size bytes per
+// sample over all channels.
+func (t *trim) apply(pcm []byte, size int) []byte {
+	n := int64(len(pcm) / size)
+	skip := min(t.skip, n)
+	pcm, n, t.skip = pcm[skip*int64(size):], n-skip, t.skip-skip
+	if t.length >= 0 {
+		n = min(n, t.length)
+		pcm, t.length = pcm[:n*int64(size)], t.length-n
+	}
+	return pcm
+}
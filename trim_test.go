@@ -0,0 +1,88 @@
+package alac
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+)
+
+// trimmed is a Trimmer of frames in memory.
+type trimmed struct {
+	frameSlice
+	skip, length int64
+}
+
+func (t *trimmed) Trim() (int64, int64) {
+	return t.skip, t.length
+}
+
+func TestTrim(t *testing.T) {
+	var (
+		frames [][]byte
+		pcm    []byte
+	)
+	for in, out := range testFrames {
+		frames = append(frames, mustHex(in))
+		pcm = append(pcm, mustHex(out)...)
+	}
+	a, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		skip, length int64
+	}{
+		{0, -1},
+		{100, -1},
+		{400, 500},
+		{0, 10},
+		{352, 352},
+		{10000, -1},
+	} {
+		start := min(4*c.skip, int64(len(pcm)))
+		want := pcm[start:]
+		if c.length >= 0 {
+			want = want[:4*c.length]
+		}
+		src := func() *trimmed {
+			return &trimmed{frameSlice(frames), c.skip, c.length}
+		}
+
+		have, err := io.ReadAll(NewPCMReader(a, src()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(have, want) {
+			t.Errorf("%v: have %d bytes, want %d", c, len(have), len(want))
+		}
+
+		var w bytes.Buffer
+		if _, err := NewPCMReader(a, src()).WriteTo(&w); err != nil {
+			t.Fatal(err)
+		}
+		if have := w.Bytes(); !bytes.Equal(have, want) {
+			t.Errorf("%v: have %d bytes, want %d", c, len(have), len(want))
+		}
+
+		have, err = a.DecodeReader(context.Background(), src())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(have, want) {
+			t.Errorf("%v: have %d bytes, want %d", c, len(have), len(want))
+		}
+
+		have = nil
+		err = NewParallelDecoder(a, 2).DecodeReader(context.Background(), src(), func(b []byte) error {
+			have = append(have, b...)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(have, want) {
+			t.Errorf("%v: have %d bytes, want %d", c, len(have), len(want))
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package alac
+
+import "fmt"
+
+// verifyFrame decodes the frame of n samples, and compares it with the
+// samples it was encoded from.
+func (e *Encoder) verifyFrame(frame []byte, n int) error {
+	k := e.cfg.NumChannels
+	got, err := e.verifier.DecodeToInt32(frame, e.decoded)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrVerify, err)
+	}
+	if got != n*k {
+		return fmt.Errorf("%w: %d samples per channel, want %d", ErrVerify, got/k, n)
+	}
+	for i, s := range e.decoded[:got] {
+		ch, j := i%k, i/k
+		if want := e.samples[ch][j]; s != want {
+			return fmt.Errorf("%w: sample %d of channel %d is %d, want %d", ErrVerify, j, ch, s, want)
+		}
+	}
+	return nil
+}